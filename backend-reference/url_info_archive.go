@@ -0,0 +1,531 @@
+// Web archive snapshots
+// A curator's note loses its context when the page it points to disappears.
+// With FetcherConfig.Archive set, fetched pages are kept as WARC 1.1 files
+// (request and response records for the page, and the response for its cover
+// image) in an ObjectStore, at most once per MinInterval per URL. The
+// snapshot endpoint serves the archived page, its image or the WARC itself.
+//
+// Endpoint: GET /client/article/{uuid}/snapshot[?at=<time>][&part=image|warc]
+
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoSnapshot is returned when a URL has no capture at the requested time
+var ErrNoSnapshot = errors.New("no snapshot")
+
+// ErrArticleNotFound is returned by an ArticleSource for an unknown article
+var ErrArticleNotFound = errors.New("article not found")
+
+// Error codes for the snapshot endpoint
+const (
+	ErrCodeArticleNotFound  = "article_not_found"
+	ErrCodeSnapshotNotFound = "snapshot_not_found"
+)
+
+// defaultArchiveMinInterval keeps repeated fetches of a URL from piling up
+// captures
+const defaultArchiveMinInterval = 30 * 24 * time.Hour
+
+// warcContentType is stored with WARC files; they are gzipped per record
+const warcContentType = "application/warc"
+
+// snapshotCSP keeps archived pages from running scripts or submitting forms
+const snapshotCSP = "sandbox; default-src 'none'; img-src http: https: data:; style-src http: https: 'unsafe-inline'; font-src http: https:"
+
+// ArchiveConfig configures a WebArchive. Zero values use defaults.
+type ArchiveConfig struct {
+	// MinInterval is the least time between two captures of one URL
+	MinInterval time.Duration
+
+	// Now is the capture clock
+	Now func() time.Time
+}
+
+// Capture describes one archived copy of a URL
+type Capture struct {
+	URL         string    `json:"url"`
+	CapturedAt  time.Time `json:"capturedAt"`
+	Key         string    `json:"key"` // the WARC file in the ObjectStore
+	FinalURL    string    `json:"finalUrl"`
+	StatusCode  int       `json:"statusCode"`
+	ContentType string    `json:"contentType"`
+	ImageURL    string    `json:"imageUrl,omitempty"`
+}
+
+// WebArchive stores WARC snapshots of pages in an ObjectStore
+type WebArchive struct {
+	store  ObjectStore
+	config ArchiveConfig
+}
+
+// NewWebArchive creates an archive writing to store
+func NewWebArchive(store ObjectStore, config ArchiveConfig) *WebArchive {
+	if config.MinInterval <= 0 {
+		config.MinInterval = defaultArchiveMinInterval
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+	return &WebArchive{store: store, config: config}
+}
+
+// archivePrefix is the key prefix for the captures of rawURL. Equivalent
+// spellings of a URL share captures.
+func archivePrefix(rawURL string) string {
+	sum := sha256.Sum256([]byte(cacheKey(rawURL)))
+	hash := hex.EncodeToString(sum[:])
+	return "archive/" + hash[:2] + "/" + hash[:32]
+}
+
+// Captures lists the captures of rawURL, newest first
+func (a *WebArchive) Captures(ctx context.Context, rawURL string) ([]Capture, error) {
+	data, err := a.store.Get(ctx, archivePrefix(rawURL)+"/index.json")
+	if errors.Is(err, ErrObjectNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var captures []Capture
+	if err := json.Unmarshal(data, &captures); err != nil {
+		return nil, fmt.Errorf("corrupt archive index for %s: %w", rawURL, err)
+	}
+	return captures, nil
+}
+
+// Find returns the newest capture of rawURL taken at or before at; a zero at
+// means the newest capture
+func (a *WebArchive) Find(ctx context.Context, rawURL string, at time.Time) (*Capture, error) {
+	captures, err := a.Captures(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range captures {
+		if at.IsZero() || !c.CapturedAt.After(at) {
+			return &c, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNoSnapshot, rawURL)
+}
+
+// Snapshot returns the WARC file of a capture
+func (a *WebArchive) Snapshot(ctx context.Context, c *Capture) ([]byte, error) {
+	return a.store.Get(ctx, c.Key)
+}
+
+// capture archives page and its cover image, unless targetURL was captured
+// within MinInterval. Only JPEG, PNG, GIF and WebP covers are kept.
+// Concurrent loads of one URL are already coalesced by the metadata cache, so
+// the index is updated without locking.
+func (a *WebArchive) capture(ctx context.Context, targetURL string, page *Page, image *downloadedImage) error {
+	captures, err := a.Captures(ctx, targetURL)
+	if err != nil {
+		return err
+	}
+	now := a.config.Now().UTC().Truncate(time.Second)
+	if len(captures) > 0 && now.Sub(captures[0].CapturedAt) < a.config.MinInterval {
+		return nil
+	}
+
+	if image != nil {
+		if _, ok := inlineImageType(image.Data, image.ContentType); !ok {
+			image = nil
+		}
+	}
+	warc, err := buildWARC(page, image, now)
+	if err != nil {
+		return err
+	}
+	prefix := archivePrefix(targetURL)
+	c := Capture{
+		URL:         targetURL,
+		CapturedAt:  now,
+		Key:         prefix + "/" + now.Format("20060102150405") + ".warc.gz",
+		FinalURL:    page.URL.String(),
+		StatusCode:  page.StatusCode,
+		ContentType: page.ContentType,
+	}
+	if image != nil {
+		c.ImageURL = image.URL
+	}
+	if err := a.store.Put(ctx, c.Key, warc, warcContentType); err != nil {
+		return err
+	}
+
+	index, err := json.Marshal(append([]Capture{c}, captures...))
+	if err != nil {
+		return err
+	}
+	return a.store.Put(ctx, prefix+"/index.json", index, "application/json")
+}
+
+// inlineImageType returns the sniffed type of an image and whether it is a
+// raster format safe to serve inline from our origin. SVG can carry scripts.
+func inlineImageType(data []byte, contentType string) (string, bool) {
+	mimeType := imageMIMEType(data, contentType)
+	return mimeType, mirrorableTypes[mimeType]
+}
+
+// buildWARC writes a warcinfo record, the page's request and response, and
+// the image's response. Bodies are stored as the client decoded them, so
+// Content-Encoding is dropped and Content-Length matches the stored body.
+func buildWARC(page *Page, image *downloadedImage, now time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	date := now.Format(time.RFC3339)
+
+	software := defaultUserAgent
+	if page.response != nil && page.response.Request != nil {
+		software = page.response.Request.Header.Get("User-Agent")
+	}
+	info := "software: " + software + "\r\nformat: WARC File Format 1.1\r\n"
+	if err := writeWARCRecord(&buf, [][2]string{
+		{"WARC-Type", "warcinfo"},
+		{"WARC-Record-ID", newWARCRecordID()},
+		{"WARC-Date", date},
+		{"Content-Type", "application/warc-fields"},
+	}, []byte(info)); err != nil {
+		return nil, err
+	}
+
+	pageURL := page.URL.String()
+	responseID := newWARCRecordID()
+	response := httpResponseBlock(page.StatusCode, page.Header, page.raw)
+	fields := [][2]string{
+		{"WARC-Type", "response"},
+		{"WARC-Record-ID", responseID},
+		{"WARC-Date", date},
+		{"WARC-Target-URI", pageURL},
+		{"Content-Type", "application/http;msgtype=response"},
+		{"WARC-Payload-Digest", warcDigest(page.raw)},
+	}
+	if page.Truncated {
+		fields = append(fields, [2]string{"WARC-Truncated", "length"})
+	}
+	if err := writeWARCRecord(&buf, fields, response); err != nil {
+		return nil, err
+	}
+
+	if page.response != nil && page.response.Request != nil {
+		if err := writeWARCRecord(&buf, [][2]string{
+			{"WARC-Type", "request"},
+			{"WARC-Record-ID", newWARCRecordID()},
+			{"WARC-Date", date},
+			{"WARC-Target-URI", pageURL},
+			{"WARC-Concurrent-To", responseID},
+			{"Content-Type", "application/http;msgtype=request"},
+		}, httpRequestBlock(page.response.Request)); err != nil {
+			return nil, err
+		}
+	}
+
+	if image != nil {
+		if err := writeWARCRecord(&buf, [][2]string{
+			{"WARC-Type", "response"},
+			{"WARC-Record-ID", newWARCRecordID()},
+			{"WARC-Date", date},
+			{"WARC-Target-URI", image.URL},
+			{"Content-Type", "application/http;msgtype=response"},
+			{"WARC-Payload-Digest", warcDigest(image.Data)},
+		}, httpResponseBlock(http.StatusOK, image.Header, image.Data)); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// writeWARCRecord writes one record as its own gzip member
+func writeWARCRecord(w io.Writer, fields [][2]string, block []byte) error {
+	zw := gzip.NewWriter(w)
+	fmt.Fprint(zw, "WARC/1.1\r\n")
+	for _, f := range fields {
+		fmt.Fprintf(zw, "%s: %s\r\n", f[0], f[1])
+	}
+	fmt.Fprintf(zw, "WARC-Block-Digest: %s\r\nContent-Length: %d\r\n\r\n", warcDigest(block), len(block))
+	zw.Write(block)
+	zw.Write([]byte("\r\n\r\n"))
+	return zw.Close()
+}
+
+// httpResponseBlock serializes a response as it would appear on the wire
+func httpResponseBlock(statusCode int, header http.Header, body []byte) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "HTTP/1.1 %d %s\r\n", statusCode, http.StatusText(statusCode))
+	header = header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Del("Content-Encoding")
+	header.Del("Transfer-Encoding")
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	header.Write(&b)
+	b.WriteString("\r\n")
+	b.Write(body)
+	return b.Bytes()
+}
+
+// httpRequestBlock serializes the request headers that were sent
+func httpRequestBlock(req *http.Request) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s %s HTTP/1.1\r\nHost: %s\r\n", req.Method, req.URL.RequestURI(), req.URL.Host)
+	req.Header.Write(&b)
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
+// warcDigest is the SHA-1 digest in the base 32 form WARC tools expect
+func warcDigest(data []byte) string {
+	sum := sha1.Sum(data)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+// newWARCRecordID returns a random UUID URN
+func newWARCRecordID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// warcRecord is a parsed WARC record
+type warcRecord struct {
+	Header textproto.MIMEHeader
+	Block  []byte
+}
+
+// readWARC parses a (possibly multi-member) gzipped WARC file
+func readWARC(data []byte) ([]warcRecord, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid WARC file: %w", err)
+	}
+	br := bufio.NewReader(zr)
+	tp := textproto.NewReader(br)
+
+	var records []warcRecord
+	for {
+		line, err := tp.ReadLine()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid WARC file: %w", err)
+		}
+		// Blank lines end each record
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "WARC/") {
+			return nil, fmt.Errorf("invalid WARC file: unexpected %q", line)
+		}
+
+		header, err := tp.ReadMIMEHeader()
+		if err != nil {
+			return nil, fmt.Errorf("invalid WARC record header: %w", err)
+		}
+		length, err := strconv.Atoi(header.Get("Content-Length"))
+		if err != nil || length < 0 {
+			return nil, fmt.Errorf("invalid WARC record length %q", header.Get("Content-Length"))
+		}
+		block := make([]byte, length)
+		if _, err := io.ReadFull(br, block); err != nil {
+			return nil, fmt.Errorf("truncated WARC record: %w", err)
+		}
+		records = append(records, warcRecord{Header: header, Block: block})
+	}
+}
+
+// archivedResponse finds the response record for targetURI and parses it
+func archivedResponse(records []warcRecord, targetURI string) (*http.Response, []byte, error) {
+	for _, r := range records {
+		if r.Header.Get("WARC-Type") != "response" || r.Header.Get("WARC-Target-URI") != targetURI {
+			continue
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(r.Block)), nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid archived response: %w", err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid archived response: %w", err)
+		}
+		return resp, body, nil
+	}
+	return nil, nil, fmt.Errorf("%w: no record for %s", ErrNoSnapshot, targetURI)
+}
+
+// ArticleSource looks up an article's target URL by UUID; the article service
+// implements it. An unknown UUID returns ErrArticleNotFound.
+type ArticleSource interface {
+	ArticleTargetURL(ctx context.Context, uuid string) (string, error)
+}
+
+// NewSnapshotHandler returns a /client/article/{uuid}/snapshot handler
+func NewSnapshotHandler(archive *WebArchive, articles ArticleSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		serveSnapshot(archive, articles, w, r)
+	}
+}
+
+func serveSnapshot(archive *WebArchive, articles ArticleSource, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendSnapshotError(w, http.StatusMethodNotAllowed, "", "Method not allowed")
+		return
+	}
+
+	// Routers other than http.ServeMux leave PathValue empty
+	uuid := r.PathValue("uuid")
+	if uuid == "" {
+		uuid = path.Base(path.Dir(r.URL.Path))
+	}
+
+	query := r.URL.Query()
+	at, err := parseSnapshotTime(query.Get("at"))
+	if err != nil {
+		sendSnapshotError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	part := query.Get("part")
+	if part != "" && part != "image" && part != "warc" {
+		sendSnapshotError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "part must be image or warc")
+		return
+	}
+
+	targetURL, err := articles.ArticleTargetURL(r.Context(), uuid)
+	if errors.Is(err, ErrArticleNotFound) {
+		sendSnapshotError(w, http.StatusNotFound, ErrCodeArticleNotFound, "article not found")
+		return
+	}
+	if err != nil {
+		sendSnapshotError(w, http.StatusInternalServerError, "", fmt.Sprintf("Failed to load article: %v", err))
+		return
+	}
+
+	capture, err := archive.Find(r.Context(), targetURL, at)
+	if errors.Is(err, ErrNoSnapshot) {
+		sendSnapshotError(w, http.StatusNotFound, ErrCodeSnapshotNotFound, "no snapshot of this page")
+		return
+	}
+	var warc []byte
+	if err == nil {
+		warc, err = archive.Snapshot(r.Context(), capture)
+	}
+	if err != nil {
+		sendSnapshotError(w, http.StatusInternalServerError, "", fmt.Sprintf("Failed to load snapshot: %v", err))
+		return
+	}
+
+	// Memento (RFC 7089) headers tell clients what and when this copy is.
+	// Every part is third-party content served from our origin, so none may
+	// run scripts.
+	w.Header().Set("Memento-Datetime", capture.CapturedAt.Format(http.TimeFormat))
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="original"`, capture.URL))
+	w.Header().Set("X-Robots-Tag", "noindex")
+	w.Header().Set("Content-Security-Policy", snapshotCSP)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if part == "warc" {
+		w.Header().Set("Content-Type", warcContentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="snapshot.warc.gz"`)
+		w.Write(warc)
+		return
+	}
+
+	targetURI := capture.FinalURL
+	if part == "image" {
+		targetURI = capture.ImageURL
+	}
+	records, err := readWARC(warc)
+	var resp *http.Response
+	var body []byte
+	if err == nil {
+		resp, body, err = archivedResponse(records, targetURI)
+	}
+	if errors.Is(err, ErrNoSnapshot) {
+		sendSnapshotError(w, http.StatusNotFound, ErrCodeSnapshotNotFound, "no archived image for this page")
+		return
+	}
+	if err != nil {
+		sendSnapshotError(w, http.StatusInternalServerError, "", fmt.Sprintf("Failed to read snapshot: %v", err))
+		return
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	switch part {
+	case "":
+		body = withBaseURL(body, capture.FinalURL)
+	case "image":
+		// Snapshots from before covers were filtered may hold an SVG
+		if mimeType, ok := inlineImageType(body, contentType); ok {
+			contentType = mimeType
+		} else {
+			contentType = "application/octet-stream"
+			w.Header().Set("Content-Disposition", `attachment; filename="cover"`)
+		}
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
+}
+
+// withBaseURL inserts a <base> element after <head> so relative links and
+// images resolve against the original page
+func withBaseURL(body []byte, baseURL string) []byte {
+	lower := bytes.ToLower(body)
+	start := bytes.Index(lower, []byte("<head"))
+	if start < 0 {
+		return body
+	}
+	end := bytes.IndexByte(body[start:], '>')
+	if end < 0 {
+		return body
+	}
+	end += start + 1
+
+	base := `<base href="` + strings.ReplaceAll(baseURL, `"`, "%22") + `">`
+	out := make([]byte, 0, len(body)+len(base))
+	out = append(out, body[:end]...)
+	out = append(out, base...)
+	return append(out, body[end:]...)
+}
+
+// parseSnapshotTime accepts RFC 3339 or Wayback-style timestamps
+// (YYYYMMDD[hhmmss]); empty means the newest capture
+func parseSnapshotTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{time.RFC3339, "20060102150405", "20060102"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid snapshot time %q", s)
+}
+
+// sendSnapshotError sends an error response
+func sendSnapshotError(w http.ResponseWriter, statusCode int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	sendURLInfoError(w, statusCode, code, message)
+}
@@ -0,0 +1,266 @@
+// Package handler tests for web archive snapshots
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// archivedSite serves a Latin-1 page with a cover image, or 404s once gone
+type archivedSite struct {
+	mu        sync.Mutex
+	gone      bool
+	cover     []byte
+	coverType string
+}
+
+const archivedPage = "<html><head><title>Caf\xe9</title><meta property=\"og:image\" content=\"/cover.png\"></head><body><a href=\"/next\">Next</a></body></html>"
+
+func (s *archivedSite) RoundTrip(req *http.Request) (*http.Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.gone:
+	case req.URL.Path == "/post":
+		return cannedResponse(req, http.StatusOK, "text/html; charset=iso-8859-1", archivedPage), nil
+	case req.URL.Path == "/cover.png":
+		return cannedResponse(req, http.StatusOK, s.coverType, string(s.cover)), nil
+	}
+	return cannedResponse(req, http.StatusNotFound, "text/plain", ""), nil
+}
+
+func newArchiveFixture(t *testing.T) (*archivedSite, *Fetcher, *WebArchive, *testClock) {
+	site := &archivedSite{cover: testImage(t, 120, 80, encodePNG), coverType: "image/png"}
+	clock := &testClock{now: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)}
+	archive := NewWebArchive(NewLocalStore(t.TempDir(), "https://archive.example.com"), ArchiveConfig{Now: clock.Now})
+	fetcher := NewFetcher(FetcherConfig{Transport: site, Archive: archive})
+	return site, fetcher, archive, clock
+}
+
+func TestFetcher_ArchivesPage(t *testing.T) {
+	_, fetcher, archive, clock := newArchiveFixture(t)
+	ctx := context.Background()
+
+	if _, err := fetcher.Fetch(ctx, "https://example.com/post"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	captures, err := archive.Captures(ctx, "https://example.com/post")
+	if err != nil || len(captures) != 1 {
+		t.Fatalf("Expected one capture, got %+v %v", captures, err)
+	}
+	c := captures[0]
+	if c.ImageURL != "https://example.com/cover.png" || c.StatusCode != 200 || !c.CapturedAt.Equal(clock.Now()) {
+		t.Errorf("Unexpected capture %+v", c)
+	}
+
+	warc, err := archive.Snapshot(ctx, &c)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	records, err := readWARC(warc)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var types []string
+	for _, r := range records {
+		types = append(types, r.Header.Get("WARC-Type"))
+		if digest := r.Header.Get("WARC-Block-Digest"); digest != warcDigest(r.Block) {
+			t.Errorf("Block digest mismatch for %s record", r.Header.Get("WARC-Type"))
+		}
+	}
+	if got := strings.Join(types, " "); got != "warcinfo response request response" {
+		t.Errorf("Unexpected records %s", got)
+	}
+
+	// The page is kept in its original encoding, not the UTF-8 the extractors saw
+	resp, body, err := archivedResponse(records, "https://example.com/post")
+	if err != nil || string(body) != archivedPage || resp.Header.Get("Content-Type") != "text/html; charset=iso-8859-1" {
+		t.Errorf("Unexpected archived page %q %v", body, err)
+	}
+	if _, image, err := archivedResponse(records, c.ImageURL); err != nil || !bytes.HasPrefix(image, []byte("\x89PNG")) {
+		t.Errorf("Expected the archived cover, got %v", err)
+	}
+
+	// Refetching within MinInterval keeps the capture; later ones add another
+	fetcher.Cache().Invalidate("https://example.com/post")
+	fetcher.Fetch(ctx, "https://example.com/post")
+	clock.Advance(defaultArchiveMinInterval)
+	fetcher.Cache().Invalidate("https://example.com/post")
+	fetcher.Fetch(ctx, "https://example.com/post")
+	if captures, _ := archive.Captures(ctx, "https://example.com/post"); len(captures) != 2 || !captures[0].CapturedAt.Equal(clock.Now()) {
+		t.Errorf("Expected a second capture, newest first, got %+v", captures)
+	}
+}
+
+// testArticles is an ArticleSource over a map
+type testArticles map[string]string
+
+func (a testArticles) ArticleTargetURL(_ context.Context, uuid string) (string, error) {
+	targetURL, ok := a[uuid]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrArticleNotFound, uuid)
+	}
+	return targetURL, nil
+}
+
+func TestSnapshotHandler(t *testing.T) {
+	_, fetcher, archive, _ := newArchiveFixture(t)
+	if _, err := fetcher.Fetch(context.Background(), "https://example.com/post"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/client/article/{uuid}/snapshot", NewSnapshotHandler(archive, testArticles{
+		"a1": "https://example.com/post",
+		"a2": "https://example.com/never-fetched",
+	}))
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		return rec
+	}
+
+	rec := get("/client/article/a1/snapshot")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/html; charset=iso-8859-1" {
+		t.Fatalf("Unexpected response %d %v", rec.Code, rec.Header())
+	}
+	if !strings.Contains(rec.Body.String(), `<head><base href="https://example.com/post"><title>Caf`+"\xe9") {
+		t.Errorf("Expected a base URL in the archived page, got %q", rec.Body)
+	}
+	if !strings.HasPrefix(rec.Header().Get("Content-Security-Policy"), "sandbox") ||
+		rec.Header().Get("Memento-Datetime") != "Sun, 01 Mar 2026 12:00:00 GMT" ||
+		rec.Header().Get("Link") != `<https://example.com/post>; rel="original"` {
+		t.Errorf("Unexpected headers %v", rec.Header())
+	}
+
+	if rec := get("/client/article/a1/snapshot?part=image"); rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("Expected the archived image, got %d %v", rec.Code, rec.Header())
+	}
+	if rec := get("/client/article/a1/snapshot?part=warc"); rec.Code != http.StatusOK || !bytes.HasPrefix(rec.Body.Bytes(), []byte{0x1f, 0x8b}) ||
+		rec.Header().Get("Content-Security-Policy") != snapshotCSP {
+		t.Errorf("Expected the gzipped WARC, got %d %v", rec.Code, rec.Header())
+	}
+
+	testCases := []struct {
+		target string
+		status int
+		code   string
+	}{
+		{"/client/article/a1/snapshot?at=20260301115959", http.StatusNotFound, ErrCodeSnapshotNotFound},
+		{"/client/article/a1/snapshot?at=yesterday", http.StatusBadRequest, ErrCodeInvalidRequest},
+		{"/client/article/a2/snapshot", http.StatusNotFound, ErrCodeSnapshotNotFound},
+		{"/client/article/zz/snapshot", http.StatusNotFound, ErrCodeArticleNotFound},
+	}
+	for _, tc := range testCases {
+		rec := get(tc.target)
+		var resp URLInfoResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		if rec.Code != tc.status || resp.Code != tc.code {
+			t.Errorf("%s: expected %d %s, got %d %s", tc.target, tc.status, tc.code, rec.Code, rec.Body)
+		}
+	}
+}
+
+const scriptedSVG = `<svg xmlns="http://www.w3.org/2000/svg" width="1200" height="630"><script>alert(document.cookie)</script></svg>`
+
+func TestSnapshotHandler_ScriptedSVGCover(t *testing.T) {
+	site, fetcher, archive, clock := newArchiveFixture(t)
+	site.cover, site.coverType = []byte(scriptedSVG), "image/svg+xml"
+	ctx := context.Background()
+	if _, err := fetcher.Fetch(ctx, "https://example.com/post"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/client/article/{uuid}/snapshot", NewSnapshotHandler(archive, testArticles{"a1": "https://example.com/post"}))
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		return rec
+	}
+
+	// The SVG is not archived
+	if captures, _ := archive.Captures(ctx, "https://example.com/post"); len(captures) != 1 || captures[0].ImageURL != "" {
+		t.Fatalf("Expected a capture without the cover, got %+v", captures)
+	}
+	if rec := get("/client/article/a1/snapshot?part=image"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected no archived image, got %d %v", rec.Code, rec.Header())
+	}
+
+	// An older snapshot that kept one is sandboxed and downloaded, not rendered
+	page := testPage(t, "https://example.com/post", archivedPage)
+	clock.Advance(defaultArchiveMinInterval)
+	warc, err := buildWARC(page, &downloadedImage{
+		URL:    "https://example.com/cover.png",
+		Data:   []byte(scriptedSVG),
+		Header: http.Header{"Content-Type": {"image/svg+xml"}},
+	}, clock.Now())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	c := Capture{URL: "https://example.com/post", CapturedAt: clock.Now(), Key: "legacy.warc.gz", FinalURL: "https://example.com/post", ImageURL: "https://example.com/cover.png"}
+	index, _ := json.Marshal([]Capture{c})
+	archive.store.Put(ctx, c.Key, warc, warcContentType)
+	archive.store.Put(ctx, archivePrefix(c.URL)+"/index.json", index, "application/json")
+
+	rec := get("/client/article/a1/snapshot?part=image")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/octet-stream" ||
+		!strings.HasPrefix(rec.Header().Get("Content-Disposition"), "attachment") ||
+		!strings.HasPrefix(rec.Header().Get("Content-Security-Policy"), "sandbox") ||
+		rec.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("Expected a sandboxed attachment, got %d %v", rec.Code, rec.Header())
+	}
+}
+
+func TestLinkMonitor_FallsBackToSnapshot(t *testing.T) {
+	site, fetcher, archive, clock := newArchiveFixture(t)
+	monitor := NewLinkMonitor(fetcher, LinkMonitorConfig{Archive: archive, Now: clock.Now})
+	ctx := context.Background()
+
+	if h, err := monitor.Check(ctx, "https://example.com/post"); err != nil || !h.SnapshotAt.IsZero() {
+		t.Fatalf("Expected a healthy link without a snapshot, got %+v %v", h, err)
+	}
+	captured := clock.Now()
+
+	clock.Advance(24 * time.Hour)
+	site.mu.Lock()
+	site.gone = true
+	site.mu.Unlock()
+	h, err := monitor.Check(ctx, "https://example.com/post")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if h.Status != LinkStatusNotFound || !h.SnapshotAt.Equal(captured) {
+		t.Errorf("Expected the earlier capture, got %+v", h)
+	}
+
+	report, err := spaceHealthReport(ctx, monitor, "reading", []SpaceArticle{
+		{ID: 1, UUID: "a1", Title: "Post", TargetURL: "https://example.com/post"},
+	}, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := report.Links[0].SnapshotURL; got != "/client/article/a1/snapshot?at=20260301120000" {
+		t.Errorf("Unexpected snapshot URL %s", got)
+	}
+}
+
+func TestReadWARC_RejectsGarbage(t *testing.T) {
+	if _, err := readWARC([]byte("not gzip")); err == nil {
+		t.Error("Expected an error for a non-gzip file")
+	}
+	var buf bytes.Buffer
+	writeWARCRecord(&buf, [][2]string{{"WARC-Type", "resource"}}, []byte("data"))
+	records, err := readWARC(buf.Bytes())
+	if err != nil || len(records) != 1 || string(records[0].Block) != "data" {
+		t.Errorf("Unexpected records %+v %v", records, err)
+	}
+}
@@ -0,0 +1,249 @@
+// Batch URL metadata endpoint
+// Fetches metadata for many URLs in one request, for bookmark imports and
+// cover backfills. Concurrency is bounded overall and per host so a batch of
+// links to one site does not hammer it.
+//
+// Endpoint: POST /client/common/urlInfo/batch[?detail=full][&stream=ndjson]
+// Body:     {"urls": ["https://...", ...]}
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Batch limits
+const (
+	maxBatchURLs      = 50
+	maxBatchBodyBytes = 256 * 1024
+	batchWorkers      = 8
+	batchPerHost      = 2
+)
+
+// Additional error codes for the batch endpoint
+const (
+	ErrCodeInvalidRequest = "invalid_request"
+	ErrCodeFetchFailed    = "fetch_failed"
+)
+
+// ndjsonContentType is the streaming response type, one result per line
+const ndjsonContentType = "application/x-ndjson"
+
+// BatchURLInfoRequest is the batch request body
+type BatchURLInfoRequest struct {
+	URLs []string `json:"urls"`
+}
+
+// BatchURLResult is the outcome for one URL of a batch. Status is 1 on
+// success and 0 on failure, with Code and Msg describing the error; failed
+// fetches also carry fetchStatus and diagnostics in Data.
+type BatchURLResult struct {
+	Index  int          `json:"index"`
+	URL    string       `json:"url"`
+	Status int          `json:"status"`
+	Msg    string       `json:"msg,omitempty"`
+	Code   string       `json:"code,omitempty"`
+	Data   *URLMetadata `json:"data,omitempty"`
+}
+
+// BatchURLInfoResponse is the buffered batch response; results are in input order
+type BatchURLInfoResponse struct {
+	Status int              `json:"status"`
+	Msg    string           `json:"msg"`
+	Code   string           `json:"code,omitempty"`
+	Data   []BatchURLResult `json:"data,omitempty"`
+}
+
+// BatchURLInfoHandler handles the /client/common/urlInfo/batch endpoint with
+// DefaultFetcher
+func BatchURLInfoHandler(w http.ResponseWriter, r *http.Request) {
+	NewBatchURLInfoHandler(DefaultFetcher)(w, r)
+}
+
+// NewBatchURLInfoHandler returns a batch handler backed by fetcher
+func NewBatchURLInfoHandler(fetcher *Fetcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		serveBatchURLInfo(fetcher, w, r)
+	}
+}
+
+func serveBatchURLInfo(fetcher *Fetcher, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		sendBatchError(w, http.StatusMethodNotAllowed, "", "Method not allowed")
+		return
+	}
+
+	var req BatchURLInfoRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchBodyBytes)).Decode(&req); err != nil {
+		sendBatchError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("Invalid request body: %v", err))
+		return
+	}
+	if len(req.URLs) == 0 {
+		sendBatchError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "urls is required")
+		return
+	}
+	if len(req.URLs) > maxBatchURLs {
+		sendBatchError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("at most %d urls per batch", maxBatchURLs))
+		return
+	}
+
+	detail := r.URL.Query().Get("detail")
+	results := runBatch(r.Context(), fetcher, req.URLs, detail)
+
+	if wantsNDJSON(r) {
+		streamBatchResults(w, results)
+		return
+	}
+
+	ordered := make([]BatchURLResult, len(req.URLs))
+	for result := range results {
+		ordered[result.Index] = result
+	}
+	json.NewEncoder(w).Encode(BatchURLInfoResponse{
+		Status: 1,
+		Msg:    "success",
+		Data:   ordered,
+	})
+}
+
+// wantsNDJSON reports whether the client asked for a streamed response
+func wantsNDJSON(r *http.Request) bool {
+	return r.URL.Query().Get("stream") == "ndjson" || strings.Contains(r.Header.Get("Accept"), ndjsonContentType)
+}
+
+// streamBatchResults writes each result as a JSON line as soon as it is ready.
+// Lines arrive in completion order; index gives the input position.
+func streamBatchResults(w http.ResponseWriter, results <-chan BatchURLResult) {
+	w.Header().Set("Content-Type", ndjsonContentType)
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	for result := range results {
+		enc.Encode(result)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// runBatch fetches every URL concurrently, at most batchWorkers at a time and
+// batchPerHost per host, and sends each result as it completes. The channel
+// is closed once all URLs are done.
+func runBatch(ctx context.Context, fetcher *Fetcher, urls []string, detail string) <-chan BatchURLResult {
+	results := make(chan BatchURLResult, len(urls))
+	workers := make(chan struct{}, batchWorkers)
+	hosts := newHostLimiter(batchPerHost)
+
+	var wg sync.WaitGroup
+	for i, rawURL := range urls {
+		wg.Add(1)
+		go func(i int, rawURL string) {
+			defer wg.Done()
+
+			normalizedURL, err := fetcher.Validate(rawURL)
+			if err != nil {
+				results <- batchError(i, rawURL, urlErrorCode(err), fmt.Sprintf("Invalid URL: %v", err))
+				return
+			}
+
+			// Host slot first, then a worker, so workers never sit idle
+			// waiting on a busy host
+			release := hosts.acquire(batchHostKey(normalizedURL))
+			defer release()
+			workers <- struct{}{}
+			defer func() { <-workers }()
+
+			// The client went away; don't start new fetches for it
+			if err := ctx.Err(); err != nil {
+				results <- batchError(i, rawURL, ErrCodeFetchFailed, err.Error())
+				return
+			}
+
+			results <- fetchBatchURL(ctx, fetcher, i, rawURL, normalizedURL, detail)
+		}(i, rawURL)
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+// fetchBatchURL fetches one URL through the fetcher's cache
+func fetchBatchURL(ctx context.Context, fetcher *Fetcher, i int, rawURL, normalizedURL, detail string) BatchURLResult {
+	metadata, err := fetcher.fetchDetail(ctx, normalizedURL, detail)
+	if _, code, message, refused := refusedFetch(err); refused {
+		return batchError(i, rawURL, code, message)
+	}
+	if err != nil {
+		logFetchFailure("batchUrlInfo", normalizedURL, err)
+		result := batchError(i, rawURL, ErrCodeFetchFailed, err.Error())
+		result.Data = failureMetadata(err)
+		return result
+	}
+
+	return BatchURLResult{
+		Index:  i,
+		URL:    rawURL,
+		Status: 1,
+		Data:   withDetail(metadata, detail),
+	}
+}
+
+func batchError(i int, rawURL, code, message string) BatchURLResult {
+	return BatchURLResult{Index: i, URL: rawURL, Status: 0, Code: code, Msg: message}
+}
+
+// batchHostKey groups URLs by hostname for the per-host limit
+func batchHostKey(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// hostLimiter bounds concurrent work per host
+type hostLimiter struct {
+	mu    sync.Mutex
+	limit int
+	slots map[string]chan struct{}
+}
+
+func newHostLimiter(limit int) *hostLimiter {
+	return &hostLimiter{limit: limit, slots: make(map[string]chan struct{})}
+}
+
+// acquire blocks until host has a free slot and returns its release func
+func (h *hostLimiter) acquire(host string) func() {
+	h.mu.Lock()
+	slot, ok := h.slots[host]
+	if !ok {
+		slot = make(chan struct{}, h.limit)
+		h.slots[host] = slot
+	}
+	h.mu.Unlock()
+
+	slot <- struct{}{}
+	return func() { <-slot }
+}
+
+// sendBatchError sends an error response for the whole batch
+func sendBatchError(w http.ResponseWriter, statusCode int, code, message string) {
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(BatchURLInfoResponse{
+		Status: 0,
+		Msg:    message,
+		Code:   code,
+	})
+}
@@ -0,0 +1,178 @@
+// Package handler tests for the batch URL metadata endpoint
+package handler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newBatchTestServer serves a titled page per path and 404 under /missing
+func newBatchTestServer(t *testing.T, handle func()) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if handle != nil {
+			handle()
+		}
+		if strings.HasPrefix(r.URL.Path, "/missing") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<html><head><meta property="og:title" content="Page %s"></head><body></body></html>`, r.URL.Path)
+	}))
+	t.Cleanup(server.Close)
+	allowLoopbackForTest(t)
+	return server
+}
+
+func postBatch(t *testing.T, query string, urls []string) *httptest.ResponseRecorder {
+	t.Helper()
+	body, _ := json.Marshal(BatchURLInfoRequest{URLs: urls})
+	req := httptest.NewRequest("POST", "/client/common/urlInfo/batch"+query, strings.NewReader(string(body)))
+	w := httptest.NewRecorder()
+	BatchURLInfoHandler(w, req)
+	return w
+}
+
+func TestBatchURLInfoHandler_ResultsInInputOrder(t *testing.T) {
+	server := newBatchTestServer(t, nil)
+
+	urls := []string{
+		server.URL + "/a",
+		"http://10.0.0.1/admin",
+		server.URL + "/missing",
+		"http://",
+		server.URL + "/b",
+	}
+	w := postBatch(t, "", urls)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+
+	var response BatchURLInfoResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Data) != len(urls) {
+		t.Fatalf("Expected %d results, got %d", len(urls), len(response.Data))
+	}
+
+	want := []struct {
+		status int
+		code   string
+		title  string
+	}{
+		{1, "", "Page /a"},
+		{0, ErrCodeBlockedAddress, ""},
+		{0, ErrCodeFetchFailed, ""},
+		{0, ErrCodeInvalidURL, ""},
+		{1, "", "Page /b"},
+	}
+	for i, tt := range want {
+		got := response.Data[i]
+		if got.Index != i || got.URL != urls[i] {
+			t.Errorf("Result %d: wrong position: index %d, url %s", i, got.Index, got.URL)
+		}
+		if got.Status != tt.status || got.Code != tt.code {
+			t.Errorf("Result %d: expected status %d code %q, got %d %q", i, tt.status, tt.code, got.Status, got.Code)
+		}
+		if tt.title != "" && (got.Data == nil || got.Data.Title != tt.title) {
+			t.Errorf("Result %d: expected title %q, got %+v", i, tt.title, got.Data)
+		}
+	}
+}
+
+func TestBatchURLInfoHandler_PerHostLimit(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, peak := 0, 0
+	server := newBatchTestServer(t, func() {
+		mu.Lock()
+		inFlight++
+		if inFlight > peak {
+			peak = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(30 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	})
+
+	var urls []string
+	for i := 0; i < 6; i++ {
+		urls = append(urls, fmt.Sprintf("%s/limit/%d", server.URL, i))
+	}
+	postBatch(t, "", urls)
+
+	if peak > batchPerHost {
+		t.Errorf("Expected at most %d concurrent requests to one host, saw %d", batchPerHost, peak)
+	}
+}
+
+func TestBatchURLInfoHandler_NDJSON(t *testing.T) {
+	server := newBatchTestServer(t, nil)
+
+	urls := []string{server.URL + "/x", "http://localhost/", server.URL + "/y"}
+	w := postBatch(t, "?stream=ndjson", urls)
+	if ct := w.Header().Get("Content-Type"); ct != ndjsonContentType {
+		t.Errorf("Expected %s, got %s", ndjsonContentType, ct)
+	}
+
+	seen := make(map[int]BatchURLResult)
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var result BatchURLResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			t.Fatalf("Bad NDJSON line %q: %v", scanner.Text(), err)
+		}
+		seen[result.Index] = result
+	}
+
+	if len(seen) != len(urls) {
+		t.Fatalf("Expected %d lines, got %d", len(urls), len(seen))
+	}
+	if seen[1].Code != ErrCodeBlockedAddress {
+		t.Errorf("Expected localhost to be blocked, got %+v", seen[1])
+	}
+	if seen[2].Data == nil || seen[2].Data.Title != "Page /y" {
+		t.Errorf("Unexpected result for /y: %+v", seen[2])
+	}
+}
+
+func TestBatchURLInfoHandler_InvalidRequests(t *testing.T) {
+	tooMany := make([]string, maxBatchURLs+1)
+	for i := range tooMany {
+		tooMany[i] = "https://example.com/"
+	}
+	tooManyBody, _ := json.Marshal(BatchURLInfoRequest{URLs: tooMany})
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		status int
+	}{
+		{"wrong method", "GET", "", http.StatusMethodNotAllowed},
+		{"malformed body", "POST", "{", http.StatusBadRequest},
+		{"no urls", "POST", `{"urls": []}`, http.StatusBadRequest},
+		{"too many urls", "POST", string(tooManyBody), http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/client/common/urlInfo/batch", strings.NewReader(tt.body))
+		w := httptest.NewRecorder()
+		BatchURLInfoHandler(w, req)
+		if w.Code != tt.status {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.status, w.Code)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+// Metadata cache for the urlInfo endpoints
+// Results are cached per normalized URL with a TTL. Failures are cached briefly
+// so a dead site is not refetched on every paste, concurrent lookups of the
+// same URL share one fetch, and expired entries with an ETag or Last-Modified
+// are revalidated with a conditional request instead of refetched.
+
+package handler
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default cache settings
+const (
+	defaultCacheCapacity = 1024
+	defaultCacheTTL      = time.Hour
+	defaultNegativeTTL   = 2 * time.Minute
+	defaultStaleTTL      = 24 * time.Hour
+)
+
+// CacheEntry is a cached metadata lookup
+type CacheEntry struct {
+	Metadata   *URLMetadata
+	Err        error // set for negative entries
+	Analyzed   bool  // Metadata includes the main-content analysis
+	Validators pageValidators
+	ExpiresAt  time.Time // fresh until this time
+	DiscardAt  time.Time // kept for revalidation until this time
+}
+
+// CacheBackend stores cache entries by key. Implementations must be safe for
+// concurrent use; the in-memory LRU is the default, a shared store such as
+// Redis can be plugged in for multi-instance deployments.
+type CacheBackend interface {
+	Get(key string) (*CacheEntry, bool)
+	Set(key string, entry *CacheEntry)
+	Delete(key string)
+}
+
+// LRUCache is an in-memory CacheBackend evicting the least recently used entry
+type LRUCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List // front is most recently used
+	items    map[string]*list.Element
+}
+
+type lruItem struct {
+	key   string
+	entry *CacheEntry
+}
+
+// NewLRUCache creates an LRU cache holding at most capacity entries
+func NewLRUCache(capacity int) *LRUCache {
+	if capacity <= 0 {
+		capacity = defaultCacheCapacity
+	}
+	return &LRUCache{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// Get returns the entry for key and marks it as recently used
+func (c *LRUCache) Get(key string) (*CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*lruItem).entry, true
+}
+
+// Set stores the entry for key, evicting the oldest entry when full
+func (c *LRUCache) Set(key string, entry *CacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		el.Value.(*lruItem).entry = entry
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&lruItem{key: key, entry: entry})
+
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruItem).key)
+	}
+}
+
+// Delete removes the entry for key
+func (c *LRUCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.order.Remove(el)
+		delete(c.items, key)
+	}
+}
+
+// Len returns the number of cached entries
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// MetadataCacheConfig configures a MetadataCache. Zero values use defaults.
+type MetadataCacheConfig struct {
+	TTL         time.Duration // how long a successful result is fresh
+	NegativeTTL time.Duration // how long a failure is remembered
+	StaleTTL    time.Duration // how long an expired result is kept for revalidation
+}
+
+// MetadataCache sits in front of a Fetcher's page loads
+type MetadataCache struct {
+	backend CacheBackend
+	config  MetadataCacheConfig
+	group   callGroup
+
+	// Set by NewFetcher; replaceable in tests. analyze asks for the
+	// main-content analysis.
+	load func(ctx context.Context, targetURL string, validators *pageValidators, analyze bool) (*CacheEntry, error)
+	now  func() time.Time
+}
+
+// newMetadataCache creates a cache over backend; NewFetcher sets its loader
+func newMetadataCache(backend CacheBackend, config MetadataCacheConfig) *MetadataCache {
+	if config.TTL <= 0 {
+		config.TTL = defaultCacheTTL
+	}
+	if config.NegativeTTL <= 0 {
+		config.NegativeTTL = defaultNegativeTTL
+	}
+	if config.StaleTTL <= 0 {
+		config.StaleTTL = defaultStaleTTL
+	}
+
+	return &MetadataCache{
+		backend: backend,
+		config:  config,
+		now:     time.Now,
+	}
+}
+
+// Fetch returns metadata for targetURL, from cache when fresh. A miss is
+// fetched once for all concurrent callers and canceled only when every
+// caller's ctx is done.
+func (c *MetadataCache) Fetch(ctx context.Context, targetURL string) (*URLMetadata, error) {
+	return c.fetch(ctx, targetURL, false)
+}
+
+// fetch is Fetch, optionally with the main-content analysis. An analyzed
+// entry serves both kinds of lookup; one without it is refetched for a lookup
+// that needs it.
+func (c *MetadataCache) fetch(ctx context.Context, targetURL string, analyze bool) (*URLMetadata, error) {
+	key := cacheKey(targetURL)
+
+	if entry, ok := c.backend.Get(key); ok && c.now().Before(entry.ExpiresAt) && entry.covers(analyze) {
+		return entry.result()
+	}
+
+	// Coalesce concurrent misses for the same key into one fetch. Analyzed
+	// lookups cannot share a plain fetch, so they are grouped apart.
+	groupKey := key
+	if analyze {
+		groupKey += " analyzed"
+	}
+	entry, err := c.group.Do(ctx, groupKey, func(ctx context.Context) *CacheEntry {
+		return c.refresh(ctx, key, targetURL, analyze)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry.result()
+}
+
+// refresh loads targetURL, revalidating a stale entry when it has validators
+func (c *MetadataCache) refresh(ctx context.Context, key, targetURL string, analyze bool) *CacheEntry {
+	now := c.now()
+
+	// Another caller may have refreshed the entry while we waited
+	stale, ok := c.backend.Get(key)
+	if ok && now.Before(stale.ExpiresAt) && stale.covers(analyze) {
+		return stale
+	}
+	if ok && (stale.Err != nil || !now.Before(stale.DiscardAt)) {
+		stale = nil
+	}
+
+	// A 304 only extends what is cached, which may lack the analysis
+	var validators *pageValidators
+	if stale != nil && stale.covers(analyze) && (stale.Validators.ETag != "" || stale.Validators.LastModified != "") {
+		validators = &stale.Validators
+	}
+
+	entry, err := c.load(ctx, targetURL, validators, analyze)
+	switch {
+	case err != nil && ctx.Err() == context.Canceled:
+		// Every caller went away; nothing learned about the site
+		return &CacheEntry{Err: err}
+	case errors.Is(err, errNotModified):
+		// Unchanged upstream: extend the cached copy
+		entry = &CacheEntry{Metadata: stale.Metadata, Validators: stale.Validators, Analyzed: stale.Analyzed}
+	case err != nil && stale != nil:
+		// Serve the stale copy rather than nothing, but retry soon
+		entry = &CacheEntry{Metadata: stale.Metadata, Validators: stale.Validators, Analyzed: stale.Analyzed}
+		entry.ExpiresAt = now.Add(c.config.NegativeTTL)
+		entry.DiscardAt = stale.DiscardAt
+		c.backend.Set(key, entry)
+		return entry
+	case err != nil:
+		entry = &CacheEntry{Err: err, ExpiresAt: now.Add(c.config.NegativeTTL)}
+		entry.DiscardAt = entry.ExpiresAt
+		c.backend.Set(key, entry)
+		return entry
+	}
+
+	entry.ExpiresAt = now.Add(c.config.TTL)
+	entry.DiscardAt = entry.ExpiresAt.Add(c.config.StaleTTL)
+	c.backend.Set(key, entry)
+	return entry
+}
+
+// covers reports whether the entry answers a lookup that may need the
+// main-content analysis. A cached failure answers both kinds.
+func (e *CacheEntry) covers(analyze bool) bool {
+	return !analyze || e.Analyzed || e.Err != nil
+}
+
+// result returns the cached metadata or the cached failure
+func (e *CacheEntry) result() (*URLMetadata, error) {
+	if e.Err != nil {
+		return nil, e.Err
+	}
+	return e.Metadata, nil
+}
+
+// Invalidate drops the cached entry for targetURL
+func (c *MetadataCache) Invalidate(targetURL string) {
+	c.backend.Delete(cacheKey(targetURL))
+}
+
+// cacheKey normalizes a URL so equivalent spellings share an entry: scheme and
+// host are lowercased, default ports, fragments and tracking params dropped,
+// remaining query params sorted
+func cacheKey(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	switch {
+	case port != "":
+		u.Host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		u.Host = "[" + host + "]"
+	default:
+		u.Host = host
+	}
+
+	u.Fragment = ""
+	u.RawFragment = ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	u.RawQuery = stripTrackingParams(u.Query(), host).Encode()
+
+	return u.String()
+}
+
+// callGroup coalesces concurrent calls with the same key, singleflight-style
+type callGroup struct {
+	mu    sync.Mutex
+	calls map[string]*groupCall
+}
+
+type groupCall struct {
+	done    chan struct{}
+	entry   *CacheEntry
+	waiters int                // callers still interested in the result
+	cancel  context.CancelFunc // cancels fn once waiters drops to zero
+}
+
+// Do runs fn once per key at a time; concurrent callers share its result.
+// fn's context keeps the first caller's values but is only canceled when all
+// callers have given up. A caller whose ctx is done gets ctx.Err().
+func (g *callGroup) Do(ctx context.Context, key string, fn func(context.Context) *CacheEntry) (*CacheEntry, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*groupCall)
+	}
+	// A call everyone gave up on is being canceled; start over
+	call, ok := g.calls[key]
+	if ok && call.waiters > 0 {
+		call.waiters++
+	} else {
+		callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		call = &groupCall{done: make(chan struct{}), waiters: 1, cancel: cancel}
+		g.calls[key] = call
+
+		go func() {
+			call.entry = fn(callCtx)
+			cancel()
+
+			g.mu.Lock()
+			if g.calls[key] == call {
+				delete(g.calls, key)
+			}
+			g.mu.Unlock()
+			close(call.done)
+		}()
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.entry, nil
+	case <-ctx.Done():
+		g.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			call.cancel()
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
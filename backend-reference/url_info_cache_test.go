@@ -0,0 +1,223 @@
+// Package handler tests for the metadata cache
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestCache creates a cache with a controllable clock and loader
+func newTestCache(load func(context.Context, string, *pageValidators, bool) (*CacheEntry, error)) (*MetadataCache, *time.Time) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := newMetadataCache(NewLRUCache(10), MetadataCacheConfig{
+		TTL:         time.Hour,
+		NegativeTTL: time.Minute,
+		StaleTTL:    24 * time.Hour,
+	})
+	cache.load = load
+	cache.now = func() time.Time { return now }
+	return cache, &now
+}
+
+func TestMetadataCache_CoalescesConcurrentFetches(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+
+	cache, _ := newTestCache(func(context.Context, string, *pageValidators, bool) (*CacheEntry, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return &CacheEntry{Metadata: &URLMetadata{Title: "Shared"}}, nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			metadata, err := cache.Fetch(context.Background(), "https://example.com/post")
+			if err != nil || metadata.Title != "Shared" {
+				t.Errorf("Unexpected result: %v %v", metadata, err)
+			}
+		}()
+	}
+
+	// Let the goroutines pile up on the in-flight call
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("Expected 1 load, got %d", calls)
+	}
+}
+
+func TestMetadataCache_NegativeCaching(t *testing.T) {
+	calls := 0
+	cache, now := newTestCache(func(context.Context, string, *pageValidators, bool) (*CacheEntry, error) {
+		calls++
+		return nil, errors.New("received status code 503")
+	})
+
+	for i := 0; i < 3; i++ {
+		if _, err := cache.Fetch(context.Background(), "https://example.com/down"); err == nil {
+			t.Fatal("Expected cached error")
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected 1 load within negative TTL, got %d", calls)
+	}
+
+	*now = now.Add(2 * time.Minute)
+	cache.Fetch(context.Background(), "https://example.com/down")
+	if calls != 2 {
+		t.Errorf("Expected reload after negative TTL, got %d loads", calls)
+	}
+}
+
+func TestMetadataCache_RevalidatesWithValidators(t *testing.T) {
+	var got *pageValidators
+	calls := 0
+	cache, now := newTestCache(func(_ context.Context, _ string, v *pageValidators, _ bool) (*CacheEntry, error) {
+		calls++
+		got = v
+		if v != nil {
+			return nil, errNotModified
+		}
+		return &CacheEntry{
+			Metadata:   &URLMetadata{Title: "Original"},
+			Validators: pageValidators{ETag: `"v1"`},
+		}, nil
+	})
+
+	cache.Fetch(context.Background(), "https://example.com/post")
+	*now = now.Add(2 * time.Hour)
+
+	metadata, err := cache.Fetch(context.Background(), "https://example.com/post")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got == nil || got.ETag != `"v1"` {
+		t.Errorf("Expected conditional request with ETag, got %+v", got)
+	}
+	if metadata.Title != "Original" {
+		t.Errorf("Expected cached title after 304, got %s", metadata.Title)
+	}
+
+	// The 304 made the entry fresh again
+	cache.Fetch(context.Background(), "https://example.com/post")
+	if calls != 2 {
+		t.Errorf("Expected 2 loads, got %d", calls)
+	}
+}
+
+func TestMetadataCache_AnalyzedEntries(t *testing.T) {
+	var loads []bool
+	cache, _ := newTestCache(func(_ context.Context, _ string, v *pageValidators, analyze bool) (*CacheEntry, error) {
+		loads = append(loads, analyze)
+		if v != nil {
+			t.Error("A plain entry must not be revalidated for an analyzed lookup")
+		}
+		return &CacheEntry{Metadata: &URLMetadata{}, Analyzed: analyze, Validators: pageValidators{ETag: `"v1"`}}, nil
+	})
+	ctx := context.Background()
+
+	// A plain entry is refetched once for an analyzed lookup, which then
+	// serves both kinds
+	cache.Fetch(ctx, "https://example.com/post")
+	cache.fetch(ctx, "https://example.com/post", true)
+	cache.fetch(ctx, "https://example.com/post", true)
+	cache.Fetch(ctx, "https://example.com/post")
+	if !reflect.DeepEqual(loads, []bool{false, true}) {
+		t.Errorf("Unexpected loads %v", loads)
+	}
+}
+
+func TestMetadataCache_ServesStaleOnError(t *testing.T) {
+	fail := false
+	cache, now := newTestCache(func(context.Context, string, *pageValidators, bool) (*CacheEntry, error) {
+		if fail {
+			return nil, errors.New("timeout")
+		}
+		return &CacheEntry{Metadata: &URLMetadata{Title: "Kept"}}, nil
+	})
+
+	cache.Fetch(context.Background(), "https://example.com/post")
+	*now = now.Add(2 * time.Hour)
+	fail = true
+
+	metadata, err := cache.Fetch(context.Background(), "https://example.com/post")
+	if err != nil || metadata.Title != "Kept" {
+		t.Errorf("Expected stale metadata, got %v %v", metadata, err)
+	}
+}
+
+func TestLoadURLMetadata_ConditionalRequest(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"abc"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("ETag", `"abc"`)
+		w.Write([]byte(`<html><head><title>Page</title></head></html>`))
+	}))
+	defer testServer.Close()
+	allowLoopbackForTest(t)
+
+	entry, err := DefaultFetcher.load(context.Background(), testServer.URL, nil, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if entry.Validators.ETag != `"abc"` {
+		t.Errorf("Expected ETag to be recorded, got %q", entry.Validators.ETag)
+	}
+
+	if _, err := DefaultFetcher.load(context.Background(), testServer.URL, &entry.Validators, false); !errors.Is(err, errNotModified) {
+		t.Errorf("Expected errNotModified, got %v", err)
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"HTTPS://Example.COM", "https://example.com/"},
+		{"https://example.com:443/a#section", "https://example.com/a"},
+		{"http://example.com:8080/a", "http://example.com:8080/a"},
+		{"https://example.com/a?b=2&a=1", "https://example.com/a?a=1&b=2"},
+		{"https://example.com/a?utm_source=x&id=7&fbclid=y", "https://example.com/a?id=7"},
+		{"https://[2606:4700::1]:443/", "https://[2606:4700::1]/"},
+	}
+
+	for _, tc := range testCases {
+		if result := cacheKey(tc.input); result != tc.expected {
+			t.Errorf("For %s: expected %s, got %s", tc.input, tc.expected, result)
+		}
+	}
+}
+
+func TestLRUCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewLRUCache(2)
+	cache.Set("a", &CacheEntry{})
+	cache.Set("b", &CacheEntry{})
+	cache.Get("a")
+	cache.Set("c", &CacheEntry{})
+
+	if _, ok := cache.Get("b"); ok {
+		t.Error("Expected b to be evicted")
+	}
+	if _, ok := cache.Get("a"); !ok {
+		t.Error("Expected a to be kept")
+	}
+	if cache.Len() != 2 {
+		t.Errorf("Expected 2 entries, got %d", cache.Len())
+	}
+}
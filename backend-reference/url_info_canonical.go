@@ -0,0 +1,233 @@
+// Canonical URL resolution for deduplication
+// The same article is shared as ?utm_source=..., ?fbclid=..., m. subdomains,
+// AMP variants and with or without a trailing slash. CanonicalizeURL reduces
+// those spellings to one form; pages can also declare their canonical URL with
+// <link rel="canonical"> or og:url, which is honored when it stays on the same
+// site.
+
+package handler
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+// trackingParams are query parameters that never change page content
+var trackingParams = map[string]bool{
+	"fbclid": true, "gclid": true, "gclsrc": true, "dclid": true, "gbraid": true,
+	"wbraid": true, "msclkid": true, "yclid": true, "twclid": true, "ttclid": true,
+	"igshid": true, "igsh": true, "li_fat_id": true, "mc_cid": true, "mc_eid": true,
+	"_ga": true, "_gl": true, "_hsenc": true, "_hsmi": true, "mkt_tok": true,
+	"oly_anon_id": true, "oly_enc_id": true, "vero_id": true, "wickedid": true,
+	"rb_clickid": true, "s_cid": true, "cmpid": true, "ref_src": true, "ref_url": true,
+	"spm": true, "amp": true,
+}
+
+// trackingPrefixes are families of tracking parameters
+var trackingPrefixes = []string{"utm_", "pk_", "mtm_", "hsa_"}
+
+// siteTrackingParams are share-link parameters that are only tracking on
+// particular sites
+var siteTrackingParams = []struct {
+	hosts  []string
+	params []string
+}{
+	{[]string{"youtube.com", "youtu.be"}, []string{"si", "feature", "pp"}},
+	{[]string{"spotify.com"}, []string{"si", "nd", "context"}},
+	{[]string{"twitter.com", "x.com"}, []string{"s", "t"}},
+}
+
+// mobileLabels are host labels for mobile and AMP mirrors of a site
+var mobileLabels = map[string]bool{"m": true, "mobile": true, "amp": true}
+
+// CanonicalizeURL returns the canonical form of rawURL used to detect that two
+// links point at the same page: scheme and host lowercased, IDN hosts in
+// punycode, default ports, fragments, tracking parameters, mobile/AMP variants
+// and trailing slashes removed, remaining query parameters sorted.
+func CanonicalizeURL(rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse URL: %v", err)
+	}
+	if u.Scheme == "" && u.Host == "" {
+		// Bare host such as example.com/a
+		if u, err = url.Parse("https://" + strings.TrimSpace(rawURL)); err != nil {
+			return "", fmt.Errorf("failed to parse URL: %v", err)
+		}
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("unsupported scheme: %s", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("URL must have a valid host")
+	}
+
+	if target, ok := ampCacheTarget(u); ok {
+		return CanonicalizeURL(target)
+	}
+
+	u.User = nil
+	u.Fragment = ""
+	u.RawFragment = ""
+	u.Host = canonicalHost(u)
+
+	// AMP variants: /article/amp, /article.amp.html
+	path := u.EscapedPath()
+	path = strings.TrimSuffix(strings.TrimSuffix(path, "/"), "/amp")
+	path = strings.Replace(path, ".amp.html", ".html", 1)
+	path = strings.TrimSuffix(path, "/")
+	if path == "" {
+		path = "/"
+	}
+	if p, err := url.PathUnescape(path); err == nil {
+		u.Path, u.RawPath = p, path
+	}
+
+	u.RawQuery = stripTrackingParams(u.Query(), u.Hostname()).Encode()
+	u.ForceQuery = false
+
+	return u.String(), nil
+}
+
+// canonicalHost lowercases and punycodes the host, drops mobile/AMP labels and
+// default ports
+func canonicalHost(u *url.URL) string {
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+		host = ascii
+	}
+
+	// m.example.com, en.m.wikipedia.org; the registrable domain is left alone
+	if _, isIP := parseHostIP(host); !isIP {
+		labels := strings.Split(host, ".")
+		kept := labels[:0]
+		for i, label := range labels {
+			if mobileLabels[label] && i < len(labels)-2 {
+				continue
+			}
+			kept = append(kept, label)
+		}
+		host = strings.Join(kept, ".")
+	}
+
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	switch {
+	case port != "":
+		return net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		return "[" + host + "]"
+	default:
+		return host
+	}
+}
+
+// ampCacheTarget unwraps Google AMP viewer and AMP cache URLs to the
+// publisher URL they serve
+func ampCacheTarget(u *url.URL) (string, bool) {
+	host := strings.ToLower(u.Hostname())
+	path := u.EscapedPath()
+
+	var rest string
+	switch {
+	case (host == "google.com" || host == "www.google.com") && strings.HasPrefix(path, "/amp/"):
+		rest = strings.TrimPrefix(path, "/amp/")
+	case strings.HasSuffix(host, ".cdn.ampproject.org"):
+		// /c/s/example.com/article, /v/s/..., /i/s/...
+		parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)
+		if len(parts) < 2 || len(parts[0]) != 1 {
+			return "", false
+		}
+		rest = parts[1]
+	default:
+		return "", false
+	}
+
+	scheme := "http://"
+	if strings.HasPrefix(rest, "s/") {
+		scheme, rest = "https://", strings.TrimPrefix(rest, "s/")
+	}
+	if rest == "" {
+		return "", false
+	}
+	if u.RawQuery != "" {
+		rest += "?" + u.RawQuery
+	}
+	return scheme + rest, true
+}
+
+// stripTrackingParams removes tracking parameters from a query
+func stripTrackingParams(query url.Values, host string) url.Values {
+	for key := range query {
+		lower := strings.ToLower(key)
+		if trackingParams[lower] {
+			query.Del(key)
+			continue
+		}
+		for _, prefix := range trackingPrefixes {
+			if strings.HasPrefix(lower, prefix) {
+				query.Del(key)
+				break
+			}
+		}
+	}
+
+	for _, site := range siteTrackingParams {
+		if hostMatches(host, site.hosts) {
+			for _, param := range site.params {
+				query.Del(param)
+			}
+		}
+	}
+	return query
+}
+
+// resolveCanonicalURL picks the canonical URL for a fetched page: the page's
+// declared canonical when it is on the same site as the final URL, otherwise
+// the final URL itself. Cross-site canonicals are ignored so a page cannot
+// claim to be an article that was already curated elsewhere; trusted values
+// from site-specific extractors (youtu.be -> youtube.com) are exempt.
+func resolveCanonicalURL(declared string, pageURL *url.URL, trusted bool) string {
+	if pageURL == nil {
+		return ""
+	}
+	fallback, err := CanonicalizeURL(pageURL.String())
+	if err != nil {
+		return ""
+	}
+
+	declared = resolveURL(strings.TrimSpace(declared), pageURL)
+	if declared == "" {
+		return fallback
+	}
+	canonical, err := CanonicalizeURL(declared)
+	if err != nil {
+		return fallback
+	}
+
+	target, err := url.Parse(canonical)
+	if err != nil || (!trusted && !sameSite(target.Hostname(), pageURL.Hostname())) {
+		return fallback
+	}
+	return canonical
+}
+
+// sameSite reports whether two hosts share a registrable domain
+func sameSite(a, b string) bool {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	if a == b {
+		return true
+	}
+	siteA, errA := publicsuffix.EffectiveTLDPlusOne(a)
+	siteB, errB := publicsuffix.EffectiveTLDPlusOne(b)
+	return errA == nil && errB == nil && siteA == siteB
+}
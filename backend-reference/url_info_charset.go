@@ -0,0 +1,144 @@
+// Character-set detection and transcoding for fetched pages
+// Pages served as GBK, GB18030, Big5, Shift_JIS, EUC-KR and other legacy
+// encodings are converted to UTF-8 before extraction. The charset is taken
+// from, in order: a byte-order mark, the Content-Type header, then
+// <meta charset> / http-equiv tags in the head.
+
+package handler
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// maxCharsetScanBytes bounds how far into the page <meta charset> is looked for
+const maxCharsetScanBytes = 64 * 1024
+
+// detectCharset determines the encoding of an HTML body. It returns the
+// encoding and its canonical name; a nil encoding means UTF-8.
+func detectCharset(body []byte, contentType string) (encoding.Encoding, string) {
+	// Byte-order marks override everything else
+	switch {
+	case bytes.HasPrefix(body, []byte{0xEF, 0xBB, 0xBF}):
+		return nil, "utf-8"
+	case bytes.HasPrefix(body, []byte{0xFF, 0xFE}):
+		return unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM), "utf-16le"
+	case bytes.HasPrefix(body, []byte{0xFE, 0xFF}):
+		return unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM), "utf-16be"
+	}
+
+	// Content-Type: text/html; charset=gbk
+	if enc, name := lookupCharset(charsetParam(contentType)); name != "" {
+		return enc, name
+	}
+
+	// <meta charset="..."> or <meta http-equiv="Content-Type" content="...">
+	if enc, name := lookupCharset(metaCharset(body)); name != "" {
+		return enc, name
+	}
+
+	if utf8.Valid(body) {
+		return nil, "utf-8"
+	}
+
+	// Undeclared and not UTF-8: use the HTML5 default guess
+	enc, name, _ := charset.DetermineEncoding(body, "")
+	return enc, name
+}
+
+// lookupCharset resolves a charset label, mapping UTF-8 to a nil encoding
+func lookupCharset(label string) (encoding.Encoding, string) {
+	if label == "" {
+		return nil, ""
+	}
+	enc, name := charset.Lookup(label)
+	if enc == nil {
+		return nil, ""
+	}
+	if name == "utf-8" {
+		return nil, name
+	}
+	return enc, name
+}
+
+// charsetParam extracts the charset parameter from a Content-Type value
+func charsetParam(contentType string) string {
+	for _, param := range strings.Split(contentType, ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if ok && strings.EqualFold(strings.TrimSpace(key), "charset") {
+			return strings.Trim(strings.TrimSpace(value), `"'`)
+		}
+	}
+	return ""
+}
+
+// metaCharset scans the start of the document for a charset declaration,
+// stopping at </head> or <body>
+func metaCharset(body []byte) string {
+	if len(body) > maxCharsetScanBytes {
+		body = body[:maxCharsetScanBytes]
+	}
+
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == "head" {
+				return ""
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			if string(name) == "body" {
+				return ""
+			}
+			if string(name) != "meta" || !hasAttr {
+				continue
+			}
+
+			var httpEquiv, content string
+			for {
+				key, val, more := z.TagAttr()
+				switch strings.ToLower(string(key)) {
+				case "charset":
+					return strings.TrimSpace(string(val))
+				case "http-equiv":
+					httpEquiv = strings.ToLower(string(val))
+				case "content":
+					content = string(val)
+				}
+				if !more {
+					break
+				}
+			}
+			if httpEquiv == "content-type" {
+				if label := charsetParam(content); label != "" {
+					return label
+				}
+			}
+		}
+	}
+}
+
+// decodeToUTF8 transcodes body to UTF-8 and returns the detected charset name.
+// Undecodable bytes become U+FFFD rather than failing the fetch.
+func decodeToUTF8(body []byte, contentType string) ([]byte, string) {
+	enc, name := detectCharset(body, contentType)
+	if enc == nil {
+		return bytes.TrimPrefix(body, []byte{0xEF, 0xBB, 0xBF}), name
+	}
+
+	decoded, _, err := transform.Bytes(enc.NewDecoder(), body)
+	if err != nil {
+		return body, name
+	}
+	return decoded, name
+}
@@ -0,0 +1,89 @@
+// Package handler tests for charset detection
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFetchPage_TranscodesLegacyEncodings(t *testing.T) {
+	testCases := []struct {
+		fixture     string
+		contentType string
+		charset     string
+		title       string
+		description string
+	}{
+		{"gbk.html", "text/html", "gbk", "中文标题 - 新闻频道", "这是一个使用GBK编码的页面"},
+		{"gb18030.html", "text/html", "gb18030", "国标扩展字符 𠀀 测试", ""},
+		{"big5.html", "text/html", "big5", "繁體中文標題", "臺灣新聞摘要"},
+		{"shift_jis.html", "text/html; charset=Shift_JIS", "shift_jis", "日本語のタイトル", "シフトJISで書かれたページ"},
+		{"euc-kr.html", "text/html", "euc-kr", "한국어 제목", ""},
+		{"utf-16le-bom.html", "text/html; charset=iso-8859-1", "utf-16le", "UTF-16 页面", ""},
+	}
+
+	allowLoopbackForTest(t)
+
+	for _, tc := range testCases {
+		body, err := os.ReadFile(filepath.Join("testdata", "charset", tc.fixture))
+		if err != nil {
+			t.Fatalf("Failed to read fixture %s: %v", tc.fixture, err)
+		}
+
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", tc.contentType)
+			w.Write(body)
+		}))
+
+		page, err := DefaultFetcher.fetchPage(context.Background(), testServer.URL, nil)
+		testServer.Close()
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.fixture, err)
+			continue
+		}
+
+		if page.Charset != tc.charset {
+			t.Errorf("%s: expected charset %s, got %s", tc.fixture, tc.charset, page.Charset)
+		}
+
+		metadata, err := defaultPipeline().Run(context.Background(), page)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.fixture, err)
+			continue
+		}
+		if metadata.Title != tc.title {
+			t.Errorf("%s: expected title %q, got %q", tc.fixture, tc.title, metadata.Title)
+		}
+		if tc.description != "" && metadata.Description != tc.description {
+			t.Errorf("%s: expected description %q, got %q", tc.fixture, tc.description, metadata.Description)
+		}
+	}
+}
+
+func TestDetectCharset_Precedence(t *testing.T) {
+	testCases := []struct {
+		name        string
+		body        string
+		contentType string
+		expected    string
+	}{
+		{"header beats meta", `<meta charset="big5">`, "text/html; charset=gbk", "gbk"},
+		{"quoted header param", `<p>x</p>`, `text/html; charset="EUC-KR"`, "euc-kr"},
+		{"gb2312 maps to gbk", `<meta charset="gb2312">`, "text/html", "gbk"},
+		{"http-equiv", `<meta http-equiv="Content-Type" content="text/html; charset=Shift_JIS">`, "", "shift_jis"},
+		{"meta after head ignored", `<head></head><body><meta charset="big5">`, "", "utf-8"},
+		{"utf-8 bom beats header", "\xEF\xBB\xBF<p>x</p>", "text/html; charset=gbk", "utf-8"},
+		{"undeclared utf-8", `<title>héllo</title>`, "", "utf-8"},
+		{"undeclared latin-1", "<title>h\xe9llo</title>", "", "windows-1252"},
+	}
+
+	for _, tc := range testCases {
+		if _, name := detectCharset([]byte(tc.body), tc.contentType); name != tc.expected {
+			t.Errorf("%s: expected %s, got %s", tc.name, tc.expected, name)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+// Academic citation metadata
+// Journals, repositories and preprint servers describe papers with Highwire
+// Press citation_* meta tags (the ones Google Scholar indexes) and Dublin
+// Core DC.* / DCTERMS.* tags. The head and DOM extractors collect those tags;
+// the citation extractor turns them into URLMetadata.Citation, preferring
+// citation_* over Dublin Core field by field. Bare doi:10.xxxx input is
+// accepted as a URL and resolved through doi.org to the landing page.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Citation describes a scholarly work
+type Citation struct {
+	Title           string   `json:"title,omitempty"`
+	Authors         []string `json:"authors,omitempty"` // as written, often "Last, First"
+	DOI             string   `json:"doi,omitempty"`     // without a doi: or resolver prefix
+	PublicationDate string   `json:"publicationDate,omitempty"`
+	Journal         string   `json:"journal,omitempty"`
+	Conference      string   `json:"conference,omitempty"`
+	Publisher       string   `json:"publisher,omitempty"`
+	Volume          string   `json:"volume,omitempty"`
+	Issue           string   `json:"issue,omitempty"`
+	FirstPage       string   `json:"firstPage,omitempty"`
+	LastPage        string   `json:"lastPage,omitempty"`
+	ISSN            string   `json:"issn,omitempty"`
+	ISBN            string   `json:"isbn,omitempty"`
+	ArxivID         string   `json:"arxivId,omitempty"`
+	PDFURL          string   `json:"pdfUrl,omitempty"`
+}
+
+var (
+	// doiRegex matches a DOI: the 10. directory indicator, a registrant code
+	// and any suffix
+	doiRegex = regexp.MustCompile(`^10\.\d{4,9}(?:\.\d+)*/\S+$`)
+
+	// citationDateRegex matches the year, year/month and year/month/day forms
+	// citation_publication_date uses
+	citationDateRegex = regexp.MustCompile(`^(\d{4})(?:[/-](\d{1,2}))?(?:[/-](\d{1,2}))?$`)
+)
+
+// isCitationTag reports whether a <meta name> is a citation or Dublin Core tag
+func isCitationTag(name string) bool {
+	return strings.HasPrefix(name, "citation_") || strings.HasPrefix(name, "dc.") || strings.HasPrefix(name, "dcterms.")
+}
+
+// addCitationTag records a citation or Dublin Core tag for the citation
+// extractor
+func (e *Extraction) addCitationTag(name, content string) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return
+	}
+	if e.citationMeta == nil {
+		e.citationMeta = make(map[string][]string)
+	}
+	e.citationMeta[name] = append(e.citationMeta[name], content)
+}
+
+// citationExtractor builds the citation block from the tags collected by the
+// head and DOM extractors, and fills in title, authors and date from it
+type citationExtractor struct{}
+
+func (citationExtractor) Name() string { return "citation" }
+
+func (citationExtractor) Extract(_ context.Context, page *Page, found *Extraction) (*Extraction, error) {
+	meta := found.citationMeta
+	if len(meta) == 0 {
+		return nil, nil
+	}
+
+	c := buildCitation(meta, page.URL)
+	if c == nil {
+		return nil, nil
+	}
+
+	result := NewExtraction("citation")
+	result.Citation = c
+
+	// Dublin Core is common on ordinary CMS pages, so only citation_* tags
+	// make a page a paper
+	scholarly := firstMeta(meta, "citation_title", "citation_doi") != ""
+	confidence := ConfidenceLow
+	if scholarly {
+		confidence = ConfidenceMedium
+		result.Set(FieldContentType, "ScholarlyArticle", ConfidenceFallback)
+	}
+
+	result.Set(FieldTitle, c.Title, confidence)
+	authors := make([]string, 0, len(c.Authors))
+	for _, a := range c.Authors {
+		authors = append(authors, displayName(a))
+	}
+	if len(authors) > maxListedAuthors {
+		authors = append(authors[:maxListedAuthors:maxListedAuthors], "et al.")
+	}
+	result.Set(FieldAuthor, strings.Join(authors, ", "), confidence)
+	result.Set(FieldPublishedAt, normalizeDate(c.PublicationDate), confidence)
+	result.Set(FieldSiteName, firstNonEmpty(c.Journal, c.Conference), ConfidenceLow)
+	result.Set(FieldDescription, firstMeta(meta, "citation_abstract", "dc.description", "dcterms.abstract", "dcterms.description"), ConfidenceLow)
+
+	var keywords []string
+	for _, k := range meta["citation_keywords"] {
+		keywords = append(keywords, strings.Split(k, ";")...)
+	}
+	result.Set(FieldKeywords, strings.Join(keywords, ","), ConfidenceMedium)
+	return result, nil
+}
+
+// buildCitation reads citation_* tags, filling gaps from Dublin Core
+func buildCitation(meta map[string][]string, base *url.URL) *Citation {
+	c := &Citation{
+		Title:           firstMeta(meta, "citation_title", "dc.title", "dcterms.title"),
+		DOI:             normalizeDOI(firstMeta(meta, "citation_doi")),
+		PublicationDate: citationDate(firstMeta(meta, "citation_publication_date", "citation_date", "citation_cover_date", "citation_online_date")),
+		Journal:         firstMeta(meta, "citation_journal_title"),
+		Conference:      firstMeta(meta, "citation_conference_title"),
+		Publisher:       firstMeta(meta, "citation_publisher", "dc.publisher", "dcterms.publisher"),
+		Volume:          firstMeta(meta, "citation_volume"),
+		Issue:           firstMeta(meta, "citation_issue"),
+		FirstPage:       firstMeta(meta, "citation_firstpage"),
+		LastPage:        firstMeta(meta, "citation_lastpage"),
+		ISSN:            firstMeta(meta, "citation_issn", "citation_eissn"),
+		ISBN:            firstMeta(meta, "citation_isbn"),
+		ArxivID:         firstMeta(meta, "citation_arxiv_id"),
+		PDFURL:          resolveURL(firstMeta(meta, "citation_pdf_url"), base),
+	}
+
+	// Some publishers put all authors in one semicolon-separated tag
+	c.Authors = slices.Clone(meta["citation_author"])
+	for _, list := range meta["citation_authors"] {
+		for _, a := range strings.Split(list, ";") {
+			if a = strings.TrimSpace(a); a != "" {
+				c.Authors = append(c.Authors, a)
+			}
+		}
+	}
+	if len(c.Authors) == 0 {
+		c.Authors = slices.Concat(meta["dc.creator"], meta["dcterms.creator"])
+	}
+
+	if c.DOI == "" {
+		for _, id := range slices.Concat(meta["dc.identifier"], meta["dcterms.identifier"]) {
+			if c.DOI = normalizeDOI(id); c.DOI != "" {
+				break
+			}
+		}
+	}
+	if c.PublicationDate == "" {
+		c.PublicationDate = citationDate(firstMeta(meta, "dc.date", "dcterms.issued", "dcterms.created", "dcterms.date", "dcterms.available"))
+	}
+
+	if c.Title == "" && c.DOI == "" && len(c.Authors) == 0 {
+		return nil
+	}
+	return c
+}
+
+// normalizeDOI extracts the DOI from doi:, resolver URL and bare forms, or
+// returns "" when value is not a DOI
+func normalizeDOI(value string) string {
+	value = strings.TrimSpace(value)
+	lower := strings.ToLower(value)
+	for _, prefix := range []string{"doi:", "info:doi/", "https://doi.org/", "http://doi.org/", "https://dx.doi.org/", "http://dx.doi.org/"} {
+		if strings.HasPrefix(lower, prefix) {
+			value = strings.TrimSpace(value[len(prefix):])
+			break
+		}
+	}
+	if unescaped, err := url.PathUnescape(value); err == nil {
+		value = unescaped
+	}
+	if !doiRegex.MatchString(value) {
+		return ""
+	}
+	return value
+}
+
+// doiURL turns doi:10.xxxx input into its doi.org URL. ok is false for input
+// that does not start with doi:.
+func doiURL(input string) (resolved string, ok bool, err error) {
+	if len(input) < 4 || !strings.EqualFold(input[:4], "doi:") {
+		return "", false, nil
+	}
+	doi := normalizeDOI(input)
+	if doi == "" {
+		return "", true, fmt.Errorf("invalid DOI: %s", input)
+	}
+	// doi.org redirects to the landing page
+	u := &url.URL{Scheme: "https", Host: "doi.org", Path: "/" + doi}
+	return u.String(), true, nil
+}
+
+// citationDate normalizes 2024/03/05, 2024/3 or 2024 to YYYY-MM-DD, YYYY-MM
+// or YYYY
+func citationDate(value string) string {
+	value = strings.TrimSpace(value)
+	if date := normalizeDate(value); date != "" {
+		return date
+	}
+	m := citationDateRegex.FindStringSubmatch(value)
+	if m == nil {
+		return ""
+	}
+	date := m[1]
+	for _, part := range m[2:] {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			break
+		}
+		date += fmt.Sprintf("-%02d", n)
+	}
+	return date
+}
+
+// displayName turns "Lovelace, Ada" into "Ada Lovelace"
+func displayName(name string) string {
+	last, first, ok := strings.Cut(name, ",")
+	if !ok || strings.Contains(first, ",") {
+		return name
+	}
+	return strings.TrimSpace(strings.TrimSpace(first) + " " + strings.TrimSpace(last))
+}
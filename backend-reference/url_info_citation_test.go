@@ -0,0 +1,139 @@
+// Package handler tests for academic citation metadata
+package handler
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const citationPage = `<html><head>
+<title>Notes on the Analytical Engine | Journal of Computing</title>
+<meta name="DC.title" content="Ignored in favor of citation_title">
+<meta name="DC.creator" content="Someone Else">
+<meta name="citation_title" content="Notes on the Analytical Engine">
+<meta name="citation_author" content="Lovelace, Ada">
+<meta name="citation_author" content="Babbage, Charles">
+<meta name="citation_doi" content="doi:10.1234/jc.1843.42">
+<meta name="citation_publication_date" content="1843/10/5">
+<meta name="citation_journal_title" content="Journal of Computing">
+<meta name="citation_volume" content="3">
+<meta name="citation_firstpage" content="666">
+<meta name="citation_lastpage" content="731">
+<meta name="citation_keywords" content="engines; computation">
+<meta name="citation_pdf_url" content="/article/42.pdf">
+<meta name="DC.publisher" content="Taylor's Scientific Memoirs">
+</head><body></body></html>`
+
+func TestCitationExtractor(t *testing.T) {
+	page := testPage(t, "https://journal.example.com/article/42", citationPage)
+	metadata, err := defaultPipeline().Run(context.Background(), page)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := &Citation{
+		Title:           "Notes on the Analytical Engine",
+		Authors:         []string{"Lovelace, Ada", "Babbage, Charles"},
+		DOI:             "10.1234/jc.1843.42",
+		PublicationDate: "1843-10-05",
+		Journal:         "Journal of Computing",
+		Publisher:       "Taylor's Scientific Memoirs",
+		Volume:          "3",
+		FirstPage:       "666",
+		LastPage:        "731",
+		PDFURL:          "https://journal.example.com/article/42.pdf",
+	}
+	if !reflect.DeepEqual(metadata.Citation, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, metadata.Citation)
+	}
+
+	if metadata.Title != "Notes on the Analytical Engine" || metadata.Author != "Ada Lovelace, Charles Babbage" {
+		t.Errorf("Unexpected title or author %q %q", metadata.Title, metadata.Author)
+	}
+	if metadata.PublishedAt != "1843-10-05" || metadata.Format != FormatPaper || metadata.SiteName != "Journal of Computing" {
+		t.Errorf("Unexpected date, format or site %q %q %q", metadata.PublishedAt, metadata.Format, metadata.SiteName)
+	}
+	if strings.Join(metadata.Keywords, ",") != "engines,computation" {
+		t.Errorf("Unexpected keywords %v", metadata.Keywords)
+	}
+}
+
+func TestCitationExtractor_DublinCore(t *testing.T) {
+	page := testPage(t, "https://blog.example.com/post", `<html><head>
+<meta property="og:title" content="A Post">
+<meta name="dcterms.creator" content="Jane Doe">
+<meta name="dcterms.issued" content="2024-03">
+<meta name="DC.identifier" content="https://doi.org/10.5555/blog.7">
+</head></html>`)
+	metadata, _ := defaultPipeline().Run(context.Background(), page)
+
+	c := metadata.Citation
+	if c == nil || c.DOI != "10.5555/blog.7" || c.PublicationDate != "2024-03" || len(c.Authors) != 1 {
+		t.Fatalf("Unexpected citation %+v", c)
+	}
+	// Dublin Core alone does not make a paper, nor override og:title
+	if metadata.Format != FormatArticle || metadata.Title != "A Post" || metadata.Author != "Jane Doe" {
+		t.Errorf("Unexpected metadata %+v", metadata)
+	}
+}
+
+func TestFetcher_ResolvesDOI(t *testing.T) {
+	fetcher := newCannedFetcher(FetcherConfig{}, map[string]string{
+		"https://doi.org/10.1234/jc.1843.42":     "redirect:https://journal.example.com/article/42",
+		"https://journal.example.com/article/42": citationPage,
+	})
+	target, err := fetcher.Validate("doi:10.1234/jc.1843.42")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	metadata, err := fetcher.Fetch(context.Background(), target)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if metadata.FinalURL != "https://journal.example.com/article/42" || metadata.Citation == nil || metadata.Citation.DOI != "10.1234/jc.1843.42" {
+		t.Errorf("Expected the landing page, got %s %+v", metadata.FinalURL, metadata.Citation)
+	}
+}
+
+func TestCitationHelpers(t *testing.T) {
+	dois := map[string]string{
+		"10.1000/xyz123":                   "10.1000/xyz123",
+		"doi:10.1000/xyz123":               "10.1000/xyz123",
+		"https://dx.doi.org/10.1000/a%2Fb": "10.1000/a/b",
+		"info:doi/10.1000.10/abc":          "10.1000.10/abc",
+		"https://example.com/10.1000/xyz":  "",
+		"10.12/too-short-registrant":       "",
+	}
+	for input, expected := range dois {
+		if got := normalizeDOI(input); got != expected {
+			t.Errorf("normalizeDOI(%q): expected %q, got %q", input, expected, got)
+		}
+	}
+
+	dates := map[string]string{
+		"2024/03/05":           "2024-03-05",
+		"2024/3":               "2024-03",
+		"2024":                 "2024",
+		"2024-03-05T10:00:00Z": "2024-03-05T10:00:00Z",
+		"spring 2024":          "",
+	}
+	for input, expected := range dates {
+		if got := citationDate(input); got != expected {
+			t.Errorf("citationDate(%q): expected %q, got %q", input, expected, got)
+		}
+	}
+
+	names := map[string]string{
+		"Lovelace, Ada":     "Ada Lovelace",
+		"Ada Lovelace":      "Ada Lovelace",
+		"Doe, Jane, Jr.":    "Doe, Jane, Jr.",
+		"World Health Org.": "World Health Org.",
+	}
+	for input, expected := range names {
+		if got := displayName(input); got != expected {
+			t.Errorf("displayName(%q): expected %q, got %q", input, expected, got)
+		}
+	}
+}
@@ -0,0 +1,514 @@
+// Main-content extraction
+// A readability-style scorer finds the element holding the article text, then
+// computes word count (CJK-aware), reading time, a plain-text excerpt, the
+// number of outbound links and the primary language. Served with
+// ?detail=full on /client/common/urlInfo.
+
+package handler
+
+import (
+	"context"
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// Reading speed and excerpt settings
+const (
+	wordsPerMinute     = 230 // space-delimited languages
+	cjkCharsPerMinute  = 500 // Chinese and Japanese characters
+	maxExcerptRunes    = 280
+	minParagraphRunes  = 25
+	siblingScoreFactor = 0.2 // siblings scoring this share of the best join it
+)
+
+// ContentSummary describes the main content of a page
+type ContentSummary struct {
+	WordCount          int    `json:"wordCount"`
+	ReadingTimeMinutes int    `json:"readingTimeMinutes"`
+	Excerpt            string `json:"excerpt,omitempty"`
+	OutboundLinks      int    `json:"outboundLinks"`
+	Language           string `json:"language,omitempty"`
+}
+
+// Class/id hints used to weight candidate containers
+var (
+	positiveHint = regexp.MustCompile(`(?i)article|body|content|entry|main|page|post|text|blog|story`)
+	negativeHint = regexp.MustCompile(`(?i)comment|meta|footer|footnote|sidebar|widget|nav|menu|share|social|related|promo|sponsor|ad-|ads|banner|cookie|popup|subscribe`)
+)
+
+// skippedTags never contribute content
+var skippedTags = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true, "svg": true,
+	"nav": true, "footer": true, "aside": true, "form": true, "iframe": true,
+	"button": true, "select": true, "header": true,
+}
+
+// blockTags end a run of text when extracting plain text
+var blockTags = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "h1": true, "h2": true, "h3": true,
+	"h4": true, "h5": true, "h6": true, "pre": true, "blockquote": true, "td": true,
+	"tr": true, "section": true, "article": true, "figcaption": true,
+}
+
+// contentExtractor summarizes the page's main content. It needs the DOM, so
+// it only runs for lookups that asked for the analysis (Fetcher.FetchFull).
+type contentExtractor struct{}
+
+func (contentExtractor) Name() string { return "content" }
+
+func (contentExtractor) Extract(_ context.Context, page *Page, _ *Extraction) (*Extraction, error) {
+	if !page.analyze {
+		return nil, nil
+	}
+
+	doc, err := page.Document()
+	if err != nil {
+		return nil, err
+	}
+
+	summary := summarizeContent(doc, page.URL)
+	if summary == nil {
+		return nil, nil
+	}
+
+	found := NewExtraction("content")
+	found.Content = summary
+	// Last-resort description for pages without one
+	found.Set(FieldDescription, summary.Excerpt, ConfidenceGuess)
+	return found, nil
+}
+
+// summarizeContent extracts and measures the main content of doc
+func summarizeContent(doc *html.Node, pageURL *url.URL) *ContentSummary {
+	body := findElement(doc, "body")
+	if body == nil {
+		return nil
+	}
+
+	nodes := mainContentNodes(body)
+
+	var text strings.Builder
+	links := 0
+	for _, n := range nodes {
+		writeText(&text, n)
+		links += countOutboundLinks(n, pageURL)
+	}
+	plain := strings.Join(strings.Fields(text.String()), " ")
+
+	words, cjk := countWords(plain)
+	summary := &ContentSummary{
+		WordCount:     words + cjk,
+		OutboundLinks: links,
+		Excerpt:       excerpt(plain, maxExcerptRunes),
+		Language:      detectLanguage(doc, plain),
+	}
+	if summary.WordCount > 0 {
+		minutes := float64(words)/wordsPerMinute + float64(cjk)/cjkCharsPerMinute
+		summary.ReadingTimeMinutes = int(math.Max(1, math.Ceil(minutes)))
+	}
+	return summary
+}
+
+// findElement returns the first element with the given tag
+func findElement(n *html.Node, tag string) *html.Node {
+	if n.Type == html.ElementNode && n.Data == tag {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// mainContentNodes scores containers by the paragraphs they hold and returns
+// the best one plus any siblings that score nearly as well
+func mainContentNodes(body *html.Node) []*html.Node {
+	scores := make(map[*html.Node]float64)
+	var order []*html.Node
+
+	addScore := func(n *html.Node, score float64) {
+		if n == nil || n.Type != html.ElementNode {
+			return
+		}
+		if _, ok := scores[n]; !ok {
+			scores[n] = containerWeight(n)
+			order = append(order, n)
+		}
+		scores[n] += score
+	}
+
+	var traverse func(*html.Node)
+	traverse = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if skippedTags[n.Data] {
+				return
+			}
+			switch n.Data {
+			case "p", "pre", "td", "blockquote":
+				text := strings.TrimSpace(innerText(n))
+				length := utf8.RuneCountInString(text)
+				if length >= minParagraphRunes {
+					score := 1 + float64(strings.Count(text, ",")+strings.Count(text, "，")+strings.Count(text, "、"))
+					score += math.Min(float64(length)/100, 3)
+					addScore(n.Parent, score)
+					if n.Parent != nil {
+						addScore(n.Parent.Parent, score/2)
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			traverse(c)
+		}
+	}
+	traverse(body)
+
+	var best *html.Node
+	bestScore := 0.0
+	for _, n := range order {
+		scores[n] *= 1 - linkDensity(n)
+		if scores[n] > bestScore {
+			best, bestScore = n, scores[n]
+		}
+	}
+	if best == nil {
+		return []*html.Node{body}
+	}
+
+	// Articles split across sibling containers
+	nodes := []*html.Node{}
+	if best.Parent == nil {
+		return []*html.Node{best}
+	}
+	for s := best.Parent.FirstChild; s != nil; s = s.NextSibling {
+		if s == best || scores[s] >= bestScore*siblingScoreFactor && scores[s] > 0 {
+			nodes = append(nodes, s)
+		}
+	}
+	return nodes
+}
+
+// containerWeight is the base score of a container from its tag and class/id
+func containerWeight(n *html.Node) float64 {
+	weight := 0.0
+	switch n.Data {
+	case "article":
+		weight += 10
+	case "div", "section", "main":
+		weight += 5
+	case "pre", "td", "blockquote":
+		weight += 3
+	case "ol", "ul", "dl", "form":
+		weight -= 3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		weight -= 5
+	}
+
+	for _, attr := range n.Attr {
+		if attr.Key != "class" && attr.Key != "id" {
+			continue
+		}
+		if negativeHint.MatchString(attr.Val) {
+			weight -= 25
+		}
+		if positiveHint.MatchString(attr.Val) {
+			weight += 25
+		}
+	}
+	return weight
+}
+
+// innerText returns the text of n without skipped subtrees
+func innerText(n *html.Node) string {
+	var b strings.Builder
+	writeText(&b, n)
+	return b.String()
+}
+
+// writeText appends the visible text of n, separating block elements
+func writeText(b *strings.Builder, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		b.WriteString(n.Data)
+		return
+	case html.ElementNode:
+		if skippedTags[n.Data] {
+			return
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		writeText(b, c)
+	}
+	if n.Type == html.ElementNode && blockTags[n.Data] {
+		b.WriteString(" ")
+	}
+}
+
+// linkDensity is the share of a node's text that sits inside links
+func linkDensity(n *html.Node) float64 {
+	total := utf8.RuneCountInString(strings.TrimSpace(innerText(n)))
+	if total == 0 {
+		return 0
+	}
+
+	linked := 0
+	var traverse func(*html.Node)
+	traverse = func(c *html.Node) {
+		if c.Type == html.ElementNode && c.Data == "a" {
+			linked += utf8.RuneCountInString(strings.TrimSpace(innerText(c)))
+			return
+		}
+		for gc := c.FirstChild; gc != nil; gc = gc.NextSibling {
+			traverse(gc)
+		}
+	}
+	traverse(n)
+
+	return math.Min(float64(linked)/float64(total), 1)
+}
+
+// countOutboundLinks counts links in n pointing to other sites
+func countOutboundLinks(n *html.Node, pageURL *url.URL) int {
+	pageHost := strings.TrimPrefix(strings.ToLower(pageURL.Hostname()), "www.")
+	count := 0
+
+	var traverse func(*html.Node)
+	traverse = func(c *html.Node) {
+		if c.Type == html.ElementNode {
+			if skippedTags[c.Data] {
+				return
+			}
+			if c.Data == "a" {
+				for _, attr := range c.Attr {
+					if attr.Key != "href" {
+						continue
+					}
+					link, err := pageURL.Parse(strings.TrimSpace(attr.Val))
+					if err != nil || (link.Scheme != "http" && link.Scheme != "https") {
+						continue
+					}
+					if strings.TrimPrefix(strings.ToLower(link.Hostname()), "www.") != pageHost {
+						count++
+					}
+				}
+			}
+		}
+		for gc := c.FirstChild; gc != nil; gc = gc.NextSibling {
+			traverse(gc)
+		}
+	}
+	traverse(n)
+	return count
+}
+
+// isCJK reports whether r is a Chinese or Japanese character, which are read
+// individually rather than as space-separated words. Hangul is written with
+// spaces and counts as ordinary words.
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r)
+}
+
+// countWords counts space-delimited words and CJK characters separately
+func countWords(text string) (words, cjk int) {
+	inWord := false
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			cjk++
+			inWord = false
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if !inWord {
+				words++
+				inWord = true
+			}
+		case r == '\'' || r == '’' || r == '-':
+			// Contractions and hyphenated words stay one word
+		default:
+			inWord = false
+		}
+	}
+	return words, cjk
+}
+
+// excerpt shortens text to at most limit runes, cutting at a word boundary
+// for space-delimited text
+func excerpt(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+
+	cut := limit
+	for i := limit; i > limit*3/4; i-- {
+		if unicode.IsSpace(runes[i]) {
+			cut = i
+			break
+		}
+	}
+	return strings.TrimSpace(string(runes[:cut])) + "…"
+}
+
+// scriptLanguages maps writing systems to the language they most likely mean
+var scriptLanguages = []struct {
+	table *unicode.RangeTable
+	lang  string
+}{
+	{unicode.Hangul, "ko"},
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Han, "zh"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Greek, "el"},
+	{unicode.Thai, "th"},
+	{unicode.Devanagari, "hi"},
+}
+
+// stopwords are frequent short words identifying Latin-script languages
+var stopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "for", "with", "was"},
+	"es": {"el", "los", "las", "que", "y", "por", "una", "con", "para", "del"},
+	"fr": {"le", "les", "et", "des", "est", "une", "pour", "dans", "qui", "sur"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "mit", "den", "ein", "zu"},
+	"pt": {"o", "os", "que", "e", "do", "da", "em", "não", "uma", "para"},
+	"it": {"il", "di", "che", "per", "un", "non", "sono", "della", "gli", "anche"},
+	"nl": {"het", "een", "en", "van", "is", "dat", "niet", "op", "zijn", "voor"},
+}
+
+// detectLanguage returns the page's primary language as a lowercase ISO 639-1
+// code. A declared language wins unless the text is plainly in another script
+// (templates often hardcode lang="en").
+func detectLanguage(doc *html.Node, text string) string {
+	declared := declaredLanguage(doc)
+	detected := scriptLanguage(text)
+
+	switch {
+	case detected != "" && declared != detected && !(detected == "zh" && declared == "ja"):
+		return detected
+	case declared != "":
+		return declared
+	default:
+		return stopwordLanguage(text)
+	}
+}
+
+// declaredLanguage reads <html lang>, Content-Language or og:locale
+func declaredLanguage(doc *html.Node) string {
+	if htmlNode := findElement(doc, "html"); htmlNode != nil {
+		for _, attr := range htmlNode.Attr {
+			if attr.Key == "lang" || attr.Key == "xml:lang" {
+				if lang := primarySubtag(attr.Val); lang != "" {
+					return lang
+				}
+			}
+		}
+	}
+
+	lang := ""
+	var traverse func(*html.Node)
+	traverse = func(n *html.Node) {
+		if lang != "" {
+			return
+		}
+		if n.Type == html.ElementNode && n.Data == "meta" {
+			var key, content string
+			for _, attr := range n.Attr {
+				switch strings.ToLower(attr.Key) {
+				case "http-equiv", "property":
+					key = strings.ToLower(attr.Val)
+				case "content":
+					content = attr.Val
+				}
+			}
+			if key == "content-language" || key == "og:locale" {
+				lang = primarySubtag(content)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			traverse(c)
+		}
+	}
+	traverse(doc)
+	return lang
+}
+
+// primarySubtag returns the language part of a tag such as en-US or zh_CN
+func primarySubtag(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_,; "); i >= 0 {
+		tag = tag[:i]
+	}
+	if len(tag) < 2 || len(tag) > 3 {
+		return ""
+	}
+	return tag
+}
+
+// scriptLanguage guesses the language from the dominant non-Latin script.
+// Japanese text mixes kana into Han, so any notable kana means Japanese.
+func scriptLanguage(text string) string {
+	counts := make(map[string]int)
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for _, s := range scriptLanguages {
+			if unicode.Is(s.table, r) {
+				counts[s.lang]++
+				break
+			}
+		}
+	}
+	if letters == 0 {
+		return ""
+	}
+
+	if counts["ja"]*10 >= letters {
+		return "ja"
+	}
+	best, bestCount := "", 0
+	for _, s := range scriptLanguages {
+		if counts[s.lang] > bestCount {
+			best, bestCount = s.lang, counts[s.lang]
+		}
+	}
+	// The script must dominate the text
+	if bestCount*10 < letters*3 {
+		return ""
+	}
+	return best
+}
+
+// stopwordLanguage guesses a Latin-script language from common words
+func stopwordLanguage(text string) string {
+	counts := make(map[string]int)
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		word = strings.Trim(word, ".,;:!?\"'()[]")
+		for lang, words := range stopwords {
+			for _, sw := range words {
+				if word == sw {
+					counts[lang]++
+				}
+			}
+		}
+	}
+
+	best, bestCount := "", 2 // need at least 3 hits
+	for lang, count := range counts {
+		if count > bestCount || (count == bestCount && lang < best) {
+			best, bestCount = lang, count
+		}
+	}
+	return best
+}
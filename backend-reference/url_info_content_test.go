@@ -0,0 +1,179 @@
+// Package handler tests for main-content extraction
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const articleFixture = `<!DOCTYPE html>
+<html lang="en-US">
+<head><title>Post</title></head>
+<body>
+	<nav class="menu"><a href="/">Home</a> <a href="/about">About</a> <a href="/blog">Blog</a></nav>
+	<div class="sidebar"><p>Subscribe to our newsletter, follow us, share this, and read more posts.</p></div>
+	<article class="post-content">
+		<p>The quick brown fox jumps over the lazy dog, which is a sentence used for typing practice.</p>
+		<p>It contains every letter of the alphabet, and it has been <a href="https://en.wikipedia.org/wiki/Pangram">described</a> as a pangram.</p>
+		<p>Related work is <a href="/archive">in the archive</a> and <a href="https://www.example.com/x">on our site</a>.</p>
+	</article>
+	<footer><p>Copyright 2024, all rights reserved, example company incorporated.</p></footer>
+</body>
+</html>`
+
+func TestSummarizeContent_Article(t *testing.T) {
+	page := testPage(t, "https://example.com/post", articleFixture)
+	page.analyze = true
+	found, err := contentExtractor{}.Extract(context.Background(), page, NewExtraction(""))
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+
+	summary := found.Content
+	if summary == nil {
+		t.Fatal("Expected a content summary")
+	}
+	if summary.WordCount != 42 {
+		t.Errorf("Expected 42 words, got %d", summary.WordCount)
+	}
+	if summary.ReadingTimeMinutes != 1 {
+		t.Errorf("Expected 1 minute, got %d", summary.ReadingTimeMinutes)
+	}
+	if !strings.HasPrefix(summary.Excerpt, "The quick brown fox") {
+		t.Errorf("Excerpt should start with the article, got %q", summary.Excerpt)
+	}
+	if strings.Contains(summary.Excerpt, "newsletter") || strings.Contains(summary.Excerpt, "Copyright") {
+		t.Errorf("Excerpt includes boilerplate: %q", summary.Excerpt)
+	}
+	// Only the Wikipedia link leaves the site
+	if summary.OutboundLinks != 1 {
+		t.Errorf("Expected 1 outbound link, got %d", summary.OutboundLinks)
+	}
+	if summary.Language != "en" {
+		t.Errorf("Expected language en, got %q", summary.Language)
+	}
+	if found.Get(FieldDescription) != summary.Excerpt {
+		t.Error("Excerpt should be proposed as a fallback description")
+	}
+}
+
+func TestCountWords_CJK(t *testing.T) {
+	tests := []struct {
+		text       string
+		words, cjk int
+	}{
+		{"Hello, world! It's a well-known test.", 6, 0},
+		{"这是一个测试", 0, 6},
+		{"Go语言很好 and fast", 3, 4},
+		{"日本語のテキスト", 0, 8},
+		{"한국어 텍스트 입니다", 3, 0},
+	}
+
+	for _, tt := range tests {
+		words, cjk := countWords(tt.text)
+		if words != tt.words || cjk != tt.cjk {
+			t.Errorf("countWords(%q) = %d, %d; want %d, %d", tt.text, words, cjk, tt.words, tt.cjk)
+		}
+	}
+}
+
+func TestSummarizeContent_ReadingTime(t *testing.T) {
+	english := strings.Repeat("word ", 1000)
+	chinese := strings.Repeat("中文内容", 500)
+
+	tests := []struct {
+		name    string
+		text    string
+		minutes int
+	}{
+		{"english", english, 5}, // 1000 / 230
+		{"chinese", chinese, 4}, // 2000 / 500
+		{"mixed", english + chinese, 9},
+	}
+
+	for _, tt := range tests {
+		page := testPage(t, "https://example.com/", "<html><body><div><p>"+tt.text+"</p></div></body></html>")
+		doc, _ := page.Document()
+		summary := summarizeContent(doc, page.URL)
+		if summary.ReadingTimeMinutes != tt.minutes {
+			t.Errorf("%s: expected %d minutes, got %d", tt.name, tt.minutes, summary.ReadingTimeMinutes)
+		}
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		name, body, want string
+	}{
+		{"declared", `<html lang="fr-CA"><body><p>Bonjour</p></body></html>`, "fr"},
+		{"meta", `<html><head><meta http-equiv="Content-Language" content="de"></head><body></body></html>`, "de"},
+		{"script overrides template default", `<html lang="en"><body><p>这是一篇关于互联网的中文文章，内容很长。</p></body></html>`, "zh"},
+		{"japanese kana", `<html><body><p>これは日本語の記事です。</p></body></html>`, "ja"},
+		{"korean", `<html><body><p>이것은 한국어 기사입니다.</p></body></html>`, "ko"},
+		{"stopwords", `<html><body><p>El perro y el gato de la casa son los mejores amigos para una familia.</p></body></html>`, "es"},
+		{"unknown", `<html><body><p>Lorem ipsum</p></body></html>`, ""},
+	}
+
+	for _, tt := range tests {
+		page := testPage(t, "https://example.com/", tt.body)
+		doc, _ := page.Document()
+		summary := summarizeContent(doc, page.URL)
+		if summary.Language != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, summary.Language)
+		}
+	}
+}
+
+func TestExcerpt_Truncates(t *testing.T) {
+	text := strings.Repeat("lorem ipsum ", 50)
+	got := excerpt(text, 40)
+	if !strings.HasSuffix(got, "…") || len([]rune(got)) > 41 {
+		t.Errorf("Unexpected excerpt %q", got)
+	}
+	if strings.HasSuffix(strings.TrimSuffix(got, "…"), " ") {
+		t.Errorf("Excerpt should not end in whitespace: %q", got)
+	}
+
+	if excerpt("short", 40) != "short" {
+		t.Error("Short text should be returned unchanged")
+	}
+}
+
+func TestURLInfoHandler_DetailFull(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(articleFixture))
+	}))
+	defer server.Close()
+	allowLoopbackForTest(t)
+
+	get := func(query string) *URLMetadata {
+		req := httptest.NewRequest("GET", "/client/common/urlInfo?url="+server.URL+query, nil)
+		w := httptest.NewRecorder()
+		URLInfoHandler(w, req)
+
+		var response URLInfoResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if response.Data == nil {
+			t.Fatal("Expected data in response")
+		}
+		return response.Data
+	}
+
+	if data := get(""); data.Content != nil {
+		t.Error("Content should be omitted without detail=full")
+	}
+	if data := get("&detail=full"); data.Content == nil || data.Content.WordCount == 0 {
+		t.Errorf("Expected content with detail=full, got %+v", data.Content)
+	}
+	// The cached entry must not have been stripped by the first request
+	if data := get(""); data.Content != nil {
+		t.Error("Content should still be omitted after a detailed request")
+	}
+}
@@ -0,0 +1,127 @@
+// Document metadata
+// Links to PDFs, images and audio or video files are described instead of
+// failing as "not an HTML page": the title, author, date and page count of a
+// PDF, the image itself as the cover, and the type and size of media files.
+// Other non-HTML responses are still reported as not_html.
+
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"mime"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Kinds of non-HTML pages the fetcher extracts metadata from
+const (
+	documentPDF   = "pdf"
+	documentImage = "image"
+	documentMedia = "media" // audio and video; only the headers are used
+)
+
+// DocumentInfo describes a link to a file rather than a web page
+type DocumentInfo struct {
+	MIMEType string `json:"mimeType"`
+	Size     int64  `json:"size,omitempty"`  // bytes, from Content-Length
+	Pages    int    `json:"pages,omitempty"` // PDFs
+	Width    int    `json:"width,omitempty"` // images
+	Height   int    `json:"height,omitempty"`
+}
+
+// documentKind classifies a non-HTML response, or returns "" when it has no
+// metadata worth extracting. PDFs served as a generic binary are recognized
+// by their extension.
+func documentKind(contentType string, u *url.URL) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/pdf", mediaType == "application/x-pdf":
+		return documentPDF
+	case strings.HasPrefix(mediaType, "image/"):
+		return documentImage
+	case strings.HasPrefix(mediaType, "audio/"), strings.HasPrefix(mediaType, "video/"):
+		return documentMedia
+	case mediaType == "application/octet-stream" || mediaType == "binary/octet-stream" || mediaType == "":
+		if strings.EqualFold(path.Ext(u.Path), ".pdf") {
+			return documentPDF
+		}
+	}
+	return ""
+}
+
+// documentPipeline is the chain for non-HTML pages: site-specific extractors
+// (an arXiv PDF is still a paper), the document extractor, the placeholder for
+// an image and format classification
+func documentPipeline() *Pipeline {
+	chain := append([]Extractor{}, siteExtractors...)
+	chain = append(chain, documentExtractor{}, placeholderExtractor{}, formatExtractor{})
+	return NewPipeline(chain...)
+}
+
+// documentExtractor describes a PDF, image or media file
+type documentExtractor struct{}
+
+func (documentExtractor) Name() string { return "document" }
+
+func (documentExtractor) Extract(_ context.Context, page *Page, _ *Extraction) (result *Extraction, err error) {
+	if page.FileKind == "" {
+		return nil, nil
+	}
+	// The file parsers read untrusted bytes; a bug in them fails this
+	// extractor, leaving partial metadata, instead of the process
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, fmt.Errorf("parsing %s: %v", page.FileKind, r)
+		}
+	}()
+
+	mediaType, _, _ := mime.ParseMediaType(page.ContentType)
+	if page.FileKind == documentPDF {
+		mediaType = "application/pdf"
+	}
+	info := &DocumentInfo{MIMEType: mediaType}
+	if size, err := strconv.ParseInt(page.Header.Get("Content-Length"), 10, 64); err == nil && size > 0 {
+		info.Size = size
+	}
+
+	result = NewExtraction("document")
+	result.Document = info
+
+	// The file name is better than nothing
+	if name, err := url.PathUnescape(path.Base(page.URL.Path)); err == nil && name != "/" && name != "." {
+		result.Set(FieldTitle, name, ConfidenceGuess)
+	}
+
+	switch page.FileKind {
+	case documentPDF:
+		pdf := parsePDF(page.Body)
+		info.Pages = pdf.Pages
+		result.Set(FieldTitle, pdf.Title, ConfidenceHigh)
+		result.Set(FieldAuthor, pdf.Author, ConfidenceHigh)
+		result.Set(FieldDescription, pdf.Subject, ConfidenceHigh)
+		result.Set(FieldKeywords, pdf.Keywords, ConfidenceHigh)
+		result.Set(FieldPublishedAt, pdf.CreatedAt, ConfidenceHigh)
+
+	case documentImage:
+		imageURL := page.URL.String()
+		candidate := ImageCandidate{URL: imageURL, Source: ImageSourceDocument, MIMEType: imageMIMEType(page.Body, page.ContentType)}
+		if cfg, _, err := image.DecodeConfig(bytes.NewReader(page.Body)); err == nil {
+			candidate.Width, candidate.Height = cfg.Width, cfg.Height
+			info.Width, info.Height = cfg.Width, cfg.Height
+		}
+		result.Images = []ImageCandidate{candidate}
+		result.Set(FieldImage, imageURL, ConfidenceVerified)
+
+		// The placeholder and the mirror use the body instead of downloading
+		// the image again
+		if !page.Truncated {
+			page.cover = &downloadedImage{URL: imageURL, Data: page.Body, ContentType: page.ContentType, Header: page.Header}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,117 @@
+// Package handler tests for document metadata
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"testing"
+)
+
+func TestFetcher_DescribesFiles(t *testing.T) {
+	cover := testImage(t, 120, 80, encodePNG)
+	pdf := testPDF("<< /Root 1 0 R /Info 3 0 R >>",
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [] /Count 7 >>",
+		"<< /Title (Annual Report) /Author (Finance Team) /CreationDate (D:20250110) >>",
+	)
+
+	var requests, mediaBytesRead atomic.Int32
+	fetcher := NewFetcher(FetcherConfig{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requests.Add(1)
+		switch req.URL.Path {
+		case "/annual report.pdf":
+			return cannedResponse(req, http.StatusOK, "application/pdf", string(pdf)), nil
+		case "/download/report.pdf":
+			return cannedResponse(req, http.StatusOK, "application/octet-stream", string(pdf)), nil
+		case "/photo.png":
+			return cannedResponse(req, http.StatusOK, "image/png", string(cover)), nil
+		case "/episode.mp3":
+			resp := cannedResponse(req, http.StatusOK, "audio/mpeg", "")
+			resp.Header.Set("Content-Length", "48000000")
+			resp.Body = io.NopCloser(readerFunc(func(p []byte) (int, error) {
+				mediaBytesRead.Add(int32(len(p)))
+				return 0, io.EOF
+			}))
+			return resp, nil
+		}
+		return cannedResponse(req, http.StatusNotFound, "text/plain", ""), nil
+	})})
+	ctx := context.Background()
+
+	metadata, err := fetcher.Fetch(ctx, "https://example.com/annual%20report.pdf")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if metadata.Title != "Annual Report" || metadata.Author != "Finance Team" || metadata.PublishedAt != "2025-01-10" {
+		t.Errorf("Unexpected PDF metadata %+v", metadata)
+	}
+	if metadata.FetchStatus != FetchStatusOK || metadata.Format != FormatDocument {
+		t.Errorf("Expected an ok document, got %s %s", metadata.FetchStatus, metadata.Format)
+	}
+	if d := metadata.Document; d == nil || d.MIMEType != "application/pdf" || d.Pages != 7 {
+		t.Errorf("Unexpected document info %+v", d)
+	}
+
+	// Served as a generic binary, recognized by the extension
+	metadata, _ = fetcher.Fetch(ctx, "https://example.com/download/report.pdf")
+	if metadata.Title != "Annual Report" || metadata.Document == nil || metadata.Document.MIMEType != "application/pdf" {
+		t.Errorf("Expected the PDF to be recognized, got %+v", metadata)
+	}
+
+	// The image is its own cover, downloaded once
+	before := requests.Load()
+	metadata, _ = fetcher.Fetch(ctx, "https://example.com/photo.png")
+	if metadata.OgImage != "https://example.com/photo.png" || metadata.Format != FormatImage || metadata.Title != "photo.png" {
+		t.Errorf("Unexpected image metadata %+v", metadata)
+	}
+	if d := metadata.Document; d == nil || d.Width != 120 || d.Height != 80 {
+		t.Errorf("Unexpected image dimensions %+v", d)
+	}
+	if len(metadata.Images) != 1 || metadata.Images[0].Source != ImageSourceDocument || metadata.Images[0].MIMEType != "image/png" {
+		t.Errorf("Unexpected image candidates %+v", metadata.Images)
+	}
+	if metadata.Placeholder == nil || metadata.Placeholder.Width != 120 {
+		t.Errorf("Expected a placeholder, got %+v", metadata.Placeholder)
+	}
+	if n := requests.Load() - before; n != 1 {
+		t.Errorf("Expected one request for the image, got %d", n)
+	}
+
+	// Audio is described from its headers without reading the body
+	metadata, _ = fetcher.Fetch(ctx, "https://example.com/episode.mp3")
+	if d := metadata.Document; d == nil || d.MIMEType != "audio/mpeg" || d.Size != 48000000 {
+		t.Errorf("Unexpected media info %+v", d)
+	}
+	if metadata.Format != FormatAudio || metadata.Title != "episode.mp3" || mediaBytesRead.Load() != 0 {
+		t.Errorf("Unexpected media metadata %+v (read %d bytes)", metadata, mediaBytesRead.Load())
+	}
+}
+
+// readerFunc adapts a function to io.Reader
+type readerFunc func([]byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) { return f(p) }
+
+func TestDocumentKind(t *testing.T) {
+	testCases := []struct {
+		contentType, path, expected string
+	}{
+		{"application/pdf", "/a", documentPDF},
+		{"application/octet-stream", "/paper.PDF", documentPDF},
+		{"application/octet-stream", "/setup.exe", ""},
+		{"image/webp", "/a", documentImage},
+		{"video/mp4; codecs=avc1", "/a", documentMedia},
+		{"audio/ogg", "/a", documentMedia},
+		{"application/zip", "/a.pdf", ""},
+		{"text/plain", "/notes.txt", ""},
+	}
+	for _, tc := range testCases {
+		u, _ := url.Parse("https://example.com" + tc.path)
+		if got := documentKind(tc.contentType, u); got != tc.expected {
+			t.Errorf("%s %s: expected %q, got %q", tc.contentType, tc.path, tc.expected, got)
+		}
+	}
+}
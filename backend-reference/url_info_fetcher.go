@@ -0,0 +1,547 @@
+// Configurable page and resource fetcher
+// A Fetcher owns everything outbound: the HTTP client and its SSRF-checked
+// transport, robots.txt cache, per-host throttle and metadata cache. Handlers
+// take one through their constructors; the package-level handlers use
+// DefaultFetcher. Callers pass their request context so a client that goes
+// away cancels the fetch.
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Fetch defaults, used for zero FetcherConfig fields
+const (
+	defaultFetchTimeout   = 10 * time.Second
+	defaultConnectTimeout = 10 * time.Second
+	defaultMaxRedirects   = 5
+	defaultMaxPageBytes   = 5 * 1024 * 1024
+	defaultUserAgent      = "Mozilla/5.0 (compatible; CopusBot/1.0; +https://copus.network)"
+)
+
+// ErrDomainNotAllowed is returned for URLs outside the fetcher's allow list or
+// on its deny list
+var ErrDomainNotAllowed = errors.New("domain is not allowed")
+
+// errNotModified is returned by fetchPage when a conditional request gets a 304
+var errNotModified = errors.New("not modified")
+
+// FetcherConfig configures a Fetcher. Zero values use defaults.
+type FetcherConfig struct {
+	Timeout        time.Duration // whole page fetch, including extractor sub-requests
+	ConnectTimeout time.Duration // dial and TLS handshake
+	MaxPageBytes   int64
+	MaxRedirects   int
+	UserAgent      string
+
+	// Transport replaces the SSRF-checked transport, e.g. to serve canned
+	// responses in tests. Host name checks still apply; address checks are
+	// up to the transport.
+	Transport http.RoundTripper
+
+	// Proxy routes requests through an HTTP proxy. The dial-time address check
+	// would only see the proxy, so target hosts are resolved and checked
+	// before each request instead.
+	Proxy func(*http.Request) (*url.URL, error)
+
+	// AllowDomains, when set, limits page fetches to these domains and their
+	// subdomains. DenyDomains are never fetched, not even for sub-resources.
+	AllowDomains []string
+	DenyDomains  []string
+
+	// SkipContent turns off main-content analysis, so ?detail=full has no
+	// content section and FetchFull is the same as Fetch
+	SkipContent bool
+
+	// Media, when set, mirrors each page's cover image into object storage
+	Media *MediaMirror
+
+	// Archive, when set, keeps a WARC snapshot of each fetched page and its
+	// cover image
+	Archive *WebArchive
+
+	// Cache stores metadata; defaults to an in-memory LRU
+	Cache       CacheBackend
+	CacheConfig MetadataCacheConfig
+
+	// Now is the clock for caches and throttling
+	Now func() time.Time
+}
+
+// Fetcher downloads pages and sub-resources and extracts metadata
+type Fetcher struct {
+	config   FetcherConfig
+	client   *http.Client
+	throttle *hostThrottle
+	robots   *robotsCache
+	cache    *MetadataCache
+}
+
+// NewFetcher creates a Fetcher from config
+func NewFetcher(config FetcherConfig) *Fetcher {
+	if config.Timeout <= 0 {
+		config.Timeout = defaultFetchTimeout
+	}
+	if config.ConnectTimeout <= 0 {
+		config.ConnectTimeout = defaultConnectTimeout
+	}
+	if config.MaxPageBytes <= 0 {
+		config.MaxPageBytes = defaultMaxPageBytes
+	}
+	if config.MaxRedirects <= 0 {
+		config.MaxRedirects = defaultMaxRedirects
+	}
+	if config.UserAgent == "" {
+		config.UserAgent = defaultUserAgent
+	}
+	if config.Cache == nil {
+		config.Cache = NewLRUCache(defaultCacheCapacity)
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+	config.AllowDomains = lowerDomains(config.AllowDomains)
+	config.DenyDomains = lowerDomains(config.DenyDomains)
+
+	f := &Fetcher{config: config}
+
+	f.throttle = newHostThrottle(hostRequestInterval, hostRequestBurst)
+	f.throttle.now = config.Now
+	f.robots = newRobotsCache(f)
+	f.robots.now = config.Now
+	f.cache = newMetadataCache(config.Cache, config.CacheConfig)
+	f.cache.load = f.load
+	f.cache.now = config.Now
+
+	transport := config.Transport
+	if transport == nil {
+		transport = newSafeTransport(config.ConnectTimeout, config.Proxy)
+	}
+	f.client = &http.Client{
+		Timeout:       config.Timeout,
+		Transport:     &throttledTransport{next: transport, throttle: f.throttle},
+		CheckRedirect: f.redirectPolicy,
+	}
+	return f
+}
+
+// DefaultFetcher backs URLInfoHandler, SimpleURLInfoHandler and
+// BatchURLInfoHandler
+var DefaultFetcher = NewFetcher(FetcherConfig{})
+
+// Cache returns the fetcher's metadata cache
+func (f *Fetcher) Cache() *MetadataCache {
+	return f.cache
+}
+
+// Validate normalizes a user-supplied URL and rejects private hosts and
+// domains the fetcher may not fetch
+func (f *Fetcher) Validate(rawURL string) (string, error) {
+	normalized, err := validateAndNormalizeURL(rawURL)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(normalized)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse URL: %v", err)
+	}
+	if err := f.checkDomain(u.Hostname(), true); err != nil {
+		return "", err
+	}
+	return normalized, nil
+}
+
+// checkDomain applies the deny list, and for pages the allow list
+func (f *Fetcher) checkDomain(host string, page bool) error {
+	if hostMatches(host, f.config.DenyDomains) {
+		return fmt.Errorf("%w: %s", ErrDomainNotAllowed, host)
+	}
+	if page && len(f.config.AllowDomains) > 0 && !hostMatches(host, f.config.AllowDomains) {
+		return fmt.Errorf("%w: %s", ErrDomainNotAllowed, host)
+	}
+	return nil
+}
+
+// Fetch returns metadata for a validated URL, from cache when fresh. The
+// main-content analysis is skipped, so a page whose <head> has a title,
+// description and image is never parsed into a DOM.
+func (f *Fetcher) Fetch(ctx context.Context, targetURL string) (*URLMetadata, error) {
+	return f.cache.Fetch(ctx, targetURL)
+}
+
+// FetchFull is Fetch with the main-content analysis that ?detail=full serves
+// in URLMetadata.Content. A cached entry without it is refetched once.
+func (f *Fetcher) FetchFull(ctx context.Context, targetURL string) (*URLMetadata, error) {
+	return f.cache.fetch(ctx, targetURL, !f.config.SkipContent)
+}
+
+// fetchDetail is Fetch or, for detail=full, FetchFull
+func (f *Fetcher) fetchDetail(ctx context.Context, targetURL, detail string) (*URLMetadata, error) {
+	if detail == "full" {
+		return f.FetchFull(ctx, targetURL)
+	}
+	return f.Fetch(ctx, targetURL)
+}
+
+// load fetches and extracts metadata into a cache entry. With validators it
+// makes a conditional request and may return errNotModified; with analyze it
+// includes the main-content analysis.
+func (f *Fetcher) load(ctx context.Context, targetURL string, validators *pageValidators, analyze bool) (*CacheEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, f.config.Timeout)
+	defer cancel()
+
+	page, err := f.fetchPage(ctx, targetURL, validators)
+	pipeline := defaultPipeline()
+	var fetchErr error
+	switch {
+	case err != nil:
+		// Sites that serve crawlers a login wall can still be described
+		// through their APIs
+		page, pipeline = f.pagelessFallback(targetURL, err)
+		if page == nil {
+			return nil, err
+		}
+		fetchErr = err
+	case page.FileKind != "":
+		pipeline = documentPipeline()
+	}
+	page.analyze = analyze
+
+	// Run the extractor chain over the page
+	metadata, err := pipeline.Run(ctx, page)
+	if fetchErr != nil && (err != nil || metadata.Site == nil) {
+		return nil, fetchErr
+	}
+	if err != nil {
+		return nil, &FetchError{
+			HTTPStatus:    page.StatusCode,
+			FinalURL:      page.URL.String(),
+			RedirectChain: page.RedirectChain,
+			Err:           fmt.Errorf("failed to parse HTML: %w", err),
+		}
+	}
+
+	if page.Truncated || fetchErr != nil {
+		metadata.FetchStatus = FetchStatusPartial
+	}
+	if metadata.FetchStatus == "" {
+		metadata.FetchStatus = FetchStatusOK
+	}
+	metadata.HTTPStatus = page.StatusCode
+	metadata.FinalURL = page.URL.String()
+	metadata.RedirectChain = page.RedirectChain
+	metadata.RedirectPermanent = page.RedirectPermanent
+
+	// The mirror and the archive share one download of the cover, usually
+	// the placeholder extractor's
+	coverMaxBytes := int64(defaultMirrorMaxBytes)
+	if f.config.Media != nil {
+		coverMaxBytes = f.config.Media.config.MaxBytes
+	}
+	cover := func() (*downloadedImage, error) {
+		if page.cover == nil || page.cover.URL != metadata.OgImage {
+			image, err := downloadImage(ctx, f, metadata.OgImage, coverMaxBytes)
+			if err != nil {
+				return nil, err
+			}
+			page.cover = image
+		}
+		return page.cover, nil
+	}
+
+	// A cover that cannot be mirrored is still served by its original URL
+	if f.config.Media != nil && metadata.OgImage != "" {
+		mirror, err := f.config.Media.mirror(ctx, metadata.OgImage, cover)
+		if err != nil {
+			slog.Warn("urlInfo cover mirroring failed",
+				slog.String("url", targetURL),
+				slog.String("image", metadata.OgImage),
+				slog.Any("error", err),
+			)
+		}
+		metadata.Mirror = mirror
+	}
+
+	// Audio and video are never downloaded, so there is nothing to keep
+	if f.config.Archive != nil && page.FileKind != documentMedia && fetchErr == nil {
+		// A page whose cover cannot be downloaded is still worth keeping
+		var image *downloadedImage
+		if metadata.OgImage != "" {
+			image, _ = cover()
+		}
+		if err := f.config.Archive.capture(ctx, targetURL, page, image); err != nil {
+			slog.Warn("urlInfo page archiving failed",
+				slog.String("url", targetURL),
+				slog.Any("error", err),
+			)
+		}
+	}
+
+	return &CacheEntry{
+		Metadata: metadata,
+		Analyzed: analyze,
+		Validators: pageValidators{
+			ETag:         page.Header.Get("ETag"),
+			LastModified: page.Header.Get("Last-Modified"),
+		},
+	}, nil
+}
+
+// pagelessFallback prepares a page without a body for the site extractors
+// that work from the URL alone, when fetching the page failed with err. It
+// returns a nil page when there are none, or when err is a refusal: ours, the
+// site's robots.txt or the throttle.
+func (f *Fetcher) pagelessFallback(targetURL string, err error) (*Page, *Pipeline) {
+	for _, refusal := range []error{errNotModified, ErrBlockedAddress, ErrDomainNotAllowed, ErrRobotsDisallowed, errHostThrottled} {
+		if errors.Is(err, refusal) {
+			return nil, nil
+		}
+	}
+	u, parseErr := url.Parse(targetURL)
+	if parseErr != nil {
+		return nil, nil
+	}
+
+	var chain []Extractor
+	for _, e := range siteExtractors {
+		site, ok := e.(SiteExtractor)
+		if !ok || !hostMatches(u.Hostname(), site.Hosts) {
+			continue
+		}
+		if _, ok := site.Extractor.(pagelessExtractor); ok {
+			chain = append(chain, site)
+		}
+	}
+	if len(chain) == 0 {
+		return nil, nil
+	}
+
+	page := &Page{URL: u, Header: http.Header{}, fetcher: f}
+	var fetchErr *FetchError
+	if errors.As(err, &fetchErr) {
+		page.StatusCode = fetchErr.HTTPStatus
+	}
+	chain = append(chain, imageExtractor{}, placeholderExtractor{}, formatExtractor{})
+	return page, NewPipeline(chain...)
+}
+
+// fetchPage downloads an HTML page, or a file described by documentKind, for
+// the extractors
+func (f *Fetcher) fetchPage(ctx context.Context, targetURL string, validators *pageValidators) (*Page, error) {
+	// Create HTTP request
+	req, err := http.NewRequestWithContext(ctx, "GET", targetURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	// Diagnostics reported with a failure
+	finalURL := req.URL.String()
+	var chain []string
+	permanent := true
+	fail := func(httpStatus int, contentType string, err error) error {
+		return &FetchError{
+			HTTPStatus:    httpStatus,
+			FinalURL:      finalURL,
+			RedirectChain: chain,
+			ContentType:   contentType,
+			Err:           err,
+		}
+	}
+
+	if err := f.checkDomain(req.URL.Hostname(), true); err != nil {
+		return nil, fail(0, "", err)
+	}
+
+	// Honor robots.txt before the first byte is requested
+	if err := f.robots.check(ctx, req.URL); err != nil {
+		return nil, fail(0, "", err)
+	}
+
+	// Revalidate a cached copy instead of downloading it again
+	if validators != nil {
+		if validators.ETag != "" {
+			req.Header.Set("If-None-Match", validators.ETag)
+		}
+		if validators.LastModified != "" {
+			req.Header.Set("If-Modified-Since", validators.LastModified)
+		}
+	}
+
+	// Set headers to mimic a browser request
+	req.Header.Set("User-Agent", f.config.UserAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	req.Header.Set("Accept-Language", "en-US,en;q=0.5")
+
+	// Every redirect hop is re-checked, including against the allow list and
+	// the robots.txt of the hop's origin
+	client := *f.client
+	client.CheckRedirect = func(next *http.Request, via []*http.Request) error {
+		chain = chain[:0]
+		for _, hop := range via {
+			chain = append(chain, hop.URL.String())
+		}
+		finalURL = next.URL.String()
+		if code := next.Response.StatusCode; code != http.StatusMovedPermanently && code != http.StatusPermanentRedirect {
+			permanent = false
+		}
+
+		if err := f.redirectPolicy(next, via); err != nil {
+			return err
+		}
+		if err := f.checkDomain(next.URL.Hostname(), true); err != nil {
+			return err
+		}
+		return f.robots.check(next.Context(), next.URL)
+	}
+
+	// Make the request
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fail(0, "", fmt.Errorf("failed to fetch URL: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && validators != nil {
+		return nil, errNotModified
+	}
+
+	// Check status code
+	if resp.StatusCode != http.StatusOK {
+		return nil, fail(resp.StatusCode, "", &HTTPStatusError{StatusCode: resp.StatusCode})
+	}
+
+	// Check content type - parse HTML, and describe the files we know
+	contentType := resp.Header.Get("Content-Type")
+	var kind string
+	if !strings.Contains(contentType, "text/html") && !strings.Contains(contentType, "application/xhtml") {
+		if kind = documentKind(contentType, resp.Request.URL); kind == "" {
+			return nil, fail(resp.StatusCode, contentType, fmt.Errorf("%w: %s", errNotHTML, contentType))
+		}
+	}
+
+	// Limit response body size; a page cut off by the limit or by a failed read
+	// is still worth extracting from, since the head comes first. Audio and
+	// video are described from the headers alone.
+	var body []byte
+	var truncated bool
+	if kind != documentMedia {
+		maxBytes := f.config.MaxPageBytes
+		body, err = io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+		if err != nil && len(body) == 0 {
+			return nil, fail(resp.StatusCode, contentType, fmt.Errorf("failed to read body: %w", err))
+		}
+		truncated = err != nil || int64(len(body)) > maxBytes
+		if int64(len(body)) > maxBytes {
+			body = body[:maxBytes]
+		}
+	}
+
+	// Extractors work on UTF-8 regardless of the page's declared encoding
+	raw := body
+	pageCharset := ""
+	if kind == "" {
+		body, pageCharset = decodeToUTF8(body, contentType)
+	}
+
+	return &Page{
+		URL:               resp.Request.URL,
+		RedirectChain:     chain,
+		RedirectPermanent: len(chain) > 0 && permanent,
+		StatusCode:        resp.StatusCode,
+		ContentType:       contentType,
+		Charset:           pageCharset,
+		Header:            resp.Header,
+		Body:              body,
+		Truncated:         truncated,
+		FileKind:          kind,
+		fetcher:           f,
+		raw:               raw,
+		response:          resp,
+	}, nil
+}
+
+// HTTPStatusError reports an unexpected HTTP status from the target
+type HTTPStatusError struct {
+	StatusCode int
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("received status code %d", e.StatusCode)
+}
+
+// Resource downloads a sub-resource such as oEmbed JSON with the same
+// protections as page fetches
+func (f *Fetcher) Resource(ctx context.Context, resourceURL, accept string, maxBytes int64) ([]byte, http.Header, error) {
+	return f.getResource(ctx, resourceURL, accept, maxBytes, false)
+}
+
+// ResourcePrefix downloads only the first maxBytes of a resource using a
+// Range request, e.g. to sniff an image's type and dimensions
+func (f *Fetcher) ResourcePrefix(ctx context.Context, resourceURL, accept string, maxBytes int64) ([]byte, http.Header, error) {
+	return f.getResource(ctx, resourceURL, accept, maxBytes, true)
+}
+
+func (f *Fetcher) getResource(ctx context.Context, resourceURL, accept string, maxBytes int64, ranged bool) ([]byte, http.Header, error) {
+	resourceURL, err := validateAndNormalizeURL(resourceURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", resourceURL, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	if err := f.checkDomain(req.URL.Hostname(), false); err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("User-Agent", f.config.UserAgent)
+	req.Header.Set("Accept", accept)
+	if ranged {
+		req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", maxBytes-1))
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch resource: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Servers that ignore Range answer 200 and are cut off below
+	if resp.StatusCode != http.StatusOK && !(ranged && resp.StatusCode == http.StatusPartialContent) {
+		return nil, nil, &HTTPStatusError{StatusCode: resp.StatusCode}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read body: %w", err)
+	}
+	return body, resp.Header, nil
+}
+
+// redirectPolicy limits redirects and re-validates every hop
+func (f *Fetcher) redirectPolicy(req *http.Request, via []*http.Request) error {
+	if err := safeRedirectPolicy(f.config.MaxRedirects)(req, via); err != nil {
+		return err
+	}
+	return f.checkDomain(req.URL.Hostname(), false)
+}
+
+// lowerDomains normalizes a domain list for hostMatches
+func lowerDomains(domains []string) []string {
+	var out []string
+	for _, d := range domains {
+		if d = strings.Trim(strings.ToLower(strings.TrimSpace(d)), "."); d != "" {
+			out = append(out, d)
+		}
+	}
+	return out
+}
@@ -0,0 +1,212 @@
+// Package handler tests for the configurable Fetcher
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// roundTripFunc serves requests in-process so Fetcher tests need no sockets
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// cannedResponse builds a response to req
+func cannedResponse(req *http.Request, status int, contentType, body string) *http.Response {
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}
+}
+
+// newCannedFetcher serves pages by URL; everything else, robots.txt
+// included, is a 404
+func newCannedFetcher(config FetcherConfig, pages map[string]string) *Fetcher {
+	config.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if body, ok := pages[req.URL.String()]; ok {
+			if strings.HasPrefix(body, "redirect:") {
+				resp := cannedResponse(req, http.StatusFound, "", "")
+				resp.Header.Set("Location", strings.TrimPrefix(body, "redirect:"))
+				return resp, nil
+			}
+			return cannedResponse(req, http.StatusOK, "text/html; charset=utf-8", body), nil
+		}
+		return cannedResponse(req, http.StatusNotFound, "text/plain", "not found"), nil
+	})
+	return NewFetcher(config)
+}
+
+func TestFetcher_InjectedTransport(t *testing.T) {
+	var userAgent string
+	fetcher := NewFetcher(FetcherConfig{
+		UserAgent: "TestBot/2.0",
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path == "/robots.txt" {
+				return cannedResponse(req, http.StatusNotFound, "", ""), nil
+			}
+			userAgent = req.Header.Get("User-Agent")
+			return cannedResponse(req, http.StatusOK, "text/html", `<html><head><title>Canned</title></head></html>`), nil
+		}),
+	})
+
+	metadata, err := fetcher.Fetch(context.Background(), "https://example.com/post")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if metadata.Title != "Canned" || metadata.FetchStatus != FetchStatusOK {
+		t.Errorf("Unexpected metadata %+v", metadata)
+	}
+	if userAgent != "TestBot/2.0" {
+		t.Errorf("Expected configured user agent, got %q", userAgent)
+	}
+}
+
+func TestFetcher_DomainLists(t *testing.T) {
+	fetcher := newCannedFetcher(FetcherConfig{
+		AllowDomains: []string{"Example.com"},
+		DenyDomains:  []string{"private.example.com"},
+	}, map[string]string{
+		"https://example.com/away": "redirect:https://elsewhere.test/",
+		"https://elsewhere.test/":  `<html><title>Elsewhere</title></html>`,
+	})
+
+	testCases := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://example.com/a", true},
+		{"https://www.example.com/a", true},
+		{"https://private.example.com/a", false},
+		{"https://elsewhere.test/", false},
+		{"https://notexample.com/", false},
+	}
+	for _, tc := range testCases {
+		_, err := fetcher.Validate(tc.url)
+		if tc.allowed != (err == nil) || (err != nil && !errors.Is(err, ErrDomainNotAllowed)) {
+			t.Errorf("For %s: expected allowed=%v, got %v", tc.url, tc.allowed, err)
+		}
+	}
+
+	// Redirects cannot leave the allow list either
+	req := httptest.NewRequest("GET", "/client/common/urlInfo?url=https://example.com/away", nil)
+	w := httptest.NewRecorder()
+	NewURLInfoHandler(fetcher)(w, req)
+
+	var response URLInfoResponse
+	json.NewDecoder(w.Body).Decode(&response)
+	if w.Code != http.StatusForbidden || response.Code != ErrCodeDomainNotAllowed {
+		t.Errorf("Expected 403 %s, got %d %q", ErrCodeDomainNotAllowed, w.Code, response.Code)
+	}
+}
+
+func TestFetcher_MaxPageBytes(t *testing.T) {
+	page := `<html><head><title>Long</title></head><body>` + strings.Repeat("<p>text</p>", 100) + `</body></html>`
+	fetcher := newCannedFetcher(FetcherConfig{MaxPageBytes: 200}, map[string]string{
+		"https://example.com/long": page,
+	})
+
+	metadata, err := fetcher.Fetch(context.Background(), "https://example.com/long")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if metadata.Title != "Long" || metadata.FetchStatus != FetchStatusPartial {
+		t.Errorf("Expected a partial result with the title, got %q/%s", metadata.Title, metadata.FetchStatus)
+	}
+}
+
+func TestFetcher_ClientDisconnectCancelsFetch(t *testing.T) {
+	var mu sync.Mutex
+	hang := true
+	fetcher := NewFetcher(FetcherConfig{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			mu.Lock()
+			wait := hang && req.URL.Path != "/robots.txt"
+			mu.Unlock()
+			if wait {
+				<-req.Context().Done()
+				return nil, req.Context().Err()
+			}
+			return cannedResponse(req, http.StatusOK, "text/html", `<title>Back</title>`), nil
+		}),
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	start := time.Now()
+	if _, err := fetcher.Fetch(ctx, "https://example.com/slow"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("Expected the fetch to stop when the caller went away")
+	}
+
+	// The abandoned fetch is not remembered as a failure
+	mu.Lock()
+	hang = false
+	mu.Unlock()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		metadata, err := fetcher.Fetch(context.Background(), "https://example.com/slow")
+		if err == nil && metadata.Title == "Back" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected a fresh fetch after cancellation, got %+v %v", metadata, err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCallGroup_SurvivesOneCallerLeaving(t *testing.T) {
+	var g callGroup
+	release := make(chan struct{})
+	fn := func(ctx context.Context) *CacheEntry {
+		select {
+		case <-release:
+			return &CacheEntry{Metadata: &URLMetadata{Title: "Shared"}}
+		case <-ctx.Done():
+			return &CacheEntry{Err: ctx.Err()}
+		}
+	}
+
+	leaving, cancel := context.WithCancel(context.Background())
+	left := make(chan error)
+	go func() {
+		_, err := g.Do(leaving, "key", fn)
+		left <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	stayed := make(chan *CacheEntry)
+	go func() {
+		entry, _ := g.Do(context.Background(), "key", fn)
+		stayed <- entry
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	cancel()
+	if err := <-left; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the leaving caller to get context.Canceled, got %v", err)
+	}
+
+	close(release)
+	if entry := <-stayed; entry.Err != nil || entry.Metadata.Title != "Shared" {
+		t.Errorf("Expected the remaining caller to get the result, got %+v", entry)
+	}
+}
@@ -0,0 +1,185 @@
+// Content format classification
+// Classifies a link as article, video, podcast, music, paper, repo, ... from
+// host rules, JSON-LD @type, the oEmbed type, og:type and the MIME type, so
+// search, taste profiles and discovery filters share one classification.
+
+package handler
+
+import (
+	"context"
+	"mime"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Content formats returned in URLMetadata.Format
+const (
+	FormatArticle    = "article"
+	FormatVideo      = "video"
+	FormatPodcast    = "podcast"
+	FormatMusic      = "music"
+	FormatAudio      = "audio" // audio that is neither podcast nor music
+	FormatPaper      = "paper"
+	FormatRepo       = "repo"
+	FormatImage      = "image"
+	FormatSocialPost = "social_post"
+	FormatBook       = "book"
+	FormatFilm       = "film"
+	FormatGame       = "game"
+	FormatApp        = "app"
+	FormatDocument   = "document" // PDFs and other files that are not papers
+)
+
+// formatHostRule classifies pages on a host, optionally only matching paths
+type formatHostRule struct {
+	hosts  []string
+	path   *regexp.Regexp // nil matches any path
+	format string
+}
+
+// formatHostRules are checked in order; more specific hosts come first
+// (music.youtube.com before youtube.com)
+var formatHostRules = []formatHostRule{
+	{[]string{"music.youtube.com", "music.apple.com", "soundcloud.com", "bandcamp.com", "tidal.com", "deezer.com"}, nil, FormatMusic},
+	{[]string{"youtube.com"}, regexp.MustCompile(`^/(watch|shorts/|live/|embed/)`), FormatVideo},
+	{[]string{"youtu.be", "vimeo.com", "twitch.tv", "dai.ly"}, nil, FormatVideo},
+	{[]string{"dailymotion.com"}, regexp.MustCompile(`^/video/`), FormatVideo},
+	{[]string{"tiktok.com"}, regexp.MustCompile(`^/@[^/]+/video/`), FormatVideo},
+	{[]string{"instagram.com"}, regexp.MustCompile(`^/(reels?|tv)/`), FormatVideo},
+	{[]string{"open.spotify.com"}, regexp.MustCompile(`^(/intl-[a-z-]+)?/(episode|show)/`), FormatPodcast},
+	{[]string{"open.spotify.com"}, regexp.MustCompile(`^(/intl-[a-z-]+)?/(track|album|playlist|artist)/`), FormatMusic},
+	{[]string{"podcasts.apple.com", "overcast.fm", "pocketcasts.com", "castbox.fm", "podcasts.google.com"}, nil, FormatPodcast},
+	{[]string{"arxiv.org"}, regexp.MustCompile(`^/(abs|pdf|html)/`), FormatPaper},
+	{[]string{"doi.org", "biorxiv.org", "medrxiv.org", "papers.ssrn.com", "pubmed.ncbi.nlm.nih.gov"}, nil, FormatPaper},
+	{[]string{"semanticscholar.org"}, regexp.MustCompile(`^/paper/`), FormatPaper},
+	{[]string{"openreview.net"}, regexp.MustCompile(`^/(forum|pdf)`), FormatPaper},
+	{[]string{"github.com", "gitlab.com", "codeberg.org", "bitbucket.org"}, regexp.MustCompile(`^/[^/]+/[^/]+`), FormatRepo},
+	{[]string{"twitter.com", "x.com"}, regexp.MustCompile(`^/[^/]+/status/`), FormatSocialPost},
+	{[]string{"threads.net", "bsky.app"}, regexp.MustCompile(`/post/`), FormatSocialPost},
+	{[]string{"reddit.com"}, regexp.MustCompile(`/comments/`), FormatSocialPost},
+	{[]string{"instagram.com"}, regexp.MustCompile(`^/p/`), FormatImage},
+	{[]string{"flickr.com", "unsplash.com"}, regexp.MustCompile(`^/photos/`), FormatImage},
+	{[]string{"dribbble.com"}, regexp.MustCompile(`^/shots/`), FormatImage},
+	{[]string{"behance.net"}, regexp.MustCompile(`^/gallery/`), FormatImage},
+	{[]string{"imdb.com"}, regexp.MustCompile(`^/title/`), FormatFilm},
+	{[]string{"letterboxd.com"}, regexp.MustCompile(`^/film/`), FormatFilm},
+	{[]string{"goodreads.com"}, regexp.MustCompile(`^/book/`), FormatBook},
+	{[]string{"openlibrary.org"}, regexp.MustCompile(`^/(works|books)/`), FormatBook},
+	{[]string{"store.steampowered.com"}, regexp.MustCompile(`^/app/`), FormatGame},
+	{[]string{"itch.io"}, regexp.MustCompile(`^/[^/]+`), FormatGame},
+	{[]string{"gog.com"}, regexp.MustCompile(`^(/[a-z]{2})?/game/`), FormatGame},
+	{[]string{"apps.apple.com", "chromewebstore.google.com"}, nil, FormatApp},
+	{[]string{"play.google.com"}, regexp.MustCompile(`^/store/apps/`), FormatApp},
+}
+
+// schemaFormats maps schema.org types to formats
+var schemaFormats = map[string]string{
+	"Article": FormatArticle, "NewsArticle": FormatArticle, "BlogPosting": FormatArticle,
+	"TechArticle": FormatArticle, "Report": FormatArticle, "AnalysisNewsArticle": FormatArticle,
+	"OpinionNewsArticle": FormatArticle, "ReviewNewsArticle": FormatArticle,
+	"LiveBlogPosting": FormatArticle, "Review": FormatArticle, "Recipe": FormatArticle,
+	"ScholarlyArticle": FormatPaper, "MedicalScholarlyArticle": FormatPaper,
+	"VideoObject": FormatVideo, "Clip": FormatVideo, "TVEpisode": FormatVideo, "TVSeries": FormatVideo,
+	"Movie": FormatFilm, "VideoGame": FormatGame, "Book": FormatBook,
+	"PodcastEpisode": FormatPodcast, "PodcastSeries": FormatPodcast, "PodcastSeason": FormatPodcast,
+	"MusicRecording": FormatMusic, "MusicAlbum": FormatMusic, "MusicPlaylist": FormatMusic, "MusicGroup": FormatMusic,
+	"AudioObject": FormatAudio, "SoftwareSourceCode": FormatRepo,
+	"SoftwareApplication": FormatApp, "MobileApplication": FormatApp, "WebApplication": FormatApp,
+	"ImageObject": FormatImage, "Photograph": FormatImage,
+	"SocialMediaPosting": FormatSocialPost, "DiscussionForumPosting": FormatSocialPost,
+}
+
+// ogTypeFormats maps og:type values to formats; prefixes end in "."
+var ogTypeFormats = map[string]string{
+	"video.":              FormatVideo,
+	"music.song":          FormatMusic,
+	"music.album":         FormatMusic,
+	"music.playlist":      FormatMusic,
+	"music.radio_station": FormatAudio,
+	"book":                FormatBook,
+	"books.book":          FormatBook,
+	"article":             FormatArticle,
+}
+
+// formatExtractor classifies the page from everything found so far
+type formatExtractor struct{}
+
+func (formatExtractor) Name() string { return "format" }
+
+func (formatExtractor) Extract(_ context.Context, page *Page, found *Extraction) (*Extraction, error) {
+	result := NewExtraction("format")
+
+	// Host rules know the site layout
+	result.Set(FieldFormat, hostFormat(page.URL), ConfidenceSite)
+
+	// Files served directly
+	result.Set(FieldFormat, mimeFormat(page.ContentType), ConfidenceHigh)
+
+	// Structured data, including types set by site extractors
+	result.Set(FieldFormat, schemaFormats[found.Get(FieldContentType)], ConfidenceHigh)
+
+	if found.Embed != nil {
+		switch found.Embed.Type {
+		case "video":
+			result.Set(FieldFormat, FormatVideo, ConfidenceMedium)
+		case "photo":
+			result.Set(FieldFormat, FormatImage, ConfidenceMedium)
+		}
+	}
+
+	result.Set(FieldFormat, ogTypeFormat(found.OGType), ConfidenceMedium)
+
+	// A page that is mostly a player, e.g. with og:video but no og:type
+	if found.Media != nil {
+		result.Set(FieldFormat, found.Media.Kind, ConfidenceLow)
+	}
+
+	// Most of the web is articles
+	result.Set(FieldFormat, FormatArticle, ConfidenceGuess)
+	return result, nil
+}
+
+// hostFormat applies the host rules to a URL
+func hostFormat(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	for _, rule := range formatHostRules {
+		if hostMatches(u.Hostname(), rule.hosts) && (rule.path == nil || rule.path.MatchString(u.Path)) {
+			return rule.format
+		}
+	}
+	return ""
+}
+
+// mimeFormat classifies non-HTML responses by MIME type
+func mimeFormat(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "image/"):
+		return FormatImage
+	case strings.HasPrefix(mediaType, "video/"):
+		return FormatVideo
+	case strings.HasPrefix(mediaType, "audio/"):
+		return FormatAudio
+	case mediaType == "application/pdf":
+		return FormatDocument
+	}
+	return ""
+}
+
+// ogTypeFormat maps an og:type value such as video.movie or music.song
+func ogTypeFormat(ogType string) string {
+	ogType = strings.ToLower(strings.TrimSpace(ogType))
+	if format, ok := ogTypeFormats[ogType]; ok {
+		return format
+	}
+	if i := strings.Index(ogType, "."); i > 0 {
+		return ogTypeFormats[ogType[:i+1]]
+	}
+	return ""
+}
@@ -0,0 +1,63 @@
+// Package handler tests for content format classification
+package handler
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFormatExtractor(t *testing.T) {
+	testCases := []struct {
+		name        string
+		url         string
+		contentType string
+		body        string
+		expected    string
+	}{
+		{"plain page", "https://example.com/post", "text/html", `<html><head><title>Post</title></head></html>`, FormatArticle},
+		{"youtube watch", "https://www.youtube.com/watch?v=dQw4w9WgXcQ", "text/html", `<html></html>`, FormatVideo},
+		{"youtube channel", "https://www.youtube.com/@channel", "text/html", `<html></html>`, FormatArticle},
+		{"youtube music", "https://music.youtube.com/watch?v=dQw4w9WgXcQ", "text/html", `<html></html>`, FormatMusic},
+		{"spotify episode", "https://open.spotify.com/episode/4rOoJ6Egrf8K2IrywzwOMk", "text/html", `<html></html>`, FormatPodcast},
+		{"spotify track", "https://open.spotify.com/intl-de/track/4PTG3Z6ehGkBFwjybzWkR8", "text/html", `<html></html>`, FormatMusic},
+		{"arxiv", "https://arxiv.org/abs/1706.03762", "text/html", `<html></html>`, FormatPaper},
+		{"github repo", "https://github.com/golang/go", "text/html", `<html></html>`, FormatRepo},
+		{"github profile", "https://github.com/golang", "text/html", `<html></html>`, FormatArticle},
+		{"tweet", "https://x.com/golang/status/1", "text/html", `<html></html>`, FormatSocialPost},
+		{"og:type video", "https://example.com/clip", "text/html",
+			`<html><head><meta property="og:type" content="video.other"></head></html>`, FormatVideo},
+		{"og:type song", "https://example.com/song", "text/html",
+			`<html><head><meta property="og:type" content="music.song"></head></html>`, FormatMusic},
+		{"json-ld beats og:type", "https://example.com/ep", "text/html",
+			`<html><head><meta property="og:type" content="article">
+			<script type="application/ld+json">{"@type": "PodcastEpisode", "name": "Ep 1"}</script></head></html>`, FormatPodcast},
+		{"scholarly article", "https://journal.example/paper", "text/html",
+			`<html><head><script type="application/ld+json">{"@type": "ScholarlyArticle", "headline": "Results"}</script></head></html>`, FormatPaper},
+		{"pdf", "https://example.com/report.pdf", "application/pdf", ``, FormatDocument},
+	}
+
+	for _, tc := range testCases {
+		page := testPage(t, tc.url, tc.body)
+		page.ContentType = tc.contentType
+
+		metadata, err := NewPipeline(domExtractor{}, jsonLDExtractor{}, formatExtractor{}).Run(context.Background(), page)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+			continue
+		}
+		if metadata.Format != tc.expected {
+			t.Errorf("%s: expected %s, got %s", tc.name, tc.expected, metadata.Format)
+		}
+	}
+}
+
+func TestFormatExtractor_EmbedType(t *testing.T) {
+	found := NewExtraction("")
+	found.Embed = &Embed{Type: "video", HTML: "<iframe></iframe>"}
+	page := testPage(t, "https://videos.example/v/1", `<html></html>`)
+
+	result, _ := formatExtractor{}.Extract(context.Background(), page, found)
+	if got := result.Get(FieldFormat); got != FormatVideo {
+		t.Errorf("Expected oEmbed video to classify as video, got %s", got)
+	}
+}
@@ -1,7 +1,7 @@
 // Package handler provides HTTP handlers for the Copus API
 // This file implements the URL metadata fetching endpoint for auto-fetching og:image
 //
-// Endpoint: GET /client/common/urlInfo?url=<encoded-url>
+// Endpoint: GET /client/common/urlInfo?url=<encoded-url>[&detail=full]
 // Purpose: Fetch og:image and other metadata from external URLs for cover image auto-fill
 
 package handler
@@ -9,13 +9,11 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
-	"regexp"
 	"strings"
-	"time"
 
 	"golang.org/x/net/html"
 )
@@ -26,49 +24,138 @@ type URLMetadata struct {
 	Title       string `json:"title,omitempty"`
 	Description string `json:"description,omitempty"`
 	Favicon     string `json:"favicon,omitempty"`
+
+	// Attribution and classification, mostly from JSON-LD
+	Author      string   `json:"author,omitempty"`
+	PublishedAt string   `json:"publishedAt,omitempty"` // RFC 3339 or YYYY-MM-DD
+	SiteName    string   `json:"siteName,omitempty"`
+	ThemeColor  string   `json:"themeColor,omitempty"`  // from theme-color or the web app manifest
+	ContentType string   `json:"contentType,omitempty"` // schema.org @type, e.g. NewsArticle
+	Format      string   `json:"format,omitempty"`      // article, video, podcast, music, paper, repo, ...
+	Keywords    []string `json:"keywords,omitempty"`
+
+	// Canonical form of the page URL, for detecting already-curated links
+	CanonicalURL string `json:"canonicalUrl,omitempty"`
+
+	// Cover image candidates, best first; OgImage is the first of these
+	Images []ImageCandidate `json:"images,omitempty"`
+
+	// BlurHash, colors and aspect ratio of the cover, for painting a
+	// placeholder while it loads
+	Placeholder *ImagePlaceholder `json:"placeholder,omitempty"`
+
+	// Stored copies of the cover, when mirroring is configured; OgImage
+	// stays the original URL
+	Mirror *MirroredImage `json:"mirror,omitempty"`
+
+	// Playable embed from oEmbed, for video, audio and rich media links
+	Embed *Embed `json:"embed,omitempty"`
+
+	// Typed details from a site-specific extractor (GitHub stars, arXiv authors, ...)
+	Site *SiteExtras `json:"site,omitempty"`
+
+	// Duration, player and channel of the video or audio the page is about
+	Media *MediaInfo `json:"media,omitempty"`
+
+	// Bibliographic details from citation_* and Dublin Core tags
+	Citation *Citation `json:"citation,omitempty"`
+
+	// Type, size, page count or dimensions when the link is a PDF, image or
+	// media file rather than a page
+	Document *DocumentInfo `json:"document,omitempty"`
+
+	// Length, excerpt and language of the main content; only with ?detail=full
+	Content *ContentSummary `json:"content,omitempty"`
+
+	// Confidence of each populated field, from 0 to 1
+	Confidence map[string]float64 `json:"confidence,omitempty"`
+
+	// How the fetch went: ok, partial, or why nothing could be extracted
+	FetchStatus       string   `json:"fetchStatus,omitempty"`
+	HTTPStatus        int      `json:"httpStatus,omitempty"`
+	FinalURL          string   `json:"finalUrl,omitempty"`
+	RedirectChain     []string `json:"redirectChain,omitempty"`
+	RedirectPermanent bool     `json:"redirectPermanent,omitempty"` // every redirect was a 301 or 308
 }
 
 // URLInfoResponse is the API response structure
 type URLInfoResponse struct {
 	Status int          `json:"status"`
 	Msg    string       `json:"msg"`
+	Code   string       `json:"code,omitempty"`
 	Data   *URLMetadata `json:"data,omitempty"`
 }
 
-// URLInfoHandler handles the /client/common/urlInfo endpoint
+// Machine-readable error codes returned in URLInfoResponse.Code
+const (
+	ErrCodeInvalidURL       = "invalid_url"
+	ErrCodeBlockedAddress   = "blocked_address"
+	ErrCodeDomainNotAllowed = "domain_not_allowed"
+	ErrCodeRobotsDisallowed = "robots_disallowed"
+)
+
+// URLInfoHandler handles the /client/common/urlInfo endpoint with DefaultFetcher
 func URLInfoHandler(w http.ResponseWriter, r *http.Request) {
+	NewURLInfoHandler(DefaultFetcher)(w, r)
+}
+
+// NewURLInfoHandler returns a /client/common/urlInfo handler backed by fetcher
+func NewURLInfoHandler(fetcher *Fetcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		serveURLInfo(fetcher, w, r)
+	}
+}
+
+func serveURLInfo(fetcher *Fetcher, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// Only allow GET requests
 	if r.Method != http.MethodGet {
-		sendURLInfoError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		sendURLInfoError(w, http.StatusMethodNotAllowed, "", "Method not allowed")
 		return
 	}
 
 	// Get URL parameter
 	targetURL := r.URL.Query().Get("url")
 	if targetURL == "" {
-		sendURLInfoError(w, http.StatusBadRequest, "URL parameter is required")
+		sendURLInfoError(w, http.StatusBadRequest, ErrCodeInvalidURL, "URL parameter is required")
 		return
 	}
 
 	// Validate and normalize the URL
-	normalizedURL, err := validateAndNormalizeURL(targetURL)
+	normalizedURL, err := fetcher.Validate(targetURL)
 	if err != nil {
-		sendURLInfoError(w, http.StatusBadRequest, fmt.Sprintf("Invalid URL: %v", err))
+		sendURLInfoError(w, http.StatusBadRequest, urlErrorCode(err), fmt.Sprintf("Invalid URL: %v", err))
 		return
 	}
 
-	// Fetch and parse the URL metadata
-	metadata, err := fetchURLMetadata(normalizedURL)
+	// Fetch and parse the URL metadata, served from cache when possible. The
+	// request context cancels the fetch if the client goes away.
+	detail := r.URL.Query().Get("detail")
+	metadata, err := fetcher.fetchDetail(r.Context(), normalizedURL, detail)
+	if statusCode, code, message, refused := refusedFetch(err); refused {
+		sendURLInfoError(w, statusCode, code, message)
+		return
+	}
 	if err != nil {
-		// Log the error but return empty metadata (graceful degradation)
-		fmt.Printf("[URLInfo] Failed to fetch metadata for %s: %v\n", normalizedURL, err)
-		sendURLInfoSuccess(w, &URLMetadata{})
+		// Log the error but return the reason instead of metadata (graceful degradation)
+		logFetchFailure("urlInfo", normalizedURL, err)
+		sendURLInfoSuccess(w, failureMetadata(err))
 		return
 	}
 
-	sendURLInfoSuccess(w, metadata)
+	sendURLInfoSuccess(w, withDetail(metadata, detail))
+}
+
+// withDetail drops the content analysis, which a cached entry may hold from
+// an earlier detailed lookup, unless the caller asked for detail=full. The cached metadata is never modified.
+func withDetail(metadata *URLMetadata, detail string) *URLMetadata {
+	if detail == "full" || metadata.Content == nil {
+		return metadata
+	}
+	summary := *metadata
+	summary.Content = nil
+	return &summary
 }
 
 // validateAndNormalizeURL validates the URL and adds protocol if missing
@@ -80,6 +167,14 @@ func validateAndNormalizeURL(rawURL string) (string, error) {
 		return "", fmt.Errorf("URL cannot be empty")
 	}
 
+	// doi:10.xxxx resolves through doi.org
+	if resolved, ok, err := doiURL(rawURL); ok {
+		if err != nil {
+			return "", err
+		}
+		rawURL = resolved
+	}
+
 	// Add https:// if no protocol specified
 	if !strings.HasPrefix(rawURL, "http://") && !strings.HasPrefix(rawURL, "https://") {
 		rawURL = "https://" + rawURL
@@ -99,115 +194,56 @@ func validateAndNormalizeURL(rawURL string) (string, error) {
 	// Block localhost and private IPs for security
 	host := strings.ToLower(parsedURL.Hostname())
 	if isPrivateHost(host) {
-		return "", fmt.Errorf("private/local URLs are not allowed")
+		return "", fmt.Errorf("%w: private/local URLs are not allowed", ErrBlockedAddress)
 	}
 
 	return parsedURL.String(), nil
 }
 
-// isPrivateHost checks if the host is localhost or a private IP
+// isPrivateHost checks if the host is localhost or an IP literal in a reserved range
 func isPrivateHost(host string) bool {
-	privateHosts := []string{
-		"localhost",
-		"127.0.0.1",
-		"0.0.0.0",
-		"::1",
-	}
+	host = strings.TrimSuffix(host, ".")
 
-	for _, ph := range privateHosts {
-		if host == ph {
-			return true
-		}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
 	}
 
-	// Check for private IP ranges
-	privatePatterns := []string{
-		`^10\.`,
-		`^172\.(1[6-9]|2[0-9]|3[0-1])\.`,
-		`^192\.168\.`,
-		`^169\.254\.`,
-	}
-
-	for _, pattern := range privatePatterns {
-		if matched, _ := regexp.MatchString(pattern, host); matched {
-			return true
-		}
+	// IP literals in any notation, including decimal and IPv4-mapped IPv6
+	if addr, ok := parseHostIP(host); ok {
+		return isBlockedIP(addr)
 	}
 
 	return false
 }
 
-// fetchURLMetadata fetches the webpage and extracts metadata
-func fetchURLMetadata(targetURL string) (*URLMetadata, error) {
-	// Create context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	// Create HTTP request
-	req, err := http.NewRequestWithContext(ctx, "GET", targetURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %v", err)
-	}
-
-	// Set headers to mimic a browser request
-	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; CopusBot/1.0; +https://copus.network)")
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
-	req.Header.Set("Accept-Language", "en-US,en;q=0.5")
-
-	// Create HTTP client with timeout and redirect policy
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			// Allow up to 5 redirects
-			if len(via) >= 5 {
-				return fmt.Errorf("too many redirects")
-			}
-			return nil
-		},
-	}
-
-	// Make the request
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch URL: %v", err)
-	}
-	defer resp.Body.Close()
-
-	// Check status code
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("received status code %d", resp.StatusCode)
-	}
+// pageValidators are HTTP cache validators sent with conditional requests
+type pageValidators struct {
+	ETag         string
+	LastModified string
+}
 
-	// Check content type - only parse HTML
-	contentType := resp.Header.Get("Content-Type")
-	if !strings.Contains(contentType, "text/html") && !strings.Contains(contentType, "application/xhtml") {
-		return nil, fmt.Errorf("not an HTML page: %s", contentType)
-	}
+// domExtractor extracts Open Graph and other metadata from the parsed HTML
+// tree. It is the fallback for the head extractor: the page is only parsed
+// here when the head left fields missing or the tree already exists.
+type domExtractor struct{}
 
-	// Limit response body size (5MB max)
-	limitedReader := io.LimitReader(resp.Body, 5*1024*1024)
+func (domExtractor) Name() string { return "dom" }
 
-	// Parse HTML and extract metadata
-	metadata, err := parseHTMLMetadata(limitedReader, targetURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse HTML: %v", err)
+func (domExtractor) Extract(_ context.Context, page *Page, found *Extraction) (*Extraction, error) {
+	if found.Has(headFields...) && !page.parsed {
+		return nil, nil
 	}
 
-	return metadata, nil
-}
-
-// parseHTMLMetadata parses HTML and extracts Open Graph and other metadata
-func parseHTMLMetadata(reader io.Reader, baseURL string) (*URLMetadata, error) {
-	doc, err := html.Parse(reader)
+	doc, err := page.Document()
 	if err != nil {
 		return nil, err
 	}
+	return parseHTMLMetadata(doc, page.URL), nil
+}
 
-	metadata := &URLMetadata{}
-	var titleFromTag string
-
-	// Parse base URL for resolving relative URLs
-	parsedBaseURL, _ := url.Parse(baseURL)
+// parseHTMLMetadata extracts Open Graph and other metadata from an HTML tree
+func parseHTMLMetadata(doc *html.Node, baseURL *url.URL) *Extraction {
+	found := NewExtraction("dom")
 
 	// Recursive function to traverse the HTML tree
 	var traverse func(*html.Node)
@@ -215,14 +251,16 @@ func parseHTMLMetadata(reader io.Reader, baseURL string) (*URLMetadata, error) {
 		if n.Type == html.ElementNode {
 			switch n.Data {
 			case "meta":
-				handleMetaTag(n, metadata)
+				handleMetaTag(n, found)
 			case "title":
 				// Get title from <title> tag
 				if n.FirstChild != nil {
-					titleFromTag = strings.TrimSpace(n.FirstChild.Data)
+					found.Set(FieldTitle, n.FirstChild.Data, ConfidenceLow)
 				}
 			case "link":
-				handleLinkTag(n, metadata, parsedBaseURL)
+				handleLinkTag(n, found)
+			case "body":
+				found.Images = append(found.Images, collectBodyImages(n)...)
 			}
 		}
 
@@ -234,29 +272,16 @@ func parseHTMLMetadata(reader io.Reader, baseURL string) (*URLMetadata, error) {
 
 	traverse(doc)
 
-	// Use <title> tag if og:title not found
-	if metadata.Title == "" && titleFromTag != "" {
-		metadata.Title = titleFromTag
-	}
-
-	// Resolve relative URLs to absolute URLs
-	if metadata.OgImage != "" {
-		metadata.OgImage = resolveURL(metadata.OgImage, parsedBaseURL)
-	}
-	if metadata.Favicon != "" {
-		metadata.Favicon = resolveURL(metadata.Favicon, parsedBaseURL)
-	}
-
 	// Generate default favicon URL if not found
-	if metadata.Favicon == "" && parsedBaseURL != nil {
-		metadata.Favicon = fmt.Sprintf("%s://%s/favicon.ico", parsedBaseURL.Scheme, parsedBaseURL.Host)
+	if baseURL != nil {
+		found.Set(FieldFavicon, fmt.Sprintf("%s://%s/favicon.ico", baseURL.Scheme, baseURL.Host), ConfidenceGuess)
 	}
 
-	return metadata, nil
+	return found
 }
 
 // handleMetaTag extracts metadata from <meta> tags
-func handleMetaTag(n *html.Node, metadata *URLMetadata) {
+func handleMetaTag(n *html.Node, found *Extraction) {
 	var property, name, content string
 
 	for _, attr := range n.Attr {
@@ -270,46 +295,85 @@ func handleMetaTag(n *html.Node, metadata *URLMetadata) {
 		}
 	}
 
+	// Video and audio tags are assembled by the media extractor
+	if isMediaTag(property) {
+		found.addMediaTag(property, content)
+		return
+	}
+	if isMediaTag(name) {
+		found.addMediaTag(name, content)
+		return
+	}
+
 	// Open Graph tags
 	switch property {
-	case "og:image":
-		if metadata.OgImage == "" {
-			metadata.OgImage = content
+	case "og:image", "og:image:url":
+		found.Set(FieldImage, content, ConfidenceHigh)
+		found.addImage(content, ImageSourceOpenGraph)
+	case "og:image:secure_url":
+		// Prefer the https variant of the preceding og:image
+		if img := found.lastImage(ImageSourceOpenGraph); img != nil && strings.HasPrefix(content, "https://") {
+			img.URL = content
 		}
-	case "og:title":
-		if metadata.Title == "" {
-			metadata.Title = content
+	case "og:image:width", "og:image:height", "og:image:alt":
+		if img := found.lastImage(ImageSourceOpenGraph); img != nil {
+			img.setProperty(strings.TrimPrefix(property, "og:image:"), content)
 		}
+	case "og:title":
+		found.Set(FieldTitle, content, ConfidenceHigh)
 	case "og:description":
-		if metadata.Description == "" {
-			metadata.Description = content
+		found.Set(FieldDescription, content, ConfidenceHigh)
+	case "og:url":
+		found.Set(FieldCanonical, content, ConfidenceMedium)
+	case "og:type":
+		if found.OGType == "" {
+			found.OGType = strings.TrimSpace(content)
+		}
+	case "og:site_name":
+		found.Set(FieldSiteName, content, ConfidenceHigh)
+	case "article:published_time":
+		found.Set(FieldPublishedAt, normalizeDate(content), ConfidenceMedium)
+	case "article:author":
+		// Often a profile URL rather than a name
+		if !strings.HasPrefix(content, "http") {
+			found.Set(FieldAuthor, content, ConfidenceMedium)
 		}
 	}
 
+	// Scholarly tags are assembled by the citation extractor
+	if isCitationTag(name) {
+		found.addCitationTag(name, content)
+		return
+	}
+
 	// Twitter Card tags (fallback)
 	switch name {
-	case "twitter:image":
-		if metadata.OgImage == "" {
-			metadata.OgImage = content
+	case "twitter:image", "twitter:image:src":
+		found.Set(FieldImage, content, ConfidenceMedium)
+		found.addImage(content, ImageSourceTwitter)
+	case "twitter:image:alt":
+		if img := found.lastImage(ImageSourceTwitter); img != nil {
+			img.setProperty("alt", content)
 		}
 	case "twitter:title":
-		if metadata.Title == "" {
-			metadata.Title = content
-		}
+		found.Set(FieldTitle, content, ConfidenceMedium)
 	case "twitter:description":
-		if metadata.Description == "" {
-			metadata.Description = content
-		}
+		found.Set(FieldDescription, content, ConfidenceMedium)
 	case "description":
-		if metadata.Description == "" {
-			metadata.Description = content
-		}
+		found.Set(FieldDescription, content, ConfidenceLow)
+	case "author":
+		found.Set(FieldAuthor, content, ConfidenceMedium)
+	case "keywords":
+		found.Set(FieldKeywords, content, ConfidenceMedium)
+	case "theme-color":
+		found.Set(FieldThemeColor, content, ConfidenceHigh)
 	}
 }
 
-// handleLinkTag extracts favicon from <link> tags
-func handleLinkTag(n *html.Node, metadata *URLMetadata, baseURL *url.URL) {
-	var rel, href string
+// handleLinkTag extracts icon, manifest, canonical and oEmbed discovery links
+// from <link> tags
+func handleLinkTag(n *html.Node, found *Extraction) {
+	var rel, href, linkType, sizes string
 
 	for _, attr := range n.Attr {
 		switch strings.ToLower(attr.Key) {
@@ -317,12 +381,29 @@ func handleLinkTag(n *html.Node, metadata *URLMetadata, baseURL *url.URL) {
 			rel = strings.ToLower(attr.Val)
 		case "href":
 			href = attr.Val
+		case "type":
+			linkType = strings.ToLower(strings.TrimSpace(attr.Val))
+		case "sizes":
+			sizes = attr.Val
 		}
 	}
 
-	// Look for favicon
-	if strings.Contains(rel, "icon") && href != "" && metadata.Favicon == "" {
-		metadata.Favicon = href
+	// Icons are ranked by the icon extractor; the first one stands in until then
+	if found.addIcon(rel, href, sizes, linkType) {
+		found.Set(FieldFavicon, href, ConfidenceHigh)
+	}
+
+	if rel == "manifest" && found.ManifestURL == "" {
+		found.ManifestURL = strings.TrimSpace(href)
+	}
+
+	if rel == "canonical" {
+		found.Set(FieldCanonical, href, ConfidenceHigh)
+	}
+
+	// oEmbed discovery, JSON only
+	if rel == "alternate" && linkType == "application/json+oembed" && found.OEmbedURL == "" {
+		found.OEmbedURL = strings.TrimSpace(href)
 	}
 }
 
@@ -364,12 +445,40 @@ func sendURLInfoSuccess(w http.ResponseWriter, data *URLMetadata) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// urlErrorCode maps a URL validation error to its response code
+func urlErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrBlockedAddress):
+		return ErrCodeBlockedAddress
+	case errors.Is(err, ErrDomainNotAllowed):
+		return ErrCodeDomainNotAllowed
+	}
+	return ErrCodeInvalidURL
+}
+
+// refusedFetch maps errors that refuse a URL outright, rather than failing to
+// fetch it, to an HTTP status, response code and message
+func refusedFetch(err error) (statusCode int, code, message string, refused bool) {
+	switch {
+	case errors.Is(err, ErrBlockedAddress):
+		// The host resolved to (or redirected to) a private address
+		return http.StatusBadRequest, ErrCodeBlockedAddress, "private/local URLs are not allowed", true
+	case errors.Is(err, ErrDomainNotAllowed):
+		return http.StatusForbidden, ErrCodeDomainNotAllowed, "fetching this domain is not allowed", true
+	case errors.Is(err, ErrRobotsDisallowed):
+		// The site asked crawlers to stay out; say so instead of returning nothing
+		return http.StatusForbidden, ErrCodeRobotsDisallowed, "the site's robots.txt disallows fetching this URL", true
+	}
+	return 0, "", "", false
+}
+
 // sendURLInfoError sends an error response
-func sendURLInfoError(w http.ResponseWriter, statusCode int, message string) {
+func sendURLInfoError(w http.ResponseWriter, statusCode int, code, message string) {
 	w.WriteHeader(statusCode)
 	response := URLInfoResponse{
 		Status: 0,
 		Msg:    message,
+		Code:   code,
 	}
 	json.NewEncoder(w).Encode(response)
 }
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 )
 
@@ -27,6 +28,7 @@ func TestURLInfoHandler_ValidURL(t *testing.T) {
 		`))
 	}))
 	defer testServer.Close()
+	allowLoopbackForTest(t)
 
 	// Create request
 	req := httptest.NewRequest("GET", "/client/common/urlInfo?url="+testServer.URL, nil)
@@ -125,6 +127,9 @@ func TestValidateAndNormalizeURL(t *testing.T) {
 		{"localhost", "", true},
 		{"127.0.0.1", "", true},
 		{"192.168.1.1", "", true},
+		{"doi:10.1038/nphys1170", "https://doi.org/10.1038/nphys1170", false},
+		{"DOI: 10.1000/a#b", "https://doi.org/10.1000/a%23b", false},
+		{"doi:not-a-doi", "", true},
 	}
 
 	for _, tc := range testCases {
@@ -166,6 +171,3 @@ func TestResolveURL(t *testing.T) {
 		}
 	}
 }
-
-// Import url package for tests
-import "net/url"
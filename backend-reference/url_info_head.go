@@ -0,0 +1,119 @@
+// Streaming <head> extraction
+// Most pages carry everything the summary needs in <head>. The head
+// extractor tokenizes the page and stops where the head ends, without
+// building a DOM; the DOM extractor only parses the whole page when the head
+// left title, description or image missing, or when the tree is built anyway
+// for main-content analysis.
+
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// headFields are the fields a head scan must find for the full parse to be
+// skipped
+var headFields = []Field{FieldTitle, FieldDescription, FieldImage}
+
+// headElements may appear in <head>; any other start tag means the body has
+// begun, whether or not </head> was written
+var headElements = map[atom.Atom]bool{
+	atom.Html: true, atom.Head: true, atom.Title: true, atom.Meta: true, atom.Link: true,
+	atom.Base: true, atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+}
+
+// headExtractor extracts head metadata with a streaming tokenizer
+type headExtractor struct{}
+
+func (headExtractor) Name() string { return "head" }
+
+func (headExtractor) Extract(_ context.Context, page *Page, _ *Extraction) (*Extraction, error) {
+	return parseHeadMetadata(page.Body, page.URL), nil
+}
+
+// parseHeadMetadata extracts the same head metadata as parseHTMLMetadata,
+// reading only as far as the end of <head>
+func parseHeadMetadata(body []byte, baseURL *url.URL) *Extraction {
+	found := NewExtraction("head")
+	z := html.NewTokenizer(bytes.NewReader(body))
+
+	inTitle := false
+scan:
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			break scan
+		case html.TextToken:
+			if inTitle {
+				found.Set(FieldTitle, string(z.Text()), ConfidenceLow)
+				inTitle = false
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch atom.Lookup(name) {
+			case atom.Head:
+				break scan
+			case atom.Title:
+				inTitle = false
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			if !headElements[tok.DataAtom] {
+				break scan
+			}
+			n := &html.Node{Type: html.ElementNode, DataAtom: tok.DataAtom, Data: tok.Data, Attr: tok.Attr}
+			switch tok.DataAtom {
+			case atom.Meta:
+				handleMetaTag(n, found)
+			case atom.Link:
+				handleLinkTag(n, found)
+			case atom.Title:
+				inTitle = tt == html.StartTagToken
+			}
+		}
+	}
+
+	if baseURL != nil {
+		found.Set(FieldFavicon, fmt.Sprintf("%s://%s/favicon.ico", baseURL.Scheme, baseURL.Host), ConfidenceGuess)
+	}
+	return found
+}
+
+// scanJSONLD collects the page's JSON-LD blocks with the tokenizer, for pages
+// that are never parsed into a DOM
+func scanJSONLD(body []byte) *jsonLDDocument {
+	ld := newJSONLDDocument()
+	z := html.NewTokenizer(bytes.NewReader(body))
+
+	inBlock := false
+	var raw strings.Builder
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return ld
+		case html.StartTagToken:
+			tok := z.Token()
+			if tok.DataAtom == atom.Script {
+				inBlock = isJSONLDScript(&html.Node{Attr: tok.Attr})
+				raw.Reset()
+			}
+		case html.TextToken:
+			if inBlock {
+				raw.Write(z.Text())
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); inBlock && atom.Lookup(name) == atom.Script {
+				ld.add(raw.String())
+				inBlock = false
+			}
+		}
+	}
+}
@@ -0,0 +1,198 @@
+// Package handler tests for the streaming head extractor
+package handler
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+const testHead = `<!DOCTYPE html>
+<html><head>
+<meta charset="utf-8">
+<title>Fallback &amp; title</title>
+<meta property="og:title" content="Streaming head">
+<meta property="og:description" content="Everything is in the head">
+<meta property="og:image" content="/cover.jpg">
+<meta property="og:image:width" content="1200">
+<meta property="og:type" content="article">
+<meta name="keywords" content="go, html">
+<link rel="canonical" href="https://example.com/post">
+<link rel="icon" href="/icon.png">
+<link rel="alternate" type="application/json+oembed" href="https://example.com/oembed?url=post">
+<script type="application/ld+json">{"@type": "NewsArticle", "author": {"@type": "Person", "name": "Ada"}}</script>
+</head>
+`
+
+func TestParseHeadMetadata_MatchesDOM(t *testing.T) {
+	base, _ := url.Parse("https://example.com/post")
+	body := testHead + `<body><p>Text</p></body></html>`
+
+	head := parseHeadMetadata([]byte(body), base)
+	doc, _ := html.Parse(strings.NewReader(body))
+	dom := parseHTMLMetadata(doc, base)
+
+	for field, want := range dom.Fields {
+		if got := head.Fields[field]; got.Value != want.Value || got.Confidence != want.Confidence {
+			t.Errorf("%s: expected %q (%v), got %q (%v)", field, want.Value, want.Confidence, got.Value, got.Confidence)
+		}
+	}
+	if head.OEmbedURL != dom.OEmbedURL || head.OGType != dom.OGType {
+		t.Errorf("Expected oEmbed %q and type %q, got %q and %q", dom.OEmbedURL, dom.OGType, head.OEmbedURL, head.OGType)
+	}
+	if !reflect.DeepEqual(head.Images, dom.Images) {
+		t.Errorf("Expected images %+v, got %+v", dom.Images, head.Images)
+	}
+}
+
+func TestParseHeadMetadata_StopsAtBody(t *testing.T) {
+	testCases := []struct {
+		name string
+		html string
+	}{
+		{"closed head", `<html><head><title>T</title></head><meta property="og:image" content="/late.jpg">`},
+		{"implicit head end", `<html><head><title>T</title><div>x</div><meta property="og:image" content="/late.jpg">`},
+		{"no head", `<title>T</title><h1>Hi</h1><meta property="og:image" content="/late.jpg">`},
+	}
+
+	for _, tc := range testCases {
+		found := parseHeadMetadata([]byte(tc.html), nil)
+		if found.Get(FieldTitle) != "T" {
+			t.Errorf("%s: expected title T, got %q", tc.name, found.Get(FieldTitle))
+		}
+		if found.Has(FieldImage) {
+			t.Errorf("%s: expected the scan to stop before the body", tc.name)
+		}
+	}
+}
+
+func TestPipeline_SkipsDOMWhenHeadComplete(t *testing.T) {
+	testCases := []struct {
+		name    string
+		html    string
+		analyze bool
+		parsed  bool
+	}{
+		{"complete head", testHead + `<body><img src="/a.jpg"></body></html>`, false, false},
+		{"missing image", `<html><head><title>T</title><meta name="description" content="D"></head><body></body></html>`, false, true},
+		{"detail=full", testHead + `<body><p>Text</p></body></html>`, true, true},
+	}
+
+	for _, tc := range testCases {
+		page := testPage(t, "https://example.com/post", tc.html)
+		page.analyze = tc.analyze
+		metadata, err := NewPipeline(headExtractor{}, contentExtractor{}, domExtractor{}, jsonLDExtractor{}).Run(context.Background(), page)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if page.parsed != tc.parsed {
+			t.Errorf("%s: expected parsed=%v", tc.name, tc.parsed)
+		}
+		if metadata.Title == "" {
+			t.Errorf("%s: expected a title", tc.name)
+		}
+	}
+
+	// JSON-LD still comes through without the tree
+	page := testPage(t, "https://example.com/post", testHead)
+	metadata, _ := NewPipeline(headExtractor{}, domExtractor{}, jsonLDExtractor{}).Run(context.Background(), page)
+	if metadata.Author != "Ada" || page.parsed {
+		t.Errorf("Expected the author from a tokenizer scan, got %q (parsed=%v)", metadata.Author, page.parsed)
+	}
+}
+
+func TestScanJSONLD_MatchesDOM(t *testing.T) {
+	body := `<html><head><script type="application/ld+json">{"@type":"WebSite","name":"Site"}</script></head>
+<body><script type="application/ld+json"><!--{"@type":"Article","headline":"A &amp; B"}--></script>
+<script>var x = "<script type='application/ld+json'>";</script></body></html>`
+
+	doc, _ := html.Parse(strings.NewReader(body))
+	want := parseJSONLD(doc)
+	got := scanJSONLD([]byte(body))
+	if !reflect.DeepEqual(got.nodes, want.nodes) {
+		t.Errorf("Expected %v, got %v", want.nodes, got.nodes)
+	}
+}
+
+// benchmarkPage is a typical article: a complete head and a long body
+var benchmarkPage = testHead + "<body><article>" +
+	strings.Repeat(`<p>Paragraph text with <a href="https://example.org/">a link</a> and <img src="/inline.jpg" width="800" height="600"> an image.</p>`, 5000) +
+	"</article></body></html>"
+
+// The three metadata strategies over the same in-memory page: the head
+// tokenizer, a full DOM, and the regex fallback
+
+func BenchmarkExtract_Head(b *testing.B) {
+	base, _ := url.Parse("https://example.com/post")
+	body := []byte(benchmarkPage)
+	b.SetBytes(int64(len(body)))
+	for b.Loop() {
+		parseHeadMetadata(body, base)
+	}
+}
+
+func BenchmarkExtract_DOM(b *testing.B) {
+	base, _ := url.Parse("https://example.com/post")
+	b.SetBytes(int64(len(benchmarkPage)))
+	for b.Loop() {
+		doc, _ := html.Parse(strings.NewReader(benchmarkPage))
+		parseHTMLMetadata(doc, base)
+	}
+}
+
+func BenchmarkExtract_Regex(b *testing.B) {
+	b.SetBytes(int64(len(benchmarkPage)))
+	for b.Loop() {
+		body := benchmarkPage
+		if len(body) > maxRegexScanBytes {
+			body = body[:maxRegexScanBytes]
+		}
+		extractMetadataRegex(body)
+	}
+}
+
+// BenchmarkFetch runs the default pipeline end to end over canned responses.
+// A plain lookup of benchmarkPage never builds a DOM; detail=full does.
+func BenchmarkFetch(b *testing.B) {
+	var cover bytes.Buffer
+	jpeg.Encode(&cover, image.NewRGBA(image.Rect(0, 0, 1200, 630)), nil)
+
+	fetcher := NewFetcher(FetcherConfig{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		switch req.URL.Path {
+		case "/post":
+			return cannedResponse(req, http.StatusOK, "text/html; charset=utf-8", benchmarkPage), nil
+		case "/cover.jpg":
+			return cannedResponse(req, http.StatusOK, "image/jpeg", cover.String()), nil
+		}
+		return cannedResponse(req, http.StatusNotFound, "text/plain", ""), nil
+	})})
+	// No politeness delays between iterations
+	fetcher.throttle.interval = 0
+	ctx := context.Background()
+
+	for _, bc := range []struct {
+		name  string
+		fetch func(context.Context, string) (*URLMetadata, error)
+	}{
+		{"summary", fetcher.Fetch},
+		{"full", fetcher.FetchFull},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.SetBytes(int64(len(benchmarkPage)))
+			for b.Loop() {
+				fetcher.Cache().Invalidate("https://example.com/post")
+				if _, err := bc.fetch(ctx, "https://example.com/post"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+// Site icons and web app manifests
+// Every <link rel="icon">, apple-touch-icon and manifest icon is a candidate
+// for the favicon. The largest is checked to exist before it is returned, and
+// /favicon.ico is only a last resort. The manifest also supplies the site
+// name and theme color for source attribution chips.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Icon selection limits
+const (
+	maxManifestBytes = 64 * 1024
+	maxIconProbes    = 4
+	iconProbeBytes   = 512
+	scalableIconSize = 4096 // sizes="any", i.e. SVG
+	touchIconSize    = 180  // apple-touch-icon without sizes
+)
+
+// iconCandidate is an icon declared by the page or its manifest
+type iconCandidate struct {
+	URL   string
+	Rel   string // icon, apple-touch-icon or manifest
+	Sizes string
+	Type  string
+}
+
+// size is the icon's largest declared size in pixels, 0 when unknown
+func (c iconCandidate) size() int {
+	best := 0
+	for _, s := range strings.Fields(strings.ToLower(c.Sizes)) {
+		if s == "any" {
+			return scalableIconSize
+		}
+		w, h, ok := strings.Cut(s, "x")
+		if !ok {
+			continue
+		}
+		width, _ := strconv.Atoi(w)
+		height, _ := strconv.Atoi(h)
+		best = max(best, min(width, height))
+	}
+	if best == 0 && strings.HasPrefix(c.Rel, "apple-touch-icon") {
+		return touchIconSize
+	}
+	if best == 0 && c.Type == "image/svg+xml" {
+		return scalableIconSize
+	}
+	return best
+}
+
+// addIcon records an icon link and reports whether rel named one
+func (e *Extraction) addIcon(rel, href, sizes, linkType string) bool {
+	for _, token := range strings.Fields(rel) {
+		switch token {
+		case "icon", "apple-touch-icon", "apple-touch-icon-precomposed":
+			e.Icons = append(e.Icons, iconCandidate{URL: strings.TrimSpace(href), Rel: token, Sizes: sizes, Type: linkType})
+			return true
+		}
+	}
+	return false
+}
+
+// webManifest is the part of a web app manifest used for attribution
+type webManifest struct {
+	Name       string `json:"name"`
+	ShortName  string `json:"short_name"`
+	ThemeColor string `json:"theme_color"`
+	Icons      []struct {
+		Src     string `json:"src"`
+		Sizes   string `json:"sizes"`
+		Type    string `json:"type"`
+		Purpose string `json:"purpose"`
+	} `json:"icons"`
+}
+
+// iconExtractor reads the web app manifest and picks the best reachable icon
+type iconExtractor struct{}
+
+func (iconExtractor) Name() string { return "icons" }
+
+func (iconExtractor) Extract(ctx context.Context, page *Page, found *Extraction) (*Extraction, error) {
+	result := NewExtraction("icons")
+	candidates := append([]iconCandidate{}, found.Icons...)
+
+	if found.ManifestURL != "" {
+		manifestURL := resolveURL(found.ManifestURL, page.URL)
+		if manifest, err := fetchManifest(ctx, page.Fetcher(), manifestURL); err == nil {
+			result.Set(FieldSiteName, manifest.Name, ConfidenceMedium)
+			result.Set(FieldSiteName, manifest.ShortName, ConfidenceLow)
+			result.Set(FieldThemeColor, manifest.ThemeColor, ConfidenceMedium)
+			candidates = append(candidates, manifestIcons(manifest, manifestURL)...)
+		}
+	}
+
+	// Whatever another extractor settled on, then the conventional location
+	if current := found.Get(FieldFavicon); current != "" {
+		candidates = append(candidates, iconCandidate{URL: current})
+	}
+	candidates = append(candidates, iconCandidate{URL: fmt.Sprintf("%s://%s/favicon.ico", page.URL.Scheme, page.URL.Host)})
+
+	for i, icon := range rankIcons(candidates, page.URL) {
+		if i == maxIconProbes {
+			break
+		}
+		ok, err := probeIcon(ctx, page.Fetcher(), icon.URL)
+		if err != nil {
+			// Unreachable for reasons unrelated to the icon; keep the
+			// unverified choice
+			return result, nil
+		}
+		if ok {
+			result.Set(FieldFavicon, icon.URL, ConfidenceVerified)
+			return result, nil
+		}
+	}
+
+	result.Clear(FieldFavicon, ConfidenceVerified)
+	return result, nil
+}
+
+// fetchManifest downloads and decodes a web app manifest
+func fetchManifest(ctx context.Context, fetcher *Fetcher, manifestURL string) (*webManifest, error) {
+	body, _, err := fetcher.Resource(ctx, manifestURL, "application/manifest+json, application/json", maxManifestBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest webManifest
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// manifestIcons converts manifest icons, resolved against the manifest URL.
+// Monochrome-only icons are skipped.
+func manifestIcons(manifest *webManifest, manifestURL string) []iconCandidate {
+	base, err := url.Parse(manifestURL)
+	if err != nil {
+		return nil
+	}
+
+	var icons []iconCandidate
+	for _, icon := range manifest.Icons {
+		if purpose := strings.Fields(icon.Purpose); len(purpose) > 0 && !slices.Contains(purpose, "any") && !slices.Contains(purpose, "maskable") {
+			continue
+		}
+		icons = append(icons, iconCandidate{
+			URL:   resolveURL(strings.TrimSpace(icon.Src), base),
+			Rel:   "manifest",
+			Sizes: icon.Sizes,
+			Type:  strings.ToLower(icon.Type),
+		})
+	}
+	return icons
+}
+
+// rankIcons resolves and dedupes candidates, largest first; equal sizes keep
+// document order
+func rankIcons(candidates []iconCandidate, base *url.URL) []iconCandidate {
+	seen := make(map[string]bool)
+	var ranked []iconCandidate
+	for _, icon := range candidates {
+		icon.URL = resolveURL(icon.URL, base)
+		if !strings.HasPrefix(icon.URL, "http://") && !strings.HasPrefix(icon.URL, "https://") {
+			continue
+		}
+		if seen[icon.URL] {
+			continue
+		}
+		seen[icon.URL] = true
+		ranked = append(ranked, icon)
+	}
+
+	slices.SortStableFunc(ranked, func(a, b iconCandidate) int {
+		return b.size() - a.size()
+	})
+	return ranked
+}
+
+// probeIcon reports whether an icon exists and is an image. Errors other than
+// a bad response are returned so the caller can tell "missing" from "unknown".
+func probeIcon(ctx context.Context, fetcher *Fetcher, iconURL string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, imageProbeTimeout)
+	defer cancel()
+
+	data, header, err := fetcher.ResourcePrefix(ctx, iconURL, "image/*", iconProbeBytes)
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) || errors.Is(err, ErrBlockedAddress) || errors.Is(err, ErrDomainNotAllowed) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return strings.HasPrefix(imageMIMEType(data, header.Get("Content-Type")), "image/"), nil
+}
@@ -0,0 +1,105 @@
+// Package handler tests for icon selection and web app manifests
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+// testICO is the header of a 16x16 .ico file
+const testICO = "\x00\x00\x01\x00\x01\x00\x10\x10\x00\x00\x01\x00\x20\x00"
+
+// newResourceFetcher serves the given URLs with their content types; every
+// other URL is a 404
+func newResourceFetcher(resources map[string][2]string) *Fetcher {
+	return NewFetcher(FetcherConfig{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			if r, ok := resources[req.URL.String()]; ok {
+				return cannedResponse(req, http.StatusOK, r[0], r[1]), nil
+			}
+			return cannedResponse(req, http.StatusNotFound, "text/plain", "not found"), nil
+		}),
+	})
+}
+
+func TestIconCandidate_Size(t *testing.T) {
+	testCases := []struct {
+		icon     iconCandidate
+		expected int
+	}{
+		{iconCandidate{Rel: "icon", Sizes: "16x16 32x32"}, 32},
+		{iconCandidate{Rel: "icon", Sizes: "192X192"}, 192},
+		{iconCandidate{Rel: "icon", Sizes: "any"}, scalableIconSize},
+		{iconCandidate{Rel: "icon", Type: "image/svg+xml"}, scalableIconSize},
+		{iconCandidate{Rel: "apple-touch-icon"}, touchIconSize},
+		{iconCandidate{Rel: "icon"}, 0},
+	}
+
+	for _, tc := range testCases {
+		if got := tc.icon.size(); got != tc.expected {
+			t.Errorf("For %+v: expected %d, got %d", tc.icon, tc.expected, got)
+		}
+	}
+}
+
+func TestIconExtractor_ManifestAndReachability(t *testing.T) {
+	page := testPage(t, "https://example.com/post", `<html><head>
+		<meta name="theme-color" content="#ffffff">
+		<link rel="icon" href="/favicon-16.png" sizes="16x16">
+		<link rel="apple-touch-icon" href="/touch.png">
+		<link rel="mask-icon" href="/mask.svg">
+		<link rel="manifest" href="/app/manifest.json">
+	</head><body></body></html>`)
+	page.fetcher = newResourceFetcher(map[string][2]string{
+		"https://example.com/app/manifest.json": {"application/manifest+json", `{
+			"name": "Example Site", "short_name": "Ex", "theme_color": "#000000",
+			"icons": [
+				{"src": "icon-512.png", "sizes": "512x512", "type": "image/png"},
+				{"src": "icon-192.png", "sizes": "192x192", "type": "image/png"},
+				{"src": "mono.svg", "sizes": "any", "purpose": "monochrome"}
+			]}`},
+		// icon-512.png is missing, so the next largest wins
+		"https://example.com/app/icon-192.png": {"image/png", "\x89PNG\r\n\x1a\n"},
+		"https://example.com/touch.png":        {"image/png", "\x89PNG\r\n\x1a\n"},
+	})
+
+	metadata, err := NewPipeline(headExtractor{}, iconExtractor{}).Run(context.Background(), page)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if metadata.Favicon != "https://example.com/app/icon-192.png" {
+		t.Errorf("Expected the largest reachable icon, got %q", metadata.Favicon)
+	}
+	if metadata.SiteName != "Example Site" {
+		t.Errorf("Expected the manifest name, got %q", metadata.SiteName)
+	}
+	if metadata.ThemeColor != "#ffffff" {
+		t.Errorf("Expected the theme-color meta tag to win, got %q", metadata.ThemeColor)
+	}
+}
+
+func TestIconExtractor_MissingFavicon(t *testing.T) {
+	testCases := []struct {
+		name      string
+		resources map[string][2]string
+		expected  string
+	}{
+		{"guess exists", map[string][2]string{"https://example.com/favicon.ico": {"image/x-icon", testICO}}, "https://example.com/favicon.ico"},
+		{"guess missing", nil, ""},
+		{"not an image", map[string][2]string{"https://example.com/favicon.ico": {"text/html", "<html>Not found</html>"}}, ""},
+	}
+
+	for _, tc := range testCases {
+		page := testPage(t, "https://example.com/post", `<html><head><title>T</title></head></html>`)
+		page.fetcher = newResourceFetcher(tc.resources)
+
+		metadata, err := NewPipeline(headExtractor{}, iconExtractor{}).Run(context.Background(), page)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if metadata.Favicon != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, metadata.Favicon)
+		}
+	}
+}
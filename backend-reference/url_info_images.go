@@ -0,0 +1,398 @@
+// Cover image candidates and reachability probing
+// Every image a page advertises (og:image and its properties, twitter:image,
+// JSON-LD images, large images in the article body) is collected, probed with
+// a ranged GET to learn its real MIME type and pixel size, and ranked. Broken
+// links and tracking pixels are dropped.
+
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	_ "image/gif"  // register GIF for DecodeConfig
+	_ "image/jpeg" // register JPEG for DecodeConfig
+	_ "image/png"  // register PNG for DecodeConfig
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	_ "golang.org/x/image/webp" // register WebP for DecodeConfig
+	"golang.org/x/net/html"
+)
+
+// Image candidate sources
+const (
+	ImageSourceOpenGraph = "og:image"
+	ImageSourceTwitter   = "twitter:image"
+	ImageSourceJSONLD    = "jsonld"
+	ImageSourceOEmbed    = "oembed"
+	ImageSourceBody      = "body"
+	ImageSourceFallback  = "fallback"
+	ImageSourceSite      = "site"     // chosen by a site-specific extractor
+	ImageSourceDocument  = "document" // the link itself is an image
+)
+
+// Probing limits
+const (
+	maxImageCandidates = 8
+	maxBodyImages      = 5
+	imageProbeWorkers  = 4
+	imageProbeBytes    = 64 * 1024
+	imageProbeTimeout  = 5 * time.Second
+	minImageDimension  = 50  // anything smaller is an icon or tracking pixel
+	minBodyImageSize   = 300 // declared size for a body image to count as large
+)
+
+// ImageCandidate is a possible cover image
+type ImageCandidate struct {
+	URL      string `json:"url"`
+	Source   string `json:"source"`
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+	Alt      string `json:"alt,omitempty"`
+	MIMEType string `json:"mimeType,omitempty"`
+
+	probed   bool    // dimensions and MIME type come from the image itself
+	rejected bool    // definitely unusable: 4xx/5xx, not an image, too small
+	score    float64 // higher is better
+}
+
+// setProperty applies a width, height or alt value from markup
+func (img *ImageCandidate) setProperty(key, value string) {
+	value = strings.TrimSpace(value)
+	switch key {
+	case "width":
+		if n, err := strconv.Atoi(strings.TrimSuffix(value, "px")); err == nil && n > 0 {
+			img.Width = n
+		}
+	case "height":
+		if n, err := strconv.Atoi(strings.TrimSuffix(value, "px")); err == nil && n > 0 {
+			img.Height = n
+		}
+	case "alt":
+		if value != "" {
+			img.Alt = value
+		}
+	}
+}
+
+// addImage appends a candidate from markup
+func (e *Extraction) addImage(rawURL, source string) {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return
+	}
+	e.Images = append(e.Images, ImageCandidate{URL: rawURL, Source: source})
+}
+
+// lastImage returns the most recent candidate from source, which og:image:*
+// and twitter:image:* properties apply to
+func (e *Extraction) lastImage(source string) *ImageCandidate {
+	for i := len(e.Images) - 1; i >= 0; i-- {
+		if e.Images[i].Source == source {
+			return &e.Images[i]
+		}
+	}
+	return nil
+}
+
+// collectBodyImages finds large images in the page body, preferring those
+// inside <article> or <main>. Lazy-loading attributes are honored.
+func collectBodyImages(body *html.Node) []ImageCandidate {
+	var inContent, anywhere []ImageCandidate
+
+	var traverse func(n *html.Node, inArticle bool)
+	traverse = func(n *html.Node, inArticle bool) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "article", "main":
+				inArticle = true
+			case "header", "footer", "nav", "aside":
+				// Logos and avatars live here
+				return
+			case "img":
+				if img, ok := bodyImage(n, inArticle); ok {
+					if inArticle {
+						inContent = append(inContent, img)
+					} else {
+						anywhere = append(anywhere, img)
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			traverse(c, inArticle)
+		}
+	}
+	traverse(body, false)
+
+	images := append(inContent, anywhere...)
+	if len(images) > maxBodyImages {
+		images = images[:maxBodyImages]
+	}
+	return images
+}
+
+// bodyImage turns an <img> into a candidate if it looks like content
+func bodyImage(n *html.Node, inArticle bool) (ImageCandidate, bool) {
+	img := ImageCandidate{Source: ImageSourceBody}
+	var src, lazySrc, srcset string
+
+	for _, attr := range n.Attr {
+		switch strings.ToLower(attr.Key) {
+		case "src":
+			src = attr.Val
+		case "data-src", "data-lazy-src", "data-original":
+			lazySrc = attr.Val
+		case "srcset", "data-srcset":
+			srcset = attr.Val
+		case "width", "height", "alt":
+			img.setProperty(strings.ToLower(attr.Key), attr.Val)
+		}
+	}
+
+	// Lazy loaders put a placeholder in src
+	img.URL = strings.TrimSpace(lazySrc)
+	if img.URL == "" {
+		img.URL = largestSrcset(srcset)
+	}
+	if img.URL == "" {
+		img.URL = strings.TrimSpace(src)
+	}
+	if img.URL == "" || strings.HasPrefix(img.URL, "data:") {
+		return img, false
+	}
+
+	lower := strings.ToLower(img.URL)
+	for _, hint := range []string{"logo", "icon", "avatar", "sprite", "pixel", "spacer", "badge"} {
+		if strings.Contains(lower, hint) {
+			return img, false
+		}
+	}
+
+	// Outside the article only explicitly large images count
+	large := img.Width >= minBodyImageSize || img.Height >= minBodyImageSize
+	if (img.Width > 0 && img.Width < minImageDimension) || (img.Height > 0 && img.Height < minImageDimension) {
+		return img, false
+	}
+	return img, inArticle || large
+}
+
+// largestSrcset returns the widest entry of a srcset attribute
+func largestSrcset(srcset string) string {
+	best, bestWidth := "", -1.0
+	for _, entry := range strings.Split(srcset, ",") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		width := 0.0
+		if len(fields) > 1 {
+			descriptor := fields[1]
+			if n, err := strconv.ParseFloat(strings.TrimRight(descriptor, "wx"), 64); err == nil {
+				width = n
+			}
+		}
+		if width > bestWidth {
+			best, bestWidth = fields[0], width
+		}
+	}
+	return best
+}
+
+// confidenceUnprobedCover is below a verified image but above the tags the
+// candidates came from, so ogImage always matches images[0]
+const confidenceUnprobedCover = 0.92
+
+// imageExtractor probes and ranks the collected candidates and picks the cover
+type imageExtractor struct{}
+
+func (imageExtractor) Name() string { return "images" }
+
+func (imageExtractor) Extract(ctx context.Context, page *Page, found *Extraction) (*Extraction, error) {
+	candidates := dedupeImages(found, page.URL)
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	probeImages(ctx, page.Fetcher(), candidates)
+	ranked := rankImages(candidates)
+
+	result := NewExtraction("images")
+	switch {
+	case len(ranked) == 0:
+		// Every candidate is broken or a tracking pixel
+		result.Clear(FieldImage, ConfidenceVerified)
+	case ranked[0].probed:
+		result.Set(FieldImage, ranked[0].URL, ConfidenceVerified)
+	default:
+		result.Set(FieldImage, ranked[0].URL, confidenceUnprobedCover)
+	}
+
+	// The ranked list replaces the raw candidates accumulated so far
+	result.Images = ranked
+	result.imagesRanked = true
+	return result, nil
+}
+
+// dedupeImages resolves candidate URLs, adds the current best image if no
+// extractor listed it, and drops duplicates keeping the first source
+func dedupeImages(found *Extraction, base *url.URL) []ImageCandidate {
+	all := found.Images
+	if current := found.Get(FieldImage); current != "" {
+		all = append(all, ImageCandidate{URL: current, Source: ImageSourceFallback})
+	}
+
+	seen := make(map[string]int)
+	var candidates []ImageCandidate
+	for _, img := range all {
+		img.URL = resolveURL(img.URL, base)
+		if !strings.HasPrefix(img.URL, "http://") && !strings.HasPrefix(img.URL, "https://") {
+			continue
+		}
+		if i, ok := seen[img.URL]; ok {
+			// Keep declared details another source had
+			existing := &candidates[i]
+			if existing.Width == 0 && existing.Height == 0 {
+				existing.Width, existing.Height = img.Width, img.Height
+			}
+			if existing.Alt == "" {
+				existing.Alt = img.Alt
+			}
+			continue
+		}
+		seen[img.URL] = len(candidates)
+		candidates = append(candidates, img)
+		if len(candidates) == maxImageCandidates {
+			break
+		}
+	}
+	return candidates
+}
+
+// probeImages probes candidates concurrently with a bounded worker pool
+func probeImages(ctx context.Context, fetcher *Fetcher, candidates []ImageCandidate) {
+	sem := make(chan struct{}, imageProbeWorkers)
+	var wg sync.WaitGroup
+
+	for i := range candidates {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(img *ImageCandidate) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			probeImage(ctx, fetcher, img)
+		}(&candidates[i])
+	}
+	wg.Wait()
+}
+
+// probeImage fetches the start of an image to learn its real MIME type and
+// dimensions. Network errors leave the candidate unprobed but usable.
+func probeImage(ctx context.Context, fetcher *Fetcher, img *ImageCandidate) {
+	ctx, cancel := context.WithTimeout(ctx, imageProbeTimeout)
+	defer cancel()
+
+	data, header, err := fetcher.ResourcePrefix(ctx, img.URL, "image/avif,image/webp,image/*;q=0.8", imageProbeBytes)
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) || errors.Is(err, ErrBlockedAddress) {
+		img.rejected = true
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	img.probed = true
+	img.MIMEType = imageMIMEType(data, header.Get("Content-Type"))
+	if !strings.HasPrefix(img.MIMEType, "image/") {
+		img.rejected = true
+		return
+	}
+
+	// Pixel size from the image header; SVGs and truncated headers keep the
+	// declared size
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		img.Width, img.Height = cfg.Width, cfg.Height
+	}
+
+	if (img.Width > 0 && img.Width < minImageDimension) || (img.Height > 0 && img.Height < minImageDimension) {
+		img.rejected = true
+	}
+}
+
+// imageMIMEType sniffs the content, trusting the header only for types the
+// sniffer cannot recognize such as SVG and AVIF
+func imageMIMEType(data []byte, contentType string) string {
+	sniffed := http.DetectContentType(data)
+	if strings.HasPrefix(sniffed, "image/") {
+		return sniffed
+	}
+
+	declared, _, _ := mime.ParseMediaType(contentType)
+	if declared == "image/svg+xml" || declared == "image/avif" || declared == "image/heic" {
+		return declared
+	}
+	return sniffed
+}
+
+// imageSourceWeight ranks sources by how deliberately they pick a cover
+var imageSourceWeight = map[string]float64{
+	ImageSourceDocument:  1.0,
+	ImageSourceOpenGraph: 1.0,
+	ImageSourceSite:      0.95,
+	ImageSourceJSONLD:    0.9,
+	ImageSourceTwitter:   0.85,
+	ImageSourceOEmbed:    0.8,
+	ImageSourceFallback:  0.7,
+	ImageSourceBody:      0.6,
+}
+
+// rankImages drops rejected candidates and sorts the rest best first
+func rankImages(candidates []ImageCandidate) []ImageCandidate {
+	var ranked []ImageCandidate
+	for _, img := range candidates {
+		if img.rejected {
+			continue
+		}
+		img.score = imageScore(img)
+		ranked = append(ranked, img)
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].score > ranked[j].score
+	})
+	return ranked
+}
+
+// imageScore combines source, size relative to a 1200x630 share card, aspect
+// ratio and whether the image could be verified
+func imageScore(img ImageCandidate) float64 {
+	score := imageSourceWeight[img.Source]
+
+	if img.Width > 0 && img.Height > 0 {
+		area := float64(img.Width * img.Height)
+		score *= 0.5 + 0.5*math.Min(area/(1200*630), 1)
+
+		// Banners and skyscrapers make poor covers
+		ratio := float64(img.Width) / float64(img.Height)
+		if ratio > 3 || ratio < 0.4 {
+			score *= 0.5
+		}
+	} else {
+		score *= 0.6
+	}
+
+	if !img.probed {
+		score *= 0.5
+	}
+	return score
+}
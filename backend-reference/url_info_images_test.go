@@ -0,0 +1,176 @@
+// Package handler tests for image candidates and probing
+package handler
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// encodeTestImage renders a blank image of the given size
+func encodeTestImage(t *testing.T, format string, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	var err error
+	if format == "png" {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatalf("Failed to encode %s: %v", format, err)
+	}
+	return buf.Bytes()
+}
+
+func TestImageExtractor_RanksAndDropsBrokenCandidates(t *testing.T) {
+	pixel := encodeTestImage(t, "png", 1, 1)
+	cover := encodeTestImage(t, "png", 1200, 630)
+	inline := encodeTestImage(t, "jpeg", 800, 600)
+
+	var rangeHeader string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head>
+			<meta property="og:image" content="/tracker.png">
+			<meta property="og:image" content="/missing.jpg">
+			<meta name="twitter:image" content="/cover.png">
+			<meta name="twitter:image:alt" content="Cover alt">
+		</head><body>
+			<header><img src="/logo-large.png" width="600"></header>
+			<article><p>Text</p><img data-src="/inline.jpg" src="data:image/gif;base64,R0lGOD" alt="Inline"></article>
+		</body></html>`))
+	})
+	mux.HandleFunc("/tracker.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(pixel)
+	})
+	mux.HandleFunc("/cover.png", func(w http.ResponseWriter, r *http.Request) {
+		// The placeholder extractor downloads it in full afterwards
+		if rangeHeader == "" {
+			rangeHeader = r.Header.Get("Range")
+		}
+		// Declared as HTML by a misconfigured server; sniffing wins
+		w.Header().Set("Content-Type", "text/html")
+		w.Write(cover)
+	})
+	mux.HandleFunc("/inline.jpg", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(inline)
+	})
+	testServer := httptest.NewServer(mux)
+	defer testServer.Close()
+	allowLoopbackForTest(t)
+
+	page, err := DefaultFetcher.fetchPage(context.Background(), testServer.URL+"/page", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	metadata, err := defaultPipeline().Run(context.Background(), page)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if metadata.OgImage != testServer.URL+"/cover.png" {
+		t.Errorf("Expected cover.png as best image, got %s", metadata.OgImage)
+	}
+	if rangeHeader == "" {
+		t.Error("Expected probe to use a Range request")
+	}
+
+	if len(metadata.Images) != 2 {
+		t.Fatalf("Expected 2 usable candidates, got %+v", metadata.Images)
+	}
+	best := metadata.Images[0]
+	if best.Width != 1200 || best.Height != 630 || best.MIMEType != "image/png" || best.Alt != "Cover alt" {
+		t.Errorf("Unexpected best candidate: %+v", best)
+	}
+	second := metadata.Images[1]
+	if second.URL != testServer.URL+"/inline.jpg" || second.Source != ImageSourceBody || second.MIMEType != "image/jpeg" {
+		t.Errorf("Unexpected second candidate: %+v", second)
+	}
+}
+
+func TestImageExtractor_ClearsWhenAllBroken(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><meta property="og:image" content="/gone.jpg"></head></html>`))
+	})
+	testServer := httptest.NewServer(mux)
+	defer testServer.Close()
+	allowLoopbackForTest(t)
+
+	page, err := DefaultFetcher.fetchPage(context.Background(), testServer.URL+"/page", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	metadata, _ := defaultPipeline().Run(context.Background(), page)
+
+	if metadata.OgImage != "" {
+		t.Errorf("Expected broken og:image to be dropped, got %s", metadata.OgImage)
+	}
+	if _, ok := metadata.Confidence["ogImage"]; ok {
+		t.Error("Expected no confidence for a cleared field")
+	}
+}
+
+func TestImageExtractor_UnprobedCoverMatchesFirstImage(t *testing.T) {
+	// A server that is gone leaves its image unprobed but usable
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><meta property="og:image" content="/gone.jpg"></head>
+			<body><article><img src="` + unreachable.URL + `/photo.jpg"></article></body></html>`))
+	})
+	testServer := httptest.NewServer(mux)
+	defer testServer.Close()
+	allowLoopbackForTest(t)
+
+	page, err := DefaultFetcher.fetchPage(context.Background(), testServer.URL+"/page", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	metadata, _ := defaultPipeline().Run(context.Background(), page)
+
+	if len(metadata.Images) != 1 || metadata.OgImage != metadata.Images[0].URL {
+		t.Fatalf("Expected ogImage to be the first candidate, got %q and %+v", metadata.OgImage, metadata.Images)
+	}
+	if metadata.Confidence["ogImage"] >= ConfidenceVerified {
+		t.Errorf("Expected an unverified confidence, got %v", metadata.Confidence["ogImage"])
+	}
+
+	// The extractor returns the ranked list rather than editing found
+	found := NewExtraction("test")
+	found.Images = []ImageCandidate{{URL: "/gone.jpg", Source: ImageSourceOpenGraph}}
+	result, _ := imageExtractor{}.Extract(context.Background(), page, found)
+	if len(found.Images) != 1 || result == nil || len(result.Images) != 0 {
+		t.Errorf("Unexpected images: found %+v, result %+v", found.Images, result)
+	}
+}
+
+func TestLargestSrcset(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"a.jpg 320w, b.jpg 1024w, c.jpg 640w", "b.jpg"},
+		{"a.jpg 1x, b.jpg 2x", "b.jpg"},
+		{"only.jpg", "only.jpg"},
+		{"", ""},
+	}
+
+	for _, tc := range testCases {
+		if result := largestSrcset(tc.input); result != tc.expected {
+			t.Errorf("For %q: expected %q, got %q", tc.input, tc.expected, result)
+		}
+	}
+}
@@ -0,0 +1,417 @@
+// JSON-LD / schema.org extraction
+// Reads <script type="application/ld+json"> blocks, including @graph arrays and
+// @id references, for author, publish date, site name, content type and
+// keywords. Headline, description and image act as fallbacks for head tags.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// jsonLDNode is a decoded JSON-LD object
+type jsonLDNode map[string]interface{}
+
+// jsonLDDocument holds every object found in a page's JSON-LD blocks
+type jsonLDDocument struct {
+	nodes []jsonLDNode
+	byID  map[string]jsonLDNode
+}
+
+// contentTypes are the schema.org types describing the page's main content,
+// in no particular order
+var contentTypes = map[string]bool{
+	"Article": true, "NewsArticle": true, "BlogPosting": true, "TechArticle": true,
+	"ScholarlyArticle": true, "Report": true, "AnalysisNewsArticle": true,
+	"OpinionNewsArticle": true, "ReviewNewsArticle": true, "LiveBlogPosting": true,
+	"SocialMediaPosting": true, "DiscussionForumPosting": true, "Review": true,
+	"VideoObject": true, "AudioObject": true, "PodcastEpisode": true, "PodcastSeries": true,
+	"MusicRecording": true, "MusicAlbum": true, "MusicPlaylist": true,
+	"Book": true, "Movie": true, "TVEpisode": true, "Recipe": true, "Product": true,
+	"Course": true, "Event": true, "SoftwareApplication": true, "SoftwareSourceCode": true,
+	"Dataset": true, "CreativeWork": true,
+}
+
+// jsonLDExtractor extracts schema.org metadata from JSON-LD
+type jsonLDExtractor struct{}
+
+func (jsonLDExtractor) Name() string { return "jsonld" }
+
+func (jsonLDExtractor) Extract(_ context.Context, page *Page, _ *Extraction) (*Extraction, error) {
+	ld, err := page.JSONLD()
+	if err != nil {
+		return nil, err
+	}
+	return extractJSONLDMetadata(ld, page.URL), nil
+}
+
+// JSONLD parses the page's JSON-LD blocks once and shares them between extractors
+func (p *Page) JSONLD() (*jsonLDDocument, error) {
+	if p.jsonLD != nil {
+		return p.jsonLD, nil
+	}
+
+	// Reuse the tree when an extractor already built it; a tokenizer pass is
+	// much cheaper than parsing just for the scripts
+	if !p.parsed {
+		p.jsonLD = scanJSONLD(p.Body)
+		return p.jsonLD, nil
+	}
+
+	doc, err := p.Document()
+	if err != nil {
+		return nil, err
+	}
+
+	p.jsonLD = parseJSONLD(doc)
+	return p.jsonLD, nil
+}
+
+// parseJSONLD collects and flattens every JSON-LD block in the document.
+// Blocks that fail to decode are skipped.
+func parseJSONLD(doc *html.Node) *jsonLDDocument {
+	ld := newJSONLDDocument()
+
+	var traverse func(*html.Node)
+	traverse = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "script" && isJSONLDScript(n) {
+			var raw strings.Builder
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				raw.WriteString(c.Data)
+			}
+			ld.add(raw.String())
+			return
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			traverse(c)
+		}
+	}
+	traverse(doc)
+
+	return ld
+}
+
+func newJSONLDDocument() *jsonLDDocument {
+	return &jsonLDDocument{byID: make(map[string]jsonLDNode)}
+}
+
+// add decodes one JSON-LD block; blocks that fail to decode are skipped
+func (ld *jsonLDDocument) add(raw string) {
+	var value interface{}
+	if err := json.Unmarshal([]byte(cleanJSONLD(raw)), &value); err == nil {
+		ld.collect(value)
+	}
+}
+
+// isJSONLDScript reports whether a <script> holds JSON-LD
+func isJSONLDScript(n *html.Node) bool {
+	for _, attr := range n.Attr {
+		if strings.ToLower(attr.Key) == "type" {
+			return strings.ToLower(strings.TrimSpace(attr.Val)) == "application/ld+json"
+		}
+	}
+	return false
+}
+
+// cleanJSONLD strips wrappers some CMSs leave around the JSON
+func cleanJSONLD(raw string) string {
+	raw = strings.TrimSpace(raw)
+	for _, wrapper := range []string{"<!--", "-->", "//<![CDATA[", "//]]>", "<![CDATA[", "]]>"} {
+		raw = strings.ReplaceAll(raw, wrapper, "")
+	}
+	return strings.TrimSpace(raw)
+}
+
+// collect adds top-level objects, array items and @graph members, indexing
+// them by @id so references can be resolved
+func (ld *jsonLDDocument) collect(value interface{}) {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			ld.collect(item)
+		}
+	case map[string]interface{}:
+		node := jsonLDNode(v)
+		if graph, ok := v["@graph"]; ok {
+			ld.collect(graph)
+			// A bare @graph container has nothing else to offer
+			if _, typed := v["@type"]; !typed {
+				return
+			}
+		}
+		ld.nodes = append(ld.nodes, node)
+		if id := node.str("@id"); id != "" {
+			ld.byID[id] = node
+		}
+	}
+}
+
+// resolve follows an {"@id": ...} reference to the full node
+func (ld *jsonLDDocument) resolve(node jsonLDNode) jsonLDNode {
+	if len(node) == 1 {
+		if target, ok := ld.byID[node.str("@id")]; ok {
+			return target
+		}
+	}
+	return node
+}
+
+// primary returns the node describing the page's main content
+func (ld *jsonLDDocument) primary() jsonLDNode {
+	for _, node := range ld.nodes {
+		for _, t := range node.types() {
+			if contentTypes[t] {
+				return node
+			}
+		}
+	}
+	// Fall back to a WebPage, which often carries name and description
+	for _, node := range ld.nodes {
+		if node.hasType("WebPage") {
+			return node
+		}
+	}
+	return nil
+}
+
+// ofType returns the first node with the given @type
+func (ld *jsonLDDocument) ofType(t string) jsonLDNode {
+	for _, node := range ld.nodes {
+		if node.hasType(t) {
+			return node
+		}
+	}
+	return nil
+}
+
+// types returns the node's @type values with any schema.org prefix removed
+func (n jsonLDNode) types() []string {
+	var types []string
+	switch v := n["@type"].(type) {
+	case string:
+		types = []string{v}
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				types = append(types, s)
+			}
+		}
+	}
+	for i, t := range types {
+		t = strings.TrimPrefix(t, "http://schema.org/")
+		types[i] = strings.TrimPrefix(t, "https://schema.org/")
+	}
+	return types
+}
+
+// hasType reports whether the node has the given @type
+func (n jsonLDNode) hasType(t string) bool {
+	for _, nt := range n.types() {
+		if nt == t {
+			return true
+		}
+	}
+	return false
+}
+
+// str returns a string property; numbers are formatted and language-tagged
+// values ({"@value": ...}) unwrapped
+func (n jsonLDNode) str(key string) string {
+	return jsonLDString(n[key])
+}
+
+// jsonLDString converts a scalar or @value object to a string
+func jsonLDString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(html.UnescapeString(v))
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]interface{}:
+		return jsonLDString(v["@value"])
+	case []interface{}:
+		if len(v) > 0 {
+			return jsonLDString(v[0])
+		}
+	}
+	return ""
+}
+
+// names returns the name(s) of a person/organization property, which may be a
+// string, an object, a reference or an array of any of those
+func (ld *jsonLDDocument) names(value interface{}) []string {
+	var names []string
+	switch v := value.(type) {
+	case string:
+		if s := strings.TrimSpace(v); s != "" {
+			names = append(names, s)
+		}
+	case map[string]interface{}:
+		if name := ld.resolve(jsonLDNode(v)).str("name"); name != "" {
+			names = append(names, name)
+		}
+	case []interface{}:
+		for _, item := range v {
+			names = append(names, ld.names(item)...)
+		}
+	}
+	return names
+}
+
+// imageURL returns the first URL of an image property: a string, an
+// ImageObject, a reference or an array of those
+func (ld *jsonLDDocument) imageURL(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case map[string]interface{}:
+		node := ld.resolve(jsonLDNode(v))
+		if u := node.str("url"); u != "" {
+			return u
+		}
+		return node.str("contentUrl")
+	case []interface{}:
+		for _, item := range v {
+			if u := ld.imageURL(item); u != "" {
+				return u
+			}
+		}
+	}
+	return ""
+}
+
+// images returns every image of an image property as candidates, keeping
+// ImageObject dimensions and captions
+func (ld *jsonLDDocument) images(value interface{}) []ImageCandidate {
+	var images []ImageCandidate
+	switch v := value.(type) {
+	case string:
+		if s := strings.TrimSpace(v); s != "" {
+			images = append(images, ImageCandidate{URL: s, Source: ImageSourceJSONLD})
+		}
+	case map[string]interface{}:
+		node := ld.resolve(jsonLDNode(v))
+		if u := ld.imageURL(v); u != "" {
+			img := ImageCandidate{URL: u, Source: ImageSourceJSONLD}
+			img.setProperty("width", node.str("width"))
+			img.setProperty("height", node.str("height"))
+			img.setProperty("alt", node.str("caption"))
+			images = append(images, img)
+		}
+	case []interface{}:
+		for _, item := range v {
+			images = append(images, ld.images(item)...)
+		}
+	}
+	return images
+}
+
+// keywordList returns keywords given as an array or a comma-separated string
+func keywordList(value interface{}) []string {
+	var raw []string
+	switch v := value.(type) {
+	case string:
+		raw = strings.Split(v, ",")
+	case []interface{}:
+		for _, item := range v {
+			if s := jsonLDString(item); s != "" {
+				raw = append(raw, strings.Split(s, ",")...)
+			}
+		}
+	}
+
+	var keywords []string
+	seen := make(map[string]bool)
+	for _, k := range raw {
+		k = strings.TrimSpace(k)
+		if k != "" && !seen[strings.ToLower(k)] {
+			seen[strings.ToLower(k)] = true
+			keywords = append(keywords, k)
+		}
+	}
+	return keywords
+}
+
+// extractJSONLDMetadata maps the primary JSON-LD entity onto metadata fields
+func extractJSONLDMetadata(ld *jsonLDDocument, base *url.URL) *Extraction {
+	found := NewExtraction("jsonld")
+
+	main := ld.primary()
+	if main != nil {
+		// Fallbacks for the head tags
+		headline := main.str("headline")
+		if headline == "" {
+			headline = main.str("name")
+		}
+		found.Set(FieldTitle, headline, ConfidenceFallback)
+		found.Set(FieldDescription, main.str("description"), ConfidenceFallback)
+		found.Set(FieldImage, ld.imageURL(main["image"]), ConfidenceFallback)
+		found.Set(FieldImage, ld.imageURL(main["thumbnailUrl"]), ConfidenceLow)
+		found.Images = append(found.Images, ld.images(main["image"])...)
+
+		// Structured data is the authoritative source for these
+		found.Set(FieldAuthor, strings.Join(ld.names(main["author"]), ", "), ConfidenceHigh)
+		found.Set(FieldAuthor, strings.Join(ld.names(main["creator"]), ", "), ConfidenceMedium)
+
+		for _, key := range []string{"datePublished", "uploadDate", "dateCreated"} {
+			found.Set(FieldPublishedAt, normalizeDate(main.str(key)), ConfidenceHigh)
+		}
+
+		if types := main.types(); len(types) > 0 {
+			found.Set(FieldContentType, types[0], ConfidenceHigh)
+		}
+
+		found.Set(FieldKeywords, strings.Join(keywordList(main["keywords"]), ","), ConfidenceHigh)
+
+		found.Set(FieldSiteName, strings.Join(ld.names(main["publisher"]), ", "), ConfidenceMedium)
+	}
+
+	if site := ld.ofType("WebSite"); site != nil {
+		found.Set(FieldSiteName, site.str("name"), ConfidenceMedium)
+	}
+
+	found.Media = ld.media(base)
+
+	return found
+}
+
+// normalizeDate converts common publish date layouts to RFC 3339, or to
+// YYYY-MM-DD for date-only values. Unparseable dates are dropped.
+func normalizeDate(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ""
+	}
+
+	layouts := []string{
+		time.RFC3339,
+		"2006-01-02T15:04:05Z0700",
+		"2006-01-02T15:04:05.000Z0700",
+		"2006-01-02T15:04:05",
+		"2006-01-02T15:04Z07:00",
+		"2006-01-02 15:04:05",
+		time.RFC1123Z,
+		time.RFC1123,
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Format(time.RFC3339)
+		}
+	}
+
+	for _, layout := range []string{"2006-01-02", "2006/01/02", "January 2, 2006", "Jan 2, 2006"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Format("2006-01-02")
+		}
+	}
+
+	return ""
+}
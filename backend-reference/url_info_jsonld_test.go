@@ -0,0 +1,116 @@
+// Package handler tests for JSON-LD extraction
+package handler
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestJSONLD_GraphWithReferences(t *testing.T) {
+	page := testPage(t, "https://news.example.com/story", `
+		<html><head>
+			<meta property="og:title" content="OG Headline">
+			<script type="application/ld+json">
+			{
+				"@context": "https://schema.org",
+				"@graph": [
+					{"@type": "WebSite", "@id": "https://news.example.com/#website", "name": "Example News"},
+					{"@type": "Person", "@id": "https://news.example.com/#jane", "name": "Jane Doe"},
+					{
+						"@type": ["NewsArticle"],
+						"headline": "JSON-LD Headline",
+						"description": "Story summary",
+						"image": {"@type": "ImageObject", "url": "https://news.example.com/cover.jpg"},
+						"author": [{"@id": "https://news.example.com/#jane"}, {"@type": "Person", "name": "John Roe"}],
+						"datePublished": "2024-03-05T10:30:00+01:00",
+						"keywords": ["Climate", "Policy", "climate"]
+					}
+				]
+			}
+			</script>
+		</head><body></body></html>
+	`)
+
+	metadata, err := defaultPipeline().Run(context.Background(), page)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if metadata.Author != "Jane Doe, John Roe" {
+		t.Errorf("Expected both authors, got %q", metadata.Author)
+	}
+	if metadata.PublishedAt != "2024-03-05T10:30:00+01:00" {
+		t.Errorf("Unexpected publishedAt %q", metadata.PublishedAt)
+	}
+	if metadata.SiteName != "Example News" {
+		t.Errorf("Expected site name, got %q", metadata.SiteName)
+	}
+	if metadata.ContentType != "NewsArticle" {
+		t.Errorf("Expected NewsArticle, got %q", metadata.ContentType)
+	}
+	if !reflect.DeepEqual(metadata.Keywords, []string{"Climate", "Policy"}) {
+		t.Errorf("Unexpected keywords %v", metadata.Keywords)
+	}
+
+	// og:title outranks the headline; JSON-LD fills what the head lacks
+	if metadata.Title != "OG Headline" {
+		t.Errorf("Expected og:title to win, got %q", metadata.Title)
+	}
+	if metadata.Description != "Story summary" {
+		t.Errorf("Expected JSON-LD description fallback, got %q", metadata.Description)
+	}
+	if metadata.OgImage != "https://news.example.com/cover.jpg" {
+		t.Errorf("Expected JSON-LD image fallback, got %q", metadata.OgImage)
+	}
+}
+
+func TestJSONLD_SkipsMalformedBlocks(t *testing.T) {
+	page := testPage(t, "https://blog.example.com/post", `
+		<html><head>
+			<title>Tag Title</title>
+			<script type="application/ld+json">{ "broken": </script>
+			<script type="application/ld+json">
+			<!--
+			[{"@type": "BlogPosting", "headline": "Post Headline", "author": "Ann Writer", "datePublished": "2023-12-01"}]
+			-->
+			</script>
+		</head></html>
+	`)
+
+	ld, err := page.JSONLD()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	found := extractJSONLDMetadata(ld, page.URL)
+
+	if found.Get(FieldTitle) != "Post Headline" {
+		t.Errorf("Expected headline, got %q", found.Get(FieldTitle))
+	}
+	if found.Get(FieldAuthor) != "Ann Writer" {
+		t.Errorf("Expected string author, got %q", found.Get(FieldAuthor))
+	}
+	if found.Get(FieldPublishedAt) != "2023-12-01" {
+		t.Errorf("Expected date-only value, got %q", found.Get(FieldPublishedAt))
+	}
+}
+
+func TestNormalizeDate(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"2024-01-02T03:04:05Z", "2024-01-02T03:04:05Z"},
+		{"2024-01-02T03:04:05+0000", "2024-01-02T03:04:05Z"},
+		{"2024-01-02T03:04:05.123Z", "2024-01-02T03:04:05Z"},
+		{"2024-01-02", "2024-01-02"},
+		{"March 5, 2024", "2024-03-05"},
+		{"yesterday", ""},
+	}
+
+	for _, tc := range testCases {
+		if result := normalizeDate(tc.input); result != tc.expected {
+			t.Errorf("For %s: expected %q, got %q", tc.input, tc.expected, result)
+		}
+	}
+}
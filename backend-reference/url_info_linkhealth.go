@@ -0,0 +1,634 @@
+// Link health monitoring
+// A curated target URL is stored once and then rots quietly. A LinkMonitor
+// rechecks tracked links in the background through a Fetcher, classifies each
+// result (ok, redirected, not found, gone, parked domain, soft 404), keeps a
+// short history and backs off on links that keep failing. Permanent redirects
+// are reported through OnMoved so the article's target URL can follow them.
+//
+// Endpoint: GET /client/article/space/health/{namespace}[?detail=full]
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrLinkNotTracked is returned by LinkHealthStore.Get for an unknown URL
+var ErrLinkNotTracked = errors.New("link is not tracked")
+
+// ErrSpaceNotFound is returned by a SpaceArticleSource for an unknown namespace
+var ErrSpaceNotFound = errors.New("space not found")
+
+// Link monitor defaults, used for zero LinkMonitorConfig fields
+const (
+	defaultLinkCheckInterval = 7 * 24 * time.Hour
+	defaultLinkRetryInterval = time.Hour
+	defaultLinkMaxInterval   = 30 * 24 * time.Hour
+	defaultLinkPollInterval  = time.Minute
+	defaultLinkBatchSize     = 50
+	maxLinkHistory           = 20
+)
+
+// Values of LinkHealth.Status
+const (
+	LinkStatusUnchecked   = "unchecked"
+	LinkStatusOK          = "ok"
+	LinkStatusRedirected  = "redirected"  // see movedTo when the redirect is permanent
+	LinkStatusNotFound    = "not_found"   // 404
+	LinkStatusGone        = "gone"        // 410, or the domain no longer resolves
+	LinkStatusParked      = "parked"      // a domain parking or for-sale page
+	LinkStatusSoft404     = "soft_404"    // answers 200 but says the page is missing
+	LinkStatusUnreachable = "unreachable" // timeouts, connection and TLS errors, 5xx
+	LinkStatusBlocked     = "blocked"     // the site refuses crawlers; health unknown
+	LinkStatusInvalid     = "invalid"     // not a fetchable URL
+	LinkStatusError       = "error"
+)
+
+// LinkCheck is one recheck of a link
+type LinkCheck struct {
+	CheckedAt  time.Time `json:"checkedAt"`
+	Status     string    `json:"status"`
+	HTTPStatus int       `json:"httpStatus,omitempty"`
+	FinalURL   string    `json:"finalUrl,omitempty"`
+}
+
+// LinkHealth is the state of a tracked link
+type LinkHealth struct {
+	URL        string `json:"url"`
+	Status     string `json:"status"`
+	HTTPStatus int    `json:"httpStatus,omitempty"`
+	FinalURL   string `json:"finalUrl,omitempty"`
+
+	// Where the link permanently moved: the page's canonical URL after a
+	// 301/308 chain, or the redirect target
+	MovedTo string `json:"movedTo,omitempty"`
+
+	Failures    int       `json:"failures,omitempty"` // consecutive broken checks
+	BrokenSince time.Time `json:"brokenSince,omitzero"`
+	SnapshotAt  time.Time `json:"snapshotAt,omitzero"` // last archived copy from before it broke
+	CheckedAt   time.Time `json:"checkedAt,omitzero"`
+	NextCheckAt time.Time `json:"nextCheckAt"`
+
+	History []LinkCheck `json:"history,omitempty"` // oldest first
+}
+
+// Broken reports whether the last check found the link dead or replaced
+func (h *LinkHealth) Broken() bool {
+	switch h.Status {
+	case LinkStatusUnchecked, LinkStatusOK, LinkStatusRedirected, LinkStatusBlocked:
+		return false
+	}
+	return true
+}
+
+// LinkHealthStore persists link health by URL. Implementations must be safe
+// for concurrent use; MemoryLinkStore is the default, a database table can be
+// plugged in so health survives restarts.
+type LinkHealthStore interface {
+	Get(ctx context.Context, url string) (*LinkHealth, error)
+	Put(ctx context.Context, health *LinkHealth) error
+	// Due returns up to limit links whose next check is at or before now,
+	// longest overdue first
+	Due(ctx context.Context, now time.Time, limit int) ([]*LinkHealth, error)
+}
+
+// MemoryLinkStore is an in-memory LinkHealthStore
+type MemoryLinkStore struct {
+	mu    sync.Mutex
+	links map[string]*LinkHealth
+}
+
+// NewMemoryLinkStore creates an empty store
+func NewMemoryLinkStore() *MemoryLinkStore {
+	return &MemoryLinkStore{links: make(map[string]*LinkHealth)}
+}
+
+func (s *MemoryLinkStore) Get(_ context.Context, url string) (*LinkHealth, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h, ok := s.links[url]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrLinkNotTracked, url)
+	}
+	return h.clone(), nil
+}
+
+func (s *MemoryLinkStore) Put(_ context.Context, health *LinkHealth) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.links[health.URL] = health.clone()
+	return nil
+}
+
+func (s *MemoryLinkStore) Due(_ context.Context, now time.Time, limit int) ([]*LinkHealth, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []*LinkHealth
+	for _, h := range s.links {
+		if !h.NextCheckAt.After(now) {
+			due = append(due, h.clone())
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextCheckAt.Before(due[j].NextCheckAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+// clone copies h so stored records are never shared with callers
+func (h *LinkHealth) clone() *LinkHealth {
+	c := *h
+	c.History = append([]LinkCheck(nil), h.History...)
+	return &c
+}
+
+// LinkMonitorConfig configures a LinkMonitor. Zero values use defaults.
+type LinkMonitorConfig struct {
+	// Store defaults to a MemoryLinkStore
+	Store LinkHealthStore
+
+	CheckInterval time.Duration // between checks of a link that is not broken
+	RetryInterval time.Duration // first recheck of a broken link; doubles per failure
+	MaxInterval   time.Duration // cap for the backoff
+	PollInterval  time.Duration // how often Run looks for due links
+	BatchSize     int           // links checked per poll
+
+	// OnMoved is called when a link is found to have permanently moved, e.g.
+	// to update SpaceArticle.TargetURL
+	OnMoved func(ctx context.Context, from, to string)
+
+	// Archive, when set, is searched for a copy of broken links; usually the
+	// fetcher's archive
+	Archive *WebArchive
+
+	// Now is the scheduling clock
+	Now func() time.Time
+}
+
+// LinkMonitor rechecks tracked links on a schedule
+type LinkMonitor struct {
+	fetcher *Fetcher
+	config  LinkMonitorConfig
+}
+
+// NewLinkMonitor creates a monitor checking links through fetcher
+func NewLinkMonitor(fetcher *Fetcher, config LinkMonitorConfig) *LinkMonitor {
+	if config.Store == nil {
+		config.Store = NewMemoryLinkStore()
+	}
+	if config.CheckInterval <= 0 {
+		config.CheckInterval = defaultLinkCheckInterval
+	}
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = defaultLinkRetryInterval
+	}
+	if config.MaxInterval <= 0 {
+		config.MaxInterval = defaultLinkMaxInterval
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = defaultLinkPollInterval
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaultLinkBatchSize
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+	return &LinkMonitor{fetcher: fetcher, config: config}
+}
+
+// Track starts monitoring rawURL, due for a check right away, and returns its
+// current health. Tracking a link twice is harmless.
+func (m *LinkMonitor) Track(ctx context.Context, rawURL string) (*LinkHealth, error) {
+	normalized, err := m.fetcher.Validate(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := m.config.Store.Get(ctx, normalized)
+	if err == nil || !errors.Is(err, ErrLinkNotTracked) {
+		return h, err
+	}
+	h = &LinkHealth{URL: normalized, Status: LinkStatusUnchecked, NextCheckAt: m.config.Now()}
+	if err := m.config.Store.Put(ctx, h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Check rechecks rawURL now, tracking it if needed
+func (m *LinkMonitor) Check(ctx context.Context, rawURL string) (*LinkHealth, error) {
+	h, err := m.Track(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return m.check(ctx, h)
+}
+
+// Run checks due links every PollInterval until ctx is done
+func (m *LinkMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := m.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			slog.Warn("linkHealth poll failed", slog.Any("error", err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce checks one batch of due links, at most batchWorkers at a time and
+// batchPerHost per host, and returns how many were checked
+func (m *LinkMonitor) RunOnce(ctx context.Context) (int, error) {
+	due, err := m.config.Store.Due(ctx, m.config.Now(), m.config.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	workers := make(chan struct{}, batchWorkers)
+	hosts := newHostLimiter(batchPerHost)
+	var wg sync.WaitGroup
+	for _, h := range due {
+		wg.Add(1)
+		go func(h *LinkHealth) {
+			defer wg.Done()
+
+			release := hosts.acquire(batchHostKey(h.URL))
+			defer release()
+			workers <- struct{}{}
+			defer func() { <-workers }()
+
+			if ctx.Err() != nil {
+				return
+			}
+			if _, err := m.check(ctx, h); err != nil && ctx.Err() == nil {
+				slog.Warn("linkHealth check failed", slog.String("url", h.URL), slog.Any("error", err))
+			}
+		}(h)
+	}
+	wg.Wait()
+	return len(due), ctx.Err()
+}
+
+// check fetches h.URL past the metadata cache, records the outcome and
+// schedules the next check
+func (m *LinkMonitor) check(ctx context.Context, h *LinkHealth) (*LinkHealth, error) {
+	// A cached or stale copy would hide a dead link
+	m.fetcher.Cache().Invalidate(h.URL)
+	metadata, err := m.fetcher.Fetch(ctx, h.URL)
+	if err != nil && ctx.Err() != nil {
+		return nil, err
+	}
+	now := m.config.Now()
+
+	// Our own rate limit says nothing about the site; try again soon
+	if errors.Is(err, errHostThrottled) {
+		h.NextCheckAt = now.Add(m.config.RetryInterval)
+		return h, m.config.Store.Put(ctx, h)
+	}
+	if err != nil {
+		metadata = failureMetadata(err)
+	}
+
+	check := LinkCheck{
+		CheckedAt:  now,
+		Status:     classifyLink(h.URL, metadata),
+		HTTPStatus: metadata.HTTPStatus,
+		FinalURL:   metadata.FinalURL,
+	}
+	movedFrom := h.MovedTo
+	m.record(h, check, metadata)
+	if err := m.findSnapshot(ctx, h); err != nil {
+		slog.Warn("linkHealth snapshot lookup failed", slog.String("url", h.URL), slog.Any("error", err))
+	}
+
+	if err := m.config.Store.Put(ctx, h); err != nil {
+		return nil, err
+	}
+	if h.MovedTo != "" && h.MovedTo != movedFrom && m.config.OnMoved != nil {
+		m.config.OnMoved(ctx, h.URL, h.MovedTo)
+	}
+	return h, nil
+}
+
+// record applies check to h
+func (m *LinkMonitor) record(h *LinkHealth, check LinkCheck, metadata *URLMetadata) {
+	h.Status = check.Status
+	h.HTTPStatus = check.HTTPStatus
+	h.FinalURL = check.FinalURL
+	h.CheckedAt = check.CheckedAt
+	h.History = append(h.History, check)
+	if len(h.History) > maxLinkHistory {
+		h.History = h.History[len(h.History)-maxLinkHistory:]
+	}
+
+	if check.Status == LinkStatusRedirected && metadata.RedirectPermanent {
+		h.MovedTo = metadata.FinalURL
+		if metadata.CanonicalURL != "" {
+			h.MovedTo = metadata.CanonicalURL
+		}
+	}
+
+	if !h.Broken() {
+		h.Failures = 0
+		h.BrokenSince = time.Time{}
+		h.NextCheckAt = check.CheckedAt.Add(m.config.CheckInterval)
+		return
+	}
+
+	h.Failures++
+	if h.BrokenSince.IsZero() {
+		h.BrokenSince = check.CheckedAt
+	}
+	h.NextCheckAt = check.CheckedAt.Add(m.backoff(h.Failures))
+}
+
+// findSnapshot points a broken link at the newest archived copy taken before
+// it broke; later captures may already show an error or parking page
+func (m *LinkMonitor) findSnapshot(ctx context.Context, h *LinkHealth) error {
+	if !h.Broken() || m.config.Archive == nil {
+		h.SnapshotAt = time.Time{}
+		return nil
+	}
+	captures, err := m.config.Archive.Captures(ctx, h.URL)
+	if err != nil {
+		return err
+	}
+	h.SnapshotAt = time.Time{}
+	for _, c := range captures {
+		if c.CapturedAt.Before(h.BrokenSince) {
+			h.SnapshotAt = c.CapturedAt
+			break
+		}
+	}
+	return nil
+}
+
+// backoff is the wait before recheck number failures+1 of a broken link
+func (m *LinkMonitor) backoff(failures int) time.Duration {
+	d := m.config.RetryInterval
+	for i := 1; i < failures && d < m.config.MaxInterval; i++ {
+		d *= 2
+	}
+	return min(d, m.config.MaxInterval)
+}
+
+// classifyLink turns a fetch outcome into a link status
+func classifyLink(targetURL string, metadata *URLMetadata) string {
+	switch metadata.FetchStatus {
+	case FetchStatusOK, FetchStatusPartial, FetchStatusNotHTML:
+		// Served; look closer below
+	case FetchStatusHTTPError:
+		switch code := metadata.HTTPStatus; {
+		case code == http.StatusNotFound:
+			return LinkStatusNotFound
+		case code == http.StatusGone:
+			return LinkStatusGone
+		case code == http.StatusUnauthorized, code == http.StatusForbidden, code == http.StatusTooManyRequests:
+			return LinkStatusBlocked
+		case code >= 500:
+			return LinkStatusUnreachable
+		}
+		return LinkStatusError
+	case FetchStatusDNSError:
+		return LinkStatusGone
+	case FetchStatusTimeout, FetchStatusConnectionFailed, FetchStatusTLSError:
+		return LinkStatusUnreachable
+	case FetchStatusBlocked, FetchStatusRobotsDisallowed, FetchStatusThrottled:
+		return LinkStatusBlocked
+	default:
+		return LinkStatusError
+	}
+
+	switch {
+	case parkedPage(metadata):
+		return LinkStatusParked
+	case soft404Page(targetURL, metadata):
+		return LinkStatusSoft404
+	case len(metadata.RedirectChain) > 0 && metadata.FinalURL != "" && cacheKey(metadata.FinalURL) != cacheKey(targetURL):
+		return LinkStatusRedirected
+	}
+	return LinkStatusOK
+}
+
+// parkingHosts serve parking and for-sale pages for expired domains
+var parkingHosts = []string{
+	"sedoparking.com", "sedo.com", "hugedomains.com", "dan.com", "afternic.com",
+	"bodis.com", "parkingcrew.net", "above.com", "undeveloped.com", "buydomains.com",
+	"domainmarket.com", "parklogic.com",
+}
+
+// parkedPhrases appear in the title or description of parking pages
+var parkedPhrases = []string{
+	"domain is for sale", "domain may be for sale", "buy this domain", "domain for sale",
+	"parked free", "parked domain", "domain parking", "this domain has expired",
+	"domain has been registered",
+}
+
+// parkedPage reports whether the page is a domain parking or for-sale page
+func parkedPage(metadata *URLMetadata) bool {
+	if u, err := url.Parse(metadata.FinalURL); err == nil && hostMatches(u.Hostname(), parkingHosts) {
+		return true
+	}
+	return containsAny(strings.ToLower(metadata.Title+" "+metadata.Description), parkedPhrases)
+}
+
+// soft404Phrases appear in the titles of error pages served with a 200
+var soft404Phrases = []string{
+	"page not found", "file not found", "post not found", "article not found",
+	"content not found", "page does not exist", "page doesn't exist",
+	"page no longer exists", "no longer available", "page could not be found",
+	"page couldn't be found", "page cannot be found", "page can't be found",
+	"page isn't available", "page is not available", "nothing was found",
+}
+
+// soft404Title matches titles that lead with the error, e.g. "404 | Site" or
+// "Not Found"
+var soft404Title = regexp.MustCompile(`(?i)^\W*(404|not found)\b|\b(error|http) ?404\b|\b404 error\b`)
+
+// soft404Page reports whether a page served as a success is really an error
+// page: its title says so, or a deep link was redirected to the home page
+func soft404Page(targetURL string, metadata *URLMetadata) bool {
+	title := strings.ToLower(metadata.Title)
+	if soft404Title.MatchString(title) || containsAny(title, soft404Phrases) {
+		return true
+	}
+
+	if len(metadata.RedirectChain) == 0 {
+		return false
+	}
+	from, err1 := url.Parse(targetURL)
+	to, err2 := url.Parse(metadata.FinalURL)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	return strings.Trim(from.Path, "/") != "" && strings.Trim(to.Path, "/") == "" && to.RawQuery == ""
+}
+
+func containsAny(s string, phrases []string) bool {
+	for _, p := range phrases {
+		if strings.Contains(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// SpaceArticle is a curated link in a space, as GetSpaceInfo lists it
+type SpaceArticle struct {
+	ID        int64  `json:"id"`
+	UUID      string `json:"uuid"`
+	Title     string `json:"title"`
+	TargetURL string `json:"targetUrl"`
+}
+
+// SpaceArticleSource lists the articles of a space by namespace; the article
+// service implements it. An unknown namespace returns ErrSpaceNotFound.
+type SpaceArticleSource interface {
+	SpaceArticles(ctx context.Context, namespace string) ([]SpaceArticle, error)
+}
+
+// SpaceLinkHealth is the health of one article's target URL
+type SpaceLinkHealth struct {
+	ArticleID int64  `json:"articleId"`
+	Title     string `json:"title"`
+	TargetURL string `json:"targetUrl"`
+	*LinkHealth
+
+	// The archived copy to show instead, for broken links that have one
+	SnapshotURL string `json:"snapshotUrl,omitempty"`
+}
+
+// SpaceHealthReport summarizes the link health of a space
+type SpaceHealthReport struct {
+	Namespace string            `json:"namespace"`
+	Total     int               `json:"total"`
+	Broken    int               `json:"broken"`
+	Summary   map[string]int    `json:"summary"` // links per status
+	Links     []SpaceLinkHealth `json:"links"`   // broken first
+}
+
+// SpaceHealthResponse is the health report API response
+type SpaceHealthResponse struct {
+	Status int                `json:"status"`
+	Msg    string             `json:"msg"`
+	Code   string             `json:"code,omitempty"`
+	Data   *SpaceHealthReport `json:"data,omitempty"`
+}
+
+// ErrCodeSpaceNotFound is returned for an unknown namespace
+const ErrCodeSpaceNotFound = "space_not_found"
+
+// NewSpaceHealthHandler returns a /client/article/space/health/{namespace}
+// handler. Links not yet tracked start being monitored and are reported as
+// unchecked.
+func NewSpaceHealthHandler(monitor *LinkMonitor, spaces SpaceArticleSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		serveSpaceHealth(monitor, spaces, w, r)
+	}
+}
+
+func serveSpaceHealth(monitor *LinkMonitor, spaces SpaceArticleSource, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		sendSpaceHealthError(w, http.StatusMethodNotAllowed, "", "Method not allowed")
+		return
+	}
+
+	// Routers other than http.ServeMux leave PathValue empty
+	namespace := r.PathValue("namespace")
+	if namespace == "" {
+		namespace = path.Base(r.URL.Path)
+	}
+
+	articles, err := spaces.SpaceArticles(r.Context(), namespace)
+	if errors.Is(err, ErrSpaceNotFound) {
+		sendSpaceHealthError(w, http.StatusNotFound, ErrCodeSpaceNotFound, "space not found")
+		return
+	}
+	if err != nil {
+		sendSpaceHealthError(w, http.StatusInternalServerError, "", fmt.Sprintf("Failed to load space: %v", err))
+		return
+	}
+
+	report, err := spaceHealthReport(r.Context(), monitor, namespace, articles, r.URL.Query().Get("detail") == "full")
+	if err != nil {
+		sendSpaceHealthError(w, http.StatusInternalServerError, "", fmt.Sprintf("Failed to load link health: %v", err))
+		return
+	}
+	json.NewEncoder(w).Encode(SpaceHealthResponse{Status: 1, Msg: "success", Data: report})
+}
+
+// spaceHealthReport looks up every article's link, tracking new ones. The
+// check history is only included with detail.
+func spaceHealthReport(ctx context.Context, monitor *LinkMonitor, namespace string, articles []SpaceArticle, detail bool) (*SpaceHealthReport, error) {
+	report := &SpaceHealthReport{
+		Namespace: namespace,
+		Total:     len(articles),
+		Summary:   make(map[string]int),
+		Links:     make([]SpaceLinkHealth, 0, len(articles)),
+	}
+
+	for _, article := range articles {
+		var h *LinkHealth
+		if _, err := monitor.fetcher.Validate(article.TargetURL); err != nil {
+			h = &LinkHealth{URL: article.TargetURL, Status: LinkStatusInvalid}
+		} else if h, err = monitor.Track(ctx, article.TargetURL); err != nil {
+			return nil, err
+		}
+		if !detail {
+			h.History = nil
+		}
+
+		report.Summary[h.Status]++
+		if h.Broken() {
+			report.Broken++
+		}
+		link := SpaceLinkHealth{
+			ArticleID:  article.ID,
+			Title:      article.Title,
+			TargetURL:  article.TargetURL,
+			LinkHealth: h,
+		}
+		if !h.SnapshotAt.IsZero() && article.UUID != "" {
+			link.SnapshotURL = "/client/article/" + url.PathEscape(article.UUID) + "/snapshot?at=" + h.SnapshotAt.UTC().Format("20060102150405")
+		}
+		report.Links = append(report.Links, link)
+	}
+
+	sort.SliceStable(report.Links, func(i, j int) bool {
+		return report.Links[i].Broken() && !report.Links[j].Broken()
+	})
+	return report, nil
+}
+
+// sendSpaceHealthError sends an error response
+func sendSpaceHealthError(w http.ResponseWriter, statusCode int, code, message string) {
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(SpaceHealthResponse{
+		Status: 0,
+		Msg:    message,
+		Code:   code,
+	})
+}
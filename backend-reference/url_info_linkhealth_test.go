@@ -0,0 +1,270 @@
+// Package handler tests for link health monitoring
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClassifyLink(t *testing.T) {
+	testCases := []struct {
+		name     string
+		target   string
+		metadata URLMetadata
+		expected string
+	}{
+		{"ok", "https://example.com/post", URLMetadata{FetchStatus: FetchStatusOK, Title: "A post"}, LinkStatusOK},
+		{"pdf", "https://example.com/paper.pdf", URLMetadata{FetchStatus: FetchStatusNotHTML}, LinkStatusOK},
+		{"404", "https://example.com/post", URLMetadata{FetchStatus: FetchStatusHTTPError, HTTPStatus: 404}, LinkStatusNotFound},
+		{"410", "https://example.com/post", URLMetadata{FetchStatus: FetchStatusHTTPError, HTTPStatus: 410}, LinkStatusGone},
+		{"503", "https://example.com/post", URLMetadata{FetchStatus: FetchStatusHTTPError, HTTPStatus: 503}, LinkStatusUnreachable},
+		{"403", "https://example.com/post", URLMetadata{FetchStatus: FetchStatusHTTPError, HTTPStatus: 403}, LinkStatusBlocked},
+		{"dns", "https://expired.example/post", URLMetadata{FetchStatus: FetchStatusDNSError}, LinkStatusGone},
+		{"timeout", "https://example.com/post", URLMetadata{FetchStatus: FetchStatusTimeout}, LinkStatusUnreachable},
+		{"robots", "https://example.com/post", URLMetadata{FetchStatus: FetchStatusRobotsDisallowed}, LinkStatusBlocked},
+		{"parked title", "https://example.com/post", URLMetadata{FetchStatus: FetchStatusOK, Title: "example.com - This domain is for sale!"}, LinkStatusParked},
+		{"parking host", "https://example.com/post", URLMetadata{FetchStatus: FetchStatusOK, FinalURL: "https://www.hugedomains.com/domain_profile.cfm?d=example.com", RedirectChain: []string{"https://example.com/post"}}, LinkStatusParked},
+		{"soft 404 title", "https://example.com/post", URLMetadata{FetchStatus: FetchStatusOK, Title: "Page Not Found | Example"}, LinkStatusSoft404},
+		{"leading 404", "https://example.com/post", URLMetadata{FetchStatus: FetchStatusOK, Title: "404 - Example"}, LinkStatusSoft404},
+		{"404 in a real title", "https://example.com/post", URLMetadata{FetchStatus: FetchStatusOK, Title: "Designing a better 404 page"}, LinkStatusOK},
+		{"redirect home", "https://example.com/2020/old-post", URLMetadata{FetchStatus: FetchStatusOK, Title: "Example", FinalURL: "https://example.com/", RedirectChain: []string{"https://example.com/2020/old-post"}}, LinkStatusSoft404},
+		{"redirected", "https://example.com/old", URLMetadata{FetchStatus: FetchStatusOK, Title: "Post", FinalURL: "https://example.com/new", RedirectChain: []string{"https://example.com/old"}}, LinkStatusRedirected},
+		{"tracking only", "https://example.com/post", URLMetadata{FetchStatus: FetchStatusOK, Title: "Post", FinalURL: "https://example.com/post?utm_source=x", RedirectChain: []string{"https://example.com/post"}}, LinkStatusOK},
+	}
+
+	for _, tc := range testCases {
+		if got := classifyLink(tc.target, &tc.metadata); got != tc.expected {
+			t.Errorf("%s: expected %s, got %s", tc.name, tc.expected, got)
+		}
+	}
+}
+
+// testClock is a settable clock for the monitor
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestLinkMonitor_BackoffAndRecovery(t *testing.T) {
+	var mu sync.Mutex
+	status := http.StatusNotFound
+	fetcher := NewFetcher(FetcherConfig{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if req.URL.Path != "/post" {
+				return cannedResponse(req, http.StatusNotFound, "text/plain", ""), nil
+			}
+			return cannedResponse(req, status, "text/html", "<html><head><title>Post</title></head></html>"), nil
+		}),
+	})
+	clock := &testClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	monitor := NewLinkMonitor(fetcher, LinkMonitorConfig{Now: clock.Now})
+	ctx := context.Background()
+
+	// Broken: rechecked after 1h, 2h, 4h
+	for i, expected := range []time.Duration{time.Hour, 2 * time.Hour, 4 * time.Hour} {
+		h, err := monitor.Check(ctx, "https://example.com/post")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if h.Status != LinkStatusNotFound || h.Failures != i+1 || h.NextCheckAt.Sub(h.CheckedAt) != expected {
+			t.Errorf("Check %d: unexpected health %+v", i+1, h)
+		}
+		clock.Advance(expected)
+	}
+
+	// Back up: failures reset, normal schedule, history kept
+	mu.Lock()
+	status = http.StatusOK
+	mu.Unlock()
+	h, err := monitor.Check(ctx, "https://example.com/post")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if h.Status != LinkStatusOK || h.Failures != 0 || !h.BrokenSince.IsZero() || h.NextCheckAt.Sub(h.CheckedAt) != defaultLinkCheckInterval {
+		t.Errorf("Unexpected health after recovery %+v", h)
+	}
+	if len(h.History) != 4 || h.History[0].Status != LinkStatusNotFound || h.History[3].Status != LinkStatusOK {
+		t.Errorf("Unexpected history %+v", h.History)
+	}
+}
+
+func TestLinkMonitor_Backoff(t *testing.T) {
+	monitor := NewLinkMonitor(DefaultFetcher, LinkMonitorConfig{RetryInterval: time.Hour, MaxInterval: 10 * time.Hour})
+	for failures, expected := range map[int]time.Duration{1: time.Hour, 2: 2 * time.Hour, 4: 8 * time.Hour, 5: 10 * time.Hour, 200: 10 * time.Hour} {
+		if got := monitor.backoff(failures); got != expected {
+			t.Errorf("After %d failures: expected %v, got %v", failures, expected, got)
+		}
+	}
+}
+
+func TestLinkMonitor_PermanentRedirect(t *testing.T) {
+	fetcher := NewFetcher(FetcherConfig{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			redirect := func(status int, location string) *http.Response {
+				resp := cannedResponse(req, status, "", "")
+				resp.Header.Set("Location", location)
+				return resp
+			}
+			switch req.URL.Path {
+			case "/moved":
+				return redirect(http.StatusMovedPermanently, "/new"), nil
+			case "/temporary":
+				return redirect(http.StatusFound, "/new"), nil
+			case "/new":
+				return cannedResponse(req, http.StatusOK, "text/html", `<html><head><title>New</title>
+					<link rel="canonical" href="https://example.com/new-post"></head></html>`), nil
+			}
+			return cannedResponse(req, http.StatusNotFound, "text/plain", ""), nil
+		}),
+	})
+
+	var moves []string
+	monitor := NewLinkMonitor(fetcher, LinkMonitorConfig{OnMoved: func(_ context.Context, from, to string) {
+		moves = append(moves, from+" -> "+to)
+	}})
+	ctx := context.Background()
+
+	h, err := monitor.Check(ctx, "https://example.com/moved")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if h.Status != LinkStatusRedirected || h.MovedTo != "https://example.com/new-post" {
+		t.Errorf("Unexpected health %+v", h)
+	}
+
+	// Reported once, not on every recheck
+	if _, err := monitor.Check(ctx, "https://example.com/moved"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(moves) != 1 || moves[0] != "https://example.com/moved -> https://example.com/new-post" {
+		t.Errorf("Unexpected moves %v", moves)
+	}
+
+	h, err = monitor.Check(ctx, "https://example.com/temporary")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if h.Status != LinkStatusRedirected || h.MovedTo != "" {
+		t.Errorf("Expected a temporary redirect not to move the link, got %+v", h)
+	}
+}
+
+func TestLinkMonitor_RunOnce(t *testing.T) {
+	fetcher := newCannedFetcher(FetcherConfig{}, map[string]string{
+		"https://a.example/":     "<html><head><title>A</title></head></html>",
+		"https://b.example/post": "<html><head><title>B</title></head></html>",
+	})
+	clock := &testClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	monitor := NewLinkMonitor(fetcher, LinkMonitorConfig{Now: clock.Now})
+	ctx := context.Background()
+
+	for _, u := range []string{"https://a.example/", "https://b.example/post", "https://b.example/gone"} {
+		if _, err := monitor.Track(ctx, u); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if n, err := monitor.RunOnce(ctx); n != 3 || err != nil {
+		t.Errorf("Expected 3 checks, got %d %v", n, err)
+	}
+	if n, _ := monitor.RunOnce(ctx); n != 0 {
+		t.Errorf("Expected nothing due, got %d", n)
+	}
+
+	// Only the broken link is due after the first retry interval
+	clock.Advance(defaultLinkRetryInterval)
+	due, _ := monitor.config.Store.Due(ctx, clock.Now(), 10)
+	if len(due) != 1 || due[0].URL != "https://b.example/gone" || due[0].Status != LinkStatusNotFound {
+		t.Errorf("Unexpected due links %+v", due)
+	}
+}
+
+// testSpaces is a SpaceArticleSource over a map
+type testSpaces map[string][]SpaceArticle
+
+func (s testSpaces) SpaceArticles(_ context.Context, namespace string) ([]SpaceArticle, error) {
+	articles, ok := s[namespace]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSpaceNotFound, namespace)
+	}
+	return articles, nil
+}
+
+func TestSpaceHealthHandler(t *testing.T) {
+	fetcher := newCannedFetcher(FetcherConfig{}, map[string]string{
+		"https://a.example/post": "<html><head><title>A</title></head></html>",
+	})
+	monitor := NewLinkMonitor(fetcher, LinkMonitorConfig{})
+	spaces := testSpaces{"reading": {
+		{ID: 1, Title: "Fine", TargetURL: "https://a.example/post"},
+		{ID: 2, Title: "Dead", TargetURL: "https://a.example/dead"},
+		{ID: 3, Title: "New", TargetURL: "https://a.example/new"},
+		{ID: 4, Title: "Local", TargetURL: "http://localhost/admin"},
+	}}
+	ctx := context.Background()
+	monitor.Check(ctx, "https://a.example/post")
+	monitor.Check(ctx, "https://a.example/dead")
+
+	mux := http.NewServeMux()
+	mux.Handle("/client/article/space/health/{namespace}", NewSpaceHealthHandler(monitor, spaces))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/client/article/space/health/reading", nil))
+	var resp SpaceHealthResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Status != 1 {
+		t.Fatalf("Unexpected response %d %s", rec.Code, rec.Body)
+	}
+
+	report := resp.Data
+	if report.Total != 4 || report.Broken != 2 {
+		t.Errorf("Unexpected totals %+v", report)
+	}
+	if report.Summary[LinkStatusOK] != 1 || report.Summary[LinkStatusNotFound] != 1 ||
+		report.Summary[LinkStatusUnchecked] != 1 || report.Summary[LinkStatusInvalid] != 1 {
+		t.Errorf("Unexpected summary %v", report.Summary)
+	}
+	if report.Links[0].ArticleID != 2 || report.Links[1].ArticleID != 4 || report.Links[2].ArticleID != 1 {
+		t.Errorf("Expected broken links first, got %+v", report.Links)
+	}
+	if report.Links[0].History != nil {
+		t.Error("Expected history only with detail=full")
+	}
+
+	// The unchecked link is now tracked and due
+	if due, _ := monitor.config.Store.Due(ctx, time.Now(), 10); len(due) != 1 || due[0].URL != "https://a.example/new" {
+		t.Errorf("Expected the new link to be due, got %+v", due)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/client/article/space/health/reading?detail=full", nil))
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if len(resp.Data.Links[0].History) != 1 {
+		t.Errorf("Expected history with detail=full, got %+v", resp.Data.Links[0])
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/client/article/space/health/missing", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown space, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,373 @@
+// Cover image mirroring
+// Hotlinked og:images break, get hotlink-blocked or disappear. A MediaMirror
+// downloads the chosen cover once, validates its type and size, and stores
+// resized variants in an ObjectStore. Re-encoding drops EXIF and other
+// metadata; the EXIF orientation is applied to the pixels first.
+
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"golang.org/x/image/draw"
+)
+
+// Errors for images that cannot be mirrored
+var (
+	errUnsupportedImage = errors.New("unsupported image type")
+	errImageTooLarge    = errors.New("image too large")
+)
+
+// Mirroring defaults
+const (
+	defaultMirrorMaxBytes  = 10 << 20
+	defaultMirrorMaxPixels = 40_000_000 // guards against decompression bombs
+	defaultMirrorQuality   = 82
+)
+
+// defaultMirrorWidths are the variant widths, largest first
+var defaultMirrorWidths = []int{1200, 640, 320}
+
+// mirrorableTypes are the source formats decodeImage accepts
+var mirrorableTypes = map[string]bool{
+	"image/jpeg": true, "image/png": true, "image/gif": true, "image/webp": true,
+}
+
+// ImageEncoder writes variants in one output format
+type ImageEncoder struct {
+	MIMEType  string
+	Extension string
+	Encode    func(w io.Writer, img image.Image, quality int) error
+}
+
+// JPEGEncoder writes JPEG variants
+var JPEGEncoder = ImageEncoder{
+	MIMEType:  "image/jpeg",
+	Extension: "jpg",
+	Encode: func(w io.Writer, img image.Image, quality int) error {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	},
+}
+
+// MediaConfig configures a MediaMirror. Zero values use defaults.
+type MediaConfig struct {
+	MaxBytes  int64 // largest source file accepted
+	MaxPixels int   // largest source width*height accepted
+	Widths    []int // variant widths; images are never upscaled
+	Quality   int
+
+	// Encoders are the output formats, preferred first. The default stores
+	// WebP variants with JPEG ones for clients that cannot show WebP.
+	Encoders []ImageEncoder
+}
+
+// MirroredImage describes the stored copies of a cover image
+type MirroredImage struct {
+	Source   string         `json:"source"` // original URL
+	URL      string         `json:"url"`    // largest variant in the preferred format
+	Width    int            `json:"width"`
+	Height   int            `json:"height"`
+	Variants []ImageVariant `json:"variants"`
+}
+
+// ImageVariant is one stored size and format
+type ImageVariant struct {
+	URL      string `json:"url"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	MIMEType string `json:"mimeType"`
+}
+
+// MediaMirror copies cover images into an ObjectStore
+type MediaMirror struct {
+	store  ObjectStore
+	config MediaConfig
+}
+
+// NewMediaMirror creates a mirror writing to store
+func NewMediaMirror(store ObjectStore, config MediaConfig) *MediaMirror {
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = defaultMirrorMaxBytes
+	}
+	if config.MaxPixels <= 0 {
+		config.MaxPixels = defaultMirrorMaxPixels
+	}
+	if len(config.Widths) == 0 {
+		config.Widths = defaultMirrorWidths
+	}
+	config.Widths = slices.Clone(config.Widths)
+	slices.SortFunc(config.Widths, func(a, b int) int { return b - a })
+	if config.Quality <= 0 {
+		config.Quality = defaultMirrorQuality
+	}
+	if len(config.Encoders) == 0 {
+		config.Encoders = []ImageEncoder{WebPEncoder, JPEGEncoder}
+	}
+	return &MediaMirror{store: store, config: config}
+}
+
+// Mirror stores variants of the image at imageURL, downloading it through
+// fetcher. An image mirrored before is not downloaded again.
+func (m *MediaMirror) Mirror(ctx context.Context, fetcher *Fetcher, imageURL string) (*MirroredImage, error) {
+	return m.mirror(ctx, imageURL, func() (*downloadedImage, error) {
+		return downloadImage(ctx, fetcher, imageURL, m.config.MaxBytes)
+	})
+}
+
+// mirror is Mirror with the download supplied by the caller, so a cover the
+// pipeline already downloaded is reused
+func (m *MediaMirror) mirror(ctx context.Context, imageURL string, download func() (*downloadedImage, error)) (*MirroredImage, error) {
+	sum := sha256.Sum256([]byte(imageURL))
+	hash := hex.EncodeToString(sum[:])
+	prefix := "media/" + hash[:2] + "/" + hash[:32]
+
+	if data, err := m.store.Get(ctx, prefix+"/image.json"); err == nil {
+		var mirrored MirroredImage
+		if err := json.Unmarshal(data, &mirrored); err == nil {
+			return &mirrored, nil
+		}
+	} else if !errors.Is(err, ErrObjectNotFound) {
+		return nil, err
+	}
+
+	file, err := download()
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(file.Data)) > m.config.MaxBytes {
+		return nil, fmt.Errorf("%w: over %d bytes", errImageTooLarge, m.config.MaxBytes)
+	}
+
+	src, orientation, err := decodeImage(file.Data, file.ContentType, m.config.MaxPixels)
+	if err != nil {
+		return nil, err
+	}
+
+	mirrored := &MirroredImage{Source: imageURL}
+	width, height := orientedSize(src.Bounds().Dx(), src.Bounds().Dy(), orientation)
+	for _, w := range variantWidths(m.config.Widths, width) {
+		h := max(1, (height*w+width/2)/width)
+		img := orient(scaleImage(src, w, h, orientation), orientation)
+
+		for _, enc := range m.config.Encoders {
+			var buf bytes.Buffer
+			if err := enc.Encode(&buf, img, m.config.Quality); err != nil {
+				return nil, fmt.Errorf("failed to encode %s: %w", enc.MIMEType, err)
+			}
+			key := prefix + "/" + strconv.Itoa(w) + "." + enc.Extension
+			if err := m.store.Put(ctx, key, buf.Bytes(), enc.MIMEType); err != nil {
+				return nil, fmt.Errorf("failed to store %s: %w", key, err)
+			}
+			mirrored.Variants = append(mirrored.Variants, ImageVariant{URL: m.store.URL(key), Width: w, Height: h, MIMEType: enc.MIMEType})
+		}
+	}
+
+	// Preferred format first, largest first within it
+	slices.SortStableFunc(mirrored.Variants, func(a, b ImageVariant) int {
+		return m.encoderRank(a.MIMEType) - m.encoderRank(b.MIMEType)
+	})
+	best := mirrored.Variants[0]
+	mirrored.URL, mirrored.Width, mirrored.Height = best.URL, best.Width, best.Height
+
+	// Written last, so a partly mirrored image is retried
+	index, _ := json.Marshal(mirrored)
+	if err := m.store.Put(ctx, prefix+"/image.json", index, "application/json"); err != nil {
+		return nil, err
+	}
+	return mirrored, nil
+}
+
+// downloadedImage is a fetched image file
+type downloadedImage struct {
+	URL         string
+	Data        []byte
+	ContentType string
+	Header      http.Header
+}
+
+// downloadImage fetches an image of at most maxBytes
+func downloadImage(ctx context.Context, fetcher *Fetcher, imageURL string, maxBytes int64) (*downloadedImage, error) {
+	// One byte over the limit tells a large file from one exactly at it
+	data, header, err := fetcher.Resource(ctx, imageURL, "image/avif,image/webp,image/*;q=0.8", maxBytes+1)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("%w: over %d bytes", errImageTooLarge, maxBytes)
+	}
+	return &downloadedImage{URL: imageURL, Data: data, ContentType: header.Get("Content-Type"), Header: header}, nil
+}
+
+// decodeImage checks the type and dimensions before decoding the whole image,
+// and returns its EXIF orientation
+func decodeImage(data []byte, contentType string, maxPixels int) (image.Image, int, error) {
+	mimeType := imageMIMEType(data, contentType)
+	if !mirrorableTypes[mimeType] {
+		return nil, 0, fmt.Errorf("%w: %s", errUnsupportedImage, mimeType)
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", errUnsupportedImage, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxPixels {
+		return nil, 0, fmt.Errorf("%w: %dx%d", errImageTooLarge, cfg.Width, cfg.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	orientation := 1
+	if mimeType == "image/jpeg" {
+		orientation = jpegOrientation(data)
+	}
+	return img, orientation, nil
+}
+
+func (m *MediaMirror) encoderRank(mimeType string) int {
+	return slices.IndexFunc(m.config.Encoders, func(e ImageEncoder) bool { return e.MIMEType == mimeType })
+}
+
+// variantWidths returns the configured widths that fit within width, with the
+// largest clamped to width itself
+func variantWidths(widths []int, width int) []int {
+	var out []int
+	for _, w := range widths {
+		w = min(w, width)
+		if len(out) == 0 || w < out[len(out)-1] {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// scaleImage resizes src so that, once oriented, it is w x h. Transparent
+// areas are flattened onto white.
+func scaleImage(src image.Image, w, h, orientation int) *image.RGBA {
+	if orientation >= 5 {
+		w, h = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Over, nil)
+	return dst
+}
+
+// orientedSize is the displayed size of a w x h image with an EXIF orientation
+func orientedSize(w, h, orientation int) (int, int) {
+	if orientation >= 5 {
+		return h, w
+	}
+	return w, h
+}
+
+// orient applies an EXIF orientation (2-8) to img
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	dw, dh := orientedSize(w, h, orientation)
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			dst.SetRGBA(dx, dy, img.RGBAAt(x, y))
+		}
+	}
+	return dst
+}
+
+// jpegOrientation reads the EXIF orientation tag of a JPEG, 1 when absent
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 { // image data starts; no EXIF before it
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+// exifOrientation finds tag 0x0112 in the first IFD of a TIFF structure
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 1
+		}
+	}
+	return 1
+}
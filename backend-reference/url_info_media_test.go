@@ -0,0 +1,234 @@
+// Package handler tests for cover image mirroring
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// testImage encodes a w x h image whose left half is red
+func testImage(t *testing.T, w, h int, encode func(*bytes.Buffer, image.Image) error) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if x < w/2 {
+				img.Set(x, y, color.NRGBA{R: 255, A: 255})
+			} else {
+				img.Set(x, y, color.NRGBA{B: 255, A: 128})
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodePNG(buf *bytes.Buffer, img image.Image) error {
+	return png.Encode(buf, img)
+}
+
+func encodeJPEG(buf *bytes.Buffer, img image.Image) error {
+	return jpeg.Encode(buf, img, nil)
+}
+
+// withEXIFOrientation inserts an APP1 segment with the orientation tag
+// (big-endian TIFF) after the JPEG's SOI marker
+func withEXIFOrientation(data []byte, orientation byte) []byte {
+	tiff := []byte{
+		'M', 'M', 0, 42, 0, 0, 0, 8, // header, IFD at offset 8
+		0, 1, // one entry
+		0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, orientation, 0, 0, // Orientation, SHORT, count 1
+		0, 0, 0, 0, // no next IFD
+	}
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := append([]byte{0xFF, 0xE1, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)}, payload...)
+	return append(append([]byte{0xFF, 0xD8}, segment...), data[2:]...)
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	plain := testImage(t, 20, 10, encodeJPEG)
+	if o := jpegOrientation(plain); o != 1 {
+		t.Errorf("Expected 1 without EXIF, got %d", o)
+	}
+	if o := jpegOrientation(withEXIFOrientation(plain, 6)); o != 6 {
+		t.Errorf("Expected 6, got %d", o)
+	}
+	if o := jpegOrientation([]byte("not a jpeg")); o != 1 {
+		t.Errorf("Expected 1 for garbage, got %d", o)
+	}
+}
+
+func TestVariantWidths(t *testing.T) {
+	testCases := []struct {
+		width    int
+		expected []int
+	}{
+		{2000, []int{1200, 640, 320}},
+		{800, []int{800, 640, 320}},
+		{640, []int{640, 320}},
+		{200, []int{200}},
+	}
+	for _, tc := range testCases {
+		got := variantWidths(defaultMirrorWidths, tc.width)
+		if len(got) != len(tc.expected) {
+			t.Errorf("For %d: expected %v, got %v", tc.width, tc.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.expected[i] {
+				t.Errorf("For %d: expected %v, got %v", tc.width, tc.expected, got)
+			}
+		}
+	}
+}
+
+func TestMediaMirror_Mirror(t *testing.T) {
+	photo := withEXIFOrientation(testImage(t, 800, 400, encodeJPEG), 6)
+	var downloads int32
+	fetcher := NewFetcher(FetcherConfig{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			atomic.AddInt32(&downloads, 1)
+			return cannedResponse(req, http.StatusOK, "image/jpeg", string(photo)), nil
+		}),
+	})
+
+	dir := t.TempDir()
+	mirror := NewMediaMirror(NewLocalStore(dir, "https://media.example.com"), MediaConfig{})
+	mirrored, err := mirror.Mirror(context.Background(), fetcher, "https://example.com/photo.jpg")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Rotated a quarter turn by the EXIF orientation, in WebP and JPEG
+	if mirrored.Width != 400 || mirrored.Height != 800 || len(mirrored.Variants) != 4 || !strings.HasSuffix(mirrored.URL, ".webp") {
+		t.Fatalf("Unexpected result %+v", mirrored)
+	}
+	if mirrored.Source != "https://example.com/photo.jpg" || !strings.HasPrefix(mirrored.URL, "https://media.example.com/media/") {
+		t.Errorf("Unexpected URLs %+v", mirrored)
+	}
+
+	for _, v := range mirrored.Variants {
+		data, err := os.ReadFile(filepath.Join(dir, strings.TrimPrefix(v.URL, "https://media.example.com/")))
+		if err != nil {
+			t.Fatalf("Variant %s not stored: %v", v.URL, err)
+		}
+		if bytes.Contains(data, []byte("Exif")) {
+			t.Errorf("Expected EXIF to be stripped from %s", v.URL)
+		}
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil || "image/"+format != v.MIMEType || cfg.Width != v.Width || cfg.Height != v.Height {
+			t.Errorf("Variant %s: expected %dx%d %s, got %dx%d %s %v", v.URL, v.Width, v.Height, v.MIMEType, cfg.Width, cfg.Height, format, err)
+		}
+	}
+
+	// Already mirrored: served from the index without downloading
+	again, err := mirror.Mirror(context.Background(), fetcher, "https://example.com/photo.jpg")
+	if err != nil || again.URL != mirrored.URL {
+		t.Errorf("Expected the stored mirror, got %+v %v", again, err)
+	}
+	if downloads != 1 {
+		t.Errorf("Expected one download, got %d", downloads)
+	}
+}
+
+func TestMediaMirror_Rejects(t *testing.T) {
+	testCases := []struct {
+		name        string
+		contentType string
+		body        []byte
+		config      MediaConfig
+		expected    error
+	}{
+		{"svg", "image/svg+xml", []byte(`<svg xmlns="http://www.w3.org/2000/svg"/>`), MediaConfig{}, errUnsupportedImage},
+		{"html", "text/html", []byte(`<html></html>`), MediaConfig{}, errUnsupportedImage},
+		{"bytes", "image/png", testImage(t, 100, 100, encodePNG), MediaConfig{MaxBytes: 100}, errImageTooLarge},
+		{"pixels", "image/png", testImage(t, 100, 100, encodePNG), MediaConfig{MaxPixels: 5000}, errImageTooLarge},
+	}
+
+	for _, tc := range testCases {
+		fetcher := NewFetcher(FetcherConfig{
+			Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				return cannedResponse(req, http.StatusOK, tc.contentType, string(tc.body)), nil
+			}),
+		})
+		mirror := NewMediaMirror(NewLocalStore(t.TempDir(), "https://media.example.com"), tc.config)
+		if _, err := mirror.Mirror(context.Background(), fetcher, "https://example.com/cover"); !errors.Is(err, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, err)
+		}
+	}
+}
+
+func TestFetcher_MirrorsCover(t *testing.T) {
+	cover := testImage(t, 300, 200, encodePNG)
+	fetcher := NewFetcher(FetcherConfig{
+		Media: NewMediaMirror(NewLocalStore(t.TempDir(), "https://media.example.com"), MediaConfig{}),
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			switch req.URL.Path {
+			case "/post":
+				return cannedResponse(req, http.StatusOK, "text/html", `<html><head><title>Post</title>
+					<meta property="og:image" content="/cover.png"></head></html>`), nil
+			case "/cover.png":
+				return cannedResponse(req, http.StatusOK, "image/png", string(cover)), nil
+			}
+			return cannedResponse(req, http.StatusNotFound, "text/plain", ""), nil
+		}),
+	})
+
+	metadata, err := fetcher.Fetch(context.Background(), "https://example.com/post")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if metadata.OgImage != "https://example.com/cover.png" {
+		t.Errorf("Expected the original cover URL, got %q", metadata.OgImage)
+	}
+	if metadata.Mirror == nil || metadata.Mirror.Width != 300 || !strings.HasPrefix(metadata.Mirror.URL, "https://media.example.com/") {
+		t.Errorf("Expected a mirrored cover, got %+v", metadata.Mirror)
+	}
+}
+
+func TestMediaMirror_EncoderPreference(t *testing.T) {
+	cover := testImage(t, 700, 350, encodePNG)
+	fetcher := NewFetcher(FetcherConfig{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			return cannedResponse(req, http.StatusOK, "image/png", string(cover)), nil
+		}),
+	})
+	// Stands in for a third format
+	pngEncoder := ImageEncoder{MIMEType: "image/png", Extension: "png", Encode: func(w io.Writer, img image.Image, _ int) error {
+		return png.Encode(w, img)
+	}}
+
+	mirror := NewMediaMirror(NewLocalStore(t.TempDir(), "https://media.example.com"), MediaConfig{Encoders: []ImageEncoder{pngEncoder, JPEGEncoder}})
+	mirrored, err := mirror.Mirror(context.Background(), fetcher, "https://example.com/cover.png")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var formats []string
+	for _, v := range mirrored.Variants {
+		formats = append(formats, v.MIMEType+"@"+strconv.Itoa(v.Width))
+	}
+	expected := "image/png@700 image/png@640 image/png@320 image/jpeg@700 image/jpeg@640 image/jpeg@320"
+	if got := strings.Join(formats, " "); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+	if !strings.HasSuffix(mirrored.URL, "/700.png") {
+		t.Errorf("Expected the largest PNG variant, got %s", mirrored.URL)
+	}
+}
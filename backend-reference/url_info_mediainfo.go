@@ -0,0 +1,365 @@
+// Video and audio metadata
+// Pages about a video, podcast episode or track describe it with og:video,
+// og:audio, twitter:player and video:duration tags, and with schema.org
+// VideoObject, PodcastEpisode, AudioObject or MusicRecording entities. These
+// become URLMetadata.Media: duration, player and stream URLs, dimensions,
+// upload date and channel, enough for a "12 min video" badge. Site-specific
+// extractors and JSON-LD take precedence field by field over the tags.
+
+package handler
+
+import (
+	"context"
+	"mime"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Values of MediaInfo.Kind
+const (
+	MediaKindVideo = "video"
+	MediaKindAudio = "audio"
+)
+
+// MediaInfo describes the video or audio a page is about
+type MediaInfo struct {
+	Kind            string `json:"kind"` // video or audio
+	DurationSeconds int    `json:"durationSeconds,omitempty"`
+	PlayerURL       string `json:"playerUrl,omitempty"` // embeddable HTML player
+	StreamURL       string `json:"streamUrl,omitempty"` // the media file itself
+	MIMEType        string `json:"mimeType,omitempty"`  // of StreamURL
+	Width           int    `json:"width,omitempty"`
+	Height          int    `json:"height,omitempty"`
+	UploadDate      string `json:"uploadDate,omitempty"` // RFC 3339 or YYYY-MM-DD
+	Channel         string `json:"channel,omitempty"`    // channel, artist or podcast
+}
+
+// fill copies the fields of other that m lacks
+func (m *MediaInfo) fill(other *MediaInfo) {
+	if other == nil {
+		return
+	}
+	if m.Kind == "" {
+		m.Kind = other.Kind
+	}
+	if m.DurationSeconds == 0 {
+		m.DurationSeconds = other.DurationSeconds
+	}
+	if m.PlayerURL == "" {
+		m.PlayerURL = other.PlayerURL
+	}
+	if m.StreamURL == "" {
+		m.StreamURL, m.MIMEType = other.StreamURL, other.MIMEType
+	}
+	if m.Width == 0 && m.Height == 0 {
+		m.Width, m.Height = other.Width, other.Height
+	}
+	if m.UploadDate == "" {
+		m.UploadDate = other.UploadDate
+	}
+	if m.Channel == "" {
+		m.Channel = other.Channel
+	}
+}
+
+// mergeMedia fills the gaps in e's media block from other's
+func (e *Extraction) mergeMedia(other *MediaInfo) {
+	if other == nil {
+		return
+	}
+	if e.Media == nil {
+		e.Media = &MediaInfo{}
+	}
+	e.Media.fill(other)
+}
+
+// isMediaTag reports whether a <meta> property or name describes video or audio
+func isMediaTag(key string) bool {
+	return strings.HasPrefix(key, "og:video") || strings.HasPrefix(key, "og:audio") ||
+		strings.HasPrefix(key, "twitter:player") || strings.HasPrefix(key, "video:") ||
+		key == "music:duration" || key == "music:release_date"
+}
+
+// addMediaTag records a media tag for the media extractor. Order matters:
+// og:video:type and friends describe the og:video before them.
+func (e *Extraction) addMediaTag(key, content string) {
+	if content = strings.TrimSpace(content); content != "" {
+		e.mediaTags = append(e.mediaTags, [2]string{key, content})
+	}
+}
+
+// mediaExtractor assembles the media block from the tags collected by the
+// head and DOM extractors, with the oEmbed embed as a last resort
+type mediaExtractor struct{}
+
+func (mediaExtractor) Name() string { return "media" }
+
+func (mediaExtractor) Extract(_ context.Context, page *Page, found *Extraction) (*Extraction, error) {
+	media := mediaFromTags(found.mediaTags, found.OGType, page)
+
+	// The oEmbed player stands in for missing tags
+	if embed := found.Embed; embed != nil && (embed.Type == "video" || found.Media != nil || media != nil) {
+		if media == nil {
+			media = &MediaInfo{}
+		}
+		if embed.Type == "video" {
+			media.fill(&MediaInfo{Kind: MediaKindVideo, Width: embed.Width, Height: embed.Height})
+		}
+		media.fill(&MediaInfo{Channel: embed.AuthorName})
+	}
+	if media == nil {
+		return nil, nil
+	}
+
+	result := NewExtraction("media")
+	result.Media = media
+	return result, nil
+}
+
+// ogMedia is one og:video or og:audio with its structured properties
+type ogMedia struct {
+	url, mimeType string
+	width, height int
+	audio         bool
+}
+
+// mediaFromTags reads og:video, og:audio, twitter:player and video:* tags. A
+// text/html og:video is a player; one with a video/* or audio/* type is the
+// stream. Flash players are ignored.
+func mediaFromTags(tags [][2]string, ogType string, page *Page) *MediaInfo {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	var items []*ogMedia
+	var current *ogMedia
+	var twitter struct {
+		player, stream, streamType string
+		width, height              int
+	}
+	media := &MediaInfo{}
+
+	for _, tag := range tags {
+		key, value := tag[0], tag[1]
+		switch key {
+		case "og:video", "og:video:url", "og:audio", "og:audio:url":
+			current = &ogMedia{url: value, audio: strings.HasPrefix(key, "og:audio")}
+			items = append(items, current)
+		case "og:video:secure_url", "og:audio:secure_url":
+			if current == nil {
+				current = &ogMedia{url: value, audio: strings.HasPrefix(key, "og:audio")}
+				items = append(items, current)
+			} else if strings.HasPrefix(value, "https://") {
+				current.url = value
+			}
+		case "og:video:type", "og:audio:type":
+			if current != nil {
+				current.mimeType = strings.ToLower(value)
+			}
+		case "og:video:width":
+			if current != nil {
+				current.width = parseDimension(value)
+			}
+		case "og:video:height":
+			if current != nil {
+				current.height = parseDimension(value)
+			}
+		case "twitter:player":
+			twitter.player = value
+		case "twitter:player:width":
+			twitter.width = parseDimension(value)
+		case "twitter:player:height":
+			twitter.height = parseDimension(value)
+		case "twitter:player:stream":
+			twitter.stream = value
+		case "twitter:player:stream:content_type":
+			twitter.streamType = strings.ToLower(value)
+		case "video:duration", "music:duration":
+			if media.DurationSeconds == 0 {
+				media.DurationSeconds, _ = strconv.Atoi(value)
+			}
+		case "video:release_date", "music:release_date":
+			if media.UploadDate == "" {
+				media.UploadDate = normalizeDate(value)
+			}
+		}
+	}
+
+	hasVideo, hasAudio := false, false
+	for _, item := range items {
+		mimeType, _, _ := mime.ParseMediaType(item.mimeType)
+		if mimeType == "" {
+			mimeType = mediaTypeByExtension(item.url)
+		}
+		resolved := mediaURL(item.url, page.URL)
+		switch {
+		case mimeType == "application/x-shockwave-flash" || resolved == "":
+			continue
+		case strings.HasPrefix(mimeType, "video/"), strings.HasPrefix(mimeType, "audio/"), mimeType == "application/x-mpegurl", mimeType == "application/vnd.apple.mpegurl":
+			if media.StreamURL == "" {
+				media.StreamURL, media.MIMEType = resolved, mimeType
+			}
+		default:
+			// text/html, or an untyped URL without a media file extension
+			if media.PlayerURL == "" {
+				media.PlayerURL = resolved
+			}
+		}
+		if media.Width == 0 && item.width > 0 && item.height > 0 {
+			media.Width, media.Height = item.width, item.height
+		}
+		hasVideo = hasVideo || !item.audio
+		hasAudio = hasAudio || item.audio
+	}
+
+	if player := mediaURL(twitter.player, page.URL); player != "" {
+		media.fill(&MediaInfo{PlayerURL: player, Width: twitter.width, Height: twitter.height})
+		hasVideo = hasVideo || !hasAudio
+	}
+	if stream := mediaURL(twitter.stream, page.URL); stream != "" {
+		media.fill(&MediaInfo{StreamURL: stream, MIMEType: twitter.streamType})
+	}
+
+	ogType = strings.ToLower(ogType)
+	switch {
+	case strings.HasPrefix(ogType, "music.") || (hasAudio && !hasVideo) || strings.HasPrefix(media.MIMEType, "audio/"):
+		media.Kind = MediaKindAudio
+	case hasVideo || strings.HasPrefix(ogType, "video."):
+		media.Kind = MediaKindVideo
+	default:
+		// Only a duration or date with nothing to play
+		return nil
+	}
+	return media
+}
+
+// mediaURL resolves a player or stream URL against the page URL and keeps it
+// only when it is http or https: the player ends up in an iframe, where a
+// javascript: or data: URL would run script
+func mediaURL(rawURL string, base *url.URL) string {
+	resolved := resolveURL(strings.TrimSpace(rawURL), base)
+	if !strings.HasPrefix(resolved, "http://") && !strings.HasPrefix(resolved, "https://") {
+		return ""
+	}
+	return resolved
+}
+
+// mediaExtensions maps media file extensions to MIME types
+var mediaExtensions = map[string]string{
+	".mp4": "video/mp4", ".m4v": "video/mp4", ".webm": "video/webm", ".mov": "video/quicktime",
+	".m3u8": "application/vnd.apple.mpegurl", ".mp3": "audio/mpeg", ".m4a": "audio/mp4",
+	".ogg": "audio/ogg", ".oga": "audio/ogg", ".opus": "audio/ogg", ".wav": "audio/wav",
+}
+
+// mediaTypeByExtension guesses the MIME type of a media file URL
+func mediaTypeByExtension(rawURL string) string {
+	rawURL, _, _ = strings.Cut(rawURL, "?")
+	return mediaExtensions[strings.ToLower(path.Ext(rawURL))]
+}
+
+// parseDimension parses a pixel width or height such as 1280 or 1280px
+func parseDimension(value string) int {
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(value), "px"))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// mediaTypes maps schema.org media types to a MediaInfo kind
+var mediaTypes = map[string]string{
+	"VideoObject": MediaKindVideo, "Clip": MediaKindVideo, "Movie": MediaKindVideo, "TVEpisode": MediaKindVideo,
+	"AudioObject": MediaKindAudio, "PodcastEpisode": MediaKindAudio, "MusicRecording": MediaKindAudio,
+}
+
+// media describes the page's video or audio entity: the primary node when it
+// is one, one attached to it as video, audio or associatedMedia, or the first
+// on the page. URLs are resolved against base.
+func (ld *jsonLDDocument) media(base *url.URL) *MediaInfo {
+	node, kind := ld.mediaNode()
+	if node == nil {
+		return nil
+	}
+
+	media := &MediaInfo{
+		Kind:            kind,
+		DurationSeconds: parseISODuration(firstNonEmpty(node.str("duration"), node.str("timeRequired"))),
+		PlayerURL:       mediaURL(firstNonEmpty(node.str("embedUrl"), node.str("embedURL")), base),
+		StreamURL:       mediaURL(node.str("contentUrl"), base),
+		Width:           parseDimension(node.str("width")),
+		Height:          parseDimension(node.str("height")),
+		UploadDate:      normalizeDate(firstNonEmpty(node.str("uploadDate"), node.str("datePublished"))),
+	}
+	if format := node.str("encodingFormat"); strings.Contains(format, "/") {
+		media.MIMEType = format
+	}
+	for _, key := range []string{"partOfSeries", "byArtist", "author", "creator"} {
+		if names := ld.names(node[key]); len(names) > 0 {
+			media.Channel = strings.Join(names, ", ")
+			break
+		}
+	}
+
+	// Podcast episodes put the audio file in a MediaObject
+	if file := ld.firstNode(node["associatedMedia"]); file != nil {
+		other := &MediaInfo{
+			DurationSeconds: parseISODuration(file.str("duration")),
+			StreamURL:       mediaURL(file.str("contentUrl"), base),
+			PlayerURL:       mediaURL(file.str("embedUrl"), base),
+		}
+		if format := file.str("encodingFormat"); strings.Contains(format, "/") {
+			other.MIMEType = format
+		}
+		media.fill(other)
+	}
+	return media
+}
+
+// mediaNode finds the node media reads from and its kind
+func (ld *jsonLDDocument) mediaNode() (jsonLDNode, string) {
+	kindOf := func(node jsonLDNode) string {
+		for _, t := range node.types() {
+			if kind := mediaTypes[t]; kind != "" {
+				return kind
+			}
+		}
+		return ""
+	}
+
+	if main := ld.primary(); main != nil {
+		if kind := kindOf(main); kind != "" {
+			return main, kind
+		}
+		for _, key := range []string{"video", "audio", "associatedMedia"} {
+			if node := ld.firstNode(main[key]); node != nil {
+				if kind := kindOf(node); kind != "" {
+					return node, kind
+				}
+			}
+		}
+	}
+	for _, node := range ld.nodes {
+		if kind := kindOf(node); kind != "" {
+			return node, kind
+		}
+	}
+	return nil, ""
+}
+
+// firstNode returns an object property, or the first object of an array,
+// following @id references
+func (ld *jsonLDDocument) firstNode(value interface{}) jsonLDNode {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return ld.resolve(jsonLDNode(v))
+	case []interface{}:
+		for _, item := range v {
+			if node := ld.firstNode(item); node != nil {
+				return node
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+// Package handler tests for video and audio metadata
+package handler
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestMediaExtractor_OpenGraph(t *testing.T) {
+	page := testPage(t, "https://videos.example.com/watch/42", `<html><head>
+<meta property="og:title" content="Building a Birdhouse">
+<meta property="og:video" content="http://videos.example.com/embed/42">
+<meta property="og:video:secure_url" content="https://videos.example.com/embed/42">
+<meta property="og:video:type" content="text/html">
+<meta property="og:video:width" content="1280">
+<meta property="og:video:height" content="720">
+<meta property="og:video" content="/files/42.swf">
+<meta property="og:video:type" content="application/x-shockwave-flash">
+<meta property="og:video" content="https://cdn.example.com/42.mp4?sig=abc">
+<meta property="video:duration" content="734">
+<meta property="video:release_date" content="2024-05-01">
+<meta name="twitter:player" content="https://videos.example.com/twitter/42">
+<meta name="twitter:player:width" content="640">
+<meta name="twitter:player:height" content="360">
+</head><body></body></html>`)
+	metadata, err := defaultPipeline().Run(context.Background(), page)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := &MediaInfo{
+		Kind:            MediaKindVideo,
+		DurationSeconds: 734,
+		PlayerURL:       "https://videos.example.com/embed/42",
+		StreamURL:       "https://cdn.example.com/42.mp4?sig=abc",
+		MIMEType:        "video/mp4",
+		Width:           1280,
+		Height:          720,
+		UploadDate:      "2024-05-01",
+	}
+	if !reflect.DeepEqual(metadata.Media, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, metadata.Media)
+	}
+	if metadata.Format != FormatVideo {
+		t.Errorf("Expected format video, got %q", metadata.Format)
+	}
+}
+
+func TestMediaExtractor_UnsafeURLs(t *testing.T) {
+	page := testPage(t, "https://videos.example.com/watch/7", `<html><head>
+<meta property="og:video" content="javascript:alert(1)">
+<meta property="og:video:type" content="text/html">
+<meta property="og:video" content=" data:text/html,<script>alert(1)</script>">
+<meta property="og:video" content="//player.example.com/embed/7">
+<meta name="twitter:player" content="javascript:alert(2)">
+<meta name="twitter:player:stream" content="data:video/mp4;base64,AAAA">
+<script type="application/ld+json">
+{"@type": "VideoObject", "name": "Clip", "embedUrl": "javascript:alert(3)", "contentUrl": "/files/7.mp4"}
+</script>
+</head><body></body></html>`)
+	metadata, err := defaultPipeline().Run(context.Background(), page)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if metadata.Media == nil {
+		t.Fatal("Expected media")
+	}
+	if metadata.Media.PlayerURL != "https://player.example.com/embed/7" {
+		t.Errorf("Expected the protocol-relative player, got %q", metadata.Media.PlayerURL)
+	}
+	if metadata.Media.StreamURL != "https://videos.example.com/files/7.mp4" {
+		t.Errorf("Expected the resolved JSON-LD stream, got %q", metadata.Media.StreamURL)
+	}
+
+	page = testPage(t, "https://videos.example.com/watch/8", `<html><head>
+<meta name="twitter:card" content="player">
+<meta name="twitter:player" content="javascript:alert(1)">
+<script type="application/ld+json">
+{"@type": "VideoObject", "name": "Clip", "embedUrl": "data:text/html,x", "contentUrl": "vbscript:msgbox"}
+</script>
+</head><body></body></html>`)
+	metadata, err = defaultPipeline().Run(context.Background(), page)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if metadata.Media != nil && (metadata.Media.PlayerURL != "" || metadata.Media.StreamURL != "") {
+		t.Errorf("Expected no player or stream, got %+v", metadata.Media)
+	}
+}
+
+func TestMediaExtractor_PodcastEpisode(t *testing.T) {
+	page := testPage(t, "https://podcasts.example.com/show/ep-12", `<html><head>
+<meta property="og:audio" content="https://cdn.example.com/ep-12.mp3">
+<script type="application/ld+json">{
+  "@context": "https://schema.org",
+  "@type": "PodcastEpisode",
+  "name": "Episode 12: Compilers",
+  "datePublished": "2024-02-20",
+  "timeRequired": "PT42M",
+  "partOfSeries": {"@type": "PodcastSeries", "name": "Systems Talk"},
+  "associatedMedia": {"@type": "MediaObject", "contentUrl": "https://cdn.example.com/ep-12.m4a", "encodingFormat": "audio/mp4"}
+}</script>
+</head><body></body></html>`)
+	metadata, _ := defaultPipeline().Run(context.Background(), page)
+
+	// JSON-LD wins over og:audio for the stream
+	expected := &MediaInfo{
+		Kind:            MediaKindAudio,
+		DurationSeconds: 2520,
+		StreamURL:       "https://cdn.example.com/ep-12.m4a",
+		MIMEType:        "audio/mp4",
+		UploadDate:      "2024-02-20",
+		Channel:         "Systems Talk",
+	}
+	if !reflect.DeepEqual(metadata.Media, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, metadata.Media)
+	}
+}
+
+func TestMediaExtractor_ArticleWithVideo(t *testing.T) {
+	page := testPage(t, "https://news.example.com/story", `<html><head>
+<meta property="og:type" content="article">
+<script type="application/ld+json">{
+  "@context": "https://schema.org",
+  "@type": "NewsArticle",
+  "headline": "Storm Hits the Coast",
+  "video": {"@type": "VideoObject", "name": "Footage", "duration": "PT1M30S", "embedUrl": "https://news.example.com/embed/7"}
+}</script>
+</head><body></body></html>`)
+	metadata, _ := defaultPipeline().Run(context.Background(), page)
+
+	if m := metadata.Media; m == nil || m.Kind != MediaKindVideo || m.DurationSeconds != 90 || m.PlayerURL != "https://news.example.com/embed/7" {
+		t.Errorf("Unexpected media %+v", m)
+	}
+	// An embedded clip does not make the story a video
+	if metadata.Format != FormatArticle {
+		t.Errorf("Expected format article, got %q", metadata.Format)
+	}
+}
+
+func TestMediaExtractor_NoMedia(t *testing.T) {
+	page := testPage(t, "https://blog.example.com/post", `<html><head>
+<meta property="og:title" content="A Post">
+<meta property="video:duration" content="60">
+</head><body></body></html>`)
+	metadata, _ := defaultPipeline().Run(context.Background(), page)
+	if metadata.Media != nil {
+		t.Errorf("Expected no media, got %+v", metadata.Media)
+	}
+}
+
+func TestMediaHelpers(t *testing.T) {
+	types := map[string]string{
+		"https://cdn.example.com/a.MP4":         "video/mp4",
+		"https://cdn.example.com/a.m3u8?token=": "application/vnd.apple.mpegurl",
+		"/episode.mp3":                          "audio/mpeg",
+		"https://example.com/embed/42":          "",
+	}
+	for input, expected := range types {
+		if got := mediaTypeByExtension(input); got != expected {
+			t.Errorf("mediaTypeByExtension(%q): expected %q, got %q", input, expected, got)
+		}
+	}
+
+	dimensions := map[string]int{"1280": 1280, " 720px": 720, "-1": 0, "auto": 0, "": 0}
+	for input, expected := range dimensions {
+		if got := parseDimension(input); got != expected {
+			t.Errorf("parseDimension(%q): expected %d, got %d", input, expected, got)
+		}
+	}
+}
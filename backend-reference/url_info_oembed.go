@@ -0,0 +1,249 @@
+// oEmbed support for the URL metadata service
+// Known providers (YouTube, Vimeo, Spotify, ...) are called directly from a
+// built-in registry; other sites are handled through <link rel="alternate"
+// type="application/json+oembed"> discovery.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// maxOEmbedBytes bounds the size of an oEmbed JSON response
+const maxOEmbedBytes = 256 * 1024
+
+// Embed is a playable or rich embed described by an oEmbed provider
+type Embed struct {
+	Type         string `json:"type"` // video, rich or photo
+	HTML         string `json:"html,omitempty"`
+	URL          string `json:"url,omitempty"` // image URL for photo embeds
+	Width        int    `json:"width,omitempty"`
+	Height       int    `json:"height,omitempty"`
+	AuthorName   string `json:"authorName,omitempty"`
+	ProviderName string `json:"providerName,omitempty"`
+}
+
+// OEmbedProvider is an oEmbed endpoint and the page URLs it serves
+type OEmbedProvider struct {
+	Name     string
+	Hosts    []string // matched with subdomains
+	Paths    []string // path prefixes; empty matches any path
+	Endpoint string
+}
+
+// oembedProviders is the built-in registry of known endpoints
+var oembedProviders = []OEmbedProvider{
+	{Name: "YouTube", Hosts: []string{"youtube.com"}, Paths: []string{"/watch", "/shorts/", "/live/", "/playlist"}, Endpoint: "https://www.youtube.com/oembed"},
+	{Name: "YouTube", Hosts: []string{"youtu.be"}, Endpoint: "https://www.youtube.com/oembed"},
+	{Name: "Vimeo", Hosts: []string{"vimeo.com"}, Endpoint: "https://vimeo.com/api/oembed.json"},
+	{Name: "Spotify", Hosts: []string{"open.spotify.com"}, Endpoint: "https://open.spotify.com/oembed"},
+	{Name: "SoundCloud", Hosts: []string{"soundcloud.com"}, Endpoint: "https://soundcloud.com/oembed"},
+	{Name: "Mixcloud", Hosts: []string{"mixcloud.com"}, Endpoint: "https://app.mixcloud.com/oembed/"},
+	{Name: "Dailymotion", Hosts: []string{"dailymotion.com", "dai.ly"}, Endpoint: "https://www.dailymotion.com/services/oembed"},
+	{Name: "TikTok", Hosts: []string{"tiktok.com"}, Paths: []string{"/@"}, Endpoint: "https://www.tiktok.com/oembed"},
+	{Name: "Twitter", Hosts: []string{"twitter.com", "x.com"}, Endpoint: "https://publish.twitter.com/oembed"},
+	{Name: "Flickr", Hosts: []string{"flickr.com", "flic.kr"}, Endpoint: "https://www.flickr.com/services/oembed/"},
+	{Name: "CodePen", Hosts: []string{"codepen.io"}, Endpoint: "https://codepen.io/api/oembed"},
+}
+
+// findOEmbedProvider returns the registered provider serving pageURL
+func findOEmbedProvider(pageURL *url.URL) (OEmbedProvider, bool) {
+	for _, p := range oembedProviders {
+		if !hostMatches(pageURL.Hostname(), p.Hosts) {
+			continue
+		}
+		if len(p.Paths) == 0 {
+			return p, true
+		}
+		for _, prefix := range p.Paths {
+			if strings.HasPrefix(pageURL.Path, prefix) {
+				return p, true
+			}
+		}
+	}
+	return OEmbedProvider{}, false
+}
+
+// oembedEndpointURL builds the request URL for a provider endpoint
+func oembedEndpointURL(endpoint, pageURL string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return ""
+	}
+	q := u.Query()
+	q.Set("url", pageURL)
+	q.Set("format", "json")
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// oembedResponse is the oEmbed 1.0 JSON response
+type oembedResponse struct {
+	Type         string      `json:"type"`
+	Title        string      `json:"title"`
+	AuthorName   string      `json:"author_name"`
+	AuthorURL    string      `json:"author_url"`
+	ProviderName string      `json:"provider_name"`
+	HTML         string      `json:"html"`
+	URL          string      `json:"url"`
+	Width        flexibleInt `json:"width"`
+	Height       flexibleInt `json:"height"`
+	ThumbnailURL string      `json:"thumbnail_url"`
+}
+
+// flexibleInt accepts dimensions sent as numbers, numeric strings or null
+type flexibleInt int
+
+func (f *flexibleInt) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		*f = flexibleInt(n)
+	}
+	// Values such as "100%" or null are ignored
+	return nil
+}
+
+// oembedExtractor fetches the oEmbed representation of the page
+type oembedExtractor struct{}
+
+func (oembedExtractor) Name() string { return "oembed" }
+
+func (oembedExtractor) Extract(ctx context.Context, page *Page, found *Extraction) (*Extraction, error) {
+	// A site-specific extractor already produced an embed
+	if found.Embed != nil {
+		return nil, nil
+	}
+
+	var endpoint string
+	trusted := false
+	if provider, ok := findOEmbedProvider(page.URL); ok {
+		endpoint = oembedEndpointURL(provider.Endpoint, page.URL.String())
+		trusted = true
+	} else if found.OEmbedURL != "" {
+		endpoint = resolveURL(found.OEmbedURL, page.URL)
+	} else {
+		return nil, nil
+	}
+
+	body, _, err := page.Fetcher().Resource(ctx, endpoint, "application/json", maxOEmbedBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp oembedResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+
+	return oembedToExtraction(&resp, trusted), nil
+}
+
+// oembedToExtraction maps an oEmbed response to an embed block and fallback
+// title/image candidates. Markup from discovered (untrusted) providers is only
+// kept when it is a single iframe, and then rebuilt by sanitizeIframe.
+func oembedToExtraction(resp *oembedResponse, trusted bool) *Extraction {
+	found := NewExtraction("oembed")
+
+	found.Set(FieldTitle, resp.Title, ConfidenceMedium)
+	found.Set(FieldImage, resp.ThumbnailURL, ConfidenceMedium)
+	found.addImage(resp.ThumbnailURL, ImageSourceOEmbed)
+
+	embedHTML := strings.TrimSpace(resp.HTML)
+	if !trusted {
+		embedHTML = sanitizeIframe(embedHTML)
+	}
+
+	// Only video/rich markup and photos are worth embedding
+	embedType := strings.ToLower(resp.Type)
+	switch embedType {
+	case "video", "rich":
+		if embedHTML == "" {
+			return found
+		}
+	case "photo":
+		if resp.URL == "" {
+			return found
+		}
+	default:
+		return found
+	}
+
+	found.Embed = &Embed{
+		Type:         embedType,
+		HTML:         embedHTML,
+		URL:          resp.URL,
+		Width:        int(resp.Width),
+		Height:       int(resp.Height),
+		AuthorName:   resp.AuthorName,
+		ProviderName: resp.ProviderName,
+	}
+	return found
+}
+
+// iframeAttributes are the attributes kept on an untrusted provider's iframe
+var iframeAttributes = map[string]bool{
+	"width": true, "height": true, "allow": true, "allowfullscreen": true, "title": true,
+}
+
+// sanitizeIframe rebuilds markup that consists solely of an iframe from its
+// https src and the attributes in iframeAttributes, so srcdoc, event handlers
+// and script URLs are dropped. Anything else yields "".
+func sanitizeIframe(markup string) string {
+	z := html.NewTokenizer(strings.NewReader(markup))
+	var iframe *html.Token
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if iframe == nil {
+				return ""
+			}
+			return renderIframe(iframe)
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := z.Token()
+			if token.Data != "iframe" || iframe != nil {
+				return ""
+			}
+			iframe = &token
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) != "iframe" {
+				return ""
+			}
+		case html.TextToken:
+			if strings.TrimSpace(string(z.Text())) != "" {
+				return ""
+			}
+		default:
+			// Comments and doctypes
+			return ""
+		}
+	}
+}
+
+// renderIframe writes an iframe with a validated src and allowed attributes
+func renderIframe(token *html.Token) string {
+	var src string
+	var attrs strings.Builder
+	for _, attr := range token.Attr {
+		name := strings.ToLower(attr.Key)
+		switch {
+		case name == "src" && src == "":
+			u, err := url.Parse(strings.TrimSpace(attr.Val))
+			if err != nil || u.Scheme != "https" || u.Host == "" {
+				return ""
+			}
+			src = u.String()
+		case iframeAttributes[name]:
+			attrs.WriteString(" " + name + `="` + html.EscapeString(attr.Val) + `"`)
+		}
+	}
+	if src == "" {
+		return ""
+	}
+	return `<iframe src="` + html.EscapeString(src) + `"` + attrs.String() + `></iframe>`
+}
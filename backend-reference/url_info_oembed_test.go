@@ -0,0 +1,144 @@
+// Package handler tests for oEmbed support
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestFindOEmbedProvider(t *testing.T) {
+	testCases := []struct {
+		url      string
+		provider string
+	}{
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", "YouTube"},
+		{"https://youtu.be/dQw4w9WgXcQ", "YouTube"},
+		{"https://www.youtube.com/@channel", ""},
+		{"https://vimeo.com/76979871", "Vimeo"},
+		{"https://open.spotify.com/track/4uLU6hMCjMI75M1A2tKUQC", "Spotify"},
+		{"https://soundcloud.com/artist/track", "SoundCloud"},
+		{"https://x.com/user/status/1", "Twitter"},
+		{"https://example.com/video", ""},
+	}
+
+	for _, tc := range testCases {
+		u, _ := url.Parse(tc.url)
+		provider, ok := findOEmbedProvider(u)
+		if tc.provider == "" {
+			if ok {
+				t.Errorf("For %s: expected no provider, got %s", tc.url, provider.Name)
+			}
+			continue
+		}
+		if !ok || provider.Name != tc.provider {
+			t.Errorf("For %s: expected %s, got %s", tc.url, tc.provider, provider.Name)
+		}
+	}
+}
+
+func TestOEmbedEndpointURL(t *testing.T) {
+	got := oembedEndpointURL("https://www.youtube.com/oembed", "https://youtu.be/abc")
+	expected := "https://www.youtube.com/oembed?format=json&url=https%3A%2F%2Fyoutu.be%2Fabc"
+	if got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+}
+
+func TestOEmbedToExtraction_UntrustedMarkup(t *testing.T) {
+	testCases := []struct {
+		html     string
+		expected string // "" for no embed
+	}{
+		{`<iframe src="https://player.example.com/1" width="640"></iframe>`, `<iframe src="https://player.example.com/1" width="640"></iframe>`},
+		{`<blockquote>hi</blockquote><script src="https://evil.example/x.js"></script>`, ""},
+		{`<iframe src="x"></iframe><img src=x onerror=alert(1)>`, ""},
+		{`<iframe src="javascript:alert(1)"></iframe>`, ""},
+		{`<iframe src=" JavaScript:alert(1)"></iframe>`, ""},
+		{`<iframe src="http://player.example.com/1"></iframe>`, ""},
+		{`<iframe srcdoc="<script>alert(1)</script>"></iframe>`, ""},
+		{`<iframe src="https://player.example.com/1" srcdoc="<script>alert(1)</script>"></iframe>`, `<iframe src="https://player.example.com/1"></iframe>`},
+		{`<iframe src="https://player.example.com/1" onload="alert(1)" ONERROR=alert(2) style="x" allowfullscreen></iframe>`, `<iframe src="https://player.example.com/1" allowfullscreen=""></iframe>`},
+		{`<iframe src="https://player.example.com/1" title='"><script>alert(1)</script>' allow="autoplay; encrypted-media"></iframe>`,
+			`<iframe src="https://player.example.com/1" title="&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;" allow="autoplay; encrypted-media"></iframe>`},
+		{`<iframe src="https://a.example/1"></iframe><iframe src="https://b.example/2"></iframe>`, ""},
+	}
+
+	for _, tc := range testCases {
+		found := oembedToExtraction(&oembedResponse{Type: "video", HTML: tc.html}, false)
+		var got string
+		if found.Embed != nil {
+			got = found.Embed.HTML
+		}
+		if got != tc.expected {
+			t.Errorf("For %s: expected %q, got %q", tc.html, tc.expected, got)
+		}
+	}
+}
+
+func TestFlexibleInt(t *testing.T) {
+	var resp oembedResponse
+	if err := json.Unmarshal([]byte(`{"width": "480", "height": null}`), &resp); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if resp.Width != 480 || resp.Height != 0 {
+		t.Errorf("Expected 480x0, got %dx%d", resp.Width, resp.Height)
+	}
+	if err := json.Unmarshal([]byte(`{"width": "100%"}`), &resp); err != nil {
+		t.Errorf("Expected percentage width to be ignored, got %v", err)
+	}
+}
+
+func TestOEmbedExtractor_Discovery(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/video", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head>
+			<title>Clip</title>
+			<link rel="alternate" type="application/json+oembed" href="/oembed?url=video">
+		</head></html>`))
+	})
+	mux.HandleFunc("/oembed", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"type": "video", "version": "1.0", "title": "Clip Title",
+			"author_name": "Curator", "provider_name": "ExampleTube",
+			"html": "<iframe src=\"https://player.example.com/1\"></iframe>",
+			"width": 640, "height": 360,
+			"thumbnail_url": "https://img.example.com/1.jpg"
+		}`))
+	})
+	testServer := httptest.NewServer(mux)
+	defer testServer.Close()
+	allowLoopbackForTest(t)
+
+	page, err := DefaultFetcher.fetchPage(context.Background(), testServer.URL+"/video", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	metadata, err := defaultPipeline().Run(context.Background(), page)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if metadata.Embed == nil {
+		t.Fatal("Expected embed block")
+	}
+	if metadata.Embed.Type != "video" || metadata.Embed.Width != 640 || metadata.Embed.Height != 360 {
+		t.Errorf("Unexpected embed: %+v", metadata.Embed)
+	}
+	if metadata.Embed.AuthorName != "Curator" || metadata.Embed.ProviderName != "ExampleTube" {
+		t.Errorf("Unexpected attribution: %+v", metadata.Embed)
+	}
+	// The page <title> ranks below the oEmbed title
+	if metadata.Title != "Clip Title" {
+		t.Errorf("Expected 'Clip Title', got %s", metadata.Title)
+	}
+	if metadata.OgImage != "https://img.example.com/1.jpg" {
+		t.Errorf("Expected thumbnail as image, got %s", metadata.OgImage)
+	}
+}
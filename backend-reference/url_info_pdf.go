@@ -0,0 +1,555 @@
+// PDF metadata
+// Reads the document information dictionary, the XMP metadata stream and the
+// page count from a PDF without a full parser: objects are located by their
+// "N G obj" headers, including those packed into compressed object streams,
+// and only the few dictionaries on the way to the metadata are tokenized.
+
+package handler
+
+import (
+	"bytes"
+	"compress/zlib"
+	"html"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	// maxPDFStreamBytes caps a decompressed object or metadata stream
+	maxPDFStreamBytes = 8 << 20
+
+	// maxPDFInflateBytes caps everything decompressed from one file, and
+	// maxPDFObjectStreams the object streams considered, so a small crafted
+	// PDF cannot expand into gigabytes
+	maxPDFInflateBytes  = 32 << 20
+	maxPDFObjectStreams = 64
+)
+
+// pdfMetadata is what the document extractor uses from a PDF. XMP values take
+// precedence over the information dictionary, which editors often leave stale.
+type pdfMetadata struct {
+	Title       string
+	Author      string
+	Subject     string
+	Keywords    string
+	CreatedAt   string // RFC 3339 or YYYY-MM-DD
+	Pages       int
+	IsEncrypted bool // strings in the information dictionary are unreadable
+}
+
+var (
+	pdfObjectRegex = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+	pdfRefRegex    = regexp.MustCompile(`^(\d+)\s+\d+\s+R\b`)
+	pdfDateRegex   = regexp.MustCompile(`^(?:D:)?(\d{4})(\d{2})?(\d{2})?(\d{2})?(\d{2})?(\d{2})?([Zz+-])?(\d{2})?'?(\d{2})?`)
+)
+
+// pdfFile indexes the objects of a PDF by number. Object streams are only
+// unpacked when an object is not found among those defined directly.
+type pdfFile struct {
+	objects map[int][]byte
+	pending [][]byte // object streams not yet unpacked, in file order
+	budget  int      // decompressed bytes left for the whole file
+}
+
+// parsePDF extracts the metadata of a PDF, as far as it can be read
+func parsePDF(data []byte) *pdfMetadata {
+	f := newPDFFile(data)
+	meta := &pdfMetadata{}
+
+	// The trailer, or the xref stream standing in for it; the last one wins
+	// since incremental updates append a new trailer
+	trailer := data
+	if i := bytes.LastIndex(data, []byte("/Root")); i >= 0 {
+		trailer = data[max(0, bytes.LastIndex(data[:i], []byte("<<"))):]
+	}
+	meta.IsEncrypted = pdfDictValue(trailer, "Encrypt") != nil
+
+	catalog := f.resolve(pdfDictValue(trailer, "Root"))
+	meta.Pages = pdfInt(f.resolve(pdfDictValue(f.resolve(pdfDictValue(catalog, "Pages")), "Count")))
+	if meta.Pages == 0 {
+		meta.Pages = f.maxPageCount()
+	}
+
+	if stream, ok := f.stream(f.resolve(pdfDictValue(catalog, "Metadata"))); ok {
+		meta.Title, meta.Author, meta.Subject, meta.Keywords, meta.CreatedAt = parseXMP(stream)
+	}
+
+	if !meta.IsEncrypted {
+		info := f.resolve(pdfDictValue(trailer, "Info"))
+		str := func(key string) string {
+			return decodePDFString(f.resolve(pdfDictValue(info, key)))
+		}
+		meta.Title = firstNonEmpty(meta.Title, str("Title"))
+		meta.Author = firstNonEmpty(meta.Author, str("Author"))
+		meta.Subject = firstNonEmpty(meta.Subject, str("Subject"))
+		meta.Keywords = firstNonEmpty(meta.Keywords, str("Keywords"))
+		meta.CreatedAt = firstNonEmpty(meta.CreatedAt, pdfDate(str("CreationDate")))
+	}
+	return meta
+}
+
+// firstNonEmpty returns the first non-empty value
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// newPDFFile indexes the objects in data and notes its object streams. Later
+// definitions of a number replace earlier ones, as incremental updates do.
+func newPDFFile(data []byte) *pdfFile {
+	f := &pdfFile{objects: make(map[int][]byte), budget: maxPDFInflateBytes}
+
+	locs := pdfObjectRegex.FindAllSubmatchIndex(data, -1)
+	for i, loc := range locs {
+		num, err := strconv.Atoi(string(data[loc[2]:loc[3]]))
+		if err != nil {
+			continue
+		}
+		end := len(data)
+		if i+1 < len(locs) {
+			end = locs[i+1][0]
+		}
+		body := data[loc[1]:end]
+		if j := bytes.Index(body, []byte("endobj")); j >= 0 {
+			body = body[:j]
+		}
+		f.objects[num] = body
+		if string(pdfDictValue(body, "Type")) == "/ObjStm" && len(f.pending) < maxPDFObjectStreams {
+			f.pending = append(f.pending, body)
+		}
+	}
+	return f
+}
+
+// object returns the body of object num, unpacking object streams until it
+// turns up
+func (f *pdfFile) object(num int) []byte {
+	for {
+		if body, ok := f.objects[num]; ok {
+			return body
+		}
+		if !f.unpackNext() {
+			return nil
+		}
+	}
+}
+
+// unpackNext unpacks the next pending object stream, if there is one
+func (f *pdfFile) unpackNext() bool {
+	if len(f.pending) == 0 {
+		return false
+	}
+	body := f.pending[0]
+	f.pending = f.pending[1:]
+	f.addObjectStream(body)
+	return true
+}
+
+// addObjectStream indexes the objects packed into a compressed object stream,
+// without replacing objects defined directly
+func (f *pdfFile) addObjectStream(body []byte) {
+	data, ok := f.stream(body)
+	if !ok {
+		return
+	}
+	n := pdfInt(pdfDictValue(body, "N"))
+	first := pdfInt(pdfDictValue(body, "First"))
+	if first <= 0 || first > len(data) {
+		return
+	}
+
+	header := strings.Fields(string(data[:first]))
+	type entry struct{ num, offset int }
+	var entries []entry
+	for i := 0; i+1 < len(header) && len(entries) < n; i += 2 {
+		num, err1 := strconv.Atoi(header[i])
+		offset, err2 := strconv.Atoi(header[i+1])
+		if err1 != nil || err2 != nil || offset < 0 || offset > len(data)-first {
+			return
+		}
+		entries = append(entries, entry{num, first + offset})
+	}
+	for i, e := range entries {
+		end := len(data)
+		if i+1 < len(entries) && entries[i+1].offset >= e.offset {
+			end = entries[i+1].offset
+		}
+		if _, exists := f.objects[e.num]; !exists {
+			f.objects[e.num] = data[e.offset:end]
+		}
+	}
+}
+
+// resolve follows an indirect reference; other values are returned as is
+func (f *pdfFile) resolve(value []byte) []byte {
+	m := pdfRefRegex.FindSubmatch(value)
+	if m == nil {
+		return value
+	}
+	num, err := strconv.Atoi(string(m[1]))
+	if err != nil {
+		return nil
+	}
+	return bytes.TrimSpace(f.object(num))
+}
+
+// stream returns the decoded data of a stream object. Only unfiltered and
+// FlateDecode streams are supported, which covers metadata and object streams.
+func (f *pdfFile) stream(body []byte) ([]byte, bool) {
+	i := bytes.Index(body, []byte("stream"))
+	if i < 0 {
+		return nil, false
+	}
+	dict := body[:i]
+	start := i + len("stream")
+	if bytes.HasPrefix(body[start:], []byte("\r\n")) {
+		start += 2
+	} else if start < len(body) && (body[start] == '\n' || body[start] == '\r') {
+		start++
+	}
+
+	var raw []byte
+	if length := pdfInt(f.resolve(pdfDictValue(dict, "Length"))); length > 0 && length <= len(body)-start {
+		raw = body[start : start+length]
+	} else {
+		end := bytes.LastIndex(body, []byte("endstream"))
+		if end < start {
+			end = len(body)
+		}
+		raw = bytes.TrimRight(body[start:end], "\r\n")
+	}
+
+	filter := strings.Join(strings.Fields(strings.Trim(string(pdfDictValue(dict, "Filter")), "[]")), "")
+	switch filter {
+	case "":
+		return raw, true
+	case "/FlateDecode":
+		limit := min(maxPDFStreamBytes, f.budget)
+		if limit <= 0 {
+			return nil, false
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, false
+		}
+		defer zr.Close()
+		// A truncated stream still yields its beginning
+		data, err := io.ReadAll(io.LimitReader(zr, int64(limit)))
+		f.budget -= len(data)
+		return data, len(data) > 0 || err == nil
+	}
+	return nil, false
+}
+
+// maxPageCount finds the page count when the catalog cannot be followed: the
+// root of the page tree has the largest /Count of all /Pages nodes
+func (f *pdfFile) maxPageCount() int {
+	for f.unpackNext() {
+	}
+
+	count := 0
+	for _, body := range f.objects {
+		if string(pdfDictValue(body, "Type")) == "/Pages" {
+			count = max(count, pdfInt(pdfDictValue(body, "Count")))
+		}
+	}
+	return count
+}
+
+// pdfDictValue returns the raw value of /key in a dictionary, or nil. Nested
+// dictionaries are searched too, which is good enough for the keys used here.
+func pdfDictValue(dict []byte, key string) []byte {
+	needle := []byte("/" + key)
+	for offset := 0; ; {
+		i := bytes.Index(dict[offset:], needle)
+		if i < 0 {
+			return nil
+		}
+		after := offset + i + len(needle)
+		if after < len(dict) && !isPDFSpace(dict[after]) && !isPDFDelimiter(dict[after]) {
+			offset = after
+			continue
+		}
+		return pdfToken(dict[after:])
+	}
+}
+
+// pdfToken returns the first value in b: a string, dictionary, array, name,
+// indirect reference or number
+func pdfToken(b []byte) []byte {
+	b = bytes.TrimLeft(b, "\x00\t\n\f\r ")
+	if len(b) == 0 {
+		return nil
+	}
+
+	switch b[0] {
+	case '(':
+		depth := 0
+		for i := 0; i < len(b); i++ {
+			switch b[i] {
+			case '\\':
+				i++
+			case '(':
+				depth++
+			case ')':
+				if depth--; depth == 0 {
+					return b[:i+1]
+				}
+			}
+		}
+		return b
+	case '<', '[':
+		if b[0] == '<' && !bytes.HasPrefix(b, []byte("<<")) {
+			if i := bytes.IndexByte(b, '>'); i >= 0 {
+				return b[:i+1]
+			}
+			return b
+		}
+		depth := 0
+		for i := 0; i < len(b); i++ {
+			switch {
+			case bytes.HasPrefix(b[i:], []byte("<<")), b[i] == '[':
+				depth++
+				if b[i] == '<' {
+					i++
+				}
+			case bytes.HasPrefix(b[i:], []byte(">>")), b[i] == ']':
+				if b[i] == '>' {
+					i++
+				}
+				if depth--; depth == 0 {
+					return b[:i+1]
+				}
+			case b[i] == '(':
+				i += len(pdfToken(b[i:])) - 1
+			}
+		}
+		return b
+	}
+
+	if m := pdfRefRegex.Find(b); m != nil {
+		return m
+	}
+	end := 1
+	for end < len(b) && !isPDFSpace(b[end]) && !isPDFDelimiter(b[end]) {
+		end++
+	}
+	return b[:end]
+}
+
+func isPDFSpace(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+// pdfInt parses an integer value, returning 0 for anything else
+func pdfInt(value []byte) int {
+	n, err := strconv.Atoi(string(bytes.TrimSpace(value)))
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// decodePDFString decodes a literal or hex string. Text strings are UTF-16BE
+// with a byte order mark, UTF-8 with one, or PDFDocEncoding, which is read
+// as Latin-1.
+func decodePDFString(token []byte) string {
+	var raw []byte
+	switch {
+	case len(token) >= 2 && token[0] == '(':
+		raw = unescapePDFLiteral(token[1 : len(token)-1])
+	case len(token) >= 2 && token[0] == '<':
+		var digits []byte
+		for _, c := range token[1 : len(token)-1] {
+			if !isPDFSpace(c) {
+				digits = append(digits, c)
+			}
+		}
+		if len(digits)%2 == 1 {
+			digits = append(digits, '0')
+		}
+		for i := 0; i+1 < len(digits); i += 2 {
+			n, err := strconv.ParseUint(string(digits[i:i+2]), 16, 8)
+			if err != nil {
+				return ""
+			}
+			raw = append(raw, byte(n))
+		}
+	default:
+		return ""
+	}
+
+	var s string
+	switch {
+	case bytes.HasPrefix(raw, []byte{0xfe, 0xff}):
+		units := make([]uint16, 0, len(raw)/2)
+		for i := 2; i+1 < len(raw); i += 2 {
+			units = append(units, uint16(raw[i])<<8|uint16(raw[i+1]))
+		}
+		s = string(utf16.Decode(units))
+	case bytes.HasPrefix(raw, []byte{0xef, 0xbb, 0xbf}):
+		s = strings.ToValidUTF8(string(raw[3:]), "")
+	default:
+		runes := make([]rune, len(raw))
+		for i, c := range raw {
+			runes[i] = rune(c)
+		}
+		s = string(runes)
+	}
+	return strings.TrimSpace(strings.ReplaceAll(s, "\x00", ""))
+}
+
+// unescapePDFLiteral resolves the backslash escapes of a literal string
+func unescapePDFLiteral(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		if b[i] != '\\' || i+1 == len(b) {
+			out = append(out, b[i])
+			continue
+		}
+		i++
+		switch c := b[i]; c {
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'b':
+			out = append(out, '\b')
+		case 'f':
+			out = append(out, '\f')
+		case '\r':
+			// Line continuation
+			if i+1 < len(b) && b[i+1] == '\n' {
+				i++
+			}
+		case '\n':
+		default:
+			if c < '0' || c > '7' {
+				out = append(out, c)
+				continue
+			}
+			n := 0
+			for j := 0; j < 3 && i < len(b) && b[i] >= '0' && b[i] <= '7'; j++ {
+				n = n*8 + int(b[i]-'0')
+				i++
+			}
+			i--
+			out = append(out, byte(n))
+		}
+	}
+	return out
+}
+
+// pdfDate converts a PDF date such as D:20240305103000+01'00' to RFC 3339,
+// or to YYYY-MM-DD when it has no time
+func pdfDate(s string) string {
+	m := pdfDateRegex.FindStringSubmatch(s)
+	if m == nil || m[2] == "" || m[3] == "" {
+		return ""
+	}
+	year, _ := strconv.Atoi(m[1])
+	month, _ := strconv.Atoi(m[2])
+	day, _ := strconv.Atoi(m[3])
+	if m[4] == "" {
+		t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+		if t.Month() != time.Month(month) {
+			return ""
+		}
+		return t.Format(time.DateOnly)
+	}
+
+	hour, _ := strconv.Atoi(m[4])
+	minute, _ := strconv.Atoi(m[5])
+	second, _ := strconv.Atoi(m[6])
+	// Dates without a zone are taken as UTC
+	offset := 0
+	if m[7] == "+" || m[7] == "-" {
+		zh, _ := strconv.Atoi(m[8])
+		zm, _ := strconv.Atoi(m[9])
+		offset = zh*3600 + zm*60
+		if m[7] == "-" {
+			offset = -offset
+		}
+	}
+	t := time.Date(year, time.Month(month), day, hour, minute, second, 0, time.FixedZone("", offset))
+	return t.Format(time.RFC3339)
+}
+
+var (
+	xmpListItemRegex = regexp.MustCompile(`(?s)<rdf:li\b[^>]*>(.*?)</rdf:li>`)
+	xmpPropertyRegex = func() map[string]*regexp.Regexp {
+		m := make(map[string]*regexp.Regexp)
+		for _, tag := range []string{"dc:title", "dc:creator", "dc:description", "dc:subject", "xmp:CreateDate", "pdf:Keywords"} {
+			// Either an element, possibly holding an rdf list, or an attribute
+			m[tag] = regexp.MustCompile(`(?s)<` + tag + `\b[^>]*>(.*?)</` + tag + `>|\b` + tag + `="([^"]*)"`)
+		}
+		return m
+	}()
+)
+
+// parseXMP reads Dublin Core and XMP basic properties from an XMP packet
+func parseXMP(data []byte) (title, author, subject, keywords, createdAt string) {
+	// values returns the text of a property, or each item of a list
+	values := func(tag string) []string {
+		m := xmpPropertyRegex[tag].FindSubmatch(data)
+		if m == nil {
+			return nil
+		}
+		if m[2] != nil {
+			return []string{html.UnescapeString(string(m[2]))}
+		}
+		items := xmpListItemRegex.FindAllSubmatch(m[1], -1)
+		if items == nil {
+			return []string{html.UnescapeString(strings.TrimSpace(string(m[1])))}
+		}
+		var out []string
+		for _, item := range items {
+			if v := strings.TrimSpace(html.UnescapeString(string(item[1]))); v != "" {
+				out = append(out, v)
+			}
+		}
+		return out
+	}
+	first := func(tag string) string {
+		if v := values(tag); len(v) > 0 {
+			return strings.TrimSpace(v[0])
+		}
+		return ""
+	}
+
+	title = first("dc:title")
+	author = strings.Join(values("dc:creator"), ", ")
+	subject = first("dc:description")
+	keywords = firstNonEmpty(first("pdf:Keywords"), strings.Join(values("dc:subject"), ", "))
+	createdAt = xmpDate(first("xmp:CreateDate"))
+	return
+}
+
+// xmpDate normalizes an ISO 8601 XMP date
+func xmpDate(s string) string {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04Z07:00"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format(time.RFC3339)
+		}
+	}
+	if len(s) >= 10 {
+		if t, err := time.Parse(time.DateOnly, s[:10]); err == nil {
+			return t.Format(time.DateOnly)
+		}
+	}
+	return ""
+}
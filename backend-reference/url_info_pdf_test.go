@@ -0,0 +1,179 @@
+// Package handler tests for PDF metadata
+package handler
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// testPDF assembles a PDF from object bodies numbered from 1 and a trailer
+// dictionary. Our reader needs no cross-reference table, so none is written.
+func testPDF(trailer string, objects ...string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	for i, body := range objects {
+		if body == "" {
+			continue
+		}
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, body)
+	}
+	fmt.Fprintf(&buf, "trailer\n%s\nstartxref\n0\n%%%%EOF\n", trailer)
+	return buf.Bytes()
+}
+
+// flateStream wraps data in a FlateDecode stream object
+func flateStream(dict, data string) string {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write([]byte(data))
+	zw.Close()
+	return fmt.Sprintf("<< %s /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream", dict, buf.Len(), buf.String())
+}
+
+const testXMP = `<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmp:CreateDate="2024-03-05T10:30:00+01:00">
+<dc:title><rdf:Alt><rdf:li xml:lang="x-default">Notes on the Analytical Engine &amp; More</rdf:li></rdf:Alt></dc:title>
+<dc:creator><rdf:Seq><rdf:li>Ada Lovelace</rdf:li><rdf:li>Charles Babbage</rdf:li></rdf:Seq></dc:creator>
+</rdf:Description></rdf:RDF></x:xmpmeta>
+<?xpacket end="w"?>`
+
+func TestParsePDF(t *testing.T) {
+	// The page tree root sits in a compressed object stream, as PDF 1.5+
+	// writers do
+	objStm := "2 0 " + "<< /Type /Pages /Kids [3 0 R 4 0 R 7 0 R] /Count 3 >>"
+	data := testPDF("<< /Size 9 /Root 1 0 R /Info 8 0 R >>",
+		"<< /Type /Catalog /Pages 2 0 R /Metadata 5 0 R >>",
+		"",
+		"<< /Type /Page /Parent 2 0 R >>",
+		"<< /Type /Page /Parent 2 0 R >>",
+		flateStream("/Type /Metadata /Subtype /XML", testXMP),
+		flateStream("/Type /ObjStm /N 1 /First 4", objStm),
+		"<< /Type /Page /Parent 2 0 R >>",
+		"<< /Title (Untitled-3) /Author (Scanner) /Subject (On the \\(analytical\\) engine) /Keywords <FEFF0065006E00670069006E00650073002C0020006D006100740068> >>",
+	)
+
+	meta := parsePDF(data)
+	expected := pdfMetadata{
+		Title:     "Notes on the Analytical Engine & More",
+		Author:    "Ada Lovelace, Charles Babbage",
+		Subject:   "On the (analytical) engine",
+		Keywords:  "engines, math",
+		CreatedAt: "2024-03-05T10:30:00+01:00",
+		Pages:     3,
+	}
+	if *meta != expected {
+		t.Errorf("Expected %+v, got %+v", expected, *meta)
+	}
+}
+
+func TestParsePDF_InfoDictionary(t *testing.T) {
+	// No XMP, an indirect title, and a catalog whose page tree is missing
+	data := testPDF("<< /Root 1 0 R /Info 2 0 R >>",
+		"<< /Type /Catalog /Pages 9 0 R >>",
+		"<< /Title 3 0 R /Author (Jos\\351 Sm\\\nith) /CreationDate (D:20230115093000-05'00') >>",
+		"(Caf\\351 Culture)",
+		"<< /Type /Pages /Kids [5 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 4 0 R >>",
+	)
+
+	meta := parsePDF(data)
+	if meta.Title != "Café Culture" || meta.Author != "José Smith" {
+		t.Errorf("Unexpected strings %q %q", meta.Title, meta.Author)
+	}
+	if meta.CreatedAt != "2023-01-15T09:30:00-05:00" || meta.Pages != 1 {
+		t.Errorf("Unexpected date or pages %q %d", meta.CreatedAt, meta.Pages)
+	}
+}
+
+func TestParsePDF_Encrypted(t *testing.T) {
+	data := testPDF("<< /Root 1 0 R /Info 3 0 R /Encrypt 4 0 R >>",
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [] /Count 12 >>",
+		"<< /Title <9f3a71c2> >>",
+		"<< /Filter /Standard /V 2 >>",
+	)
+	meta := parsePDF(data)
+	if !meta.IsEncrypted || meta.Title != "" || meta.Pages != 12 {
+		t.Errorf("Expected only the page count, got %+v", *meta)
+	}
+}
+
+func TestParsePDF_Garbage(t *testing.T) {
+	for _, data := range []string{"", "%PDF-1.7", "%PDF-1.4\n1 0 obj\n<< /Type /Catalog /Pages 2 0 R", strings.Repeat("(", 1000)} {
+		if meta := parsePDF([]byte(data)); meta.Title != "" || meta.Pages != 0 {
+			t.Errorf("%q: expected nothing, got %+v", data, *meta)
+		}
+	}
+}
+
+func TestParsePDF_DecompressionBudget(t *testing.T) {
+	// Hundreds of object streams of zeros, all numbered alike, with a catalog
+	// that is nowhere to be found, so every lookup searches them all
+	bomb := flateStream("/Type /ObjStm /N 1 /First 4", strings.Repeat("\x00", 2<<20))
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n")
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&buf, "5 0 obj\n%s\nendobj\n", bomb)
+	}
+	buf.WriteString("trailer\n<< /Root 9 0 R /Info 9 0 R >>\n%%EOF\n")
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	meta := parsePDF(buf.Bytes())
+	runtime.ReadMemStats(&after)
+
+	if meta.Title != "" || meta.Pages != 0 {
+		t.Errorf("Expected nothing, got %+v", *meta)
+	}
+	// Unbounded, this allocates about 900 MiB. io.ReadAll may allocate twice
+	// what it returns, and the race detector and other goroutines add more.
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 8*maxPDFInflateBytes {
+		t.Errorf("Expected at most %d MiB allocated, got %d MiB", 8*maxPDFInflateBytes>>20, allocated>>20)
+	}
+}
+
+func TestParsePDF_HostileOffsets(t *testing.T) {
+	testCases := map[string][]byte{
+		// An object stream whose header points before its first object
+		"negative offset": testPDF("<< /Root 1 0 R >>",
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"",
+			flateStream("/Type /ObjStm /N 1 /First 6", "2 -20 << /Type /Pages /Count 4 >>"),
+		),
+		"overflowing offset": testPDF("<< /Root 1 0 R >>",
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"",
+			flateStream("/Type /ObjStm /N 1 /First 6", "2 9223372036854775807 << /Type /Pages /Count 4 >>"),
+		),
+		"overflowing length": testPDF("<< /Root 1 0 R /Info 2 0 R >>",
+			"<< /Type /Catalog >>",
+			"<< /Type /Metadata /Length 9223372036854775807 >>\nstream\nx\nendstream",
+		),
+	}
+	for name, data := range testCases {
+		if meta := parsePDF(data); meta.Pages != 0 || meta.Title != "" {
+			t.Errorf("%s: expected nothing, got %+v", name, *meta)
+		}
+	}
+}
+
+func TestPDFDate(t *testing.T) {
+	testCases := map[string]string{
+		"D:20240305103000+01'00'": "2024-03-05T10:30:00+01:00",
+		"D:20240305103000Z":       "2024-03-05T10:30:00Z",
+		"D:202403051030":          "2024-03-05T10:30:00Z",
+		"20240305":                "2024-03-05",
+		"D:2024":                  "",
+		"yesterday":               "",
+	}
+	for input, expected := range testCases {
+		if got := pdfDate(input); got != expected {
+			t.Errorf("%s: expected %q, got %q", input, expected, got)
+		}
+	}
+}
@@ -0,0 +1,390 @@
+// Metadata extractor pipeline
+// Extractors (DOM, regex fallback, site-specific) each propose values for
+// metadata fields with a confidence. The pipeline runs them in order and keeps,
+// field by field, the candidate with the highest confidence.
+
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Field identifies a URLMetadata field produced by extractors
+type Field string
+
+// Fields produced by the extractors
+const (
+	FieldTitle       Field = "title"
+	FieldDescription Field = "description"
+	FieldImage       Field = "ogImage"
+	FieldFavicon     Field = "favicon"
+	FieldAuthor      Field = "author"
+	FieldPublishedAt Field = "publishedAt"
+	FieldSiteName    Field = "siteName"
+	FieldContentType Field = "contentType"
+	FieldKeywords    Field = "keywords" // comma-separated
+	FieldCanonical   Field = "canonicalUrl"
+	FieldFormat      Field = "format"
+	FieldThemeColor  Field = "themeColor"
+)
+
+// Confidence levels shared by the extractors
+const (
+	ConfidenceSite     = 1.0  // site-specific extractor that knows the page layout
+	ConfidenceVerified = 0.95 // value checked against the live resource
+	ConfidenceHigh     = 0.9  // dedicated tag such as og:title
+	ConfidenceMedium   = 0.7  // secondary tag such as twitter:title
+	ConfidenceFallback = 0.6  // structured data standing in for a head tag
+	ConfidenceLow      = 0.5  // generic fallback such as <title>
+	ConfidenceGuess    = 0.2  // synthesized value such as /favicon.ico
+)
+
+// Candidate is a value proposed for a field by an extractor
+type Candidate struct {
+	Value      string
+	Confidence float64
+	Source     string
+}
+
+// Extraction holds the best candidate found so far for each field, plus
+// structured blocks that are merged whole (the first extractor to provide one
+// wins, so site-specific extractors take precedence)
+type Extraction struct {
+	Fields map[Field]Candidate
+	source string
+
+	// Discovered oEmbed endpoint, consumed by the oEmbed extractor
+	OEmbedURL string
+
+	// og:type, consumed by the format classifier
+	OGType string
+
+	// Icon links and the web app manifest, consumed by the icon extractor
+	Icons       []iconCandidate
+	ManifestURL string
+
+	Embed *Embed
+
+	// Image candidates from every source, ranked by the image extractor;
+	// imagesRanked marks its result, which Merge puts in place of the rest
+	Images       []ImageCandidate
+	imagesRanked bool
+
+	Placeholder *ImagePlaceholder
+
+	Content *ContentSummary
+
+	// Typed details from a site-specific extractor
+	Site *SiteExtras
+
+	// File details for links to PDFs, images and media
+	Document *DocumentInfo
+
+	// citation_* and Dublin Core tags, consumed by the citation extractor
+	citationMeta map[string][]string
+	Citation     *Citation
+
+	// og:video, twitter:player and similar tags in document order, consumed
+	// by the media extractor; Media is merged field by field
+	mediaTags [][2]string
+	Media     *MediaInfo
+}
+
+// NewExtraction creates an empty extraction attributed to source
+func NewExtraction(source string) *Extraction {
+	return &Extraction{Fields: make(map[Field]Candidate), source: source}
+}
+
+// Set proposes a value for a field. Empty values are ignored, and an existing
+// candidate is only replaced by one with strictly higher confidence, so the
+// first occurrence wins on ties.
+func (e *Extraction) Set(field Field, value string, confidence float64) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+	if existing, ok := e.Fields[field]; ok && existing.Confidence >= confidence {
+		return
+	}
+	e.Fields[field] = Candidate{Value: value, Confidence: confidence, Source: e.source}
+}
+
+// Clear records that a field has no usable value, overriding candidates with
+// lower confidence (e.g. an og:image that turned out to be broken)
+func (e *Extraction) Clear(field Field, confidence float64) {
+	if existing, ok := e.Fields[field]; ok && existing.Confidence >= confidence {
+		return
+	}
+	e.Fields[field] = Candidate{Confidence: confidence, Source: e.source}
+}
+
+// Get returns the current value of a field
+func (e *Extraction) Get(field Field) string {
+	return e.Fields[field].Value
+}
+
+// Has reports whether all of the given fields have a value
+func (e *Extraction) Has(fields ...Field) bool {
+	for _, f := range fields {
+		if e.Fields[f].Value == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Merge folds other into e, keeping the higher-confidence candidate per field
+func (e *Extraction) Merge(other *Extraction) {
+	if other == nil {
+		return
+	}
+	for field, c := range other.Fields {
+		if existing, ok := e.Fields[field]; ok && existing.Confidence >= c.Confidence {
+			continue
+		}
+		e.Fields[field] = c
+	}
+
+	if e.OEmbedURL == "" {
+		e.OEmbedURL = other.OEmbedURL
+	}
+	if e.OGType == "" {
+		e.OGType = other.OGType
+	}
+	e.Icons = append(e.Icons, other.Icons...)
+	if e.ManifestURL == "" {
+		e.ManifestURL = other.ManifestURL
+	}
+	if e.Embed == nil {
+		e.Embed = other.Embed
+	}
+	if other.imagesRanked {
+		e.Images, e.imagesRanked = other.Images, true
+	} else {
+		e.Images = append(e.Images, other.Images...)
+	}
+	if e.Placeholder == nil {
+		e.Placeholder = other.Placeholder
+	}
+	if e.Content == nil {
+		e.Content = other.Content
+	}
+	if e.Site == nil {
+		e.Site = other.Site
+	}
+	if e.Document == nil {
+		e.Document = other.Document
+	}
+	// The DOM sees every tag when the head scan stopped early
+	if len(other.citationMeta) > len(e.citationMeta) {
+		e.citationMeta = other.citationMeta
+	}
+	if e.Citation == nil {
+		e.Citation = other.Citation
+	}
+	if len(other.mediaTags) > len(e.mediaTags) {
+		e.mediaTags = other.mediaTags
+	}
+	e.mergeMedia(other.Media)
+}
+
+// Page is a fetched document handed to extractors
+type Page struct {
+	URL               *url.URL // final URL after redirects
+	RedirectChain     []string // URLs that redirected, in order, before URL
+	RedirectPermanent bool     // every redirect was a 301 or 308
+	StatusCode        int
+	ContentType       string
+	Charset           string // original encoding; Body is always UTF-8
+	Header            http.Header
+	Body              []byte
+	Truncated         bool   // Body stops short of the full response
+	FileKind          string // pdf, image or media for files; empty for HTML
+
+	fetcher *Fetcher // for sub-resources; see Fetcher()
+	analyze bool     // run the main-content analysis, for detail=full
+
+	doc    *html.Node
+	docErr error
+	parsed bool
+	jsonLD *jsonLDDocument
+
+	cover *downloadedImage // downloaded by the placeholder extractor
+
+	// The response as received, for the archive
+	raw      []byte
+	response *http.Response
+}
+
+// Fetcher returns the fetcher that downloaded the page, for extractors that
+// fetch sub-resources. Pages built by hand use DefaultFetcher.
+func (p *Page) Fetcher() *Fetcher {
+	if p.fetcher == nil {
+		return DefaultFetcher
+	}
+	return p.fetcher
+}
+
+// Document parses the body as HTML once and shares the tree between extractors
+func (p *Page) Document() (*html.Node, error) {
+	if !p.parsed {
+		p.doc, p.docErr = html.Parse(bytes.NewReader(p.Body))
+		p.parsed = true
+	}
+	return p.doc, p.docErr
+}
+
+// Extractor extracts metadata candidates from a page. found holds the merged
+// result of the extractors that ran before it.
+type Extractor interface {
+	Name() string
+	Extract(ctx context.Context, page *Page, found *Extraction) (*Extraction, error)
+}
+
+// SiteExtractor restricts an extractor to pages on the given hosts and their
+// subdomains
+type SiteExtractor struct {
+	Hosts []string
+	Extractor
+}
+
+// Extract runs the wrapped extractor only when the page host matches
+func (s SiteExtractor) Extract(ctx context.Context, page *Page, found *Extraction) (*Extraction, error) {
+	if !hostMatches(page.URL.Hostname(), s.Hosts) {
+		return nil, nil
+	}
+	return s.Extractor.Extract(ctx, page, found)
+}
+
+// pagelessExtractor is implemented by site extractors that need only the URL
+// and an API on another origin. They also run when the page itself could not
+// be fetched, e.g. because a login wall answered 403, but not when robots.txt
+// or the throttle refused it.
+type pagelessExtractor interface {
+	Extractor
+	pageless()
+}
+
+// hostMatches reports whether host equals or is a subdomain of one of hosts
+func hostMatches(host string, hosts []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, h := range hosts {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
+
+// siteExtractors are consulted before the generic extractors
+var siteExtractors []Extractor
+
+// registerSiteExtractor adds a host-matched extractor to the default pipeline
+func registerSiteExtractor(hosts []string, e Extractor) {
+	siteExtractors = append(siteExtractors, SiteExtractor{Hosts: hosts, Extractor: e})
+}
+
+// Pipeline runs a chain of extractors and merges their results
+type Pipeline struct {
+	extractors []Extractor
+}
+
+// NewPipeline creates a pipeline running extractors in order
+func NewPipeline(extractors ...Extractor) *Pipeline {
+	return &Pipeline{extractors: extractors}
+}
+
+// defaultPipeline returns the standard chain: site-specific extractors, the
+// streaming head extractor, main-content analysis, the DOM extractor for
+// whatever the head lacked, JSON-LD, citation tags, oEmbed, video and audio
+// details, the regex fallback for anything still missing, the web app
+// manifest and icon check, image probing to pick the cover, and finally
+// format classification from everything found
+func defaultPipeline() *Pipeline {
+	chain := append([]Extractor{}, siteExtractors...)
+	chain = append(chain, headExtractor{}, contentExtractor{}, domExtractor{}, jsonLDExtractor{}, citationExtractor{}, oembedExtractor{}, mediaExtractor{}, regexExtractor{}, iconExtractor{}, imageExtractor{}, placeholderExtractor{}, formatExtractor{})
+	return NewPipeline(chain...)
+}
+
+// Run extracts metadata from page. An extractor failing does not abort the
+// pipeline as long as some other extractor produced results.
+func (p *Pipeline) Run(ctx context.Context, page *Page) (*URLMetadata, error) {
+	found := NewExtraction("")
+	var firstErr error
+
+	for _, e := range p.extractors {
+		if err := ctx.Err(); err != nil {
+			// Out of time: keep what the earlier extractors found
+			if firstErr == nil {
+				firstErr = err
+			}
+			break
+		}
+
+		result, err := e.Extract(ctx, page, found)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s extractor: %w", e.Name(), err)
+			}
+			continue
+		}
+		found.Merge(result)
+	}
+
+	if len(found.Fields) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+
+	metadata := buildMetadata(found, page.URL)
+	if firstErr != nil {
+		metadata.FetchStatus = FetchStatusPartial
+	}
+	return metadata, nil
+}
+
+// buildMetadata converts the merged extraction into the response structure,
+// resolving relative URLs against the page URL
+func buildMetadata(found *Extraction, base *url.URL) *URLMetadata {
+	metadata := &URLMetadata{
+		Title:       found.Get(FieldTitle),
+		Description: found.Get(FieldDescription),
+		OgImage:     resolveURL(found.Get(FieldImage), base),
+		Favicon:     resolveURL(found.Get(FieldFavicon), base),
+		Author:      found.Get(FieldAuthor),
+		PublishedAt: found.Get(FieldPublishedAt),
+		SiteName:    found.Get(FieldSiteName),
+		ThemeColor:  found.Get(FieldThemeColor),
+		ContentType: found.Get(FieldContentType),
+		Format:      found.Get(FieldFormat),
+		Keywords:    keywordList(found.Get(FieldKeywords)),
+		Images:      found.Images,
+		Placeholder: found.Placeholder,
+		Embed:       found.Embed,
+		Content:     found.Content,
+		Site:        found.Site,
+		Document:    found.Document,
+		Citation:    found.Citation,
+		Media:       found.Media,
+
+		CanonicalURL: resolveCanonicalURL(found.Get(FieldCanonical), base, found.Fields[FieldCanonical].Confidence >= ConfidenceSite),
+	}
+
+	for field, c := range found.Fields {
+		if c.Value == "" {
+			continue
+		}
+		if metadata.Confidence == nil {
+			metadata.Confidence = make(map[string]float64, len(found.Fields))
+		}
+		metadata.Confidence[string(field)] = c.Confidence
+	}
+
+	return metadata
+}
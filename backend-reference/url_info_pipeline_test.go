@@ -0,0 +1,166 @@
+// Package handler tests for the extractor pipeline
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// stubExtractor returns a fixed extraction
+type stubExtractor struct {
+	name   string
+	fields map[Field]string
+	conf   float64
+	err    error
+}
+
+func (s stubExtractor) Name() string { return s.name }
+
+func (s stubExtractor) Extract(_ context.Context, _ *Page, _ *Extraction) (*Extraction, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	found := NewExtraction(s.name)
+	for f, v := range s.fields {
+		found.Set(f, v, s.conf)
+	}
+	return found, nil
+}
+
+func testPage(t *testing.T, rawURL, body string) *Page {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("Failed to parse %s: %v", rawURL, err)
+	}
+	return &Page{URL: u, StatusCode: http.StatusOK, ContentType: "text/html", Body: []byte(body)}
+}
+
+func TestPipeline_MergesByConfidence(t *testing.T) {
+	pipeline := NewPipeline(
+		stubExtractor{name: "low", conf: ConfidenceLow, fields: map[Field]string{
+			FieldTitle:       "Low Title",
+			FieldDescription: "Only Description",
+		}},
+		stubExtractor{name: "high", conf: ConfidenceHigh, fields: map[Field]string{
+			FieldTitle: "High Title",
+			FieldImage: "/cover.png",
+		}},
+		stubExtractor{name: "broken", err: errors.New("boom")},
+	)
+
+	metadata, err := pipeline.Run(context.Background(), testPage(t, "https://example.com/a/", ""))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if metadata.Title != "High Title" {
+		t.Errorf("Expected 'High Title', got %s", metadata.Title)
+	}
+	if metadata.Description != "Only Description" {
+		t.Errorf("Expected 'Only Description', got %s", metadata.Description)
+	}
+	if metadata.OgImage != "https://example.com/cover.png" {
+		t.Errorf("Expected resolved image, got %s", metadata.OgImage)
+	}
+	if metadata.Confidence["title"] != ConfidenceHigh {
+		t.Errorf("Expected title confidence %v, got %v", ConfidenceHigh, metadata.Confidence["title"])
+	}
+}
+
+func TestPipeline_AllExtractorsFail(t *testing.T) {
+	pipeline := NewPipeline(stubExtractor{name: "broken", err: errors.New("boom")})
+
+	if _, err := pipeline.Run(context.Background(), testPage(t, "https://example.com", "")); err == nil {
+		t.Error("Expected error when no extractor produced results")
+	}
+}
+
+func TestSiteExtractor_HostMatching(t *testing.T) {
+	site := SiteExtractor{
+		Hosts:     []string{"example.com"},
+		Extractor: stubExtractor{name: "site", conf: ConfidenceSite, fields: map[Field]string{FieldTitle: "Site"}},
+	}
+
+	testCases := []struct {
+		url   string
+		match bool
+	}{
+		{"https://example.com/x", true},
+		{"https://www.example.com/x", true},
+		{"https://notexample.com/x", false},
+	}
+
+	for _, tc := range testCases {
+		found, _ := site.Extract(context.Background(), testPage(t, tc.url, ""), NewExtraction(""))
+		if (found != nil) != tc.match {
+			t.Errorf("For %s: expected match=%v", tc.url, tc.match)
+		}
+	}
+}
+
+func TestDefaultPipeline_DOMBeatsRegexFallback(t *testing.T) {
+	page := testPage(t, "https://example.com/post", `
+		<html><head>
+			<title>Tag Title</title>
+			<meta property="og:title" content="OG Title">
+			<meta name="description" content="Meta Description">
+		</head><body></body></html>
+	`)
+	page.fetcher = newResourceFetcher(map[string][2]string{"https://example.com/favicon.ico": {"image/x-icon", testICO}})
+
+	metadata, err := defaultPipeline().Run(context.Background(), page)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if metadata.Title != "OG Title" {
+		t.Errorf("Expected 'OG Title', got %s", metadata.Title)
+	}
+	if metadata.Description != "Meta Description" {
+		t.Errorf("Expected 'Meta Description', got %s", metadata.Description)
+	}
+	if metadata.Favicon != "https://example.com/favicon.ico" {
+		t.Errorf("Expected default favicon, got %s", metadata.Favicon)
+	}
+}
+
+func TestSimpleURLInfoHandler_UsesPipeline(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><head>
+			<meta content="https://example.com/image.jpg" property="og:image">
+			<meta property="og:title" content="OG Title">
+		</head></html>`))
+	}))
+	defer testServer.Close()
+	allowLoopbackForTest(t)
+
+	req := httptest.NewRequest("GET", "/client/common/urlInfo?targetUrl="+testServer.URL, nil)
+	w := httptest.NewRecorder()
+
+	SimpleURLInfoHandler(w, req)
+
+	var response struct {
+		Status int               `json:"status"`
+		Data   SimpleURLMetadata `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if response.Status != 1 {
+		t.Errorf("Expected status 1, got %d", response.Status)
+	}
+	if response.Data.OgImage != "https://example.com/image.jpg" {
+		t.Errorf("Expected og:image, got %s", response.Data.OgImage)
+	}
+	if response.Data.Title != "OG Title" {
+		t.Errorf("Expected 'OG Title', got %s", response.Data.Title)
+	}
+}
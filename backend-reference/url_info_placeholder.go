@@ -0,0 +1,239 @@
+// Cover image placeholders
+// Card grids flash while remote covers load. Once the cover is chosen, it is
+// downloaded and decoded (JPEG, PNG, GIF, WebP) to compute a BlurHash, its
+// dominant and average colors and its aspect ratio, so the frontend can paint
+// a placeholder immediately. The values are cached with the metadata.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"math"
+	"strings"
+	"time"
+)
+
+// Placeholder settings
+const (
+	placeholderSize    = 64 // the cover is scaled to fit this square before analysis
+	placeholderTimeout = 5 * time.Second
+	colorBucketBits    = 4 // per channel, when looking for the dominant color
+)
+
+// ImagePlaceholder describes a cover well enough to stand in for it
+type ImagePlaceholder struct {
+	BlurHash      string  `json:"blurHash"`
+	DominantColor string  `json:"dominantColor"` // #rrggbb
+	AverageColor  string  `json:"averageColor"`  // #rrggbb
+	AspectRatio   float64 `json:"aspectRatio"`   // width / height
+	Width         int     `json:"width"`
+	Height        int     `json:"height"`
+}
+
+// placeholderExtractor computes the placeholder for the chosen cover. A cover
+// that cannot be downloaded or decoded simply gets none.
+type placeholderExtractor struct{}
+
+func (placeholderExtractor) Name() string { return "placeholder" }
+
+func (placeholderExtractor) Extract(ctx context.Context, page *Page, found *Extraction) (*Extraction, error) {
+	cover := resolveURL(found.Get(FieldImage), page.URL)
+	if cover == "" {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, placeholderTimeout)
+	defer cancel()
+
+	// A link straight to an image has its body here already
+	file := page.cover
+	if file == nil || file.URL != cover {
+		var err error
+		file, err = downloadImage(ctx, page.Fetcher(), cover, defaultMirrorMaxBytes)
+		if err != nil {
+			return nil, nil
+		}
+	}
+	src, orientation, err := decodeImage(file.Data, file.ContentType, defaultMirrorMaxPixels)
+	if err != nil {
+		return nil, nil
+	}
+
+	// Kept for the media mirror, which would otherwise download it again
+	page.cover = file
+
+	result := NewExtraction("placeholder")
+	result.Placeholder = computePlaceholder(src, orientation)
+	return result, nil
+}
+
+// computePlaceholder analyzes a small copy of img
+func computePlaceholder(img image.Image, orientation int) *ImagePlaceholder {
+	width, height := orientedSize(img.Bounds().Dx(), img.Bounds().Dy(), orientation)
+
+	w, h := placeholderSize, placeholderSize
+	if width >= height {
+		h = max(1, (height*placeholderSize+width/2)/width)
+	} else {
+		w = max(1, (width*placeholderSize+height/2)/height)
+	}
+	if width < w {
+		w, h = width, height
+	}
+	small := orient(scaleImage(img, w, h, orientation), orientation)
+
+	xComponents, yComponents := 4, 3
+	if height > width {
+		xComponents, yComponents = 3, 4
+	}
+
+	return &ImagePlaceholder{
+		BlurHash:      blurHash(small, xComponents, yComponents),
+		DominantColor: dominantColor(small),
+		AverageColor:  averageColor(small),
+		AspectRatio:   math.Round(float64(width)/float64(height)*10000) / 10000,
+		Width:         width,
+		Height:        height,
+	}
+}
+
+// averageColor is the mean color of img
+func averageColor(img *image.RGBA) string {
+	var r, g, b, n int
+	for i := 0; i+3 < len(img.Pix); i += 4 {
+		r += int(img.Pix[i])
+		g += int(img.Pix[i+1])
+		b += int(img.Pix[i+2])
+		n++
+	}
+	if n == 0 {
+		return ""
+	}
+	return hexColor(r/n, g/n, b/n)
+}
+
+// dominantColor groups pixels into coarse color buckets and returns the mean
+// of the most populated one
+func dominantColor(img *image.RGBA) string {
+	type bucket struct{ r, g, b, n int }
+	buckets := make(map[int]*bucket)
+	var best *bucket
+
+	shift := 8 - colorBucketBits
+	for i := 0; i+3 < len(img.Pix); i += 4 {
+		r, g, b := int(img.Pix[i]), int(img.Pix[i+1]), int(img.Pix[i+2])
+		key := r>>shift<<(2*colorBucketBits) | g>>shift<<colorBucketBits | b>>shift
+		bk := buckets[key]
+		if bk == nil {
+			bk = &bucket{}
+			buckets[key] = bk
+		}
+		bk.r, bk.g, bk.b, bk.n = bk.r+r, bk.g+g, bk.b+b, bk.n+1
+		if best == nil || bk.n > best.n {
+			best = bk
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return hexColor(best.r/best.n, best.g/best.n, best.b/best.n)
+}
+
+func hexColor(r, g, b int) string {
+	return fmt.Sprintf("#%02x%02x%02x", r, g, b)
+}
+
+// blurHashChars is the base 83 alphabet of BlurHash
+const blurHashChars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// blurHash encodes img per https://github.com/woltapp/blurhash/blob/master/Algorithm.md
+func blurHash(img *image.RGBA, xComponents, yComponents int) string {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+
+	// Linear RGB per pixel, computed once
+	linear := make([][3]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := img.RGBAAt(x, y)
+			linear[y*w+x] = [3]float64{srgbToLinear(c.R), srgbToLinear(c.G), srgbToLinear(c.B)}
+		}
+	}
+
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for j := 0; j < yComponents; j++ {
+		for i := 0; i < xComponents; i++ {
+			var f [3]float64
+			for y := 0; y < h; y++ {
+				cy := math.Cos(math.Pi * float64(j) * float64(y) / float64(h))
+				for x := 0; x < w; x++ {
+					basis := cy * math.Cos(math.Pi*float64(i)*float64(x)/float64(w))
+					p := linear[y*w+x]
+					f[0] += basis * p[0]
+					f[1] += basis * p[1]
+					f[2] += basis * p[2]
+				}
+			}
+			scale := 2.0
+			if i == 0 && j == 0 {
+				scale = 1
+			}
+			scale /= float64(w * h)
+			factors = append(factors, [3]float64{f[0] * scale, f[1] * scale, f[2] * scale})
+		}
+	}
+
+	var hash strings.Builder
+	encode83(&hash, (xComponents-1)+(yComponents-1)*9, 1)
+
+	dc, ac := factors[0], factors[1:]
+	maximum := 1.0
+	if len(ac) > 0 {
+		actualMax := 0.0
+		for _, f := range ac {
+			actualMax = max(actualMax, math.Abs(f[0]), math.Abs(f[1]), math.Abs(f[2]))
+		}
+		quantized := int(max(0, min(82, math.Floor(actualMax*166-0.5))))
+		maximum = float64(quantized+1) / 166
+		encode83(&hash, quantized, 1)
+	} else {
+		encode83(&hash, 0, 1)
+	}
+
+	encode83(&hash, linearToSRGB(dc[0])<<16|linearToSRGB(dc[1])<<8|linearToSRGB(dc[2]), 4)
+	for _, f := range ac {
+		q := func(v float64) int {
+			return int(max(0, min(18, math.Floor(signPow(v/maximum, 0.5)*9+9.5))))
+		}
+		encode83(&hash, q(f[0])*19*19+q(f[1])*19+q(f[2]), 2)
+	}
+	return hash.String()
+}
+
+func encode83(b *strings.Builder, value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		digit := value / int(math.Pow(83, float64(i))) % 83
+		b.WriteByte(blurHashChars[digit])
+	}
+}
+
+func srgbToLinear(v uint8) float64 {
+	c := float64(v) / 255
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) int {
+	v = max(0, min(1, v))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(v, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
@@ -0,0 +1,129 @@
+// Package handler tests for cover image placeholders
+package handler
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func solidImage(w, h int, c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	return img
+}
+
+func TestBlurHash(t *testing.T) {
+	testCases := []struct {
+		name     string
+		img      *image.RGBA
+		expected string
+	}{
+		{"black", solidImage(8, 6, color.RGBA{A: 255}), "L00000" + strings.Repeat("fQ", 11)},
+		// The DC component (characters 2-5) is pure red
+		{"red", solidImage(8, 6, color.RGBA{R: 255, A: 255}), "LsTI:j]9fQ]9|csUfQsUfQfQfQfQ"},
+	}
+	for _, tc := range testCases {
+		if got := blurHash(tc.img, 4, 3); got != tc.expected {
+			t.Errorf("%s: expected %s, got %s", tc.name, tc.expected, got)
+		}
+	}
+
+	// A gradient has AC components; the size flag encodes 3x4
+	gradient := image.NewRGBA(image.Rect(0, 0, 6, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 6; x++ {
+			gradient.SetRGBA(x, y, color.RGBA{R: uint8(y * 32), B: uint8(x * 40), A: 255})
+		}
+	}
+	hash := blurHash(gradient, 3, 4)
+	if len(hash) != 4+2*12 || hash[0] != blurHashChars[2+3*9] || hash[1] == '0' {
+		t.Errorf("Unexpected gradient hash %s", hash)
+	}
+}
+
+func TestComputePlaceholder(t *testing.T) {
+	// Mostly white with a red stripe: white dominates, the average is pinker
+	img := solidImage(400, 200, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 100; x++ {
+			img.SetRGBA(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+
+	p := computePlaceholder(img, 1)
+	if p.DominantColor != "#ffffff" || p.AverageColor == "#ffffff" || p.AverageColor[:3] != "#ff" {
+		t.Errorf("Unexpected colors %+v", p)
+	}
+	if p.Width != 400 || p.Height != 200 || p.AspectRatio != 2 || len(p.BlurHash) != 28 {
+		t.Errorf("Unexpected placeholder %+v", p)
+	}
+
+	// A quarter turn swaps the dimensions and the component counts
+	rotated := computePlaceholder(img, 6)
+	if rotated.Width != 200 || rotated.Height != 400 || rotated.AspectRatio != 0.5 || rotated.BlurHash[0] != blurHashChars[2+3*9] {
+		t.Errorf("Unexpected rotated placeholder %+v", rotated)
+	}
+}
+
+func TestFetcher_PlaceholderSharesCoverDownload(t *testing.T) {
+	cover := testImage(t, 300, 200, encodePNG)
+	var downloads int32
+	fetcher := NewFetcher(FetcherConfig{
+		Media: NewMediaMirror(NewLocalStore(t.TempDir(), "https://media.example.com"), MediaConfig{}),
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			switch req.URL.Path {
+			case "/post":
+				return cannedResponse(req, http.StatusOK, "text/html", `<html><head><title>Post</title>
+					<meta property="og:image" content="/cover.png"></head></html>`), nil
+			case "/cover.png":
+				if req.Header.Get("Range") == "" {
+					atomic.AddInt32(&downloads, 1)
+				}
+				return cannedResponse(req, http.StatusOK, "image/png", string(cover)), nil
+			}
+			return cannedResponse(req, http.StatusNotFound, "text/plain", ""), nil
+		}),
+	})
+
+	metadata, err := fetcher.Fetch(context.Background(), "https://example.com/post")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	p := metadata.Placeholder
+	if p == nil || p.Width != 300 || p.Height != 200 || p.AspectRatio != 1.5 || p.DominantColor != "#ff0000" {
+		t.Errorf("Unexpected placeholder %+v", p)
+	}
+	if metadata.Mirror == nil {
+		t.Error("Expected a mirrored cover")
+	}
+	if downloads != 1 {
+		t.Errorf("Expected the cover to be downloaded once, got %d", downloads)
+	}
+}
+
+func TestPlaceholderExtractor_SkipsUndecodableCover(t *testing.T) {
+	fetcher := NewFetcher(FetcherConfig{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path == "/post" {
+				return cannedResponse(req, http.StatusOK, "text/html", `<html><head><title>Post</title>
+					<meta property="og:image" content="/cover.svg"></head></html>`), nil
+			}
+			return cannedResponse(req, http.StatusOK, "image/svg+xml", `<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"/>`), nil
+		}),
+	})
+
+	metadata, err := fetcher.Fetch(context.Background(), "https://example.com/post")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if metadata.Placeholder != nil {
+		t.Errorf("Expected no placeholder for an SVG cover, got %+v", metadata.Placeholder)
+	}
+}
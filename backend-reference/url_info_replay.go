@@ -0,0 +1,137 @@
+// Record/replay HTTP transport for offline extractor tests
+// RecordingTransport saves every response it passes through, headers and
+// body, as a raw HTTP message in a fixture directory. ReplayTransport serves
+// those files back without touching the network, so a corpus of real pages
+// can regression-test the extractors deterministically.
+
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrNoRecording is returned by ReplayTransport for a request it has no
+// recording of
+var ErrNoRecording = errors.New("no recorded response")
+
+// maxRecordedBytes caps the body saved for one response
+const maxRecordedBytes = 10 << 20
+
+// Headers dropped from recordings: they vary per request or carry session state
+var unrecordedHeaders = []string{"Date", "Set-Cookie", "Age", "X-Request-Id", "Cf-Ray"}
+
+// RecordingTransport passes requests to Next and writes each response to Dir
+type RecordingTransport struct {
+	Next http.RoundTripper
+	Dir  string
+
+	mu sync.Mutex
+}
+
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.Next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRecordedBytes))
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to record %s: %w", req.URL.Redacted(), err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	// Save a copy with a fixed length so replay does not depend on how the
+	// original was framed
+	saved := *resp
+	saved.Header = resp.Header.Clone()
+	for _, name := range unrecordedHeaders {
+		saved.Header.Del(name)
+	}
+	saved.Header.Del("Transfer-Encoding")
+	saved.TransferEncoding = nil
+	saved.ContentLength = int64(len(body))
+	saved.Body = io.NopCloser(bytes.NewReader(body))
+
+	dump, err := httputil.DumpResponse(&saved, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record %s: %w", req.URL.Redacted(), err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := os.MkdirAll(t.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(t.Dir, recordingName(req)), dump, 0o644); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// ReplayTransport serves responses saved by RecordingTransport from Dir.
+// Requests without a recording fail with ErrNoRecording and are listed by
+// Misses.
+type ReplayTransport struct {
+	Dir string
+
+	mu     sync.Mutex
+	misses []string
+}
+
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	dump, err := os.ReadFile(filepath.Join(t.Dir, recordingName(req)))
+	if errors.Is(err, os.ErrNotExist) {
+		t.mu.Lock()
+		t.misses = append(t.misses, req.Method+" "+req.URL.String())
+		t.mu.Unlock()
+		return nil, fmt.Errorf("%w for %s %s", ErrNoRecording, req.Method, req.URL.Redacted())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(dump)), req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to replay %s: %w", req.URL.Redacted(), err)
+	}
+	return resp, nil
+}
+
+// Misses returns the requests that had no recording, in order
+func (t *ReplayTransport) Misses() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.misses...)
+}
+
+// recordingName is the file a request's response is saved under: a readable
+// slug of the URL plus a hash of the method and full URL
+func recordingName(req *http.Request) string {
+	sum := sha256.Sum256([]byte(req.Method + " " + req.URL.String()))
+
+	slug := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '.' {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(req.URL.Host+req.URL.Path))
+	slug = strings.Trim(slug, "-")
+	if len(slug) > 60 {
+		slug = slug[:60]
+	}
+
+	return slug + "-" + hex.EncodeToString(sum[:4]) + ".http"
+}
@@ -0,0 +1,137 @@
+// Package handler tests for record/replay and the golden-file corpus
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Refresh the corpus in testdata/replay:
+//
+//	go test -run TestGolden -record -update   # fetch live, rewrite recordings and goldens
+//	go test -run TestGolden -update           # re-extract from recordings, rewrite goldens
+var (
+	recordFlag = flag.Bool("record", false, "record golden fixtures from the live network")
+	updateFlag = flag.Bool("update", false, "rewrite golden metadata")
+)
+
+// goldenFixture is testdata/replay/<name>/golden.json. A new fixture needs
+// only the URL; -record -update fills in the rest.
+type goldenFixture struct {
+	URL      string       `json:"url"`
+	Metadata *URLMetadata `json:"metadata,omitempty"`
+}
+
+func TestGolden(t *testing.T) {
+	dirs, err := filepath.Glob(filepath.Join("testdata", "replay", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) == 0 {
+		t.Fatal("No fixtures in testdata/replay")
+	}
+
+	for _, dir := range dirs {
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			goldenPath := filepath.Join(dir, "golden.json")
+			raw, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fixture goldenFixture
+			if err := json.Unmarshal(raw, &fixture); err != nil {
+				t.Fatalf("Invalid %s: %v", goldenPath, err)
+			}
+
+			replay := &ReplayTransport{Dir: dir}
+			var transport http.RoundTripper = replay
+			if *recordFlag {
+				transport = &RecordingTransport{Next: newSafeTransport(defaultConnectTimeout, nil), Dir: dir}
+			}
+			fetcher := NewFetcher(FetcherConfig{Transport: transport})
+
+			targetURL, err := fetcher.Validate(fixture.URL)
+			if err != nil {
+				t.Fatalf("Invalid fixture URL: %v", err)
+			}
+			// Goldens record everything, including the content analysis
+			metadata, err := fetcher.FetchFull(context.Background(), targetURL)
+			if err != nil {
+				t.Fatalf("Fetch failed: %v", err)
+			}
+			if misses := replay.Misses(); len(misses) > 0 {
+				t.Errorf("Requests without a recording (run with -record): %v", misses)
+			}
+
+			if *updateFlag {
+				fixture.Metadata = metadata
+				out, _ := json.MarshalIndent(fixture, "", "  ")
+				if err := os.WriteFile(goldenPath, append(out, '\n'), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, _ := json.MarshalIndent(fixture.Metadata, "", "  ")
+			got, _ := json.MarshalIndent(metadata, "", "  ")
+			if !bytes.Equal(want, got) {
+				t.Errorf("Metadata differs from %s (run with -update if intended)\nwant: %s\ngot:  %s", goldenPath, want, got)
+			}
+		})
+	}
+}
+
+func TestRecordingTransport_RoundTrip(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Header().Set("ETag", `"v1"`)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("<title>Recorded</title>"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	recorder := &RecordingTransport{Next: http.DefaultTransport, Dir: dir}
+	req, _ := http.NewRequest("GET", server.URL+"/page?q=1", nil)
+	resp, err := recorder.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	live, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	// The server is gone; the recording is all that is left
+	server.Close()
+	replay := &ReplayTransport{Dir: dir}
+	resp, err = replay.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("Unexpected replay error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != string(live) || resp.StatusCode != http.StatusCreated {
+		t.Errorf("Expected %d %q, got %d %q", http.StatusCreated, live, resp.StatusCode, body)
+	}
+	if resp.Header.Get("ETag") != `"v1"` || resp.Header.Get("Set-Cookie") != "" {
+		t.Errorf("Unexpected replayed headers %v", resp.Header)
+	}
+
+	other, _ := http.NewRequest("GET", server.URL+"/page?q=2", nil)
+	if _, err := replay.RoundTrip(other); !errors.Is(err, ErrNoRecording) {
+		t.Errorf("Expected ErrNoRecording, got %v", err)
+	}
+	if misses := replay.Misses(); len(misses) != 1 {
+		t.Errorf("Expected one miss, got %v", misses)
+	}
+}
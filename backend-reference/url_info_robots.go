@@ -0,0 +1,312 @@
+// robots.txt compliance for CopusBot
+// Page fetches consult the target origin's robots.txt (RFC 9309) before
+// downloading: the CopusBot group, or the * group when there is none, decides
+// with longest-match Allow/Disallow rules. Crawl-delay slows the origin's
+// token bucket. Policies are cached per origin.
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRobotsDisallowed is returned when robots.txt forbids CopusBot from
+// fetching a URL
+var ErrRobotsDisallowed = errors.New("disallowed by robots.txt")
+
+// robots.txt fetch settings
+const (
+	robotsAgent      = "copusbot" // product token matched against User-agent lines
+	robotsTTL        = 24 * time.Hour
+	robotsErrorTTL   = 10 * time.Minute // after 5xx answers, which disallow everything
+	maxRobotsBytes   = 512 * 1024
+	maxRobotsEntries = 10000
+)
+
+// robotsRule is one Allow or Disallow line
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// robotsPolicy holds the rules that apply to CopusBot on one origin
+type robotsPolicy struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+var (
+	allowAllRobots    = &robotsPolicy{}
+	disallowAllRobots = &robotsPolicy{rules: []robotsRule{{allow: false, pattern: "/"}}}
+)
+
+// parseRobots extracts the rules for agent from a robots.txt body. Groups
+// naming the agent are combined; the * groups apply only when none do.
+func parseRobots(body []byte, agent string) *robotsPolicy {
+	var specific, wildcard robotsPolicy
+	matchedSpecific := false
+
+	// The groups the current rule lines belong to
+	var targets []*robotsPolicy
+	inAgents := false
+
+	text := strings.TrimPrefix(string(body), "\ufeff")
+	for _, line := range strings.Split(text, "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		if key == "user-agent" {
+			if !inAgents {
+				targets = targets[:0]
+				inAgents = true
+			}
+			name, _, _ := strings.Cut(value, "/")
+			switch {
+			case strings.EqualFold(strings.TrimSpace(name), agent):
+				targets = append(targets, &specific)
+				matchedSpecific = true
+			case value == "*":
+				targets = append(targets, &wildcard)
+			}
+			continue
+		}
+		inAgents = false
+
+		switch key {
+		case "allow", "disallow":
+			// An empty Disallow allows everything
+			if value == "" {
+				continue
+			}
+			rule := robotsRule{allow: key == "allow", pattern: normalizeRobotsPath(value)}
+			for _, target := range targets {
+				target.rules = append(target.rules, rule)
+			}
+		case "crawl-delay":
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil || seconds <= 0 {
+				continue
+			}
+			for _, target := range targets {
+				target.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		}
+	}
+
+	if matchedSpecific {
+		return &specific
+	}
+	return &wildcard
+}
+
+// allowed reports whether the policy lets CopusBot fetch u. The longest
+// matching pattern wins; Allow wins ties.
+func (p *robotsPolicy) allowed(u *url.URL) bool {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	path = normalizeRobotsPath(path)
+
+	allow, longest := true, -1
+	for _, rule := range p.rules {
+		if !robotsMatch(rule.pattern, path) {
+			continue
+		}
+		if n := len(rule.pattern); n > longest || (n == longest && rule.allow) {
+			allow, longest = rule.allow, n
+		}
+	}
+	return allow
+}
+
+// robotsMatch matches a path against a pattern where * matches any sequence
+// and a trailing $ anchors the end; patterns are otherwise prefixes
+func robotsMatch(pattern, path string) bool {
+	if strings.HasSuffix(pattern, "$") {
+		pattern = strings.TrimSuffix(pattern, "$")
+	} else {
+		pattern += "*"
+	}
+
+	p, s := 0, 0
+	star, mark := -1, 0
+	for s < len(path) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, s
+			p++
+		case p < len(pattern) && pattern[p] == path[s]:
+			p++
+			s++
+		case star >= 0:
+			// Let the last * swallow one more byte
+			mark++
+			p, s = star+1, mark
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// normalizeRobotsPath percent-encodes non-ASCII bytes and uppercases escapes
+// so patterns and URLs compare byte for byte
+func normalizeRobotsPath(path string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		switch {
+		case c == '%' && i+2 < len(path) && isHexDigit(path[i+1]) && isHexDigit(path[i+2]):
+			b.WriteByte('%')
+			b.WriteString(strings.ToUpper(path[i+1 : i+3]))
+			i += 2
+		case c >= 0x80 || c == ' ':
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&0x0f])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func isHexDigit(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+// robotsEntry is a cached policy; ready is closed once it has been fetched
+type robotsEntry struct {
+	ready   chan struct{}
+	policy  *robotsPolicy
+	err     error
+	expires time.Time
+}
+
+// robotsCache fetches and caches robots.txt policies per origin
+type robotsCache struct {
+	mu      sync.Mutex
+	entries map[string]*robotsEntry
+	fetcher *Fetcher // fetches robots.txt and owns the throttle Crawl-delay adjusts
+	now     func() time.Time
+}
+
+func newRobotsCache(fetcher *Fetcher) *robotsCache {
+	return &robotsCache{
+		entries: make(map[string]*robotsEntry),
+		fetcher: fetcher,
+		now:     time.Now,
+	}
+}
+
+// check returns ErrRobotsDisallowed when u may not be fetched
+func (c *robotsCache) check(ctx context.Context, u *url.URL) error {
+	policy, err := c.policy(ctx, u)
+	if err != nil {
+		return err
+	}
+	if !policy.allowed(u) {
+		return fmt.Errorf("%w: %s", ErrRobotsDisallowed, u.Redacted())
+	}
+	return nil
+}
+
+// policy returns the cached policy for u's origin, fetching it when missing
+// or expired. Concurrent callers share one fetch.
+func (c *robotsCache) policy(ctx context.Context, u *url.URL) (*robotsPolicy, error) {
+	origin := strings.ToLower(u.Scheme + "://" + u.Host)
+
+	c.mu.Lock()
+	entry, ok := c.entries[origin]
+	if ok {
+		select {
+		case <-entry.ready:
+			if c.now().After(entry.expires) {
+				ok = false
+			}
+		default:
+		}
+	}
+	if !ok {
+		c.evict()
+		entry = &robotsEntry{ready: make(chan struct{})}
+		c.entries[origin] = entry
+		c.mu.Unlock()
+
+		entry.policy, entry.expires, entry.err = c.fetch(ctx, origin)
+		if entry.policy != nil && entry.policy.crawlDelay > 0 {
+			c.fetcher.throttle.setDelay(strings.ToLower(u.Host), entry.policy.crawlDelay)
+		}
+		close(entry.ready)
+		return entry.policy, entry.err
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-entry.ready:
+		return entry.policy, entry.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// fetch downloads robots.txt for an origin. Missing files (4xx) allow
+// everything; server errors disallow everything for a short while, as
+// RFC 9309 asks. Network errors are not cached.
+func (c *robotsCache) fetch(ctx context.Context, origin string) (*robotsPolicy, time.Time, error) {
+	body, _, err := c.fetcher.Resource(ctx, origin+"/robots.txt", "text/plain", maxRobotsBytes)
+
+	var status *HTTPStatusError
+	switch {
+	case err == nil:
+		return parseRobots(body, robotsAgent), c.now().Add(robotsTTL), nil
+	case errors.As(err, &status) && (status.StatusCode >= 500 || status.StatusCode == 429):
+		return disallowAllRobots, c.now().Add(robotsErrorTTL), nil
+	case errors.As(err, &status):
+		return allowAllRobots, c.now().Add(robotsTTL), nil
+	default:
+		return nil, time.Time{}, fmt.Errorf("failed to fetch robots.txt: %w", err)
+	}
+}
+
+// evict drops expired entries once the cache is full. Callers hold c.mu.
+func (c *robotsCache) evict() {
+	if len(c.entries) < maxRobotsEntries {
+		return
+	}
+	now := c.now()
+	for origin, entry := range c.entries {
+		select {
+		case <-entry.ready:
+			if now.After(entry.expires) || len(c.entries) >= maxRobotsEntries {
+				delete(c.entries, origin)
+			}
+		default:
+		}
+	}
+}
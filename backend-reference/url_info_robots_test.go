@@ -0,0 +1,186 @@
+// Package handler tests for robots.txt compliance
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testRobots = `# Example robots.txt
+User-agent: *
+Disallow: /private
+Crawl-delay: 1
+
+User-agent: Googlebot
+User-agent: CopusBot/1.0
+Disallow: /drafts/
+Disallow: /*.pdf$
+Allow: /drafts/public
+Disallow: /search?q=*
+
+User-agent: copusbot
+Crawl-delay: 2.5
+Disallow: /tmp
+`
+
+func TestParseRobots(t *testing.T) {
+	policy := parseRobots([]byte(testRobots), robotsAgent)
+
+	if policy.crawlDelay != 2500*time.Millisecond {
+		t.Errorf("Expected crawl delay 2.5s, got %v", policy.crawlDelay)
+	}
+
+	testCases := []struct {
+		path    string
+		allowed bool
+	}{
+		{"/", true},
+		{"/private", true}, // only the * group disallows it
+		{"/drafts/", false},
+		{"/drafts/post", false},
+		{"/drafts/public", true},
+		{"/drafts/public/post", true},
+		{"/files/report.pdf", false},
+		{"/files/report.pdf?download=1", true},
+		{"/search?q=go", false},
+		{"/search", true},
+		{"/tmp/x", false},
+		{"/robots.txt", true},
+	}
+
+	for _, tc := range testCases {
+		u, _ := url.Parse("https://example.com" + tc.path)
+		if got := policy.allowed(u); got != tc.allowed {
+			t.Errorf("For %s: expected allowed=%v, got %v", tc.path, tc.allowed, got)
+		}
+	}
+}
+
+func TestParseRobots_Wildcard(t *testing.T) {
+	policy := parseRobots([]byte("User-agent: *\nDisallow: /private\nDisallow:\nCrawl-delay: 1\n"), robotsAgent)
+
+	for path, allowed := range map[string]bool{"/": true, "/private/x": false, "/public": true} {
+		u, _ := url.Parse("https://example.com" + path)
+		if got := policy.allowed(u); got != allowed {
+			t.Errorf("For %s: expected allowed=%v, got %v", path, allowed, got)
+		}
+	}
+	if policy.crawlDelay != time.Second {
+		t.Errorf("Expected crawl delay 1s, got %v", policy.crawlDelay)
+	}
+
+	// No group applies
+	empty := parseRobots([]byte("User-agent: OtherBot\nDisallow: /\n"), robotsAgent)
+	if u, _ := url.Parse("https://example.com/x"); !empty.allowed(u) {
+		t.Error("Expected other agents' rules to be ignored")
+	}
+}
+
+func TestRobotsMatch(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"/fish", "/fish.html", true},
+		{"/fish", "/Fish", false},
+		{"/fish*", "/fishheads/yummy.html", true},
+		{"/*.php", "/folder/filename.php?parameters", true},
+		{"/*.php$", "/filename.php?parameters", false},
+		{"/fish*.php", "/fishheads/catfish.php?parameters", true},
+		{"/a*b*c$", "/aXbYc", true},
+		{"/a*b*c$", "/aXbYcZ", false},
+		{"/caf%C3%A9", normalizeRobotsPath("/café"), true},
+	}
+
+	for _, tc := range testCases {
+		if got := robotsMatch(normalizeRobotsPath(tc.pattern), tc.path); got != tc.match {
+			t.Errorf("%s vs %s: expected %v, got %v", tc.pattern, tc.path, tc.match, got)
+		}
+	}
+}
+
+func TestRobotsCache(t *testing.T) {
+	var robotsHits int32
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			atomic.AddInt32(&robotsHits, 1)
+			w.WriteHeader(status)
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	allowLoopbackForTest(t)
+
+	now := time.Now()
+	cache := NewFetcher(FetcherConfig{Now: func() time.Time { return now }}).robots
+
+	check := func(path string) error {
+		u, _ := url.Parse(server.URL + path)
+		return cache.check(context.Background(), u)
+	}
+
+	if err := check("/public"); err != nil {
+		t.Errorf("Expected /public to be allowed, got %v", err)
+	}
+	if err := check("/private/1"); !errors.Is(err, ErrRobotsDisallowed) {
+		t.Errorf("Expected ErrRobotsDisallowed, got %v", err)
+	}
+	if robotsHits != 1 {
+		t.Errorf("Expected robots.txt to be fetched once, got %d", robotsHits)
+	}
+
+	// Server errors disallow everything until the short TTL runs out
+	status = http.StatusServiceUnavailable
+	now = now.Add(robotsTTL + time.Minute)
+	if err := check("/public"); !errors.Is(err, ErrRobotsDisallowed) {
+		t.Errorf("Expected 503 robots.txt to disallow, got %v", err)
+	}
+
+	// A missing robots.txt allows everything
+	status = http.StatusNotFound
+	now = now.Add(robotsErrorTTL + time.Minute)
+	if err := check("/private/1"); err != nil {
+		t.Errorf("Expected 404 robots.txt to allow, got %v", err)
+	}
+	if robotsHits != 3 {
+		t.Errorf("Expected 3 robots.txt fetches, got %d", robotsHits)
+	}
+}
+
+func TestURLInfoHandler_RobotsDisallowed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: CopusBot\nDisallow: /members\n"))
+		case "/old":
+			http.Redirect(w, r, "/members/post", http.StatusFound)
+		default:
+			t.Errorf("Unexpected request for %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	allowLoopbackForTest(t)
+
+	for _, path := range []string{"/members/post", "/old"} {
+		req := httptest.NewRequest("GET", "/client/common/urlInfo?url="+url.QueryEscape(server.URL+path), nil)
+		w := httptest.NewRecorder()
+		URLInfoHandler(w, req)
+
+		var response URLInfoResponse
+		json.NewDecoder(w.Body).Decode(&response)
+		if w.Code != http.StatusForbidden || response.Code != ErrCodeRobotsDisallowed {
+			t.Errorf("%s: expected 403 %s, got %d %q", path, ErrCodeRobotsDisallowed, w.Code, response.Code)
+		}
+	}
+}
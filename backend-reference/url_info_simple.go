@@ -1,6 +1,6 @@
-// Simple regex-based URL metadata extractor
-// This is a simpler alternative that uses regex instead of HTML parsing
-// Often more reliable for meta tag extraction
+// Simple URL metadata endpoint and regex-based extractor
+// The handler is a legacy adapter over the shared extractor pipeline; the
+// regex extractor runs in that pipeline as a fallback after the DOM extractor
 
 package handler
 
@@ -8,12 +8,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
-	"net/url"
 	"regexp"
-	"strings"
-	"time"
 )
 
 // Regex patterns for extracting meta tags
@@ -37,16 +33,32 @@ var (
 	faviconRegex = regexp.MustCompile(`(?i)<link[^>]*rel\s*=\s*["'][^"']*icon[^"']*["'][^>]*href\s*=\s*["']([^"']+)["'][^>]*>`)
 )
 
+// maxRegexScanBytes bounds how much of the page the regex fallback scans
+const maxRegexScanBytes = 1024 * 1024
+
 // SimpleURLMetadata contains the extracted metadata
 type SimpleURLMetadata struct {
 	OgImage     string `json:"ogImage"`
 	Title       string `json:"title"`
 	Description string `json:"description"`
 	Favicon     string `json:"favicon"`
+	FetchStatus string `json:"fetchStatus,omitempty"`
 }
 
-// SimpleURLInfoHandler is a simpler regex-based implementation
+// SimpleURLInfoHandler serves the same metadata as URLInfoHandler with the
+// legacy envelope: it accepts targetUrl or url and always answers 200
 func SimpleURLInfoHandler(w http.ResponseWriter, r *http.Request) {
+	NewSimpleURLInfoHandler(DefaultFetcher)(w, r)
+}
+
+// NewSimpleURLInfoHandler returns the legacy handler backed by fetcher
+func NewSimpleURLInfoHandler(fetcher *Fetcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		serveSimpleURLInfo(fetcher, w, r)
+	}
+}
+
+func serveSimpleURLInfo(fetcher *Fetcher, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if r.Method != http.MethodGet {
@@ -70,150 +82,86 @@ func SimpleURLInfoHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Add https:// if missing
-	if !strings.HasPrefix(targetURL, "http://") && !strings.HasPrefix(targetURL, "https://") {
-		targetURL = "https://" + targetURL
-	}
-
-	// Fetch the page
-	htmlContent, err := fetchPage(targetURL)
+	// Add https:// if missing and reject private/local hosts
+	targetURL, err := fetcher.Validate(targetURL)
 	if err != nil {
-		fmt.Printf("[URLInfo] Failed to fetch %s: %v\n", targetURL, err)
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"status": 1,
-			"msg":    "success",
-			"data": SimpleURLMetadata{
-				OgImage:     "",
-				Title:       "",
-				Description: "",
-				Favicon:     "",
-			},
+			"status": 0,
+			"msg":    fmt.Sprintf("Invalid URL: %v", err),
+			"code":   urlErrorCode(err),
 		})
 		return
 	}
 
-	// Extract metadata using regex
-	metadata := extractMetadataRegex(htmlContent, targetURL)
+	// Fetch through the shared extractor pipeline
+	metadata, err := fetcher.Fetch(r.Context(), targetURL)
+	if _, code, message, refused := refusedFetch(err); refused {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": 0,
+			"msg":    message,
+			"code":   code,
+		})
+		return
+	}
+	if err != nil {
+		logFetchFailure("simpleUrlInfo", targetURL, err)
+		metadata = failureMetadata(err)
+	}
 
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status": 1,
 		"msg":    "success",
-		"data":   metadata,
+		"data": SimpleURLMetadata{
+			OgImage:     metadata.OgImage,
+			Title:       metadata.Title,
+			Description: metadata.Description,
+			Favicon:     metadata.Favicon,
+			FetchStatus: metadata.FetchStatus,
+		},
 	})
 }
 
-func fetchPage(targetURL string) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	req, err := http.NewRequestWithContext(ctx, "GET", targetURL, nil)
-	if err != nil {
-		return "", err
-	}
-
-	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; CopusBot/1.0)")
-	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+// regexExtractor is the fallback for pages the DOM extractor got little from,
+// such as meta tags emitted outside <head> in malformed markup
+type regexExtractor struct{}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
+func (regexExtractor) Name() string { return "regex" }
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("status %d", resp.StatusCode)
+func (regexExtractor) Extract(_ context.Context, page *Page, found *Extraction) (*Extraction, error) {
+	// Nothing left to fill
+	if found.Has(FieldImage, FieldTitle, FieldDescription, FieldFavicon) {
+		return nil, nil
 	}
 
-	// Read up to 1MB
-	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
-	if err != nil {
-		return "", err
+	body := page.Body
+	if len(body) > maxRegexScanBytes {
+		body = body[:maxRegexScanBytes]
 	}
-
-	return string(body), nil
+	return extractMetadataRegex(string(body)), nil
 }
 
-func extractMetadataRegex(html, baseURL string) SimpleURLMetadata {
-	metadata := SimpleURLMetadata{}
+// extractMetadataRegex extracts metadata with regexes, ranked below the DOM
+// extractor so it only fills gaps
+func extractMetadataRegex(html string) *Extraction {
+	found := NewExtraction("regex")
 
-	// Extract og:image
-	if matches := ogImageRegex.FindStringSubmatch(html); len(matches) > 0 {
-		for i := 1; i < len(matches); i++ {
-			if matches[i] != "" {
-				metadata.OgImage = matches[i]
-				break
-			}
-		}
-	}
-
-	// Fallback to twitter:image if no og:image
-	if metadata.OgImage == "" {
-		if matches := twitterImageRegex.FindStringSubmatch(html); len(matches) > 0 {
-			for i := 1; i < len(matches); i++ {
-				if matches[i] != "" {
-					metadata.OgImage = matches[i]
-					break
-				}
-			}
-		}
-	}
-
-	// Extract og:title
-	if matches := ogTitleRegex.FindStringSubmatch(html); len(matches) > 0 {
-		for i := 1; i < len(matches); i++ {
-			if matches[i] != "" {
-				metadata.Title = matches[i]
-				break
-			}
-		}
-	}
-
-	// Fallback to <title> tag
-	if metadata.Title == "" {
-		if matches := titleTagRegex.FindStringSubmatch(html); len(matches) > 1 {
-			metadata.Title = strings.TrimSpace(matches[1])
-		}
-	}
+	found.Set(FieldImage, firstSubmatch(ogImageRegex, html), ConfidenceMedium)
+	found.Set(FieldImage, firstSubmatch(twitterImageRegex, html), ConfidenceLow)
+	found.Set(FieldTitle, firstSubmatch(ogTitleRegex, html), ConfidenceMedium)
+	found.Set(FieldTitle, firstSubmatch(titleTagRegex, html), ConfidenceLow)
+	found.Set(FieldDescription, firstSubmatch(ogDescRegex, html), ConfidenceMedium)
+	found.Set(FieldFavicon, firstSubmatch(faviconRegex, html), ConfidenceMedium)
 
-	// Extract og:description
-	if matches := ogDescRegex.FindStringSubmatch(html); len(matches) > 0 {
-		for i := 1; i < len(matches); i++ {
-			if matches[i] != "" {
-				metadata.Description = matches[i]
-				break
-			}
-		}
-	}
-
-	// Extract favicon
-	if matches := faviconRegex.FindStringSubmatch(html); len(matches) > 1 {
-		metadata.Favicon = matches[1]
-	}
-
-	// Resolve relative URLs
-	if parsedBase, err := url.Parse(baseURL); err == nil {
-		metadata.OgImage = resolveRelativeURL(metadata.OgImage, parsedBase)
-		metadata.Favicon = resolveRelativeURL(metadata.Favicon, parsedBase)
-
-		// Default favicon
-		if metadata.Favicon == "" {
-			metadata.Favicon = fmt.Sprintf("%s://%s/favicon.ico", parsedBase.Scheme, parsedBase.Host)
-		}
-	}
-
-	return metadata
+	return found
 }
 
-func resolveRelativeURL(rawURL string, base *url.URL) string {
-	if rawURL == "" || strings.HasPrefix(rawURL, "http") {
-		return rawURL
-	}
-	if strings.HasPrefix(rawURL, "//") {
-		return base.Scheme + ":" + rawURL
-	}
-	if ref, err := url.Parse(rawURL); err == nil {
-		return base.ResolveReference(ref).String()
+// firstSubmatch returns the first non-empty capture group of the first match
+func firstSubmatch(re *regexp.Regexp, s string) string {
+	matches := re.FindStringSubmatch(s)
+	for i := 1; i < len(matches); i++ {
+		if matches[i] != "" {
+			return matches[i]
+		}
 	}
-	return rawURL
+	return ""
 }
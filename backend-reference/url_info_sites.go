@@ -0,0 +1,844 @@
+// Site-specific extractors
+// Generic og: parsing fails on bot-walled or JS-rendered sites. These
+// extractors use each site's public, no-auth representation (oEmbed, JSON
+// listings, the arXiv Atom API) and fall back to the raw page HTML. They run
+// first in the pipeline, so their values and typed extras take precedence.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// maxSiteAPIBytes bounds API responses read by site extractors
+const maxSiteAPIBytes = 1024 * 1024
+
+// SiteExtras holds typed details from a site-specific extractor. Site names
+// the extractor; only the block for that site is set.
+type SiteExtras struct {
+	Site       string        `json:"site"` // youtube, x, github, reddit, spotify or arxiv
+	Video      *YouTubeVideo `json:"video,omitempty"`
+	Post       *SocialPost   `json:"post,omitempty"`
+	Repository *Repository   `json:"repository,omitempty"`
+	Audio      *SpotifyItem  `json:"audio,omitempty"`
+	Paper      *Paper        `json:"paper,omitempty"`
+}
+
+// YouTubeVideo describes a YouTube video
+type YouTubeVideo struct {
+	ID              string `json:"id"`
+	Channel         string `json:"channel,omitempty"`
+	ChannelURL      string `json:"channelUrl,omitempty"`
+	DurationSeconds int    `json:"durationSeconds,omitempty"`
+	IsShort         bool   `json:"isShort,omitempty"`
+}
+
+// SocialPost describes a post on X or Reddit
+type SocialPost struct {
+	ID        string `json:"id"`
+	Author    string `json:"author,omitempty"`
+	Handle    string `json:"handle,omitempty"`    // @handle on X
+	Community string `json:"community,omitempty"` // r/subreddit on Reddit
+	Text      string `json:"text,omitempty"`
+	Language  string `json:"language,omitempty"`
+	Score     int    `json:"score,omitempty"`
+	Comments  int    `json:"comments,omitempty"`
+	NSFW      bool   `json:"nsfw,omitempty"`
+	LinkURL   string `json:"linkUrl,omitempty"` // target of a link post
+}
+
+// Repository describes a GitHub repository
+type Repository struct {
+	Owner      string   `json:"owner"`
+	Name       string   `json:"name"`
+	Stars      int      `json:"stars"`
+	Forks      int      `json:"forks"`
+	OpenIssues int      `json:"openIssues,omitempty"`
+	Language   string   `json:"language,omitempty"`
+	Topics     []string `json:"topics,omitempty"`
+	License    string   `json:"license,omitempty"` // SPDX identifier
+	Homepage   string   `json:"homepage,omitempty"`
+	PushedAt   string   `json:"pushedAt,omitempty"`
+	Archived   bool     `json:"archived,omitempty"`
+}
+
+// SpotifyItem describes a Spotify track, album, playlist, episode, show or artist
+type SpotifyItem struct {
+	Kind            string `json:"kind"`
+	ID              string `json:"id"`
+	Artist          string `json:"artist,omitempty"`
+	DurationSeconds int    `json:"durationSeconds,omitempty"`
+	ReleaseDate     string `json:"releaseDate,omitempty"`
+}
+
+// Paper describes an arXiv preprint
+type Paper struct {
+	ArxivID         string   `json:"arxivId"`
+	Authors         []string `json:"authors,omitempty"`
+	PrimaryCategory string   `json:"primaryCategory,omitempty"`
+	Categories      []string `json:"categories,omitempty"`
+	PDFURL          string   `json:"pdfUrl,omitempty"`
+	DOI             string   `json:"doi,omitempty"`
+	UpdatedAt       string   `json:"updatedAt,omitempty"`
+}
+
+func init() {
+	registerSiteExtractor([]string{"youtube.com", "youtu.be"}, youtubeExtractor{oembedEndpoint: "https://www.youtube.com/oembed"})
+	registerSiteExtractor([]string{"twitter.com", "x.com"}, twitterExtractor{oembedEndpoint: "https://publish.twitter.com/oembed"})
+	registerSiteExtractor([]string{"github.com"}, githubExtractor{apiBase: "https://api.github.com"})
+	registerSiteExtractor([]string{"reddit.com"}, redditExtractor{apiBase: "https://www.reddit.com"})
+	registerSiteExtractor([]string{"open.spotify.com"}, spotifyExtractor{oembedEndpoint: "https://open.spotify.com/oembed"})
+	registerSiteExtractor([]string{"arxiv.org"}, arxivExtractor{apiBase: "https://export.arxiv.org/api/query"})
+}
+
+// fetchJSON downloads and decodes a JSON API response
+func fetchJSON(ctx context.Context, fetcher *Fetcher, resourceURL, accept string, v interface{}) error {
+	body, _, err := fetcher.Resource(ctx, resourceURL, accept, maxSiteAPIBytes)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+// fetchOEmbed calls an oEmbed endpoint for pageURL
+func fetchOEmbed(ctx context.Context, fetcher *Fetcher, endpoint, pageURL string) (*oembedResponse, error) {
+	var resp oembedResponse
+	if err := fetchJSON(ctx, fetcher, oembedEndpointURL(endpoint, pageURL), "application/json", &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// pageMeta collects <meta> values keyed by lowercased property, name or
+// itemprop, in document order. Site extractors use it as a raw HTML fallback.
+func pageMeta(page *Page) map[string][]string {
+	meta := make(map[string][]string)
+	doc, err := page.Document()
+	if err != nil {
+		return meta
+	}
+
+	var traverse func(*html.Node)
+	traverse = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "meta" {
+			var key, content string
+			hasContent := false
+			for _, attr := range n.Attr {
+				switch strings.ToLower(attr.Key) {
+				case "property", "name", "itemprop":
+					if key == "" {
+						key = strings.ToLower(strings.TrimSpace(attr.Val))
+					}
+				case "content":
+					content, hasContent = strings.TrimSpace(attr.Val), true
+				}
+			}
+			if key != "" && hasContent && content != "" {
+				meta[key] = append(meta[key], content)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			traverse(c)
+		}
+	}
+	traverse(doc)
+	return meta
+}
+
+// firstMeta returns the first value of the first key present
+func firstMeta(meta map[string][]string, keys ...string) string {
+	for _, key := range keys {
+		if values := meta[key]; len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// isoDurationRegex matches ISO 8601 durations such as PT1H4M13S
+var isoDurationRegex = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// parseISODuration converts an ISO 8601 duration to seconds, or 0
+func parseISODuration(value string) int {
+	m := isoDurationRegex.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(value)))
+	if m == nil {
+		return 0
+	}
+	seconds := 0.0
+	for i, unit := range []float64{86400, 3600, 60, 1} {
+		if n, err := strconv.ParseFloat(m[i+1], 64); err == nil {
+			seconds += n * unit
+		}
+	}
+	return int(seconds)
+}
+
+// --- YouTube ---
+
+// youtubeIDRegex matches an 11-character video ID
+var youtubeIDRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+
+// youtubeExtractor reads videos through oEmbed and the watch page's itemprop tags
+type youtubeExtractor struct {
+	oembedEndpoint string
+}
+
+func (youtubeExtractor) Name() string { return "youtube" }
+
+func (e youtubeExtractor) Extract(ctx context.Context, page *Page, _ *Extraction) (*Extraction, error) {
+	id, short := youtubeVideoID(page.URL)
+	if id == "" {
+		// Channels, playlists and search pages use the generic extractors
+		return nil, nil
+	}
+
+	found := NewExtraction("youtube")
+	video := &YouTubeVideo{ID: id, IsShort: short}
+	watchURL := "https://www.youtube.com/watch?v=" + id
+
+	if resp, err := fetchOEmbed(ctx, page.Fetcher(), e.oembedEndpoint, watchURL); err == nil {
+		found.Set(FieldTitle, resp.Title, ConfidenceSite)
+		found.Set(FieldAuthor, resp.AuthorName, ConfidenceSite)
+		video.Channel = resp.AuthorName
+		video.ChannelURL = resp.AuthorURL
+	}
+
+	// Private and age-restricted videos have no oEmbed; the page still
+	// carries itemprop metadata
+	meta := pageMeta(page)
+	found.Set(FieldTitle, firstMeta(meta, "og:title", "title"), ConfidenceHigh)
+	found.Set(FieldDescription, firstMeta(meta, "og:description", "description"), ConfidenceHigh)
+	found.Set(FieldPublishedAt, normalizeDate(firstMeta(meta, "uploaddate", "datepublished")), ConfidenceSite)
+	video.DurationSeconds = parseISODuration(firstMeta(meta, "duration"))
+
+	// Thumbnails exist for every public video; maxres only for HD uploads,
+	// which image probing sorts out
+	found.Set(FieldImage, "https://i.ytimg.com/vi/"+id+"/hqdefault.jpg", ConfidenceHigh)
+	found.Images = append(found.Images,
+		ImageCandidate{URL: "https://i.ytimg.com/vi/" + id + "/maxresdefault.jpg", Source: ImageSourceSite, Width: 1280, Height: 720},
+		ImageCandidate{URL: "https://i.ytimg.com/vi/" + id + "/hqdefault.jpg", Source: ImageSourceSite, Width: 480, Height: 360},
+	)
+
+	found.Set(FieldSiteName, "YouTube", ConfidenceSite)
+	found.Set(FieldContentType, "VideoObject", ConfidenceSite)
+	if short {
+		found.Set(FieldCanonical, "https://www.youtube.com/shorts/"+id, ConfidenceSite)
+	} else {
+		found.Set(FieldCanonical, watchURL, ConfidenceSite)
+	}
+
+	found.Embed = &Embed{
+		Type:         "video",
+		HTML:         fmt.Sprintf(`<iframe src="https://www.youtube-nocookie.com/embed/%s" width="560" height="315" frameborder="0" allow="encrypted-media; picture-in-picture" allowfullscreen></iframe>`, id),
+		Width:        560,
+		Height:       315,
+		AuthorName:   video.Channel,
+		ProviderName: "YouTube",
+	}
+	found.Media = &MediaInfo{
+		Kind:            MediaKindVideo,
+		DurationSeconds: video.DurationSeconds,
+		PlayerURL:       "https://www.youtube-nocookie.com/embed/" + id,
+		UploadDate:      found.Get(FieldPublishedAt),
+		Channel:         video.Channel,
+	}
+	found.Site = &SiteExtras{Site: "youtube", Video: video}
+	return found, nil
+}
+
+// youtubeVideoID returns the video ID of a watch, short, live, embed or
+// youtu.be URL and whether it is a Short
+func youtubeVideoID(u *url.URL) (string, bool) {
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+
+	var id string
+	short := false
+	switch {
+	case hostMatches(u.Hostname(), []string{"youtu.be"}):
+		id = segments[0]
+	case u.Path == "/watch":
+		id = u.Query().Get("v")
+	case len(segments) >= 2:
+		switch segments[0] {
+		case "shorts":
+			id, short = segments[1], true
+		case "live", "embed", "v":
+			id = segments[1]
+		}
+	}
+
+	if !youtubeIDRegex.MatchString(id) {
+		return "", false
+	}
+	return id, short
+}
+
+// --- X / Twitter ---
+
+// tweetPathRegex matches /{handle}/status/{id}
+var tweetPathRegex = regexp.MustCompile(`^/([A-Za-z0-9_]{1,15})/status(?:es)?/(\d+)`)
+
+// tweetHandleRegex finds "(@handle)" in the oEmbed blockquote
+var tweetHandleRegex = regexp.MustCompile(`\(@([A-Za-z0-9_]{1,15})\)`)
+
+// twitterExtractor reads posts through the public oEmbed endpoint, since X
+// serves a login wall to crawlers
+type twitterExtractor struct {
+	oembedEndpoint string
+}
+
+func (twitterExtractor) Name() string { return "x" }
+
+// pageless lets the extractor run when the login wall blocks the page fetch
+func (twitterExtractor) pageless() {}
+
+func (e twitterExtractor) Extract(ctx context.Context, page *Page, _ *Extraction) (*Extraction, error) {
+	m := tweetPathRegex.FindStringSubmatch(page.URL.Path)
+	if m == nil {
+		return nil, nil
+	}
+	handle, id := m[1], m[2]
+
+	resp, err := fetchOEmbed(ctx, page.Fetcher(), e.oembedEndpoint, "https://twitter.com/"+handle+"/status/"+id)
+	if err != nil {
+		return nil, err
+	}
+
+	post := parseTweetHTML(resp.HTML)
+	post.ID = id
+	post.Author = resp.AuthorName
+	if post.Handle == "" {
+		post.Handle = handle
+	}
+
+	found := NewExtraction("x")
+	if post.Text != "" {
+		found.Set(FieldTitle, fmt.Sprintf("%s on X: \"%s\"", post.Author, excerpt(post.Text, 100)), ConfidenceSite)
+	}
+	found.Set(FieldDescription, post.Text, ConfidenceSite)
+	found.Set(FieldAuthor, post.Author, ConfidenceSite)
+	found.Set(FieldSiteName, "X", ConfidenceSite)
+	found.Set(FieldContentType, "SocialMediaPosting", ConfidenceSite)
+	found.Set(FieldCanonical, "https://x.com/"+post.Handle+"/status/"+id, ConfidenceSite)
+	found.Set(FieldPublishedAt, normalizeDate(tweetDate(resp.HTML)), ConfidenceSite)
+
+	if markup := strings.TrimSpace(resp.HTML); markup != "" {
+		found.Embed = &Embed{Type: "rich", HTML: markup, Width: int(resp.Width), AuthorName: post.Author, ProviderName: "X"}
+	}
+	found.Site = &SiteExtras{Site: "x", Post: post}
+	return found, nil
+}
+
+// parseTweetHTML reads the post text, language and handle from the oEmbed
+// blockquote
+func parseTweetHTML(markup string) *SocialPost {
+	post := &SocialPost{}
+	doc, err := html.Parse(strings.NewReader(markup))
+	if err != nil {
+		return post
+	}
+
+	if p := findElement(doc, "p"); p != nil {
+		post.Text = strings.Join(strings.Fields(innerText(p)), " ")
+		for _, attr := range p.Attr {
+			if attr.Key == "lang" {
+				post.Language = attr.Val
+			}
+		}
+	}
+	if quote := findElement(doc, "blockquote"); quote != nil {
+		if m := tweetHandleRegex.FindStringSubmatch(innerText(quote)); m != nil {
+			post.Handle = m[1]
+		}
+	}
+	return post
+}
+
+// tweetDate returns the date text of the permalink that ends the blockquote
+func tweetDate(markup string) string {
+	doc, err := html.Parse(strings.NewReader(markup))
+	if err != nil {
+		return ""
+	}
+	quote := findElement(doc, "blockquote")
+	if quote == nil {
+		return ""
+	}
+
+	var last *html.Node
+	var traverse func(*html.Node)
+	traverse = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "a" {
+			last = n
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			traverse(c)
+		}
+	}
+	traverse(quote)
+	if last == nil {
+		return ""
+	}
+	return strings.TrimSpace(innerText(last))
+}
+
+// --- GitHub ---
+
+// githubReservedPaths are top-level paths that are not user or org names
+var githubReservedPaths = map[string]bool{
+	"about": true, "apps": true, "collections": true, "enterprise": true, "explore": true,
+	"features": true, "issues": true, "login": true, "marketplace": true, "new": true,
+	"notifications": true, "orgs": true, "pricing": true, "pulls": true, "search": true,
+	"settings": true, "sponsors": true, "topics": true, "trending": true,
+}
+
+// githubRepo is the subset of the GitHub REST repository object we use
+type githubRepo struct {
+	FullName        string   `json:"full_name"`
+	Name            string   `json:"name"`
+	Description     string   `json:"description"`
+	HTMLURL         string   `json:"html_url"`
+	Homepage        string   `json:"homepage"`
+	Language        string   `json:"language"`
+	Topics          []string `json:"topics"`
+	StargazersCount int      `json:"stargazers_count"`
+	ForksCount      int      `json:"forks_count"`
+	OpenIssuesCount int      `json:"open_issues_count"`
+	PushedAt        string   `json:"pushed_at"`
+	Archived        bool     `json:"archived"`
+	Owner           struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+	License *struct {
+		SPDXID string `json:"spdx_id"`
+	} `json:"license"`
+}
+
+// githubExtractor reads repositories from the REST API, falling back to the
+// stars counter and language in the repository page when rate-limited
+type githubExtractor struct {
+	apiBase string
+}
+
+func (githubExtractor) Name() string { return "github" }
+
+func (e githubExtractor) Extract(ctx context.Context, page *Page, _ *Extraction) (*Extraction, error) {
+	owner, name, ok := githubRepoPath(page.URL)
+	if !ok {
+		return nil, nil
+	}
+
+	found := NewExtraction("github")
+	found.Set(FieldSiteName, "GitHub", ConfidenceSite)
+	found.Set(FieldContentType, "SoftwareSourceCode", ConfidenceSite)
+
+	var repo githubRepo
+	apiURL := fmt.Sprintf("%s/repos/%s/%s", e.apiBase, url.PathEscape(owner), url.PathEscape(name))
+	if err := fetchJSON(ctx, page.Fetcher(), apiURL, "application/vnd.github+json", &repo); err != nil {
+		info := githubRepoFromPage(page, owner, name)
+		if info.Stars == 0 && info.Language == "" {
+			return nil, fmt.Errorf("github api: %w", err)
+		}
+		found.Set(FieldTitle, owner+"/"+name, ConfidenceHigh)
+		found.Set(FieldAuthor, owner, ConfidenceSite)
+		found.Set(FieldKeywords, strings.Join(info.Topics, ","), ConfidenceSite)
+		found.Site = &SiteExtras{Site: "github", Repository: info}
+		return found, nil
+	}
+
+	info := &Repository{
+		Owner:      repo.Owner.Login,
+		Name:       repo.Name,
+		Stars:      repo.StargazersCount,
+		Forks:      repo.ForksCount,
+		OpenIssues: repo.OpenIssuesCount,
+		Language:   repo.Language,
+		Topics:     repo.Topics,
+		Homepage:   repo.Homepage,
+		PushedAt:   repo.PushedAt,
+		Archived:   repo.Archived,
+	}
+	if repo.License != nil && repo.License.SPDXID != "NOASSERTION" {
+		info.License = repo.License.SPDXID
+	}
+
+	found.Set(FieldTitle, repo.FullName, ConfidenceSite)
+	found.Set(FieldDescription, repo.Description, ConfidenceSite)
+	found.Set(FieldAuthor, repo.Owner.Login, ConfidenceSite)
+	found.Set(FieldKeywords, strings.Join(repo.Topics, ","), ConfidenceSite)
+	found.Set(FieldCanonical, repo.HTMLURL, ConfidenceSite)
+	found.Site = &SiteExtras{Site: "github", Repository: info}
+	return found, nil
+}
+
+// githubRepoPath returns the owner and repository of a repository URL or any
+// page inside one
+func githubRepoPath(u *url.URL) (string, string, bool) {
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(segments) < 2 || segments[0] == "" || segments[1] == "" || githubReservedPaths[strings.ToLower(segments[0])] {
+		return "", "", false
+	}
+	return segments[0], strings.TrimSuffix(segments[1], ".git"), true
+}
+
+// githubRepoFromPage scrapes the repository page's star counter, language and
+// topic links
+func githubRepoFromPage(page *Page, owner, name string) *Repository {
+	info := &Repository{Owner: owner, Name: name}
+	doc, err := page.Document()
+	if err != nil {
+		return info
+	}
+
+	var traverse func(*html.Node)
+	traverse = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			var id, title, itemprop, class string
+			for _, attr := range n.Attr {
+				switch attr.Key {
+				case "id":
+					id = attr.Val
+				case "title":
+					title = attr.Val
+				case "itemprop":
+					itemprop = attr.Val
+				case "class":
+					class = attr.Val
+				}
+			}
+			switch {
+			case id == "repo-stars-counter-star":
+				info.Stars = parseCount(title)
+			case id == "repo-network-counter":
+				info.Forks = parseCount(title)
+			case itemprop == "programmingLanguage" && info.Language == "":
+				info.Language = strings.TrimSpace(innerText(n))
+			case n.Data == "a" && strings.Contains(class, "topic-tag"):
+				if topic := strings.TrimSpace(innerText(n)); topic != "" {
+					info.Topics = append(info.Topics, topic)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			traverse(c)
+		}
+	}
+	traverse(doc)
+	return info
+}
+
+// parseCount parses counters such as "12,345"
+func parseCount(value string) int {
+	n, _ := strconv.Atoi(strings.ReplaceAll(strings.TrimSpace(value), ",", ""))
+	return n
+}
+
+// --- Reddit ---
+
+// redditPathRegex matches /r/{sub}/comments/{id} and /comments/{id}
+var redditPathRegex = regexp.MustCompile(`^(?:/r/[^/]+)?/comments/([a-z0-9]+)`)
+
+// redditListing is the post listing returned by Reddit's .json endpoints
+type redditListing struct {
+	Data struct {
+		Children []struct {
+			Data redditPost `json:"data"`
+		} `json:"children"`
+	} `json:"data"`
+}
+
+type redditPost struct {
+	ID          string  `json:"id"`
+	Title       string  `json:"title"`
+	Selftext    string  `json:"selftext"`
+	Author      string  `json:"author"`
+	Subreddit   string  `json:"subreddit"`
+	Score       int     `json:"score"`
+	NumComments int     `json:"num_comments"`
+	CreatedUTC  float64 `json:"created_utc"`
+	URL         string  `json:"url"`
+	Permalink   string  `json:"permalink"`
+	IsSelf      bool    `json:"is_self"`
+	Over18      bool    `json:"over_18"`
+	Spoiler     bool    `json:"spoiler"`
+	Preview     *struct {
+		Images []struct {
+			Source struct {
+				URL    string `json:"url"`
+				Width  int    `json:"width"`
+				Height int    `json:"height"`
+			} `json:"source"`
+		} `json:"images"`
+	} `json:"preview"`
+}
+
+// redditExtractor reads posts from the public .json representation
+type redditExtractor struct {
+	apiBase string
+}
+
+func (redditExtractor) Name() string { return "reddit" }
+
+func (e redditExtractor) Extract(ctx context.Context, page *Page, _ *Extraction) (*Extraction, error) {
+	m := redditPathRegex.FindStringSubmatch(page.URL.Path)
+	if m == nil {
+		return nil, nil
+	}
+
+	// The first listing holds the post, the second its comments
+	var listings []redditListing
+	if err := fetchJSON(ctx, page.Fetcher(), e.apiBase+"/comments/"+m[1]+".json?raw_json=1&limit=1", "application/json", &listings); err != nil {
+		return nil, err
+	}
+	if len(listings) == 0 || len(listings[0].Data.Children) == 0 {
+		return nil, fmt.Errorf("reddit: post %s not found", m[1])
+	}
+	post := listings[0].Data.Children[0].Data
+
+	found := NewExtraction("reddit")
+	found.Set(FieldTitle, post.Title, ConfidenceSite)
+	found.Set(FieldDescription, excerpt(strings.Join(strings.Fields(post.Selftext), " "), maxExcerptRunes), ConfidenceSite)
+	if post.Author != "" && post.Author != "[deleted]" {
+		found.Set(FieldAuthor, "u/"+post.Author, ConfidenceSite)
+	}
+	if post.CreatedUTC > 0 {
+		found.Set(FieldPublishedAt, time.Unix(int64(post.CreatedUTC), 0).UTC().Format(time.RFC3339), ConfidenceSite)
+	}
+	found.Set(FieldSiteName, "Reddit", ConfidenceSite)
+	found.Set(FieldContentType, "DiscussionForumPosting", ConfidenceSite)
+	if post.Permalink != "" {
+		found.Set(FieldCanonical, "https://www.reddit.com"+post.Permalink, ConfidenceSite)
+	}
+
+	// No previews of NSFW or spoiler posts as covers
+	if post.Preview != nil && len(post.Preview.Images) > 0 && !post.Over18 && !post.Spoiler {
+		source := post.Preview.Images[0].Source
+		found.Set(FieldImage, source.URL, ConfidenceHigh)
+		found.Images = append(found.Images, ImageCandidate{URL: source.URL, Source: ImageSourceSite, Width: source.Width, Height: source.Height})
+	}
+
+	info := &SocialPost{
+		ID:        post.ID,
+		Author:    post.Author,
+		Community: "r/" + post.Subreddit,
+		Text:      post.Selftext,
+		Score:     post.Score,
+		Comments:  post.NumComments,
+		NSFW:      post.Over18,
+	}
+	if !post.IsSelf {
+		info.LinkURL = post.URL
+	}
+	found.Site = &SiteExtras{Site: "reddit", Post: info}
+	return found, nil
+}
+
+// --- Spotify ---
+
+// spotifyPathRegex matches /{kind}/{id}, optionally after an /intl-xx prefix
+var spotifyPathRegex = regexp.MustCompile(`^(?:/intl-[a-z-]+)?/(track|album|playlist|episode|show|artist)/([A-Za-z0-9]{22})`)
+
+// spotifyContentTypes maps Spotify kinds to schema.org types
+var spotifyContentTypes = map[string]string{
+	"track":    "MusicRecording",
+	"album":    "MusicAlbum",
+	"playlist": "MusicPlaylist",
+	"episode":  "PodcastEpisode",
+	"show":     "PodcastSeries",
+	"artist":   "MusicGroup",
+}
+
+// spotifyExtractor reads items through oEmbed and the page's music: tags
+type spotifyExtractor struct {
+	oembedEndpoint string
+}
+
+func (spotifyExtractor) Name() string { return "spotify" }
+
+func (e spotifyExtractor) Extract(ctx context.Context, page *Page, _ *Extraction) (*Extraction, error) {
+	m := spotifyPathRegex.FindStringSubmatch(page.URL.Path)
+	if m == nil {
+		return nil, nil
+	}
+	kind, id := m[1], m[2]
+	itemURL := "https://open.spotify.com/" + kind + "/" + id
+
+	found := NewExtraction("spotify")
+	item := &SpotifyItem{Kind: kind, ID: id}
+
+	embed := &Embed{
+		Type:         "rich",
+		HTML:         fmt.Sprintf(`<iframe src="https://open.spotify.com/embed/%s/%s" width="100%%" height="352" frameborder="0" allow="encrypted-media"></iframe>`, kind, id),
+		Height:       352,
+		ProviderName: "Spotify",
+	}
+	if resp, err := fetchOEmbed(ctx, page.Fetcher(), e.oembedEndpoint, itemURL); err == nil {
+		found.Set(FieldTitle, resp.Title, ConfidenceSite)
+		found.Set(FieldImage, resp.ThumbnailURL, ConfidenceHigh)
+		found.addImage(resp.ThumbnailURL, ImageSourceSite)
+		if markup := strings.TrimSpace(resp.HTML); markup != "" {
+			embed.HTML = markup
+			embed.Width, embed.Height = int(resp.Width), int(resp.Height)
+		}
+	}
+
+	meta := pageMeta(page)
+	item.Artist = firstMeta(meta, "music:musician_description")
+	item.ReleaseDate = normalizeDate(firstMeta(meta, "music:release_date"))
+	item.DurationSeconds, _ = strconv.Atoi(firstMeta(meta, "music:duration"))
+
+	found.Set(FieldTitle, firstMeta(meta, "og:title"), ConfidenceHigh)
+	found.Set(FieldAuthor, item.Artist, ConfidenceSite)
+	found.Set(FieldPublishedAt, item.ReleaseDate, ConfidenceSite)
+	found.Set(FieldSiteName, "Spotify", ConfidenceSite)
+	found.Set(FieldContentType, spotifyContentTypes[kind], ConfidenceSite)
+	found.Set(FieldCanonical, itemURL, ConfidenceSite)
+
+	if kind == "track" || kind == "episode" {
+		found.Media = &MediaInfo{
+			Kind:            MediaKindAudio,
+			DurationSeconds: item.DurationSeconds,
+			PlayerURL:       "https://open.spotify.com/embed/" + kind + "/" + id,
+			UploadDate:      item.ReleaseDate,
+			Channel:         item.Artist,
+		}
+	}
+	found.Embed = embed
+	found.Site = &SiteExtras{Site: "spotify", Audio: item}
+	return found, nil
+}
+
+// --- arXiv ---
+
+// arxivPathRegex matches /abs/{id}, /pdf/{id} and /html/{id} for new
+// (2401.01234v2) and old (hep-th/9901001) identifiers
+var arxivPathRegex = regexp.MustCompile(`^/(?:abs|pdf|html)/((?:[a-z-]+(?:\.[A-Z]{2})?/\d{7}|\d{4}\.\d{4,5})(?:v\d+)?)`)
+
+// arxivFeed is the Atom feed returned by the arXiv API
+type arxivFeed struct {
+	Entries []arxivEntry `xml:"entry"`
+}
+
+type arxivEntry struct {
+	ID        string `xml:"id"`
+	Title     string `xml:"title"`
+	Summary   string `xml:"summary"`
+	Published string `xml:"published"`
+	Updated   string `xml:"updated"`
+	Authors   []struct {
+		Name string `xml:"name"`
+	} `xml:"author"`
+	Links []struct {
+		Href  string `xml:"href,attr"`
+		Title string `xml:"title,attr"`
+	} `xml:"link"`
+	PrimaryCategory struct {
+		Term string `xml:"term,attr"`
+	} `xml:"http://arxiv.org/schemas/atom primary_category"`
+	Categories []struct {
+		Term string `xml:"term,attr"`
+	} `xml:"category"`
+	DOI string `xml:"http://arxiv.org/schemas/atom doi"`
+}
+
+// maxListedAuthors caps the author field; the full list is in Paper.Authors
+const maxListedAuthors = 10
+
+// arxivExtractor reads papers from the arXiv Atom API, falling back to the
+// citation_* tags of the abs page
+type arxivExtractor struct {
+	apiBase string
+}
+
+func (arxivExtractor) Name() string { return "arxiv" }
+
+func (e arxivExtractor) Extract(ctx context.Context, page *Page, _ *Extraction) (*Extraction, error) {
+	m := arxivPathRegex.FindStringSubmatch(page.URL.Path)
+	if m == nil {
+		return nil, nil
+	}
+	id := m[1]
+
+	found := NewExtraction("arxiv")
+	paper := &Paper{ArxivID: id, PDFURL: "https://arxiv.org/pdf/" + id}
+
+	if entry, err := e.fetchEntry(ctx, page.Fetcher(), id); err == nil {
+		found.Set(FieldTitle, collapseSpace(entry.Title), ConfidenceSite)
+		found.Set(FieldDescription, collapseSpace(entry.Summary), ConfidenceSite)
+		found.Set(FieldPublishedAt, normalizeDate(entry.Published), ConfidenceSite)
+		for _, a := range entry.Authors {
+			paper.Authors = append(paper.Authors, collapseSpace(a.Name))
+		}
+		for _, c := range entry.Categories {
+			paper.Categories = append(paper.Categories, c.Term)
+		}
+		for _, l := range entry.Links {
+			if l.Title == "pdf" && l.Href != "" {
+				paper.PDFURL = l.Href
+			}
+		}
+		paper.PrimaryCategory = entry.PrimaryCategory.Term
+		paper.DOI = entry.DOI
+		paper.UpdatedAt = normalizeDate(entry.Updated)
+	} else {
+		// The abs page carries Highwire Press citation tags
+		meta := pageMeta(page)
+		found.Set(FieldTitle, firstMeta(meta, "citation_title"), ConfidenceSite)
+		found.Set(FieldDescription, firstMeta(meta, "citation_abstract"), ConfidenceSite)
+		found.Set(FieldPublishedAt, normalizeDate(strings.ReplaceAll(firstMeta(meta, "citation_date", "citation_online_date"), "/", "-")), ConfidenceSite)
+		paper.Authors = meta["citation_author"]
+		if pdf := firstMeta(meta, "citation_pdf_url"); pdf != "" {
+			paper.PDFURL = pdf
+		}
+		paper.DOI = firstMeta(meta, "citation_doi")
+		if !found.Has(FieldTitle) {
+			return nil, fmt.Errorf("arxiv api: %w", err)
+		}
+	}
+
+	authors := paper.Authors
+	if len(authors) > maxListedAuthors {
+		authors = append(authors[:maxListedAuthors:maxListedAuthors], "et al.")
+	}
+	found.Set(FieldAuthor, strings.Join(authors, ", "), ConfidenceSite)
+	found.Set(FieldSiteName, "arXiv", ConfidenceSite)
+	found.Set(FieldContentType, "ScholarlyArticle", ConfidenceSite)
+	found.Set(FieldKeywords, strings.Join(paper.Categories, ","), ConfidenceSite)
+	found.Set(FieldCanonical, "https://arxiv.org/abs/"+id, ConfidenceSite)
+
+	found.Site = &SiteExtras{Site: "arxiv", Paper: paper}
+	return found, nil
+}
+
+// fetchEntry queries the arXiv API for one paper
+func (e arxivExtractor) fetchEntry(ctx context.Context, fetcher *Fetcher, id string) (*arxivEntry, error) {
+	body, _, err := fetcher.Resource(ctx, e.apiBase+"?id_list="+url.QueryEscape(id), "application/atom+xml", maxSiteAPIBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	var feed arxivFeed
+	if err := xml.Unmarshal(body, &feed); err != nil {
+		return nil, err
+	}
+	// Unknown IDs come back as an entry pointing at the API's error page
+	if len(feed.Entries) == 0 || strings.Contains(feed.Entries[0].ID, "/api/errors") {
+		return nil, fmt.Errorf("arxiv: paper %s not found", id)
+	}
+	return &feed.Entries[0], nil
+}
+
+// collapseSpace joins the words of s with single spaces
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,372 @@
+// Package handler tests for site-specific extractors
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// readSiteFixture loads a file from testdata/sites
+func readSiteFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("testdata", "sites", name))
+	if err != nil {
+		t.Fatalf("Failed to read fixture %s: %v", name, err)
+	}
+	return body
+}
+
+// newSiteAPIServer stands in for a site's API, serving fixtures by path. A
+// fixture name of "" answers 404, as a rate-limited or missing API would.
+func newSiteAPIServer(t *testing.T, routes map[string]string) (*httptest.Server, *[]string) {
+	t.Helper()
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.String())
+		name, ok := routes[r.URL.Path]
+		if !ok || name == "" {
+			http.NotFound(w, r)
+			return
+		}
+		switch filepath.Ext(name) {
+		case ".json":
+			w.Header().Set("Content-Type", "application/json")
+		case ".atom":
+			w.Header().Set("Content-Type", "application/atom+xml")
+		}
+		w.Write(readSiteFixture(t, name))
+	}))
+	t.Cleanup(server.Close)
+	allowLoopbackForTest(t)
+	return server, &requests
+}
+
+// runSiteExtractor runs a site extractor and the DOM extractor over a fixture page
+func runSiteExtractor(t *testing.T, e Extractor, hosts []string, pageURL, pageFixture string) *URLMetadata {
+	t.Helper()
+	page := testPage(t, pageURL, string(readSiteFixture(t, pageFixture)))
+	metadata, err := NewPipeline(SiteExtractor{Hosts: hosts, Extractor: e}, domExtractor{}).Run(context.Background(), page)
+	if err != nil {
+		t.Fatalf("Pipeline failed: %v", err)
+	}
+	if metadata.Site == nil {
+		t.Fatal("Expected site extras")
+	}
+	return metadata
+}
+
+func TestYouTubeExtractor(t *testing.T) {
+	server, requests := newSiteAPIServer(t, map[string]string{"/oembed": "youtube_oembed.json"})
+
+	metadata := runSiteExtractor(t, youtubeExtractor{oembedEndpoint: server.URL + "/oembed"}, []string{"youtube.com", "youtu.be"},
+		"https://youtu.be/dQw4w9WgXcQ?si=share", "youtube_watch.html")
+
+	if metadata.Title != "Rick Astley - Never Gonna Give You Up (Official Music Video)" {
+		t.Errorf("Unexpected title %q", metadata.Title)
+	}
+	if metadata.Author != "Rick Astley" || metadata.SiteName != "YouTube" || metadata.ContentType != "VideoObject" {
+		t.Errorf("Unexpected attribution: %q %q %q", metadata.Author, metadata.SiteName, metadata.ContentType)
+	}
+	if metadata.PublishedAt != "2009-10-24T23:57:33-07:00" {
+		t.Errorf("Unexpected publish date %q", metadata.PublishedAt)
+	}
+	if m := metadata.Media; m == nil || m.Kind != MediaKindVideo || m.DurationSeconds != 213 || m.Channel != "Rick Astley" {
+		t.Errorf("Unexpected media %+v", m)
+	}
+	if metadata.CanonicalURL != "https://www.youtube.com/watch?v=dQw4w9WgXcQ" {
+		t.Errorf("Unexpected canonical URL %q", metadata.CanonicalURL)
+	}
+
+	video := metadata.Site.Video
+	want := &YouTubeVideo{ID: "dQw4w9WgXcQ", Channel: "Rick Astley", ChannelURL: "https://www.youtube.com/@RickAstleyYT", DurationSeconds: 213}
+	if !reflect.DeepEqual(video, want) {
+		t.Errorf("Expected %+v, got %+v", want, video)
+	}
+	if metadata.Embed == nil || !strings.Contains(metadata.Embed.HTML, "youtube-nocookie.com/embed/dQw4w9WgXcQ") {
+		t.Errorf("Expected a nocookie embed, got %+v", metadata.Embed)
+	}
+
+	// oEmbed is asked about the canonical watch URL, not the share link
+	if len(*requests) != 1 || !strings.Contains((*requests)[0], url.QueryEscape("https://www.youtube.com/watch?v=dQw4w9WgXcQ")) {
+		t.Errorf("Unexpected oEmbed requests %v", *requests)
+	}
+}
+
+func TestYouTubeVideoID(t *testing.T) {
+	testCases := []struct {
+		input string
+		id    string
+		short bool
+	}{
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=42", "dQw4w9WgXcQ", false},
+		{"https://youtu.be/dQw4w9WgXcQ", "dQw4w9WgXcQ", false},
+		{"https://www.youtube.com/shorts/abcdefghijk", "abcdefghijk", true},
+		{"https://www.youtube.com/live/abcdefghijk", "abcdefghijk", false},
+		{"https://www.youtube.com/@RickAstleyYT", "", false},
+		{"https://www.youtube.com/watch?v=short", "", false},
+	}
+
+	for _, tc := range testCases {
+		u, _ := url.Parse(tc.input)
+		if id, short := youtubeVideoID(u); id != tc.id || short != tc.short {
+			t.Errorf("For %s: expected %q/%v, got %q/%v", tc.input, tc.id, tc.short, id, short)
+		}
+	}
+}
+
+func TestTwitterExtractor(t *testing.T) {
+	server, _ := newSiteAPIServer(t, map[string]string{"/oembed": "twitter_oembed.json"})
+
+	metadata := runSiteExtractor(t, twitterExtractor{oembedEndpoint: server.URL + "/oembed"}, []string{"twitter.com", "x.com"},
+		"https://x.com/golang/status/1234567890123456789", "twitter_status.html")
+
+	post := metadata.Site.Post
+	if post.ID != "1234567890123456789" || post.Handle != "golang" || post.Author != "Go" || post.Language != "en" {
+		t.Errorf("Unexpected post %+v", post)
+	}
+	if !strings.HasPrefix(post.Text, "Go 1.22 is released!") {
+		t.Errorf("Unexpected text %q", post.Text)
+	}
+	if !strings.HasPrefix(metadata.Title, `Go on X: "Go 1.22 is released!`) {
+		t.Errorf("Unexpected title %q", metadata.Title)
+	}
+	if metadata.PublishedAt != "2024-02-06" {
+		t.Errorf("Unexpected publish date %q", metadata.PublishedAt)
+	}
+	if metadata.Embed == nil || metadata.Embed.Type != "rich" {
+		t.Errorf("Expected a rich embed, got %+v", metadata.Embed)
+	}
+}
+
+func TestGitHubExtractor(t *testing.T) {
+	server, _ := newSiteAPIServer(t, map[string]string{"/repos/golang/go": "github_repo.json"})
+
+	metadata := runSiteExtractor(t, githubExtractor{apiBase: server.URL}, []string{"github.com"},
+		"https://github.com/golang/go/tree/master/src", "github_repo.html")
+
+	if metadata.Title != "golang/go" || metadata.Description != "The Go programming language" {
+		t.Errorf("Unexpected title/description %q / %q", metadata.Title, metadata.Description)
+	}
+	repo := metadata.Site.Repository
+	if repo.Stars != 125000 || repo.Forks != 17600 || repo.Language != "Go" || repo.License != "BSD-3-Clause" {
+		t.Errorf("Unexpected repository %+v", repo)
+	}
+	if !reflect.DeepEqual(metadata.Keywords, []string{"go", "golang", "language", "programming-language"}) {
+		t.Errorf("Expected topics as keywords, got %v", metadata.Keywords)
+	}
+	// The repository card from the page is still the cover
+	if metadata.OgImage != "https://opengraph.githubassets.com/abc/golang/go" {
+		t.Errorf("Unexpected image %q", metadata.OgImage)
+	}
+}
+
+func TestGitHubExtractor_PageFallback(t *testing.T) {
+	// The API is rate-limited (here: 404s); stars come from the page instead
+	server, _ := newSiteAPIServer(t, map[string]string{})
+
+	metadata := runSiteExtractor(t, githubExtractor{apiBase: server.URL}, []string{"github.com"},
+		"https://github.com/golang/go", "github_repo.html")
+
+	repo := metadata.Site.Repository
+	want := &Repository{Owner: "golang", Name: "go", Stars: 125000, Forks: 17600, Language: "Go", Topics: []string{"go", "language"}}
+	if !reflect.DeepEqual(repo, want) {
+		t.Errorf("Expected %+v, got %+v", want, repo)
+	}
+}
+
+func TestGitHubRepoPath(t *testing.T) {
+	testCases := []struct {
+		input       string
+		owner, name string
+	}{
+		{"https://github.com/golang/go", "golang", "go"},
+		{"https://github.com/golang/go.git", "golang", "go"},
+		{"https://github.com/golang/go/issues/1", "golang", "go"},
+		{"https://github.com/golang", "", ""},
+		{"https://github.com/topics/go", "", ""},
+	}
+
+	for _, tc := range testCases {
+		u, _ := url.Parse(tc.input)
+		if owner, name, _ := githubRepoPath(u); owner != tc.owner || name != tc.name {
+			t.Errorf("For %s: expected %s/%s, got %s/%s", tc.input, tc.owner, tc.name, owner, name)
+		}
+	}
+}
+
+func TestRedditExtractor(t *testing.T) {
+	server, requests := newSiteAPIServer(t, map[string]string{"/comments/1b7xyz.json": "reddit_post.json"})
+
+	page := testPage(t, "https://old.reddit.com/r/golang/comments/1b7xyz/what_is_your_favourite_go_proverb/", "<html><head></head><body></body></html>")
+	found, err := redditExtractor{apiBase: server.URL}.Extract(context.Background(), page, NewExtraction(""))
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+	metadata := buildMetadata(found, page.URL)
+
+	if metadata.Title != "What is your favourite Go proverb?" || metadata.Author != "u/gopher42" {
+		t.Errorf("Unexpected title/author %q / %q", metadata.Title, metadata.Author)
+	}
+	if metadata.PublishedAt != "2024-03-05T15:00:00Z" {
+		t.Errorf("Unexpected publish date %q", metadata.PublishedAt)
+	}
+	if metadata.CanonicalURL != "https://www.reddit.com/r/golang/comments/1b7xyz/what_is_your_favourite_go_proverb" {
+		t.Errorf("Unexpected canonical URL %q", metadata.CanonicalURL)
+	}
+	if metadata.OgImage != "https://preview.redd.it/gopher.png?width=1200&format=png&s=abc" {
+		t.Errorf("Unexpected image %q", metadata.OgImage)
+	}
+
+	post := metadata.Site.Post
+	if post.Community != "r/golang" || post.Score != 321 || post.Comments != 87 || post.LinkURL != "" {
+		t.Errorf("Unexpected post %+v", post)
+	}
+	if len(*requests) != 1 || !strings.Contains((*requests)[0], "raw_json=1") {
+		t.Errorf("Unexpected API requests %v", *requests)
+	}
+}
+
+func TestFetcher_SiteAPIsWithoutThePage(t *testing.T) {
+	redditPost := string(readSiteFixture(t, "reddit_post.json"))
+	tweet := string(readSiteFixture(t, "twitter_oembed.json"))
+	var pageRequests, redditRequests []string
+	fetcher := NewFetcher(FetcherConfig{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		switch req.URL.Host + req.URL.Path {
+		case "www.reddit.com/robots.txt":
+			return cannedResponse(req, http.StatusOK, "text/plain", "User-agent: *\nDisallow: /\n"), nil
+		case "www.reddit.com/comments/1b7xyz.json":
+			redditRequests = append(redditRequests, req.URL.String())
+			return cannedResponse(req, http.StatusOK, "application/json", redditPost), nil
+		case "publish.twitter.com/oembed":
+			return cannedResponse(req, http.StatusOK, "application/json", tweet), nil
+		case "x.com/golang/status/1234567890123456789", "example.com/walled":
+			// A login wall
+			pageRequests = append(pageRequests, req.URL.String())
+			return cannedResponse(req, http.StatusForbidden, "text/html", "<html>Log in</html>"), nil
+		}
+		return cannedResponse(req, http.StatusNotFound, "text/plain", ""), nil
+	})})
+	ctx := context.Background()
+
+	// robots.txt covers the JSON API on the same host too
+	_, err := fetcher.Fetch(ctx, "https://www.reddit.com/r/golang/comments/1b7xyz/what_is_your_favourite_go_proverb/")
+	if status := fetchStatusOf(err); status != FetchStatusRobotsDisallowed {
+		t.Errorf("Expected %s, got %s (%v)", FetchStatusRobotsDisallowed, status, err)
+	}
+	if len(redditRequests) != 0 {
+		t.Errorf("Expected no API requests, got %v", redditRequests)
+	}
+
+	// The login wall answers 403, oEmbed on another origin does not
+	metadata, err := fetcher.Fetch(ctx, "https://x.com/golang/status/1234567890123456789")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if metadata.Site == nil || metadata.Site.Post == nil || metadata.Site.Post.Handle != "golang" || metadata.HTTPStatus != http.StatusForbidden {
+		t.Errorf("Expected the post from oEmbed, got %+v", metadata)
+	}
+	if metadata.FetchStatus != FetchStatusPartial || metadata.Format != FormatSocialPost {
+		t.Errorf("Unexpected status or format %q %q", metadata.FetchStatus, metadata.Format)
+	}
+	if len(pageRequests) != 1 {
+		t.Errorf("Expected one page request, got %v", pageRequests)
+	}
+
+	// Other sites still fail
+	if _, err := fetcher.Fetch(ctx, "https://example.com/walled"); err == nil {
+		t.Error("Expected the 403 to be reported")
+	}
+}
+
+func TestSpotifyExtractor(t *testing.T) {
+	server, _ := newSiteAPIServer(t, map[string]string{"/oembed": "spotify_oembed.json"})
+
+	metadata := runSiteExtractor(t, spotifyExtractor{oembedEndpoint: server.URL + "/oembed"}, []string{"open.spotify.com"},
+		"https://open.spotify.com/intl-de/track/4PTG3Z6ehGkBFwjybzWkR8?si=abc", "spotify_track.html")
+
+	if metadata.Title != "Never Gonna Give You Up" || metadata.Author != "Rick Astley" || metadata.ContentType != "MusicRecording" {
+		t.Errorf("Unexpected metadata %q / %q / %q", metadata.Title, metadata.Author, metadata.ContentType)
+	}
+	want := &SpotifyItem{Kind: "track", ID: "4PTG3Z6ehGkBFwjybzWkR8", Artist: "Rick Astley", DurationSeconds: 213, ReleaseDate: "1987-11-12"}
+	if !reflect.DeepEqual(metadata.Site.Audio, want) {
+		t.Errorf("Expected %+v, got %+v", want, metadata.Site.Audio)
+	}
+	if m := metadata.Media; m == nil || m.Kind != MediaKindAudio || m.DurationSeconds != 213 || m.UploadDate != "1987-11-12" {
+		t.Errorf("Unexpected media %+v", m)
+	}
+	if metadata.Embed == nil || metadata.Embed.Height != 152 {
+		t.Errorf("Expected the oEmbed player, got %+v", metadata.Embed)
+	}
+	if metadata.CanonicalURL != "https://open.spotify.com/track/4PTG3Z6ehGkBFwjybzWkR8" {
+		t.Errorf("Unexpected canonical URL %q", metadata.CanonicalURL)
+	}
+}
+
+func TestArxivExtractor(t *testing.T) {
+	server, requests := newSiteAPIServer(t, map[string]string{"/api/query": "arxiv_query.atom"})
+
+	metadata := runSiteExtractor(t, arxivExtractor{apiBase: server.URL + "/api/query"}, []string{"arxiv.org"},
+		"https://arxiv.org/abs/1706.03762", "arxiv_abs.html")
+
+	if metadata.Title != "Attention Is All You Need" {
+		t.Errorf("Unexpected title %q", metadata.Title)
+	}
+	if metadata.Author != "Ashish Vaswani, Noam Shazeer, Niki Parmar" {
+		t.Errorf("Unexpected author %q", metadata.Author)
+	}
+	if !strings.HasPrefix(metadata.Description, "The dominant sequence transduction models are based on complex recurrent or convolutional") {
+		t.Errorf("Unexpected description %q", metadata.Description)
+	}
+	if metadata.PublishedAt != "2017-06-12T17:57:34Z" {
+		t.Errorf("Unexpected publish date %q", metadata.PublishedAt)
+	}
+
+	paper := metadata.Site.Paper
+	if paper.PrimaryCategory != "cs.CL" || paper.DOI != "10.48550/arXiv.1706.03762" || paper.PDFURL != "http://arxiv.org/pdf/1706.03762v7" {
+		t.Errorf("Unexpected paper %+v", paper)
+	}
+	if !reflect.DeepEqual(paper.Categories, []string{"cs.CL", "cs.LG"}) {
+		t.Errorf("Unexpected categories %v", paper.Categories)
+	}
+	if len(*requests) != 1 || !strings.Contains((*requests)[0], "id_list=1706.03762") {
+		t.Errorf("Unexpected API requests %v", *requests)
+	}
+}
+
+func TestArxivExtractor_PageFallback(t *testing.T) {
+	server, _ := newSiteAPIServer(t, map[string]string{})
+
+	metadata := runSiteExtractor(t, arxivExtractor{apiBase: server.URL + "/api/query"}, []string{"arxiv.org"},
+		"https://arxiv.org/abs/1706.03762", "arxiv_abs.html")
+
+	if metadata.Author != "Vaswani, Ashish, Shazeer, Noam, Parmar, Niki" {
+		t.Errorf("Unexpected author %q", metadata.Author)
+	}
+	if metadata.PublishedAt != "2017-06-12" {
+		t.Errorf("Unexpected publish date %q", metadata.PublishedAt)
+	}
+	if metadata.Site.Paper.PDFURL != "http://arxiv.org/pdf/1706.03762" {
+		t.Errorf("Unexpected PDF URL %q", metadata.Site.Paper.PDFURL)
+	}
+}
+
+func TestSiteExtractors_Registered(t *testing.T) {
+	for _, host := range []string{"www.youtube.com", "youtu.be", "x.com", "twitter.com", "github.com", "www.reddit.com", "open.spotify.com", "arxiv.org"} {
+		matched := false
+		for _, e := range siteExtractors {
+			if hostMatches(host, e.(SiteExtractor).Hosts) {
+				matched = true
+			}
+		}
+		if !matched {
+			t.Errorf("No site extractor registered for %s", host)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+// SSRF protection for outbound metadata fetches
+// Host names are checked when the URL is validated, but the authoritative check
+// happens at dial time against the address the name actually resolved to, so
+// DNS tricks and redirects to internal hosts are caught on every hop.
+
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ErrBlockedAddress is returned when a URL points at (or resolves to) an address
+// in a reserved or private range
+var ErrBlockedAddress = errors.New("destination address is not allowed")
+
+// reservedPrefixes lists address ranges that must never be fetched
+var reservedPrefixes = []netip.Prefix{
+	// IPv4
+	netip.MustParsePrefix("0.0.0.0/8"),          // "this" network
+	netip.MustParsePrefix("10.0.0.0/8"),         // RFC1918
+	netip.MustParsePrefix("100.64.0.0/10"),      // CGNAT shared address space
+	netip.MustParsePrefix("127.0.0.0/8"),        // loopback
+	netip.MustParsePrefix("169.254.0.0/16"),     // link-local, cloud metadata
+	netip.MustParsePrefix("172.16.0.0/12"),      // RFC1918
+	netip.MustParsePrefix("192.0.0.0/24"),       // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),       // TEST-NET-1
+	netip.MustParsePrefix("192.88.99.0/24"),     // 6to4 relay anycast
+	netip.MustParsePrefix("192.168.0.0/16"),     // RFC1918
+	netip.MustParsePrefix("198.18.0.0/15"),      // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"),    // TEST-NET-2
+	netip.MustParsePrefix("203.0.113.0/24"),     // TEST-NET-3
+	netip.MustParsePrefix("224.0.0.0/4"),        // multicast
+	netip.MustParsePrefix("240.0.0.0/4"),        // reserved, includes broadcast
+	netip.MustParsePrefix("255.255.255.255/32"), // limited broadcast
+
+	// IPv6
+	netip.MustParsePrefix("::/128"),         // unspecified
+	netip.MustParsePrefix("::1/128"),        // loopback
+	netip.MustParsePrefix("64:ff9b:1::/48"), // local-use NAT64
+	netip.MustParsePrefix("100::/64"),       // discard-only
+	netip.MustParsePrefix("2001::/23"),      // IETF protocol assignments, Teredo
+	netip.MustParsePrefix("2001:db8::/32"),  // documentation
+	netip.MustParsePrefix("fc00::/7"),       // unique local
+	netip.MustParsePrefix("fe80::/10"),      // link-local
+	netip.MustParsePrefix("fec0::/10"),      // deprecated site-local
+	netip.MustParsePrefix("ff00::/8"),       // multicast
+}
+
+// Prefixes whose addresses embed an IPv4 address in the low 32 bits
+var (
+	nat64Prefix = netip.MustParsePrefix("64:ff9b::/96")
+	sixToFour   = netip.MustParsePrefix("2002::/16")
+)
+
+// allowedPrefixes are ranges explicitly exempted from the reserved table,
+// e.g. an internal egress proxy. Empty by default. Atomic because dials from
+// pooled connections may still be in flight when it changes.
+var allowedPrefixes atomic.Pointer[[]netip.Prefix]
+
+// isBlockedIP reports whether addr falls in a reserved range
+func isBlockedIP(addr netip.Addr) bool {
+	addr = addr.Unmap().WithZone("")
+
+	if allowed := allowedPrefixes.Load(); allowed != nil {
+		for _, p := range *allowed {
+			if p.Contains(addr) {
+				return false
+			}
+		}
+	}
+
+	// Check the IPv4 address embedded in NAT64 and 6to4 addresses
+	if addr.Is6() {
+		raw := addr.As16()
+		if nat64Prefix.Contains(addr) {
+			return isBlockedIP(netip.AddrFrom4([4]byte{raw[12], raw[13], raw[14], raw[15]}))
+		}
+		if sixToFour.Contains(addr) {
+			return isBlockedIP(netip.AddrFrom4([4]byte{raw[2], raw[3], raw[4], raw[5]}))
+		}
+	}
+
+	for _, p := range reservedPrefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHostIP parses an IP literal host, including bracketed IPv6 and the
+// legacy IPv4 forms accepted by inet_aton (2130706433, 0x7f.1, 0177.0.0.1)
+func parseHostIP(host string) (netip.Addr, bool) {
+	host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return addr, true
+	}
+
+	return parseLegacyIPv4(host)
+}
+
+// parseLegacyIPv4 parses 1-4 dot-separated parts in decimal, octal or hex,
+// where the last part fills the remaining bytes
+func parseLegacyIPv4(host string) (netip.Addr, bool) {
+	parts := strings.Split(host, ".")
+	if len(parts) == 0 || len(parts) > 4 {
+		return netip.Addr{}, false
+	}
+
+	values := make([]uint64, len(parts))
+	for i, part := range parts {
+		if part == "" {
+			return netip.Addr{}, false
+		}
+		// Base 0 handles the 0x and leading-zero octal prefixes
+		v, err := strconv.ParseUint(part, 0, 32)
+		if err != nil {
+			return netip.Addr{}, false
+		}
+		values[i] = v
+	}
+
+	// Every part but the last is a single byte
+	var ip uint64
+	for i := 0; i < len(values)-1; i++ {
+		if values[i] > 0xff {
+			return netip.Addr{}, false
+		}
+		ip |= values[i] << (24 - 8*uint(i))
+	}
+	last := values[len(values)-1]
+	if last >= 1<<(8*uint(5-len(values))) {
+		return netip.Addr{}, false
+	}
+	ip |= last
+
+	return netip.AddrFrom4([4]byte{byte(ip >> 24), byte(ip >> 16), byte(ip >> 8), byte(ip)}), true
+}
+
+// ssrfDialControl rejects connections to reserved addresses. It runs after
+// name resolution, once per connection attempt.
+func ssrfDialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, address)
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil || isBlockedIP(addr) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+	}
+	return nil
+}
+
+// newSafeTransport creates a transport whose dialer refuses reserved
+// addresses. With a proxy the dialer only ever sees the proxy, so each
+// request's host is resolved and checked before it is sent instead.
+func newSafeTransport(connectTimeout time.Duration, proxy func(*http.Request) (*url.URL, error)) http.RoundTripper {
+	dialer := &net.Dialer{
+		Timeout:   connectTimeout,
+		KeepAlive: 30 * time.Second,
+		Control:   ssrfDialControl,
+	}
+	if proxy != nil {
+		dialer.Control = nil
+	}
+
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   connectTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	if proxy != nil {
+		return &resolvedHostTransport{next: transport, resolver: net.DefaultResolver}
+	}
+	return transport
+}
+
+// resolvedHostTransport resolves the target host before each request and
+// refuses reserved addresses, for proxied requests the dialer cannot check
+type resolvedHostTransport struct {
+	next     http.RoundTripper
+	resolver *net.Resolver
+}
+
+func (t *resolvedHostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Hostname()
+	if addr, ok := parseHostIP(host); ok {
+		if isBlockedIP(addr) {
+			return nil, fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+		}
+		return t.next.RoundTrip(req)
+	}
+
+	addrs, err := t.resolver.LookupNetIP(req.Context(), "ip", host)
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if isBlockedIP(addr.Unmap()) {
+			return nil, fmt.Errorf("%w: %s resolves to %s", ErrBlockedAddress, host, addr)
+		}
+	}
+	return t.next.RoundTrip(req)
+}
+
+// safeRedirectPolicy limits redirects and rejects hops to non-HTTP schemes or
+// private host literals before a connection is attempted
+func safeRedirectPolicy(maxRedirects int) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return errTooManyRedirects
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+		}
+		if isPrivateHost(strings.ToLower(req.URL.Hostname())) {
+			return fmt.Errorf("%w: redirect to %s", ErrBlockedAddress, req.URL.Hostname())
+		}
+		return nil
+	}
+}
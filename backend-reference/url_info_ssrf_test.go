@@ -0,0 +1,128 @@
+// Package handler tests for SSRF protection
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+// allowLoopbackForTest exempts 127.0.0.1 so httptest servers can be fetched
+func allowLoopbackForTest(t *testing.T) {
+	t.Helper()
+	previous := allowedPrefixes.Load()
+	allowedPrefixes.Store(&[]netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")})
+	t.Cleanup(func() { allowedPrefixes.Store(previous) })
+}
+
+func TestIsBlockedIP(t *testing.T) {
+	testCases := []struct {
+		input   string
+		blocked bool
+	}{
+		{"8.8.8.8", false},
+		{"93.184.216.34", false},
+		{"10.1.2.3", true},
+		{"100.64.0.1", true},
+		{"172.31.255.255", true},
+		{"172.32.0.1", false},
+		{"169.254.169.254", true},
+		{"224.0.0.1", true},
+		{"255.255.255.255", true},
+		{"2606:4700::1111", false},
+		{"::1", true},
+		{"::ffff:127.0.0.1", true},
+		{"fd00::1", true},
+		{"fe80::1%eth0", true},
+		{"ff02::1", true},
+		{"64:ff9b::a00:1", true},    // NAT64 of 10.0.0.1
+		{"64:ff9b::808:808", false}, // NAT64 of 8.8.8.8
+		{"2002:c0a8:0101::1", true}, // 6to4 of 192.168.1.1
+	}
+
+	for _, tc := range testCases {
+		addr := netip.MustParseAddr(tc.input)
+		if got := isBlockedIP(addr); got != tc.blocked {
+			t.Errorf("For %s: expected blocked=%v, got %v", tc.input, tc.blocked, got)
+		}
+	}
+}
+
+func TestIsPrivateHost_LiteralForms(t *testing.T) {
+	testCases := []struct {
+		host    string
+		private bool
+	}{
+		{"example.com", false},
+		{"localhost.", true},
+		{"api.localhost", true},
+		{"2130706433", true}, // 127.0.0.1
+		{"0x7f000001", true}, // 127.0.0.1
+		{"0177.0.0.1", true}, // 127.0.0.1
+		{"127.1", true},      // 127.0.0.1
+		{"10.1", true},       // 10.0.0.1
+		{"[::ffff:127.0.0.1]", true},
+		{"[::1]", true},
+		{"134744072", false}, // 8.8.8.8
+	}
+
+	for _, tc := range testCases {
+		if got := isPrivateHost(tc.host); got != tc.private {
+			t.Errorf("For %s: expected private=%v, got %v", tc.host, tc.private, got)
+		}
+	}
+}
+
+func TestSSRFDialControl(t *testing.T) {
+	if err := ssrfDialControl("tcp", "10.0.0.5:80", nil); !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("Expected ErrBlockedAddress for 10.0.0.5, got %v", err)
+	}
+	if err := ssrfDialControl("tcp6", "[fd12::1]:443", nil); !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("Expected ErrBlockedAddress for fd12::1, got %v", err)
+	}
+	if err := ssrfDialControl("tcp", "93.184.216.34:443", nil); err != nil {
+		t.Errorf("Unexpected error for public address: %v", err)
+	}
+}
+
+func TestURLInfoHandler_RedirectToPrivate(t *testing.T) {
+	// 127.0.0.2 is loopback but outside the test allowance
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://127.0.0.2/admin", http.StatusFound)
+	}))
+	defer testServer.Close()
+	allowLoopbackForTest(t)
+
+	req := httptest.NewRequest("GET", "/client/common/urlInfo?url="+testServer.URL, nil)
+	w := httptest.NewRecorder()
+
+	URLInfoHandler(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+
+	var response URLInfoResponse
+	json.NewDecoder(w.Body).Decode(&response)
+
+	if response.Code != ErrCodeBlockedAddress {
+		t.Errorf("Expected code %s, got %q", ErrCodeBlockedAddress, response.Code)
+	}
+}
+
+func TestURLInfoHandler_DecimalIP(t *testing.T) {
+	req := httptest.NewRequest("GET", "/client/common/urlInfo?url=http://2130706433/", nil)
+	w := httptest.NewRecorder()
+
+	URLInfoHandler(w, req)
+
+	var response URLInfoResponse
+	json.NewDecoder(w.Body).Decode(&response)
+
+	if w.Code != http.StatusBadRequest || response.Code != ErrCodeBlockedAddress {
+		t.Errorf("Expected 400 %s, got %d %q", ErrCodeBlockedAddress, w.Code, response.Code)
+	}
+}
@@ -0,0 +1,133 @@
+// Fetch outcomes and diagnostics
+// A failed fetch still answers with status 1 so callers degrade gracefully, but
+// the metadata says why it is empty: fetchStatus is a machine-readable reason
+// and httpStatus, finalUrl and redirectChain show what the fetcher saw.
+
+package handler
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log/slog"
+	"net"
+)
+
+// Values of URLMetadata.FetchStatus
+const (
+	FetchStatusOK               = "ok"
+	FetchStatusPartial          = "partial" // some extractors failed or the body was cut off
+	FetchStatusTimeout          = "timeout"
+	FetchStatusDNSError         = "dns_error"
+	FetchStatusConnectionFailed = "connection_failed"
+	FetchStatusTLSError         = "tls_error"
+	FetchStatusHTTPError        = "http_error" // see httpStatus
+	FetchStatusNotHTML          = "not_html"
+	FetchStatusTooManyRedirects = "too_many_redirects"
+	FetchStatusBlocked          = "blocked"
+	FetchStatusRobotsDisallowed = "robots_disallowed"
+	FetchStatusThrottled        = "throttled"
+	FetchStatusError            = "error"
+)
+
+// errNotHTML is returned for responses the extractors cannot parse
+var errNotHTML = errors.New("not an HTML page")
+
+// errTooManyRedirects is returned when a redirect chain exceeds maxRedirects
+var errTooManyRedirects = errors.New("too many redirects")
+
+// FetchError is a failed page fetch with what was known when it failed
+type FetchError struct {
+	HTTPStatus    int
+	FinalURL      string
+	RedirectChain []string
+	ContentType   string
+	Err           error
+}
+
+func (e *FetchError) Error() string { return e.Err.Error() }
+
+func (e *FetchError) Unwrap() error { return e.Err }
+
+// fetchStatusOf classifies a fetch error
+func fetchStatusOf(err error) string {
+	var (
+		statusErr *HTTPStatusError
+		dnsErr    *net.DNSError
+		netErr    net.Error
+		opErr     *net.OpError
+		certErr   *tls.CertificateVerificationError
+		unknownCA x509.UnknownAuthorityError
+		hostErr   x509.HostnameError
+		invalid   x509.CertificateInvalidError
+		recordErr tls.RecordHeaderError
+	)
+
+	switch {
+	case err == nil:
+		return FetchStatusOK
+	case errors.Is(err, ErrBlockedAddress), errors.Is(err, ErrDomainNotAllowed):
+		return FetchStatusBlocked
+	case errors.Is(err, ErrRobotsDisallowed):
+		return FetchStatusRobotsDisallowed
+	case errors.Is(err, errHostThrottled):
+		return FetchStatusThrottled
+	case errors.Is(err, errTooManyRedirects):
+		return FetchStatusTooManyRedirects
+	case errors.Is(err, errNotHTML):
+		return FetchStatusNotHTML
+	case errors.As(err, &statusErr):
+		return FetchStatusHTTPError
+	case errors.As(err, &certErr), errors.As(err, &unknownCA), errors.As(err, &hostErr),
+		errors.As(err, &invalid), errors.As(err, &recordErr):
+		return FetchStatusTLSError
+	case errors.As(err, &dnsErr):
+		if dnsErr.IsTimeout {
+			return FetchStatusTimeout
+		}
+		return FetchStatusDNSError
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return FetchStatusTimeout
+	case errors.As(err, &opErr):
+		return FetchStatusConnectionFailed
+	}
+	return FetchStatusError
+}
+
+// failureMetadata is the metadata returned for a failed fetch: no page fields,
+// only the reason and the diagnostics gathered before the failure
+func failureMetadata(err error) *URLMetadata {
+	metadata := &URLMetadata{FetchStatus: fetchStatusOf(err)}
+
+	var fetchErr *FetchError
+	if errors.As(err, &fetchErr) {
+		metadata.HTTPStatus = fetchErr.HTTPStatus
+		metadata.FinalURL = fetchErr.FinalURL
+		metadata.RedirectChain = fetchErr.RedirectChain
+
+		// A file rather than a page still has a known format
+		if metadata.FetchStatus == FetchStatusNotHTML {
+			metadata.Format = mimeFormat(fetchErr.ContentType)
+		}
+	}
+
+	var statusErr *HTTPStatusError
+	if metadata.HTTPStatus == 0 && errors.As(err, &statusErr) {
+		metadata.HTTPStatus = statusErr.StatusCode
+	}
+	return metadata
+}
+
+// logFetchFailure records a failed metadata fetch
+func logFetchFailure(endpoint, targetURL string, err error) {
+	metadata := failureMetadata(err)
+	slog.Warn("urlInfo fetch failed",
+		slog.String("endpoint", endpoint),
+		slog.String("url", targetURL),
+		slog.String("fetchStatus", metadata.FetchStatus),
+		slog.Int("httpStatus", metadata.HTTPStatus),
+		slog.String("finalUrl", metadata.FinalURL),
+		slog.Any("error", err),
+	)
+}
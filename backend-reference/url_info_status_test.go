@@ -0,0 +1,132 @@
+// Package handler tests for fetch status and diagnostics
+package handler
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestFetchStatusOf(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"nil", nil, FetchStatusOK},
+		{"blocked", fmt.Errorf("failed to fetch URL: %w", ErrBlockedAddress), FetchStatusBlocked},
+		{"robots", &FetchError{Err: ErrRobotsDisallowed}, FetchStatusRobotsDisallowed},
+		{"throttled", errHostThrottled, FetchStatusThrottled},
+		{"redirects", &url.Error{Op: "Get", Err: errTooManyRedirects}, FetchStatusTooManyRedirects},
+		{"not html", &FetchError{Err: fmt.Errorf("%w: image/png", errNotHTML)}, FetchStatusNotHTML},
+		{"http", &FetchError{HTTPStatus: 503, Err: &HTTPStatusError{StatusCode: 503}}, FetchStatusHTTPError},
+		{"dns", &net.DNSError{Err: "no such host", Name: "nope.invalid", IsNotFound: true}, FetchStatusDNSError},
+		{"dns timeout", &net.DNSError{Err: "timeout", Name: "slow.example", IsTimeout: true}, FetchStatusTimeout},
+		{"deadline", fmt.Errorf("failed to fetch URL: %w", context.DeadlineExceeded), FetchStatusTimeout},
+		{"refused", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, FetchStatusConnectionFailed},
+		{"tls", &url.Error{Op: "Get", Err: x509.UnknownAuthorityError{}}, FetchStatusTLSError},
+		{"other", errors.New("boom"), FetchStatusError},
+	}
+
+	for _, tc := range testCases {
+		if got := fetchStatusOf(tc.err); got != tc.expected {
+			t.Errorf("%s: expected %s, got %s", tc.name, tc.expected, got)
+		}
+	}
+}
+
+func TestURLInfoHandler_FetchDiagnostics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved":
+			http.Redirect(w, r, "/article", http.StatusMovedPermanently)
+		case "/article":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head><title>Article</title></head></html>`))
+		case "/gone":
+			http.Redirect(w, r, "/missing", http.StatusFound)
+		case "/report.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Write([]byte("%PDF-1.7"))
+		case "/backup.zip":
+			w.Header().Set("Content-Type", "application/zip")
+			w.Write([]byte("PK\x03\x04"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	allowLoopbackForTest(t)
+
+	testCases := []struct {
+		path        string
+		fetchStatus string
+		httpStatus  int
+		finalPath   string
+		chain       int
+		title       string
+	}{
+		{"/moved", FetchStatusOK, 200, "/article", 1, "Article"},
+		{"/gone", FetchStatusHTTPError, 404, "/missing", 1, ""},
+		{"/report.pdf", FetchStatusOK, 200, "/report.pdf", 0, "report.pdf"},
+		{"/backup.zip", FetchStatusNotHTML, 200, "/backup.zip", 0, ""},
+	}
+
+	for _, tc := range testCases {
+		req := httptest.NewRequest("GET", "/client/common/urlInfo?url="+url.QueryEscape(server.URL+tc.path), nil)
+		w := httptest.NewRecorder()
+		URLInfoHandler(w, req)
+
+		var response URLInfoResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("%s: failed to decode response: %v", tc.path, err)
+		}
+		if response.Status != 1 || response.Data == nil {
+			t.Fatalf("%s: expected graceful success, got %+v", tc.path, response)
+		}
+
+		data := response.Data
+		if data.FetchStatus != tc.fetchStatus || data.HTTPStatus != tc.httpStatus {
+			t.Errorf("%s: expected %s/%d, got %s/%d", tc.path, tc.fetchStatus, tc.httpStatus, data.FetchStatus, data.HTTPStatus)
+		}
+		if data.FinalURL != server.URL+tc.finalPath {
+			t.Errorf("%s: expected final URL %s, got %s", tc.path, server.URL+tc.finalPath, data.FinalURL)
+		}
+		if len(data.RedirectChain) != tc.chain || (tc.chain > 0 && data.RedirectChain[0] != server.URL+tc.path) {
+			t.Errorf("%s: unexpected redirect chain %v", tc.path, data.RedirectChain)
+		}
+		if data.Title != tc.title {
+			t.Errorf("%s: expected title %q, got %q", tc.path, tc.title, data.Title)
+		}
+	}
+}
+
+func TestFailureMetadata_NotHTMLFormat(t *testing.T) {
+	err := &FetchError{HTTPStatus: 200, ContentType: "application/pdf", Err: errNotHTML}
+	if metadata := failureMetadata(err); metadata.Format != FormatDocument {
+		t.Errorf("Expected a PDF to keep its format, got %q", metadata.Format)
+	}
+}
+
+func TestPipeline_PartialWhenExtractorFails(t *testing.T) {
+	page := testPage(t, "https://example.com/", `<html></html>`)
+	pipeline := NewPipeline(
+		stubExtractor{name: "title", fields: map[Field]string{FieldTitle: "Kept"}, conf: ConfidenceHigh},
+		stubExtractor{name: "broken", err: errors.New("boom")},
+	)
+
+	metadata, err := pipeline.Run(context.Background(), page)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if metadata.Title != "Kept" || metadata.FetchStatus != FetchStatusPartial {
+		t.Errorf("Expected partial metadata with the title kept, got %q/%s", metadata.Title, metadata.FetchStatus)
+	}
+}
@@ -0,0 +1,154 @@
+// Per-host politeness for outbound fetches
+// Every request a Fetcher makes, including redirects, robots.txt, oEmbed,
+// images and site APIs, takes a token from its host's bucket first, so a batch
+// backfill cannot hammer a single site. robots.txt Crawl-delay slows a host's
+// bucket further.
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errHostThrottled is returned when a host's queue is longer than the
+// request's remaining time
+var errHostThrottled = errors.New("host request rate exceeded")
+
+// Per-host request limits
+const (
+	hostRequestInterval = 250 * time.Millisecond // 4 requests per second sustained
+	hostRequestBurst    = 8
+	maxCrawlDelay       = 10 * time.Second
+	maxThrottledHosts   = 10000
+)
+
+// tokenBucket tracks one host; interval and burst change with Crawl-delay
+type tokenBucket struct {
+	tokens   float64
+	last     time.Time
+	interval time.Duration
+	burst    float64
+}
+
+// hostThrottle is a set of per-host token buckets
+type hostThrottle struct {
+	mu       sync.Mutex
+	interval time.Duration
+	burst    int
+	buckets  map[string]*tokenBucket
+	now      func() time.Time
+}
+
+func newHostThrottle(interval time.Duration, burst int) *hostThrottle {
+	return &hostThrottle{
+		interval: interval,
+		burst:    burst,
+		buckets:  make(map[string]*tokenBucket),
+		now:      time.Now,
+	}
+}
+
+// wait blocks until host may be sent another request. It fails fast when the
+// wait would outlast ctx's deadline.
+func (t *hostThrottle) wait(ctx context.Context, host string) error {
+	delay := t.reserve(host)
+	if delay <= 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && t.now().Add(delay).After(deadline) {
+		t.refund(host)
+		return fmt.Errorf("%w: %s", errHostThrottled, host)
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		t.refund(host)
+		return ctx.Err()
+	}
+}
+
+// reserve takes a token and returns how long to wait before using it
+func (t *hostThrottle) reserve(host string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b := t.bucket(host)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens * float64(b.interval))
+}
+
+// refund returns a token that was reserved but not used
+func (t *hostThrottle) refund(host string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b := t.bucket(host)
+	b.tokens = min(b.burst, b.tokens+1)
+}
+
+// setDelay applies a robots.txt Crawl-delay: one request per delay, no bursts
+func (t *hostThrottle) setDelay(host string, delay time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b := t.bucket(host)
+	b.interval = max(t.interval, min(delay, maxCrawlDelay))
+	b.burst = 1
+	b.tokens = min(b.tokens, b.burst)
+}
+
+// bucket returns host's bucket refilled to now. Callers hold t.mu.
+func (t *hostThrottle) bucket(host string) *tokenBucket {
+	now := t.now()
+	b, ok := t.buckets[host]
+	if !ok {
+		if len(t.buckets) >= maxThrottledHosts {
+			t.prune(now)
+		}
+		b = &tokenBucket{tokens: float64(t.burst), last: now, interval: t.interval, burst: float64(t.burst)}
+		t.buckets[host] = b
+		return b
+	}
+
+	elapsed := now.Sub(b.last)
+	b.tokens = min(b.burst, b.tokens+float64(elapsed)/float64(b.interval))
+	b.last = now
+	return b
+}
+
+// prune forgets hosts whose buckets have refilled; a new bucket starts full
+// anyway. Hosts slowed by Crawl-delay are kept. Callers hold t.mu.
+func (t *hostThrottle) prune(now time.Time) {
+	for host, b := range t.buckets {
+		full := b.tokens+float64(now.Sub(b.last))/float64(b.interval) >= b.burst
+		if full && b.interval == t.interval {
+			delete(t.buckets, host)
+		}
+	}
+}
+
+// throttledTransport waits for the host's bucket before each request
+type throttledTransport struct {
+	next     http.RoundTripper
+	throttle *hostThrottle
+}
+
+func (t *throttledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.throttle.wait(req.Context(), strings.ToLower(req.URL.Host)); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,72 @@
+// Package handler tests for per-host request throttling
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHostThrottle_Reserve(t *testing.T) {
+	now := time.Now()
+	throttle := newHostThrottle(100*time.Millisecond, 2)
+	throttle.now = func() time.Time { return now }
+
+	// The burst goes through at once, then one request per interval
+	for i, expected := range []time.Duration{0, 0, 100 * time.Millisecond, 200 * time.Millisecond} {
+		if delay := throttle.reserve("example.com"); delay != expected {
+			t.Errorf("Request %d: expected delay %v, got %v", i, expected, delay)
+		}
+	}
+
+	// Other hosts have their own bucket
+	if delay := throttle.reserve("example.org"); delay != 0 {
+		t.Errorf("Expected a fresh bucket for another host, got %v", delay)
+	}
+
+	// Tokens refill over time
+	now = now.Add(time.Second)
+	if delay := throttle.reserve("example.com"); delay != 0 {
+		t.Errorf("Expected refilled bucket, got %v", delay)
+	}
+}
+
+func TestHostThrottle_CrawlDelay(t *testing.T) {
+	now := time.Now()
+	throttle := newHostThrottle(100*time.Millisecond, 4)
+	throttle.now = func() time.Time { return now }
+
+	throttle.setDelay("slow.example", 3*time.Second)
+	if delay := throttle.reserve("slow.example"); delay != 0 {
+		t.Errorf("Expected first request to go through, got %v", delay)
+	}
+	if delay := throttle.reserve("slow.example"); delay != 3*time.Second {
+		t.Errorf("Expected crawl delay of 3s, got %v", delay)
+	}
+
+	// Absurd delays are capped
+	throttle.setDelay("slower.example", time.Hour)
+	throttle.reserve("slower.example")
+	if delay := throttle.reserve("slower.example"); delay != maxCrawlDelay {
+		t.Errorf("Expected delay capped at %v, got %v", maxCrawlDelay, delay)
+	}
+}
+
+func TestHostThrottle_WaitRespectsDeadline(t *testing.T) {
+	throttle := newHostThrottle(time.Hour, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := throttle.wait(ctx, "example.com"); err != nil {
+		t.Fatalf("Expected first request to pass, got %v", err)
+	}
+	start := time.Now()
+	if err := throttle.wait(ctx, "example.com"); !errors.Is(err, errHostThrottled) {
+		t.Errorf("Expected errHostThrottled, got %v", err)
+	}
+	if time.Since(start) > 100*time.Millisecond {
+		t.Error("Expected wait to fail fast instead of sleeping")
+	}
+}
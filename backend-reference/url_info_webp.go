@@ -0,0 +1,1115 @@
+// WebP encoding
+// Go decodes WebP but has no encoder, so mirrored variants are written here as
+// lossy VP8 key frames (RFC 6386) in a RIFF container. The encoder is kept
+// small: every macroblock uses 16x16 luma and 8x8 chroma intra prediction with
+// the best of the DC, vertical, horizontal and TrueMotion modes, there are no
+// segments and no loop filter, and the coefficients are coded with the default
+// token probabilities. Files come out larger than libwebp's at the same
+// quality, and about the size of a JPEG of the same fidelity.
+
+package handler
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+
+	"golang.org/x/image/draw"
+)
+
+// WebPEncoder writes lossy WebP variants
+var WebPEncoder = ImageEncoder{
+	MIMEType:  "image/webp",
+	Extension: "webp",
+	Encode:    encodeWebP,
+}
+
+// VP8 limits
+const (
+	maxWebPDimension    = 16383     // 14 bits each for width and height
+	maxVP8PartitionSize = 1<<19 - 1 // the first partition's size has 19 bits
+	maxVP8Level         = 2048      // largest quantized coefficient a token can carry
+)
+
+// encodeWebP writes img as a lossy WebP. quality runs from 0 to 100 like
+// JPEG's and picks the quantizer. Alpha is dropped.
+func encodeWebP(w io.Writer, img image.Image, quality int) error {
+	b := img.Bounds()
+	if b.Dx() > maxWebPDimension || b.Dy() > maxWebPDimension {
+		return fmt.Errorf("%w: %dx%d exceeds the WebP limit", errImageTooLarge, b.Dx(), b.Dy())
+	}
+	if b.Empty() {
+		return fmt.Errorf("%w: empty image", errUnsupportedImage)
+	}
+
+	frame, err := newVP8Encoder(img, quality).encode()
+	if err != nil {
+		return err
+	}
+
+	// RIFF header, then a single VP8 chunk padded to an even size
+	pad := len(frame) & 1
+	header := make([]byte, 20)
+	copy(header, "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(12+len(frame)+pad))
+	copy(header[8:], "WEBPVP8 ")
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(frame)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(frame); err != nil {
+		return err
+	}
+	if pad == 1 {
+		_, err = w.Write([]byte{0})
+	}
+	return err
+}
+
+// Intra prediction modes, numbered as in the decoder
+const (
+	vp8PredDC = iota
+	vp8PredTM
+	vp8PredVE
+	vp8PredHE
+	vp8PredModes
+)
+
+// Token probability planes
+const (
+	vp8PlaneY1WithY2 = iota
+	vp8PlaneY2
+	vp8PlaneUV
+)
+
+var (
+	// vp8Zigzag is the coefficient order within a 4x4 block
+	vp8Zigzag = [16]uint8{0, 1, 4, 8, 5, 2, 3, 6, 9, 12, 13, 10, 7, 11, 14, 15}
+	// vp8Bands maps a coefficient's position to its probability band
+	vp8Bands = [17]uint8{0, 1, 2, 3, 6, 4, 5, 6, 6, 6, 6, 6, 6, 6, 6, 7, 0}
+	// vp8ExtraBitsProb are the probabilities of the extra bits of token
+	// categories 3 to 6
+	vp8ExtraBitsProb = [4][]uint8{
+		{173, 148, 140},
+		{176, 155, 140, 135},
+		{180, 157, 141, 134, 130},
+		{254, 254, 243, 230, 196, 177, 153, 140, 133, 130, 129},
+	}
+)
+
+// vp8Quant holds the DC and AC quantizer steps of the three kinds of blocks
+type vp8Quant struct {
+	index      int // 0-127, written to the frame header
+	y1, y2, uv [2]int32
+}
+
+// newVP8Quant derives the quantizer steps from a 0-100 quality
+func newVP8Quant(quality int) vp8Quant {
+	q := (100 - min(max(quality, 0), 100)) * 127 / 100
+	return vp8Quant{
+		index: q,
+		y1:    [2]int32{vp8DCTable[q], vp8ACTable[q]},
+		y2:    [2]int32{vp8DCTable[q] * 2, max(vp8ACTable[q]*155/100, 8)},
+		uv:    [2]int32{vp8DCTable[min(q, 117)], vp8ACTable[q]},
+	}
+}
+
+// vp8Nonzero records which 4x4 blocks along a macroblock edge had
+// coefficients, the context for coding the next macroblock's
+type vp8Nonzero struct {
+	y    [4]uint8
+	u, v [2]uint8
+	y2   uint8
+}
+
+// vp8Encoder encodes one key frame
+type vp8Encoder struct {
+	width, height int
+	mbw, mbh      int
+	quant         vp8Quant
+
+	// Source planes, padded to whole macroblocks, and the reconstruction the
+	// decoder will see, which later macroblocks are predicted from
+	y, u, v          []uint8
+	recY, recU, recV []uint8
+
+	header, tokens vp8BoolEncoder
+	top            []vp8Nonzero
+	left           vp8Nonzero
+}
+
+func newVP8Encoder(img image.Image, quality int) *vp8Encoder {
+	b := img.Bounds()
+	e := &vp8Encoder{
+		width:  b.Dx(),
+		height: b.Dy(),
+		mbw:    (b.Dx() + 15) / 16,
+		mbh:    (b.Dy() + 15) / 16,
+		quant:  newVP8Quant(quality),
+	}
+	rgba, ok := img.(*image.RGBA)
+	if !ok {
+		rgba = image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	}
+	e.convert(rgba)
+	return e
+}
+
+// convert fills the Y'CbCr planes from img with BT.601 limited-range
+// coefficients, as WebP decoders expect. Edge pixels are repeated into the
+// padding.
+func (e *vp8Encoder) convert(img *image.RGBA) {
+	yw, yh := 16*e.mbw, 16*e.mbh
+	cw, ch := yw/2, yh/2
+	e.y, e.recY = make([]uint8, yw*yh), make([]uint8, yw*yh)
+	e.u, e.recU = make([]uint8, cw*ch), make([]uint8, cw*ch)
+	e.v, e.recV = make([]uint8, cw*ch), make([]uint8, cw*ch)
+
+	b := img.Bounds()
+	pixel := func(x, y int) (int32, int32, int32) {
+		x, y = min(x, e.width-1), min(y, e.height-1)
+		i := img.PixOffset(b.Min.X+x, b.Min.Y+y)
+		return int32(img.Pix[i]), int32(img.Pix[i+1]), int32(img.Pix[i+2])
+	}
+	for y := 0; y < yh; y++ {
+		for x := 0; x < yw; x++ {
+			r, g, b := pixel(x, y)
+			e.y[y*yw+x] = rgbToVP8Y(r, g, b)
+		}
+	}
+	for y := 0; y < ch; y++ {
+		for x := 0; x < cw; x++ {
+			var r, g, b int32
+			for _, d := range [4][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+				pr, pg, pb := pixel(2*x+d[0], 2*y+d[1])
+				r, g, b = r+pr, g+pg, b+pb
+			}
+			e.u[y*cw+x], e.v[y*cw+x] = rgbToVP8UV(r, g, b)
+		}
+	}
+}
+
+// rgbToVP8Y converts one pixel to luma
+func rgbToVP8Y(r, g, b int32) uint8 {
+	return uint8((16839*r + 33059*g + 6420*b + 16<<16 + 1<<15) >> 16)
+}
+
+// rgbToVP8UV converts the sums of four pixels to chroma
+func rgbToVP8UV(r, g, b int32) (uint8, uint8) {
+	clip := func(v int32) uint8 {
+		return uint8(min(max((v+1<<17+128<<18)>>18, 0), 255))
+	}
+	return clip(-9719*r - 19081*g + 28800*b), clip(28800*r - 24116*g - 4684*b)
+}
+
+// encode returns the VP8 frame
+func (e *vp8Encoder) encode() ([]byte, error) {
+	e.writeHeader()
+	e.top = make([]vp8Nonzero, e.mbw)
+	for mby := 0; mby < e.mbh; mby++ {
+		e.left = vp8Nonzero{}
+		for mbx := 0; mbx < e.mbw; mbx++ {
+			e.encodeMacroblock(mbx, mby)
+		}
+	}
+
+	first, tokens := e.header.finish(), e.tokens.finish()
+	if len(first) > maxVP8PartitionSize {
+		return nil, fmt.Errorf("%w: %dx%d is too large to encode as WebP", errImageTooLarge, e.width, e.height)
+	}
+
+	// Key frame tag: version 0, shown, followed by the first partition's size
+	tag := uint32(len(first))<<5 | 1<<4
+	frame := make([]byte, 10, 10+len(first)+len(tokens))
+	frame[0], frame[1], frame[2] = byte(tag), byte(tag>>8), byte(tag>>16)
+	frame[3], frame[4], frame[5] = 0x9d, 0x01, 0x2a
+	binary.LittleEndian.PutUint16(frame[6:], uint16(e.width))
+	binary.LittleEndian.PutUint16(frame[8:], uint16(e.height))
+	frame = append(frame, first...)
+	return append(frame, tokens...), nil
+}
+
+// writeHeader writes the frame header at the start of the first partition
+func (e *vp8Encoder) writeHeader() {
+	h := &e.header
+	h.putLiteral(0, 1) // color space
+	h.putLiteral(0, 1) // clamping required
+	h.putLiteral(0, 1) // no segmentation
+	h.putLiteral(0, 1) // normal loop filter...
+	h.putLiteral(0, 6) // ...at level 0, i.e. none
+	h.putLiteral(0, 3) // sharpness
+	h.putLiteral(0, 1) // no loop filter adjustments
+	h.putLiteral(0, 2) // one token partition
+	h.putLiteral(uint32(e.quant.index), 7)
+	for i := 0; i < 5; i++ {
+		h.putLiteral(0, 1) // no quantizer deltas
+	}
+	h.putLiteral(0, 1) // probabilities are not kept for later frames
+	for i := range vp8TokenUpdateProb {
+		for j := range vp8TokenUpdateProb[i] {
+			for k := range vp8TokenUpdateProb[i][j] {
+				for _, p := range vp8TokenUpdateProb[i][j][k] {
+					h.put(false, p) // the default token probabilities are kept
+				}
+			}
+		}
+	}
+	h.putLiteral(0, 1) // no per-macroblock skip flags
+}
+
+// encodeMacroblock predicts, transforms and codes the macroblock at (mbx, mby)
+func (e *vp8Encoder) encodeMacroblock(mbx, mby int) {
+	yStride, cStride := 16*e.mbw, 8*e.mbw
+	x, y := 16*mbx, 16*mby
+
+	// Luma: a second-order transform of the sixteen DC coefficients
+	yMode := bestVP8Mode(16, func(mode int, pred []uint8) int {
+		predictVP8(pred, e.recY, yStride, x, y, 16, mode)
+		return sse(e.y, yStride, x, y, pred, 16)
+	})
+	var pred [16 * 16]uint8
+	predictVP8(pred[:], e.recY, yStride, x, y, 16, yMode)
+	var coeffs [16][16]int32
+	var dc [16]int32
+	for n := range coeffs {
+		bx, by := x+4*(n%4), y+4*(n/4)
+		fdct4(e.y[by*yStride+bx:], yStride, pred[64*(n/4)+4*(n%4):], 16, &coeffs[n])
+		dc[n] = coeffs[n][0]
+	}
+	y2 := fwht4(&dc)
+	var y2Levels [16]int32
+	for i := range y2 {
+		y2Levels[i] = quantizeVP8(y2[i], e.quant.y2[min(i, 1)])
+		y2[i] = y2Levels[i] * e.quant.y2[min(i, 1)]
+	}
+	dc = iwht4(&y2)
+	var yLevels [16][16]int32
+	for n := range coeffs {
+		for i := 1; i < 16; i++ {
+			yLevels[n][i] = quantizeVP8(coeffs[n][i], e.quant.y1[1])
+			coeffs[n][i] = yLevels[n][i] * e.quant.y1[1]
+		}
+		coeffs[n][0] = dc[n]
+		bx, by := x+4*(n%4), y+4*(n/4)
+		idct4Add(&coeffs[n], pred[64*(n/4)+4*(n%4):], 16, e.recY[by*yStride+bx:], yStride)
+	}
+
+	// Chroma: both planes share one mode
+	cx, cy := 8*mbx, 8*mby
+	uvMode := bestVP8Mode(8, func(mode int, pred []uint8) int {
+		predictVP8(pred, e.recU, cStride, cx, cy, 8, mode)
+		cost := sse(e.u, cStride, cx, cy, pred, 8)
+		predictVP8(pred, e.recV, cStride, cx, cy, 8, mode)
+		return cost + sse(e.v, cStride, cx, cy, pred, 8)
+	})
+	uLevels := e.encodeChroma(e.u, e.recU, cStride, cx, cy, uvMode)
+	vLevels := e.encodeChroma(e.v, e.recV, cStride, cx, cy, uvMode)
+
+	e.writeModes(yMode, uvMode)
+
+	// Tokens, with each block's context taken from its neighbours above
+	// and to the left
+	top := &e.top[mbx]
+	nz := e.writeCoeffs(vp8PlaneY2, e.left.y2+top.y2, &y2Levels, 0)
+	e.left.y2, top.y2 = nz, nz
+	for j := 0; j < 4; j++ {
+		for i := 0; i < 4; i++ {
+			nz := e.writeCoeffs(vp8PlaneY1WithY2, e.left.y[j]+top.y[i], &yLevels[4*j+i], 1)
+			e.left.y[j], top.y[i] = nz, nz
+		}
+	}
+	for _, plane := range []struct {
+		levels    *[4][16]int32
+		left, top *[2]uint8
+	}{{&uLevels, &e.left.u, &top.u}, {&vLevels, &e.left.v, &top.v}} {
+		for j := 0; j < 2; j++ {
+			for i := 0; i < 2; i++ {
+				nz := e.writeCoeffs(vp8PlaneUV, plane.left[j]+plane.top[i], &plane.levels[2*j+i], 0)
+				plane.left[j], plane.top[i] = nz, nz
+			}
+		}
+	}
+}
+
+// encodeChroma transforms and quantizes one 8x8 chroma block, reconstructing
+// it into rec
+func (e *vp8Encoder) encodeChroma(src, rec []uint8, stride, x, y, mode int) [4][16]int32 {
+	var pred [8 * 8]uint8
+	predictVP8(pred[:], rec, stride, x, y, 8, mode)
+	var levels [4][16]int32
+	for n := range levels {
+		bx, by := x+4*(n%2), y+4*(n/2)
+		var coeffs [16]int32
+		fdct4(src[by*stride+bx:], stride, pred[32*(n/2)+4*(n%2):], 8, &coeffs)
+		for i := range coeffs {
+			levels[n][i] = quantizeVP8(coeffs[i], e.quant.uv[min(i, 1)])
+			coeffs[i] = levels[n][i] * e.quant.uv[min(i, 1)]
+		}
+		idct4Add(&coeffs, pred[32*(n/2)+4*(n%2):], 8, rec[by*stride+bx:], stride)
+	}
+	return levels
+}
+
+// writeModes codes the macroblock's prediction modes with the fixed key
+// frame probabilities
+func (e *vp8Encoder) writeModes(yMode, uvMode int) {
+	h := &e.header
+	h.put(true, 145) // 16x16 luma prediction
+	switch yMode {
+	case vp8PredDC, vp8PredVE:
+		h.put(false, 156)
+		h.put(yMode == vp8PredVE, 163)
+	default:
+		h.put(true, 156)
+		h.put(yMode == vp8PredTM, 128)
+	}
+	h.put(uvMode != vp8PredDC, 142)
+	if uvMode != vp8PredDC {
+		h.put(uvMode != vp8PredVE, 114)
+		if uvMode != vp8PredVE {
+			h.put(uvMode == vp8PredTM, 183)
+		}
+	}
+}
+
+// writeCoeffs codes one block's quantized coefficients from position first
+// on and reports whether any were non-zero
+func (e *vp8Encoder) writeCoeffs(plane int, context uint8, levels *[16]int32, first int) uint8 {
+	last := -1
+	for n := 15; n >= first; n-- {
+		if levels[vp8Zigzag[n]] != 0 {
+			last = n
+			break
+		}
+	}
+
+	t := &e.tokens
+	probs := &vp8DefaultTokenProb[plane]
+	p := probs[vp8Bands[first]][context]
+	if last < 0 {
+		t.put(false, p[0]) // end of block
+		return 0
+	}
+	t.put(true, p[0])
+	for n := first; n < 16; {
+		level := levels[vp8Zigzag[n]]
+		v := abs32(level)
+		n++
+		if v == 0 {
+			t.put(false, p[1])
+			p = probs[vp8Bands[n]][0]
+			continue
+		}
+		t.put(true, p[1])
+		switch {
+		case v == 1:
+			t.put(false, p[2])
+			p = probs[vp8Bands[n]][1]
+		case v <= 4:
+			t.put(true, p[2])
+			t.put(false, p[3])
+			t.put(v != 2, p[4])
+			if v != 2 {
+				t.put(v == 4, p[5])
+			}
+			p = probs[vp8Bands[n]][2]
+		case v <= 10:
+			t.put(true, p[2])
+			t.put(true, p[3])
+			t.put(false, p[6])
+			if v <= 6 {
+				t.put(false, p[7])
+				t.put(v == 6, 159)
+			} else {
+				t.put(true, p[7])
+				t.put((v-7)&2 != 0, 165)
+				t.put((v-7)&1 != 0, 145)
+			}
+			p = probs[vp8Bands[n]][2]
+		default:
+			t.put(true, p[2])
+			t.put(true, p[3])
+			t.put(true, p[6])
+			cat := 0
+			for cat < 3 && v >= 3+8<<(cat+1) {
+				cat++
+			}
+			t.put(cat >= 2, p[8])
+			t.put(cat&1 != 0, p[9+cat/2])
+			extra := v - (3 + 8<<cat)
+			bits := vp8ExtraBitsProb[cat]
+			for i, prob := range bits {
+				t.put(extra>>(len(bits)-1-i)&1 != 0, prob)
+			}
+			p = probs[vp8Bands[n]][2]
+		}
+		t.put(level < 0, 128)
+		if n == 16 {
+			break
+		}
+		t.put(n <= last, p[0])
+		if n > last {
+			break
+		}
+	}
+	return 1
+}
+
+// bestVP8Mode returns the prediction mode with the lowest cost
+func bestVP8Mode(size int, cost func(mode int, pred []uint8) int) int {
+	pred := make([]uint8, size*size)
+	best, bestCost := vp8PredDC, -1
+	for mode := 0; mode < vp8PredModes; mode++ {
+		if c := cost(mode, pred); bestCost < 0 || c < bestCost {
+			best, bestCost = mode, c
+		}
+	}
+	return best
+}
+
+// predictVP8 fills pred with the size x size prediction of the block at (x, y)
+// from the reconstructed pixels above and to the left. Outside the image the
+// decoder assumes 127 above and 129 to the left.
+func predictVP8(pred, rec []uint8, stride, x, y, size, mode int) {
+	var top, left [16]int32
+	corner := int32(127)
+	for i := 0; i < size; i++ {
+		top[i], left[i] = 127, 129
+		if y > 0 {
+			top[i] = int32(rec[(y-1)*stride+x+i])
+		}
+		if x > 0 {
+			left[i] = int32(rec[(y+i)*stride+x-1])
+		}
+	}
+	if y > 0 {
+		corner = 129
+		if x > 0 {
+			corner = int32(rec[(y-1)*stride+x-1])
+		}
+	}
+
+	for j := 0; j < size; j++ {
+		for i := 0; i < size; i++ {
+			var v int32
+			switch mode {
+			case vp8PredTM:
+				v = min(max(left[j]+top[i]-corner, 0), 255)
+			case vp8PredVE:
+				v = top[i]
+			case vp8PredHE:
+				v = left[j]
+			default:
+				v = predictVP8DC(top[:size], left[:size], x > 0, y > 0)
+			}
+			pred[j*size+i] = uint8(v)
+		}
+	}
+}
+
+// predictVP8DC averages the edges that lie inside the image
+func predictVP8DC(top, left []int32, hasLeft, hasTop bool) int32 {
+	size := int32(len(top))
+	var sum int32
+	for i := range top {
+		if hasTop {
+			sum += top[i]
+		}
+		if hasLeft {
+			sum += left[i]
+		}
+	}
+	switch {
+	case hasTop && hasLeft:
+		return (sum + size) / (2 * size)
+	case hasTop || hasLeft:
+		return (sum + size/2) / size
+	}
+	return 128
+}
+
+// sse is the squared error between a size x size block of src at (x, y) and pred
+func sse(src []uint8, stride, x, y int, pred []uint8, size int) int {
+	total := 0
+	for j := 0; j < size; j++ {
+		row := src[(y+j)*stride+x:]
+		for i := 0; i < size; i++ {
+			d := int(row[i]) - int(pred[j*size+i])
+			total += d * d
+		}
+	}
+	return total
+}
+
+// quantizeVP8 divides a coefficient by step, rounding slightly towards zero,
+// and keeps the result within what tokens and the decoder's int16 can hold
+func quantizeVP8(c, step int32) int32 {
+	level := min((abs32(c)+step*3/8)/step, maxVP8Level, 32767/step)
+	if c < 0 {
+		return -level
+	}
+	return level
+}
+
+func abs32(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// fdct4 is the forward DCT of the difference between a 4x4 block of src and
+// pred, as in libwebp
+func fdct4(src []uint8, srcStride int, pred []uint8, predStride int, out *[16]int32) {
+	var tmp [16]int32
+	for i := 0; i < 4; i++ {
+		s, p := src[i*srcStride:], pred[i*predStride:]
+		d0, d1 := int32(s[0])-int32(p[0]), int32(s[1])-int32(p[1])
+		d2, d3 := int32(s[2])-int32(p[2]), int32(s[3])-int32(p[3])
+		a0, a1, a2, a3 := d0+d3, d1+d2, d1-d2, d0-d3
+		tmp[4*i+0] = (a0 + a1) * 8
+		tmp[4*i+1] = (a2*2217 + a3*5352 + 1812) >> 9
+		tmp[4*i+2] = (a0 - a1) * 8
+		tmp[4*i+3] = (a3*2217 - a2*5352 + 937) >> 9
+	}
+	for i := 0; i < 4; i++ {
+		a0, a1 := tmp[i]+tmp[12+i], tmp[4+i]+tmp[8+i]
+		a2, a3 := tmp[4+i]-tmp[8+i], tmp[i]-tmp[12+i]
+		out[i] = (a0 + a1 + 7) >> 4
+		out[4+i] = (a2*2217 + a3*5352 + 12000) >> 16
+		if a3 != 0 {
+			out[4+i]++
+		}
+		out[8+i] = (a0 - a1 + 7) >> 4
+		out[12+i] = (a3*2217 - a2*5352 + 51000) >> 16
+	}
+}
+
+// idct4Add adds the inverse DCT of coeffs to pred and stores the result in
+// dst, exactly as the decoder reconstructs the block
+func idct4Add(coeffs *[16]int32, pred []uint8, predStride int, dst []uint8, dstStride int) {
+	const (
+		c1 = 85627 // 65536 * cos(pi/8) * sqrt(2)
+		c2 = 35468 // 65536 * sin(pi/8) * sqrt(2)
+	)
+	var m [4][4]int32
+	for i := 0; i < 4; i++ {
+		a := coeffs[i] + coeffs[8+i]
+		b := coeffs[i] - coeffs[8+i]
+		c := (coeffs[4+i]*c2)>>16 - (coeffs[12+i]*c1)>>16
+		d := (coeffs[4+i]*c1)>>16 + (coeffs[12+i]*c2)>>16
+		m[i] = [4]int32{a + d, b + c, b - c, a - d}
+	}
+	for j := 0; j < 4; j++ {
+		dc := m[0][j] + 4
+		a, b := dc+m[2][j], dc-m[2][j]
+		c := (m[1][j]*c2)>>16 - (m[3][j]*c1)>>16
+		d := (m[1][j]*c1)>>16 + (m[3][j]*c2)>>16
+		p, out := pred[j*predStride:], dst[j*dstStride:]
+		for i, r := range [4]int32{a + d, b + c, b - c, a - d} {
+			out[i] = uint8(min(max(int32(p[i])+r>>3, 0), 255))
+		}
+	}
+}
+
+// fwht4 is the forward Walsh-Hadamard transform of the sixteen luma DC
+// coefficients, the inverse of iwht4
+func fwht4(dc *[16]int32) [16]int32 {
+	var tmp, out [16]int32
+	for i := 0; i < 4; i++ {
+		x0, x1, x2, x3 := dc[4*i], dc[4*i+1], dc[4*i+2], dc[4*i+3]
+		tmp[4*i+0] = x0 + x1 + x2 + x3
+		tmp[4*i+1] = x0 + x1 - x2 - x3
+		tmp[4*i+2] = x0 - x1 - x2 + x3
+		tmp[4*i+3] = x0 - x1 + x2 - x3
+	}
+	for i := 0; i < 4; i++ {
+		x0, x1, x2, x3 := tmp[i], tmp[4+i], tmp[8+i], tmp[12+i]
+		out[i] = (x0 + x1 + x2 + x3) >> 1
+		out[4+i] = (x0 + x1 - x2 - x3) >> 1
+		out[8+i] = (x0 - x1 - x2 + x3) >> 1
+		out[12+i] = (x0 - x1 + x2 - x3) >> 1
+	}
+	return out
+}
+
+// iwht4 is the decoder's inverse Walsh-Hadamard transform, returning the DC
+// coefficient of each luma block
+func iwht4(in *[16]int32) [16]int32 {
+	var m, out [16]int32
+	for i := 0; i < 4; i++ {
+		a0, a1 := in[i]+in[12+i], in[4+i]+in[8+i]
+		a2, a3 := in[4+i]-in[8+i], in[i]-in[12+i]
+		m[i], m[8+i] = a0+a1, a0-a1
+		m[4+i], m[12+i] = a3+a2, a3-a2
+	}
+	for i := 0; i < 4; i++ {
+		dc := m[4*i] + 3
+		a0, a1 := dc+m[4*i+3], m[4*i+1]+m[4*i+2]
+		a2, a3 := m[4*i+1]-m[4*i+2], dc-m[4*i+3]
+		out[4*i+0] = (a0 + a1) >> 3
+		out[4*i+1] = (a3 + a2) >> 3
+		out[4*i+2] = (a0 - a1) >> 3
+		out[4*i+3] = (a3 - a2) >> 3
+	}
+	return out
+}
+
+// vp8BoolEncoder is the boolean entropy coder of RFC 6386 section 7
+type vp8BoolEncoder struct {
+	out      []byte
+	rng      uint32
+	bottom   uint32
+	bitCount int
+}
+
+// put codes bit, which is false with probability prob/256
+func (e *vp8BoolEncoder) put(bit bool, prob uint8) {
+	if e.rng == 0 {
+		e.rng, e.bitCount = 255, 24
+	}
+	split := 1 + (e.rng-1)*uint32(prob)>>8
+	if bit {
+		e.bottom += split
+		e.rng -= split
+	} else {
+		e.rng = split
+	}
+	for e.rng < 128 {
+		e.rng <<= 1
+		if e.bottom&(1<<31) != 0 {
+			e.carry()
+		}
+		e.bottom <<= 1
+		e.bitCount--
+		if e.bitCount == 0 {
+			e.out = append(e.out, byte(e.bottom>>24))
+			e.bottom &= 1<<24 - 1
+			e.bitCount = 8
+		}
+	}
+}
+
+// putLiteral codes the n low bits of v, most significant first
+func (e *vp8BoolEncoder) putLiteral(v uint32, n int) {
+	for n > 0 {
+		n--
+		e.put(v>>n&1 != 0, 128)
+	}
+}
+
+// carry propagates an overflow of bottom into the bytes already written
+func (e *vp8BoolEncoder) carry() {
+	i := len(e.out) - 1
+	for ; i >= 0 && e.out[i] == 0xff; i-- {
+		e.out[i] = 0
+	}
+	e.out[i]++
+}
+
+// finish flushes the coder and returns its bytes
+func (e *vp8BoolEncoder) finish() []byte {
+	if e.rng == 0 {
+		e.rng, e.bitCount = 255, 24
+	}
+	c, v := e.bitCount, e.bottom
+	if v&(1<<(32-c)) != 0 {
+		e.carry()
+	}
+	v <<= c & 7
+	for c >>= 3; c > 0; c-- {
+		v <<= 8
+	}
+	for i := 0; i < 4; i++ {
+		e.out = append(e.out, byte(v>>24))
+		v <<= 8
+	}
+	return e.out
+}
+
+// The quantizer steps are specified in RFC 6386 section 14.1
+var (
+	vp8DCTable = [128]int32{
+		4, 5, 6, 7, 8, 9, 10, 10,
+		11, 12, 13, 14, 15, 16, 17, 17,
+		18, 19, 20, 20, 21, 21, 22, 22,
+		23, 23, 24, 25, 25, 26, 27, 28,
+		29, 30, 31, 32, 33, 34, 35, 36,
+		37, 37, 38, 39, 40, 41, 42, 43,
+		44, 45, 46, 46, 47, 48, 49, 50,
+		51, 52, 53, 54, 55, 56, 57, 58,
+		59, 60, 61, 62, 63, 64, 65, 66,
+		67, 68, 69, 70, 71, 72, 73, 74,
+		75, 76, 76, 77, 78, 79, 80, 81,
+		82, 83, 84, 85, 86, 87, 88, 89,
+		91, 93, 95, 96, 98, 100, 101, 102,
+		104, 106, 108, 110, 112, 114, 116, 118,
+		122, 124, 126, 128, 130, 132, 134, 136,
+		138, 140, 143, 145, 148, 151, 154, 157,
+	}
+	vp8ACTable = [128]int32{
+		4, 5, 6, 7, 8, 9, 10, 11,
+		12, 13, 14, 15, 16, 17, 18, 19,
+		20, 21, 22, 23, 24, 25, 26, 27,
+		28, 29, 30, 31, 32, 33, 34, 35,
+		36, 37, 38, 39, 40, 41, 42, 43,
+		44, 45, 46, 47, 48, 49, 50, 51,
+		52, 53, 54, 55, 56, 57, 58, 60,
+		62, 64, 66, 68, 70, 72, 74, 76,
+		78, 80, 82, 84, 86, 88, 90, 92,
+		94, 96, 98, 100, 102, 104, 106, 108,
+		110, 112, 114, 116, 119, 122, 125, 128,
+		131, 134, 137, 140, 143, 146, 149, 152,
+		155, 158, 161, 164, 167, 170, 173, 177,
+		181, 185, 189, 193, 197, 201, 205, 209,
+		213, 217, 221, 225, 229, 234, 239, 245,
+		249, 254, 259, 264, 269, 274, 279, 284,
+	}
+)
+
+// vp8TokenUpdateProb are the probabilities that a token probability is
+// updated, specified in section 13.4
+var vp8TokenUpdateProb = [4][8][3][11]uint8{
+	{
+		{
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{176, 246, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{223, 241, 252, 255, 255, 255, 255, 255, 255, 255, 255},
+			{249, 253, 253, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 244, 252, 255, 255, 255, 255, 255, 255, 255, 255},
+			{234, 254, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{253, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 246, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{239, 253, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{254, 255, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 248, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{251, 255, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 253, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{251, 254, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{254, 255, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 254, 253, 255, 254, 255, 255, 255, 255, 255, 255},
+			{250, 255, 254, 255, 254, 255, 255, 255, 255, 255, 255},
+			{254, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+	},
+	{
+		{
+			{217, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{225, 252, 241, 253, 255, 255, 254, 255, 255, 255, 255},
+			{234, 250, 241, 250, 253, 255, 253, 254, 255, 255, 255},
+		},
+		{
+			{255, 254, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{223, 254, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{238, 253, 254, 254, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 248, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{249, 254, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 253, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{247, 254, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 253, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{252, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 254, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{253, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 254, 253, 255, 255, 255, 255, 255, 255, 255, 255},
+			{250, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{254, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+	},
+	{
+		{
+			{186, 251, 250, 255, 255, 255, 255, 255, 255, 255, 255},
+			{234, 251, 244, 254, 255, 255, 255, 255, 255, 255, 255},
+			{251, 251, 243, 253, 254, 255, 254, 255, 255, 255, 255},
+		},
+		{
+			{255, 253, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{236, 253, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{251, 253, 253, 254, 254, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 254, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{254, 254, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 254, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{254, 254, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{254, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{254, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+	},
+	{
+		{
+			{248, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{250, 254, 252, 254, 255, 255, 255, 255, 255, 255, 255},
+			{248, 254, 249, 253, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 253, 253, 255, 255, 255, 255, 255, 255, 255, 255},
+			{246, 253, 253, 255, 255, 255, 255, 255, 255, 255, 255},
+			{252, 254, 251, 254, 254, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 254, 252, 255, 255, 255, 255, 255, 255, 255, 255},
+			{248, 254, 253, 255, 255, 255, 255, 255, 255, 255, 255},
+			{253, 255, 254, 254, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 251, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{245, 251, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{253, 253, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 251, 253, 255, 255, 255, 255, 255, 255, 255, 255},
+			{252, 253, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 254, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 252, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{249, 255, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 255, 253, 255, 255, 255, 255, 255, 255, 255, 255},
+			{250, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{254, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+	},
+}
+
+// vp8DefaultTokenProb are the token probabilities, specified in section 13.5
+var vp8DefaultTokenProb = [4][8][3][11]uint8{
+	{
+		{
+			{128, 128, 128, 128, 128, 128, 128, 128, 128, 128, 128},
+			{128, 128, 128, 128, 128, 128, 128, 128, 128, 128, 128},
+			{128, 128, 128, 128, 128, 128, 128, 128, 128, 128, 128},
+		},
+		{
+			{253, 136, 254, 255, 228, 219, 128, 128, 128, 128, 128},
+			{189, 129, 242, 255, 227, 213, 255, 219, 128, 128, 128},
+			{106, 126, 227, 252, 214, 209, 255, 255, 128, 128, 128},
+		},
+		{
+			{1, 98, 248, 255, 236, 226, 255, 255, 128, 128, 128},
+			{181, 133, 238, 254, 221, 234, 255, 154, 128, 128, 128},
+			{78, 134, 202, 247, 198, 180, 255, 219, 128, 128, 128},
+		},
+		{
+			{1, 185, 249, 255, 243, 255, 128, 128, 128, 128, 128},
+			{184, 150, 247, 255, 236, 224, 128, 128, 128, 128, 128},
+			{77, 110, 216, 255, 236, 230, 128, 128, 128, 128, 128},
+		},
+		{
+			{1, 101, 251, 255, 241, 255, 128, 128, 128, 128, 128},
+			{170, 139, 241, 252, 236, 209, 255, 255, 128, 128, 128},
+			{37, 116, 196, 243, 228, 255, 255, 255, 128, 128, 128},
+		},
+		{
+			{1, 204, 254, 255, 245, 255, 128, 128, 128, 128, 128},
+			{207, 160, 250, 255, 238, 128, 128, 128, 128, 128, 128},
+			{102, 103, 231, 255, 211, 171, 128, 128, 128, 128, 128},
+		},
+		{
+			{1, 152, 252, 255, 240, 255, 128, 128, 128, 128, 128},
+			{177, 135, 243, 255, 234, 225, 128, 128, 128, 128, 128},
+			{80, 129, 211, 255, 194, 224, 128, 128, 128, 128, 128},
+		},
+		{
+			{1, 1, 255, 128, 128, 128, 128, 128, 128, 128, 128},
+			{246, 1, 255, 128, 128, 128, 128, 128, 128, 128, 128},
+			{255, 128, 128, 128, 128, 128, 128, 128, 128, 128, 128},
+		},
+	},
+	{
+		{
+			{198, 35, 237, 223, 193, 187, 162, 160, 145, 155, 62},
+			{131, 45, 198, 221, 172, 176, 220, 157, 252, 221, 1},
+			{68, 47, 146, 208, 149, 167, 221, 162, 255, 223, 128},
+		},
+		{
+			{1, 149, 241, 255, 221, 224, 255, 255, 128, 128, 128},
+			{184, 141, 234, 253, 222, 220, 255, 199, 128, 128, 128},
+			{81, 99, 181, 242, 176, 190, 249, 202, 255, 255, 128},
+		},
+		{
+			{1, 129, 232, 253, 214, 197, 242, 196, 255, 255, 128},
+			{99, 121, 210, 250, 201, 198, 255, 202, 128, 128, 128},
+			{23, 91, 163, 242, 170, 187, 247, 210, 255, 255, 128},
+		},
+		{
+			{1, 200, 246, 255, 234, 255, 128, 128, 128, 128, 128},
+			{109, 178, 241, 255, 231, 245, 255, 255, 128, 128, 128},
+			{44, 130, 201, 253, 205, 192, 255, 255, 128, 128, 128},
+		},
+		{
+			{1, 132, 239, 251, 219, 209, 255, 165, 128, 128, 128},
+			{94, 136, 225, 251, 218, 190, 255, 255, 128, 128, 128},
+			{22, 100, 174, 245, 186, 161, 255, 199, 128, 128, 128},
+		},
+		{
+			{1, 182, 249, 255, 232, 235, 128, 128, 128, 128, 128},
+			{124, 143, 241, 255, 227, 234, 128, 128, 128, 128, 128},
+			{35, 77, 181, 251, 193, 211, 255, 205, 128, 128, 128},
+		},
+		{
+			{1, 157, 247, 255, 236, 231, 255, 255, 128, 128, 128},
+			{121, 141, 235, 255, 225, 227, 255, 255, 128, 128, 128},
+			{45, 99, 188, 251, 195, 217, 255, 224, 128, 128, 128},
+		},
+		{
+			{1, 1, 251, 255, 213, 255, 128, 128, 128, 128, 128},
+			{203, 1, 248, 255, 255, 128, 128, 128, 128, 128, 128},
+			{137, 1, 177, 255, 224, 255, 128, 128, 128, 128, 128},
+		},
+	},
+	{
+		{
+			{253, 9, 248, 251, 207, 208, 255, 192, 128, 128, 128},
+			{175, 13, 224, 243, 193, 185, 249, 198, 255, 255, 128},
+			{73, 17, 171, 221, 161, 179, 236, 167, 255, 234, 128},
+		},
+		{
+			{1, 95, 247, 253, 212, 183, 255, 255, 128, 128, 128},
+			{239, 90, 244, 250, 211, 209, 255, 255, 128, 128, 128},
+			{155, 77, 195, 248, 188, 195, 255, 255, 128, 128, 128},
+		},
+		{
+			{1, 24, 239, 251, 218, 219, 255, 205, 128, 128, 128},
+			{201, 51, 219, 255, 196, 186, 128, 128, 128, 128, 128},
+			{69, 46, 190, 239, 201, 218, 255, 228, 128, 128, 128},
+		},
+		{
+			{1, 191, 251, 255, 255, 128, 128, 128, 128, 128, 128},
+			{223, 165, 249, 255, 213, 255, 128, 128, 128, 128, 128},
+			{141, 124, 248, 255, 255, 128, 128, 128, 128, 128, 128},
+		},
+		{
+			{1, 16, 248, 255, 255, 128, 128, 128, 128, 128, 128},
+			{190, 36, 230, 255, 236, 255, 128, 128, 128, 128, 128},
+			{149, 1, 255, 128, 128, 128, 128, 128, 128, 128, 128},
+		},
+		{
+			{1, 226, 255, 128, 128, 128, 128, 128, 128, 128, 128},
+			{247, 192, 255, 128, 128, 128, 128, 128, 128, 128, 128},
+			{240, 128, 255, 128, 128, 128, 128, 128, 128, 128, 128},
+		},
+		{
+			{1, 134, 252, 255, 255, 128, 128, 128, 128, 128, 128},
+			{213, 62, 250, 255, 255, 128, 128, 128, 128, 128, 128},
+			{55, 93, 255, 128, 128, 128, 128, 128, 128, 128, 128},
+		},
+		{
+			{128, 128, 128, 128, 128, 128, 128, 128, 128, 128, 128},
+			{128, 128, 128, 128, 128, 128, 128, 128, 128, 128, 128},
+			{128, 128, 128, 128, 128, 128, 128, 128, 128, 128, 128},
+		},
+	},
+	{
+		{
+			{202, 24, 213, 235, 186, 191, 220, 160, 240, 175, 255},
+			{126, 38, 182, 232, 169, 184, 228, 174, 255, 187, 128},
+			{61, 46, 138, 219, 151, 178, 240, 170, 255, 216, 128},
+		},
+		{
+			{1, 112, 230, 250, 199, 191, 247, 159, 255, 255, 128},
+			{166, 109, 228, 252, 211, 215, 255, 174, 128, 128, 128},
+			{39, 77, 162, 232, 172, 180, 245, 178, 255, 255, 128},
+		},
+		{
+			{1, 52, 220, 246, 198, 199, 249, 220, 255, 255, 128},
+			{124, 74, 191, 243, 183, 193, 250, 221, 255, 255, 128},
+			{24, 71, 130, 219, 154, 170, 243, 182, 255, 255, 128},
+		},
+		{
+			{1, 182, 225, 249, 219, 240, 255, 224, 128, 128, 128},
+			{149, 150, 226, 252, 216, 205, 255, 171, 128, 128, 128},
+			{28, 108, 170, 242, 183, 194, 254, 223, 255, 255, 128},
+		},
+		{
+			{1, 81, 230, 252, 204, 203, 255, 192, 128, 128, 128},
+			{123, 102, 209, 247, 188, 196, 255, 233, 128, 128, 128},
+			{20, 95, 153, 243, 164, 173, 255, 203, 128, 128, 128},
+		},
+		{
+			{1, 222, 248, 255, 216, 213, 128, 128, 128, 128, 128},
+			{168, 175, 246, 252, 235, 205, 255, 255, 128, 128, 128},
+			{47, 116, 215, 255, 211, 212, 255, 255, 128, 128, 128},
+		},
+		{
+			{1, 121, 236, 253, 212, 214, 255, 255, 128, 128, 128},
+			{141, 84, 213, 252, 201, 202, 255, 219, 128, 128, 128},
+			{42, 80, 160, 240, 162, 185, 255, 205, 128, 128, 128},
+		},
+		{
+			{1, 1, 255, 128, 128, 128, 128, 128, 128, 128, 128},
+			{244, 1, 255, 128, 128, 128, 128, 128, 128, 128, 128},
+			{238, 1, 255, 128, 128, 128, 128, 128, 128, 128, 128},
+		},
+	},
+}
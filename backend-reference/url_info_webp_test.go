@@ -0,0 +1,123 @@
+// Package handler tests for WebP encoding
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+// testPhoto draws smooth gradients with a few hard edges, odd-sized so the
+// last macroblocks are padded
+func testPhoto(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{uint8(255 * x / w), uint8(255 * y / h), uint8(128 + 100*math.Sin(float64(x+y)/9)), 255}
+			if (x/40+y/40)%3 == 0 {
+				c = color.RGBA{230, 40, 30, 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// psnr compares two planes of the same size
+func psnr(a, b []uint8) float64 {
+	var sum float64
+	for i := range a {
+		d := float64(a[i]) - float64(b[i])
+		sum += d * d
+	}
+	if sum == 0 {
+		return math.Inf(1)
+	}
+	return 10 * math.Log10(255*255*float64(len(a))/sum)
+}
+
+func TestEncodeWebP(t *testing.T) {
+	src := testPhoto(203, 117)
+	var buf bytes.Buffer
+	if err := encodeWebP(&buf, src, 82); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(buf.Bytes())%2 != 0 || string(buf.Bytes()[8:16]) != "WEBPVP8 " {
+		t.Fatalf("Expected a RIFF WebP with a VP8 chunk, got % x", buf.Bytes()[:16])
+	}
+
+	decoded, err := webp.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	ycc, ok := decoded.(*image.YCbCr)
+	if !ok || ycc.Bounds() != src.Bounds() {
+		t.Fatalf("Expected a 203x117 YCbCr image, got %T %v", decoded, decoded.Bounds())
+	}
+
+	// Compare each plane with the source converted the same way
+	expected := newVP8Encoder(src, 82)
+	planes := []struct {
+		name          string
+		got, expected []uint8
+		stride, w, h  int
+	}{
+		{"Y", ycc.Y, expected.y, 16 * expected.mbw, 203, 117},
+		{"Cb", ycc.Cb, expected.u, 8 * expected.mbw, 102, 59},
+		{"Cr", ycc.Cr, expected.v, 8 * expected.mbw, 102, 59},
+	}
+	for _, p := range planes {
+		var got, want []uint8
+		for y := 0; y < p.h; y++ {
+			offset := ycc.YStride
+			if p.name != "Y" {
+				offset = ycc.CStride
+			}
+			got = append(got, p.got[y*offset:y*offset+p.w]...)
+			want = append(want, p.expected[y*p.stride:y*p.stride+p.w]...)
+		}
+		if q := psnr(got, want); q < 35 {
+			t.Errorf("%s: expected a PSNR of at least 35 dB, got %.1f", p.name, q)
+		}
+	}
+}
+
+func TestEncodeWebP_Quality(t *testing.T) {
+	src := testPhoto(320, 180)
+	sizes := map[int]int{}
+	for _, quality := range []int{20, 82, 100} {
+		var buf bytes.Buffer
+		if err := encodeWebP(&buf, src, quality); err != nil {
+			t.Fatalf("Quality %d: unexpected error: %v", quality, err)
+		}
+		if _, err := webp.Decode(bytes.NewReader(buf.Bytes())); err != nil {
+			t.Errorf("Quality %d: failed to decode: %v", quality, err)
+		}
+		sizes[quality] = buf.Len()
+	}
+	if !(sizes[20] < sizes[82] && sizes[82] < sizes[100]) {
+		t.Errorf("Expected files to grow with quality, got %v", sizes)
+	}
+}
+
+func TestEncodeWebP_Limits(t *testing.T) {
+	var buf bytes.Buffer
+	if err := encodeWebP(&buf, image.NewRGBA(image.Rect(0, 0, 1, 1)), 82); err != nil {
+		t.Errorf("Unexpected error for a single pixel: %v", err)
+	} else if cfg, err := webp.DecodeConfig(bytes.NewReader(buf.Bytes())); err != nil || cfg.Width != 1 || cfg.Height != 1 {
+		t.Errorf("Expected a 1x1 WebP, got %+v %v", cfg, err)
+	}
+
+	tall := image.NewRGBA(image.Rect(0, 0, 1, maxWebPDimension+1))
+	if err := encodeWebP(&buf, tall, 82); !errors.Is(err, errImageTooLarge) {
+		t.Errorf("Expected errImageTooLarge, got %v", err)
+	}
+	if err := encodeWebP(&buf, image.NewRGBA(image.Rectangle{}), 82); !errors.Is(err, errUnsupportedImage) {
+		t.Errorf("Expected errUnsupportedImage, got %v", err)
+	}
+}